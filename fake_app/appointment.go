@@ -0,0 +1,330 @@
+package fake_app
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AppointmentStatus 看房预约状态
+type AppointmentStatus string
+
+const (
+	AppointmentScheduled AppointmentStatus = "scheduled" // 已预约
+	AppointmentCancelled AppointmentStatus = "cancelled" // 已取消
+)
+
+// 看房时段：每天 ViewingOpenHour 点至 ViewingCloseHour 点，每小时一个时段，最多预约 ViewingHorizonDays 天内
+const (
+	ViewingOpenHour    = 9
+	ViewingCloseHour   = 21
+	ViewingHorizonDays = 30
+	// ViewingTimeLayout 看房开始时间格式
+	ViewingTimeLayout = "2006-01-02 15:04"
+)
+
+// viewingZone 看房时间按北京时间解释
+var viewingZone = time.FixedZone("CST", 8*3600)
+
+var (
+	ErrAppointmentNotFound = errors.New("预约不存在")
+	ErrAppointmentConflict = errors.New("看房时间冲突")
+	ErrAppointmentClosed   = errors.New("预约已取消")
+	ErrHouseNotFound       = errors.New("房源不存在")
+	ErrHouseNotViewable    = errors.New("房源不可预约看房")
+	ErrInvalidViewingTime  = errors.New("看房时间无效")
+)
+
+// Appointment 看房预约，按用户隔离
+type Appointment struct {
+	AppointmentID string            `json:"appointment_id"`
+	HouseID       string            `json:"house_id"`
+	Community     string            `json:"community"`
+	Start         string            `json:"start"` // 开始时间，格式 2006-01-02 15:04
+	End           string            `json:"end"`
+	Status        AppointmentStatus `json:"status"`
+	Note          string            `json:"note,omitempty"` // 备注，如联系人、看房要求
+	CreatedAt     string            `json:"created_at"`
+	UpdatedAt     string            `json:"updated_at"`
+}
+
+// ViewingSlot 某房源某天的一个看房时段
+type ViewingSlot struct {
+	Start     string `json:"start"`
+	End       string `json:"end"`
+	Available bool   `json:"available"`
+	Reason    string `json:"reason,omitempty"` // 不可预约的原因
+}
+
+// userAppointments 单个用户的预约
+type userAppointments struct {
+	seq   int
+	items map[string]*Appointment
+}
+
+// appointmentBook 按用户隔离的看房预约，只在内存中保存；ResetUser 清空该用户，Reload 全部清空
+type appointmentBook struct {
+	mu     sync.Mutex
+	byUser map[string]*userAppointments
+	now    func() time.Time
+}
+
+func newAppointmentBook() *appointmentBook {
+	return &appointmentBook{byUser: make(map[string]*userAppointments), now: time.Now}
+}
+
+// user 取用户的预约，不存在时创建。调用方须持有 b.mu
+func (b *appointmentBook) user(userID string) *userAppointments {
+	u, ok := b.byUser[userID]
+	if !ok {
+		u = &userAppointments{items: make(map[string]*Appointment)}
+		b.byUser[userID] = u
+	}
+	return u
+}
+
+// conflict 用户在 start 时段是否已有其他有效预约（except 为正在改期的预约ID）。调用方须持有 b.mu
+func (u *userAppointments) conflict(start, except string) *Appointment {
+	for _, a := range u.items {
+		if a.AppointmentID != except && a.Status == AppointmentScheduled && a.Start == start {
+			return a
+		}
+	}
+	return nil
+}
+
+// parseViewingStart 解析并校验看房开始时间：整点、营业时段内、不早于当前且不超过预约期限
+func (b *appointmentBook) parseViewingStart(s string) (time.Time, error) {
+	t, err := time.ParseInLocation(ViewingTimeLayout, s, viewingZone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %q 格式应为 %s", ErrInvalidViewingTime, s, ViewingTimeLayout)
+	}
+	if err := b.checkSlot(t); err != nil {
+		return time.Time{}, err
+	}
+	return t, nil
+}
+
+// checkSlot 时段是否可预约（不检查冲突）
+func (b *appointmentBook) checkSlot(t time.Time) error {
+	if t.Minute() != 0 || t.Hour() < ViewingOpenHour || t.Hour() >= ViewingCloseHour {
+		return fmt.Errorf("%w: 看房时段为每天 %02d:00-%02d:00 的整点", ErrInvalidViewingTime, ViewingOpenHour, ViewingCloseHour)
+	}
+	now := b.now().In(viewingZone)
+	if !t.After(now) {
+		return fmt.Errorf("%w: 不能预约已过去的时间", ErrInvalidViewingTime)
+	}
+	if t.After(now.AddDate(0, 0, ViewingHorizonDays)) {
+		return fmt.Errorf("%w: 最多预约 %d 天内的看房", ErrInvalidViewingTime, ViewingHorizonDays)
+	}
+	return nil
+}
+
+// viewableHouse 取用户视角下可预约的房源：须存在且有效状态为可租
+func (hm *HouseManager) viewableHouse(houseID, userID string) (*House, error) {
+	hm.mu.RLock()
+	house, ok := hm.houses[houseID]
+	hm.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrHouseNotFound, houseID)
+	}
+	if status := hm.effectiveStatus(houseID, house.Status, userID); status != string(HouseStatusAvailable) {
+		return nil, fmt.Errorf("%w: %s 当前状态为 %s", ErrHouseNotViewable, houseID, status)
+	}
+	return house, nil
+}
+
+// ViewingSlots 某房源在 date（2006-01-02）当天的看房时段及当前用户能否预约
+func (hm *HouseManager) ViewingSlots(userID, houseID, date string) ([]ViewingSlot, error) {
+	if _, err := hm.viewableHouse(houseID, userID); err != nil {
+		return nil, err
+	}
+	day, err := time.ParseInLocation("2006-01-02", date, viewingZone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 日期 %q 格式应为 2006-01-02", ErrInvalidViewingTime, date)
+	}
+
+	b := hm.appointments
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	u := b.user(userID)
+	slots := make([]ViewingSlot, 0, ViewingCloseHour-ViewingOpenHour)
+	for h := ViewingOpenHour; h < ViewingCloseHour; h++ {
+		t := day.Add(time.Duration(h) * time.Hour)
+		slot := ViewingSlot{Start: t.Format(ViewingTimeLayout), End: t.Add(time.Hour).Format(ViewingTimeLayout), Available: true}
+		if err := b.checkSlot(t); err != nil {
+			slot.Available, slot.Reason = false, err.Error()
+		} else if a := u.conflict(slot.Start, ""); a != nil {
+			slot.Available = false
+			if a.HouseID == houseID {
+				slot.Reason = "已预约该房源此时段（" + a.AppointmentID + "）"
+			} else {
+				slot.Reason = "该时段已预约看其他房源（" + a.AppointmentID + "）"
+			}
+		}
+		slots = append(slots, slot)
+	}
+	return slots, nil
+}
+
+// CreateAppointment 为用户预约看房；房源须为该用户视角下可租，时段须有效且该用户同一时段没有其他预约
+func (hm *HouseManager) CreateAppointment(userID, houseID, start, note string) (*Appointment, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("需要提供 userID 以预约看房")
+	}
+	house, err := hm.viewableHouse(houseID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	b := hm.appointments
+	t, err := b.parseViewingStart(start)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	u := b.user(userID)
+	startStr := t.Format(ViewingTimeLayout)
+	if a := u.conflict(startStr, ""); a != nil {
+		return nil, fmt.Errorf("%w: %s 已有预约 %s（房源 %s）", ErrAppointmentConflict, startStr, a.AppointmentID, a.HouseID)
+	}
+	u.seq++
+	now := b.now().In(viewingZone).Format(time.RFC3339)
+	a := &Appointment{
+		AppointmentID: fmt.Sprintf("APT_%04d", u.seq),
+		HouseID:       houseID,
+		Community:     house.Community,
+		Start:         startStr,
+		End:           t.Add(time.Hour).Format(ViewingTimeLayout),
+		Status:        AppointmentScheduled,
+		Note:          note,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	u.items[a.AppointmentID] = a
+	copy := *a
+	return &copy, nil
+}
+
+// ListAppointments 用户的预约，按开始时间排序；houseID、status 非空时筛选
+func (hm *HouseManager) ListAppointments(userID, houseID string, status AppointmentStatus) []*Appointment {
+	b := hm.appointments
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	result := []*Appointment{}
+	u, ok := b.byUser[userID]
+	if !ok {
+		return result
+	}
+	for _, a := range u.items {
+		if (houseID == "" || a.HouseID == houseID) && (status == "" || a.Status == status) {
+			copy := *a
+			result = append(result, &copy)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Start != result[j].Start {
+			return result[i].Start < result[j].Start
+		}
+		return result[i].AppointmentID < result[j].AppointmentID
+	})
+	return result
+}
+
+// GetAppointment 按ID取用户的预约
+func (hm *HouseManager) GetAppointment(userID, appointmentID string) (*Appointment, error) {
+	b := hm.appointments
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	a, err := b.find(userID, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	copy := *a
+	return &copy, nil
+}
+
+// find 取用户的预约。调用方须持有 b.mu
+func (b *appointmentBook) find(userID, appointmentID string) (*Appointment, error) {
+	if u, ok := b.byUser[userID]; ok {
+		if a, ok := u.items[appointmentID]; ok {
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrAppointmentNotFound, appointmentID)
+}
+
+// RescheduleAppointment 改期；只能改已预约（未取消）的预约，房源须仍可租，新时段同样不能与该用户其他预约冲突
+func (hm *HouseManager) RescheduleAppointment(userID, appointmentID, start string) (*Appointment, error) {
+	b := hm.appointments
+	b.mu.Lock()
+	a, err := b.find(userID, appointmentID)
+	var houseID string
+	if err == nil {
+		houseID = a.HouseID
+	}
+	b.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := hm.viewableHouse(houseID, userID); err != nil {
+		return nil, err
+	}
+	t, err := b.parseViewingStart(start)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if a, err = b.find(userID, appointmentID); err != nil {
+		return nil, err
+	}
+	if a.Status != AppointmentScheduled {
+		return nil, fmt.Errorf("%w: %s", ErrAppointmentClosed, appointmentID)
+	}
+	startStr := t.Format(ViewingTimeLayout)
+	if other := b.byUser[userID].conflict(startStr, appointmentID); other != nil {
+		return nil, fmt.Errorf("%w: %s 已有预约 %s（房源 %s）", ErrAppointmentConflict, startStr, other.AppointmentID, other.HouseID)
+	}
+	a.Start = startStr
+	a.End = t.Add(time.Hour).Format(ViewingTimeLayout)
+	a.UpdatedAt = b.now().In(viewingZone).Format(time.RFC3339)
+	copy := *a
+	return &copy, nil
+}
+
+// CancelAppointment 取消预约；已取消的预约再次取消返回 ErrAppointmentClosed
+func (hm *HouseManager) CancelAppointment(userID, appointmentID string) (*Appointment, error) {
+	b := hm.appointments
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	a, err := b.find(userID, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	if a.Status != AppointmentScheduled {
+		return nil, fmt.Errorf("%w: %s", ErrAppointmentClosed, appointmentID)
+	}
+	a.Status = AppointmentCancelled
+	a.UpdatedAt = b.now().In(viewingZone).Format(time.RFC3339)
+	copy := *a
+	return &copy, nil
+}
+
+// resetUser 清空用户的全部预约
+func (b *appointmentBook) resetUser(userID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.byUser, userID)
+}
+
+// reset 清空全部用户的预约
+func (b *appointmentBook) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.byUser = make(map[string]*userAppointments)
+}
@@ -0,0 +1,204 @@
+package fake_app
+
+import (
+	"math"
+	"sync"
+)
+
+// 多目的地通勤的综合排序方式
+const (
+	CommuteRankSum      = "sum"      // 各目的地通勤时间之和（默认）
+	CommuteRankMax      = "max"      // 最长的一段通勤时间，使最辛苦的人尽量轻松
+	CommuteRankWeighted = "weighted" // 按权重加权平均
+)
+
+// CommuteTarget 通勤目的地之一（如两人各自的公司），用于 HouseQuery.CommuteTargets
+type CommuteTarget struct {
+	Landmark   *Landmark // 目的地，由调用方按地标ID或名称解析
+	Weight     float64   // 权重，仅 weighted 排序使用，<=0 视为 1
+	MaxMinutes int       // 该目的地的通勤时间上限（分钟），0 表示不限
+}
+
+// ValidCommuteRank 是否为支持的综合排序方式（空表示默认 sum）
+func ValidCommuteRank(rank string) bool {
+	switch rank {
+	case "", CommuteRankSum, CommuteRankMax, CommuteRankWeighted:
+		return true
+	}
+	return false
+}
+
+// HouseCommute 房源到查询目的地的通勤估算，仅在按 CommuteTo、CommuteTargets 查询时出现在结果中
+type HouseCommute struct {
+	Destination string `json:"destination"`           // 目的地地标名称
+	MaxMinutes  int    `json:"max_minutes,omitempty"` // 该目的地的通勤时间上限
+	Minutes     int    `json:"minutes"`               // 估算通勤时间（分钟）：步行到地铁站、乘车与换乘、出站步行
+	Station     string `json:"station,omitempty"`     // 上车站，纯步行更快时为空
+}
+
+// destCommute 某个目的地的估算器与各房源的通勤结果缓存
+type destCommute struct {
+	estimator *CommuteEstimator
+	mu        sync.Mutex
+	byHouse   map[string]HouseCommute
+}
+
+// commuteCache 按目的地地标ID缓存房源通勤时间；房源 Reload 时清空，线网图重建后按需丢弃
+type commuteCache struct {
+	mu     sync.Mutex
+	byDest map[string]*destCommute
+}
+
+func newCommuteCache() *commuteCache {
+	return &commuteCache{byDest: make(map[string]*destCommute)}
+}
+
+// SetLandmarkManager 设置地标管理器，用于按地铁线网图估算房源到任意地标的通勤时间（HouseQuery.CommuteTo）
+func (hm *HouseManager) SetLandmarkManager(lm *LandmarkManager) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	hm.landmarks = lm
+	hm.commutes = newCommuteCache()
+}
+
+// commuteTo 取目的地的通勤缓存，不存在或线网图已重建时新建；未设置地标管理器时返回 nil
+func (hm *HouseManager) commuteTo(dest *Landmark) *destCommute {
+	if hm.landmarks == nil || dest == nil {
+		return nil
+	}
+	c := hm.commutes
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if dc, ok := c.byDest[dest.ID]; ok && hm.landmarks.commuteEstimatorCurrent(dc.estimator) {
+		return dc
+	}
+	dc := &destCommute{
+		estimator: hm.landmarks.CommuteEstimator(dest.Latitude, dest.Longitude),
+		byHouse:   make(map[string]HouseCommute),
+	}
+	c.byDest[dest.ID] = dc
+	return dc
+}
+
+// of 房源到该目的地的通勤时间，首次计算后缓存
+func (dc *destCommute) of(house *House, destName string) HouseCommute {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if hc, ok := dc.byHouse[house.HouseID]; ok {
+		return hc
+	}
+	minutes, station := dc.estimator.Estimate(house.Latitude, house.Longitude)
+	hc := HouseCommute{Destination: destName, Minutes: minutes, Station: station}
+	dc.byHouse[house.HouseID] = hc
+	return hc
+}
+
+// commuteTargets 查询的全部通勤目的地：CommuteTargets 优先，否则为 CommuteTo 与 CommuteMax
+func (q *HouseQuery) commuteTargets() []CommuteTarget {
+	if len(q.CommuteTargets) > 0 {
+		return q.CommuteTargets
+	}
+	if q.CommuteTo != nil {
+		return []CommuteTarget{{Landmark: q.CommuteTo, MaxMinutes: q.CommuteMax}}
+	}
+	return nil
+}
+
+// houseCommutes 查询涉及的各目的地及其缓存，与 targets 一一对应；未设置地标管理器或无目的地时返回 nil
+type houseCommutes struct {
+	targets []CommuteTarget
+	dests   []*destCommute
+	rank    string
+}
+
+// commutesFor 取查询各目的地的通勤缓存；不支持的 CommuteRank 按 sum 处理（调用方应先用 ValidCommuteRank 校验）
+func (hm *HouseManager) commutesFor(q *HouseQuery) *houseCommutes {
+	if hm.landmarks == nil {
+		return nil
+	}
+	hc := &houseCommutes{rank: q.CommuteRank}
+	for _, t := range q.commuteTargets() {
+		if t.Landmark == nil {
+			continue
+		}
+		hc.targets = append(hc.targets, t)
+		hc.dests = append(hc.dests, hm.commuteTo(t.Landmark))
+	}
+	if len(hc.targets) == 0 {
+		return nil
+	}
+	return hc
+}
+
+// apply 计算房源到各目的地的通勤并写入 copy；任一目的地超过上限时返回 false。
+// 单个目的地写入 Commute，多个目的地写入 Commutes 与综合分 CommuteScore
+func (hc *houseCommutes) apply(house, copy *House) bool {
+	commutes := make([]HouseCommute, len(hc.targets))
+	for i, t := range hc.targets {
+		c := hc.dests[i].of(house, t.Landmark.Name)
+		if t.MaxMinutes > 0 && c.Minutes > t.MaxMinutes {
+			return false
+		}
+		c.MaxMinutes = t.MaxMinutes
+		commutes[i] = c
+	}
+	if len(commutes) == 1 {
+		copy.Commute = &commutes[0]
+		return true
+	}
+	copy.Commutes = commutes
+	score := hc.score(commutes)
+	copy.CommuteScore = &score
+	return true
+}
+
+// score 多目的地的综合通勤分（分钟），越小越好
+func (hc *houseCommutes) score(commutes []HouseCommute) float64 {
+	switch hc.rank {
+	case CommuteRankMax:
+		max := 0
+		for _, c := range commutes {
+			if c.Minutes > max {
+				max = c.Minutes
+			}
+		}
+		return float64(max)
+	case CommuteRankWeighted:
+		var sum, weights float64
+		for i, c := range commutes {
+			w := hc.targets[i].Weight
+			if w <= 0 {
+				w = 1
+			}
+			sum += w * float64(c.Minutes)
+			weights += w
+		}
+		return roundMinutes(sum / weights)
+	default:
+		sum := 0
+		for _, c := range commutes {
+			sum += c.Minutes
+		}
+		return float64(sum)
+	}
+}
+
+// commuteLess 按 commute 排序的比较：单目的地比较通勤分钟数，多目的地比较综合分；未带通勤估算的房源始终排在最后
+func commuteLess(a, b *House, asc bool) bool {
+	ka, kb := commuteSortKey(a), commuteSortKey(b)
+	if asc || math.IsInf(ka, 1) || math.IsInf(kb, 1) {
+		return ka < kb
+	}
+	return ka > kb
+}
+
+// commuteSortKey 单目的地为通勤分钟数，多目的地为综合分；未带通勤估算时为 +Inf
+func commuteSortKey(h *House) float64 {
+	switch {
+	case h.Commute != nil:
+		return float64(h.Commute.Minutes)
+	case h.CommuteScore != nil:
+		return *h.CommuteScore
+	}
+	return math.Inf(1)
+}
@@ -0,0 +1,333 @@
+// Package fake_app 提供租房信息查询功能
+// 本文件实现小区名、地标名的模糊匹配
+// - 拼音全拼、简拼（首字母）及二者混合，如 yangguang100、xeq 匹配 阳光100、西二旗
+// - 同音字（智学园 -> 智学苑）、编辑距离容错（错别字、拼音少打字母）
+// - 汉字拼音表内置于 assets/pinyin.txt，首次使用时加载
+package fake_app
+
+import (
+	_ "embed"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// 匹配方式
+const (
+	MatchExact     = "exact"     // 规范化后完全相同
+	MatchSubstring = "substring" // 包含关系
+	MatchPinyin    = "pinyin"    // 拼音全拼或同音字
+	MatchInitials  = "initials"  // 拼音简拼（含全拼与简拼混合）
+	MatchFuzzy     = "fuzzy"     // 编辑距离
+)
+
+const (
+	// MinMatchScore 低于该分数的候选不返回
+	MinMatchScore = 0.5
+	// AcceptMatchScore 未精确命中时，最高分候选达到该分数且领先第二名 acceptMatchGap 以上才直接采用
+	AcceptMatchScore = 0.75
+	acceptMatchGap   = 0.1
+)
+
+//go:embed assets/pinyin.txt
+var pinyinData string
+
+var (
+	pinyinOnce  sync.Once
+	pinyinTable map[rune][]string
+)
+
+// pinyinOf 返回汉字的不带声调读音（多音字有多个，常用读音在前），非汉字返回 nil
+func pinyinOf(r rune) []string {
+	pinyinOnce.Do(func() {
+		pinyinTable = make(map[rune][]string, 21000)
+		for _, line := range strings.Split(pinyinData, "\n") {
+			if line == "" || line[0] == '#' {
+				continue
+			}
+			ch, readings, ok := strings.Cut(line, " ")
+			if !ok {
+				continue
+			}
+			for _, r := range ch {
+				pinyinTable[r] = strings.Split(readings, ",")
+				break
+			}
+		}
+	})
+	return pinyinTable[r]
+}
+
+// normalizeName 转小写、全角转半角，只保留汉字、字母、数字
+func normalizeName(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= 0xFF01 && r <= 0xFF5E {
+			r -= 0xFEE0
+		}
+		if unicode.Is(unicode.Han, r) || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// coreName 去掉括号部分与末尾的「站」，如 保利锦上(二期) -> 保利锦上、西二旗站 -> 西二旗
+func coreName(s string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range s {
+		switch r {
+		case '(', '（':
+			depth++
+		case ')', '）':
+			if depth > 0 {
+				depth--
+			}
+		default:
+			if depth == 0 {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return strings.TrimSuffix(strings.TrimSpace(b.String()), "站")
+}
+
+// nameScore 计算查询词与名称的匹配分数（0~1）及匹配方式；名称去掉括号与「站」后的核心部分也参与匹配，分数略低
+func nameScore(query, name string) (float64, string) {
+	q := normalizeName(query)
+	if q == "" {
+		return 0, ""
+	}
+	score, typ := normalizedScore(q, normalizeName(name))
+	if core := normalizeName(coreName(name)); core != "" && core != normalizeName(name) {
+		if s, t := normalizedScore(q, core); s*0.95 > score {
+			score, typ = s*0.95, t
+		}
+	}
+	return score, typ
+}
+
+// normalizedScore 对规范化后的查询词与名称按精确、包含、拼音、编辑距离依次打分，取最高
+func normalizedScore(q, n string) (float64, string) {
+	if n == "" {
+		return 0, ""
+	}
+	if q == n {
+		return 1, MatchExact
+	}
+	qr, nr := []rune(q), []rune(n)
+
+	best, typ := 0.0, ""
+	consider := func(s float64, t string) {
+		if s > best {
+			best, typ = s, t
+		}
+	}
+
+	// 包含关系：越接近完整名称分数越高
+	if strings.Contains(n, q) || strings.Contains(q, n) {
+		short, long := len(qr), len(nr)
+		if short > long {
+			short, long = long, short
+		}
+		consider(0.7+0.25*float64(short)/float64(long), MatchSubstring)
+	}
+
+	if isASCIIWord(q) {
+		// 拼音：查询词须消耗完，覆盖名称连续若干字
+		if covered, full := pinyinCover(q, nr); covered > 0 {
+			ratio := float64(covered) / float64(len(nr))
+			if full {
+				consider(0.65+0.25*ratio, MatchPinyin)
+			} else if len(qr) >= 2 {
+				consider(0.55+0.25*ratio, MatchInitials)
+			}
+		}
+		// 拼音少打、多打字母
+		if sim := similarity(qr, []rune(namePinyin(nr))); sim >= 0.75 {
+			consider(0.8*sim, MatchFuzzy)
+		}
+	} else if sameSound(qr, nr) {
+		// 同音字（输入法选错字）
+		consider(0.85, MatchPinyin)
+	}
+
+	// 错别字
+	if sim := similarity(qr, nr); sim >= 0.6 {
+		consider(0.8*sim, MatchFuzzy)
+	}
+	return best, typ
+}
+
+// isASCIIWord 是否只含字母数字且至少有一个字母（按拼音处理）
+func isASCIIWord(s string) bool {
+	letter := false
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z':
+			letter = true
+		case r >= '0' && r <= '9':
+		default:
+			return false
+		}
+	}
+	return letter
+}
+
+// pinyinCover 用拼音查询词匹配名称中连续的若干字：每个汉字可用任一读音的全拼或常用读音的首字母，字母数字须原样相同。
+// 返回查询词恰好用完时覆盖的最多字数，及该覆盖是否全部为全拼
+func pinyinCover(q string, name []rune) (covered int, full bool) {
+	for start := range name {
+		// reach: 已消耗的查询词长度 -> 是否存在全部用全拼的路径
+		reach := map[int]bool{0: true}
+		for i := start; i < len(name) && len(reach) > 0; i++ {
+			next := make(map[int]bool)
+			add := func(j int, f bool) { next[j] = next[j] || f }
+			readings := pinyinOf(name[i])
+			for j, f := range reach {
+				if j >= len(q) {
+					continue
+				}
+				if len(readings) == 0 {
+					if rune(q[j]) == name[i] {
+						add(j+1, f)
+					}
+					continue
+				}
+				for _, py := range readings {
+					if strings.HasPrefix(q[j:], py) {
+						add(j+len(py), f)
+					}
+				}
+				// 简拼只取常用读音的首字母，避免生僻读音误匹配（如 度 zhai）
+				if q[j] == readings[0][0] {
+					add(j+1, f && len(readings[0]) == 1)
+				}
+			}
+			reach = next
+			if f, ok := reach[len(q)]; ok {
+				n := i - start + 1
+				if n > covered || (n == covered && f && !full) {
+					covered, full = n, f
+				}
+			}
+		}
+	}
+	return covered, full
+}
+
+// namePinyin 名称的拼音串，多音字取常用读音，非汉字原样保留
+func namePinyin(name []rune) string {
+	var b strings.Builder
+	for _, r := range name {
+		if py := pinyinOf(r); len(py) > 0 {
+			b.WriteString(py[0])
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// sameSound 两个名称逐字同音（任一读音相同即可）
+func sameSound(a, b []rune) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] == b[i] {
+			continue
+		}
+		pa, pb := pinyinOf(a[i]), pinyinOf(b[i])
+		if len(pa) == 0 || len(pb) == 0 || !sharesReading(pa, pb) {
+			return false
+		}
+	}
+	return true
+}
+
+func sharesReading(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// similarity 基于编辑距离的相似度：1 - 距离 / 较长者长度
+func similarity(a, b []rune) float64 {
+	long := len(a)
+	if len(b) > long {
+		long = len(b)
+	}
+	if long == 0 {
+		return 0
+	}
+	return 1 - float64(editDistance(a, b))/float64(long)
+}
+
+// editDistance Levenshtein 编辑距离
+func editDistance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// nameCandidate 待排序的模糊匹配候选
+type nameCandidate struct {
+	key   string
+	score float64
+	typ   string
+}
+
+// rankCandidates 过滤低于 MinMatchScore 的候选，按分数降序、key 升序排列，limit > 0 时截断
+func rankCandidates(cands []nameCandidate, limit int) []nameCandidate {
+	out := cands[:0]
+	for _, c := range cands {
+		if c.score >= MinMatchScore {
+			out = append(out, c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].score != out[j].score {
+			return out[i].score > out[j].score
+		}
+		return out[i].key < out[j].key
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// acceptBest 最高分候选是否足够可信，可以直接代替精确匹配
+func acceptBest(cands []nameCandidate) bool {
+	if len(cands) == 0 || cands[0].score < AcceptMatchScore {
+		return false
+	}
+	return len(cands) == 1 || cands[0].score-cands[1].score >= acceptMatchGap-1e-9
+}
+
+// roundScore 分数保留三位小数，便于展示
+func roundScore(s float64) float64 {
+	return float64(int(s*1000+0.5)) / 1000
+}
@@ -0,0 +1,161 @@
+package fake_app
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// geoCellDeg 网格边长（度），纬度方向约 1.1 公里
+	geoCellDeg = 0.01
+	// metersPerDegLat 每度纬度对应的米数
+	metersPerDegLat = 111320.0
+	// geoNearestStartRadius k 近邻查询的初始搜索半径（米），找不够时逐次翻倍
+	geoNearestStartRadius = 1000.0
+)
+
+// geoCell 网格坐标
+type geoCell struct {
+	row, col int
+}
+
+// geoHit 空间查询命中：点下标与直线距离（米）
+type geoHit struct {
+	index    int
+	distance float64
+}
+
+// geoGrid 经纬度网格空间索引。点以下标标识，由调用方维护下标到记录的映射；加载数据时构建，之后只读
+type geoGrid struct {
+	cells      map[geoCell][]int
+	lats, lngs []float64
+	// 数据范围，用于限定 k 近邻的最大搜索半径
+	minLat, minLng, maxLat, maxLng float64
+}
+
+// newGeoGrid 为 n 个点建立网格索引；coord 返回第 i 个点的坐标，ok 为 false（无坐标）时不入索引
+func newGeoGrid(n int, coord func(i int) (lat, lng float64, ok bool)) *geoGrid {
+	g := &geoGrid{
+		cells:  make(map[geoCell][]int),
+		lats:   make([]float64, n),
+		lngs:   make([]float64, n),
+		minLat: math.Inf(1), minLng: math.Inf(1),
+		maxLat: math.Inf(-1), maxLng: math.Inf(-1),
+	}
+	for i := 0; i < n; i++ {
+		lat, lng, ok := coord(i)
+		if !ok {
+			continue
+		}
+		g.lats[i], g.lngs[i] = lat, lng
+		c := cellOf(lat, lng)
+		g.cells[c] = append(g.cells[c], i)
+		g.minLat, g.maxLat = math.Min(g.minLat, lat), math.Max(g.maxLat, lat)
+		g.minLng, g.maxLng = math.Min(g.minLng, lng), math.Max(g.maxLng, lng)
+	}
+	return g
+}
+
+func cellOf(lat, lng float64) geoCell {
+	return geoCell{row: int(math.Floor(lat / geoCellDeg)), col: int(math.Floor(lng / geoCellDeg))}
+}
+
+// hasCoord 经纬度是否有效（0,0 视为缺失）
+func hasCoord(lat, lng float64) bool {
+	return (lat != 0 || lng != 0) && lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
+
+// eachInBox 遍历落在经纬度矩形所覆盖网格内的点（可能含矩形外的点，由调用方精确过滤）
+func (g *geoGrid) eachInBox(minLat, minLng, maxLat, maxLng float64, fn func(i int)) {
+	lo, hi := cellOf(minLat, minLng), cellOf(maxLat, maxLng)
+	if (hi.row-lo.row+1)*(hi.col-lo.col+1) > len(g.cells) {
+		// 范围比数据还大时直接遍历非空网格
+		for c, idx := range g.cells {
+			if c.row >= lo.row && c.row <= hi.row && c.col >= lo.col && c.col <= hi.col {
+				for _, i := range idx {
+					fn(i)
+				}
+			}
+		}
+		return
+	}
+	for row := lo.row; row <= hi.row; row++ {
+		for col := lo.col; col <= hi.col; col++ {
+			for _, i := range g.cells[geoCell{row, col}] {
+				fn(i)
+			}
+		}
+	}
+}
+
+// radius 返回距 (lat, lng) 不超过 radiusM 米且 keep 为 true 的点，按距离升序
+func (g *geoGrid) radius(lat, lng, radiusM float64, keep func(i int) bool) []geoHit {
+	dLat := radiusM / metersPerDegLat
+	dLng := 180.0
+	if cos := math.Cos(lat * math.Pi / 180); cos > 1e-6 {
+		dLng = math.Min(180, radiusM/(metersPerDegLat*cos))
+	}
+	var hits []geoHit
+	g.eachInBox(lat-dLat, lng-dLng, lat+dLat, lng+dLng, func(i int) {
+		if keep != nil && !keep(i) {
+			return
+		}
+		if d := calcDistance(g.lats[i], g.lngs[i], lat, lng); d <= radiusM {
+			hits = append(hits, geoHit{index: i, distance: d})
+		}
+	})
+	sortHits(hits)
+	return hits
+}
+
+// bbox 返回落在经纬度矩形内且 keep 为 true 的点下标（升序）
+func (g *geoGrid) bbox(minLat, minLng, maxLat, maxLng float64, keep func(i int) bool) []int {
+	var out []int
+	g.eachInBox(minLat, minLng, maxLat, maxLng, func(i int) {
+		if g.lats[i] < minLat || g.lats[i] > maxLat || g.lngs[i] < minLng || g.lngs[i] > maxLng {
+			return
+		}
+		if keep == nil || keep(i) {
+			out = append(out, i)
+		}
+	})
+	sort.Ints(out)
+	return out
+}
+
+// nearest 返回距 (lat, lng) 最近的 k 个 keep 为 true 的点，按距离升序；maxDistanceM > 0 时只在该半径内查找。
+// 从 geoNearestStartRadius 开始逐次翻倍搜索半径，直到找够 k 个或半径覆盖全部数据
+func (g *geoGrid) nearest(lat, lng float64, k int, maxDistanceM float64, keep func(i int) bool) []geoHit {
+	if k <= 0 || len(g.cells) == 0 {
+		return nil
+	}
+	// 到数据范围最远角的距离：半径超过它即已覆盖全部点
+	limit := 0.0
+	for _, corner := range [][2]float64{{g.minLat, g.minLng}, {g.minLat, g.maxLng}, {g.maxLat, g.minLng}, {g.maxLat, g.maxLng}} {
+		limit = math.Max(limit, calcDistance(lat, lng, corner[0], corner[1]))
+	}
+	if maxDistanceM > 0 && maxDistanceM < limit {
+		limit = maxDistanceM
+	}
+	r := math.Min(geoNearestStartRadius, limit)
+	for {
+		hits := g.radius(lat, lng, r, keep)
+		if len(hits) >= k || r >= limit {
+			if len(hits) > k {
+				hits = hits[:k]
+			}
+			return hits
+		}
+		r = math.Min(r*2, limit)
+	}
+}
+
+// sortHits 按距离升序，距离相同按下标
+func sortHits(hits []geoHit) {
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].distance != hits[j].distance {
+			return hits[i].distance < hits[j].distance
+		}
+		return hits[i].index < hits[j].index
+	})
+}
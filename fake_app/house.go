@@ -56,6 +56,12 @@ type House struct {
 	Longitude        float64  `json:"longitude"`
 	Latitude         float64  `json:"latitude"`
 	CoordinateSystem string   `json:"coordinate_system"`
+
+	// Commute 到查询目的地的通勤估算，仅按 HouseQuery.CommuteTo（或单个 CommuteTargets）查询时填充
+	Commute *HouseCommute `json:"commute,omitempty"`
+	// Commutes、CommuteScore 多个通勤目的地时每个目的地的通勤估算与综合分（分钟，按 CommuteRank 计算）
+	Commutes     []HouseCommute `json:"commutes,omitempty"`
+	CommuteScore *float64       `json:"commute_score,omitempty"`
 }
 
 // HouseWithDistance 带距离信息的房屋
@@ -68,6 +74,9 @@ type HouseWithDistance struct {
 
 // HouseQuery 房屋查询条件
 type HouseQuery struct {
+	// 全文检索：在小区名、商圈、标签、地址中检索，未指定排序时按相关度排序
+	Keyword string
+
 	// 基础筛选
 	Districts  []string // 行政区列表
 	Areas      []string // 商圈列表
@@ -90,10 +99,26 @@ type HouseQuery struct {
 	SubwayStation string // 指定地铁站
 
 	// 水电与通勤
-	UtilitiesType      string // 水电类型，如 民水民电
+	UtilitiesType       string // 水电类型，如 民水民电
 	AvailableFromBefore string // 可入住日期上限，格式 2006-01-02
 	CommuteToXierqiMax  int    // 到西二旗通勤时间上限（分钟）
 
+	// 到任意地标的通勤：按地铁线网图实时估算（需 SetLandmarkManager），结果带 Commute，可按 commute 排序
+	CommuteTo  *Landmark // 通勤目的地，由调用方按地标ID或名称解析
+	CommuteMax int       // 到 CommuteTo 的通勤时间上限（分钟），0 表示不限
+	// 多个通勤目的地（如两人各自的公司），设置时忽略 CommuteTo；每个目的地可设上限，按 CommuteRank 综合排序
+	CommuteTargets []CommuteTarget
+	CommuteRank    string // sum（默认）/max/weighted
+
+	// 标签与隐性属性
+	Tags             []string // 标签，须全部包含（all-of）
+	AnyTags          []string // 标签，包含任一即可（any-of）
+	Bathrooms        []int    // 卫生间数列表
+	MinBathrooms     int      // 最少卫生间数
+	Floors           []string // 楼层段，如 中层、高层
+	NoiseLevels      []string // 隐性噪音等级，如 安静、中等
+	ListingPlatforms []string // 挂牌平台，如 链家、安居客
+
 	// 地标距离
 	NearLandmarkID string  // 附近地标ID
 	MaxDistance    float64 // 最大距离
@@ -128,9 +153,14 @@ type PriceRange struct {
 type HouseManager struct {
 	dataDir             string
 	houses              map[string]*House
+	index               *houseIndex      // 小区名、商圈、标签、地址的倒排索引，随 houses 一起重建
+	lookup              *houseLookup     // 行政区、商圈、户型、小区、地铁站、价格/面积分桶二级索引，随 houses 一起重建
+	landmarks           *LandmarkManager // 通勤估算使用的地铁线网图，未设置时不支持 CommuteTo
+	commutes            *commuteCache    // 按目的地缓存的房源通勤时间，随 houses 一起清空
 	mu                  sync.RWMutex
 	userStatusOverrides map[string]map[string]string // userID -> houseID -> status
 	overridesMu         sync.RWMutex
+	appointments        *appointmentBook // 按用户隔离的看房预约，ResetUser 时清空该用户
 }
 
 // NewHouseManager 创建房屋管理器
@@ -143,6 +173,8 @@ func NewHouseManager(dataDir string) (*HouseManager, error) {
 		dataDir:             dataDir,
 		houses:              make(map[string]*House),
 		userStatusOverrides: make(map[string]map[string]string),
+		commutes:            newCommuteCache(),
+		appointments:        newAppointmentBook(),
 	}
 
 	if err := hm.loadHouses(); err != nil {
@@ -153,7 +185,7 @@ func NewHouseManager(dataDir string) (*HouseManager, error) {
 	return hm, nil
 }
 
-// ResetUser 清空指定用户的状态覆盖（租赁/退租等），使该用户视角下的房源恢复为初始状态。评测或比赛每启动新题目时对该用户调用。
+// ResetUser 清空指定用户的状态覆盖（租赁/退租等）与看房预约，使该用户视角下的房源恢复为初始状态。评测或比赛每启动新题目时对该用户调用。
 func (hm *HouseManager) ResetUser(userID string) {
 	if userID == "" {
 		return
@@ -161,10 +193,11 @@ func (hm *HouseManager) ResetUser(userID string) {
 	hm.overridesMu.Lock()
 	defer hm.overridesMu.Unlock()
 	delete(hm.userStatusOverrides, userID)
-	log.Printf("[HouseManager] 已重置用户 %s 的状态覆盖，该用户视角房源恢复为初始状态", userID)
+	hm.appointments.resetUser(userID)
+	log.Printf("[HouseManager] 已重置用户 %s 的状态覆盖与看房预约，该用户视角房源恢复为初始状态", userID)
 }
 
-// Reload 从磁盘重新加载房源数据并清空用户状态覆盖，用于完整初始化。
+// Reload 从磁盘重新加载房源数据并清空用户状态覆盖与看房预约，用于完整初始化。
 func (hm *HouseManager) Reload() error {
 	hm.mu.Lock()
 	hm.houses = make(map[string]*House)
@@ -172,11 +205,13 @@ func (hm *HouseManager) Reload() error {
 		hm.mu.Unlock()
 		return err
 	}
+	hm.commutes = newCommuteCache()
 	hm.overridesMu.Lock()
 	hm.userStatusOverrides = make(map[string]map[string]string)
 	hm.overridesMu.Unlock()
 	hm.mu.Unlock()
-	log.Printf("[HouseManager] 已从磁盘重新加载 %d 套房源并重置用户状态", len(hm.houses))
+	hm.appointments.reset()
+	log.Printf("[HouseManager] 已从磁盘重新加载 %d 套房源并重置用户状态与看房预约", len(hm.houses))
 	return nil
 }
 
@@ -242,6 +277,8 @@ func (hm *HouseManager) loadHouses() error {
 	if len(hm.houses) == 0 {
 		return fmt.Errorf("未从任何房源文件中加载到有效数据")
 	}
+	hm.index = newHouseIndex(hm.houses)
+	hm.lookup = newHouseLookup(hm.houses)
 	return nil
 }
 
@@ -288,10 +325,11 @@ func (hm *HouseManager) GetAll(userID string) []*House {
 	hm.mu.RLock()
 	defer hm.mu.RUnlock()
 
-	result := make([]*House, 0, len(hm.houses))
-	for _, house := range hm.houses {
+	overrides := hm.userOverrides(userID)
+	result := make([]*House, 0, len(hm.lookup.all))
+	for _, house := range hm.lookup.all {
 		copy := *house
-		copy.Status = hm.effectiveStatus(house.HouseID, house.Status, userID)
+		copy.Status = statusWith(house, overrides)
 		result = append(result, &copy)
 	}
 	return result
@@ -315,18 +353,46 @@ func (hm *HouseManager) Query(query *HouseQuery, userID string) []*House {
 	hm.mu.RLock()
 	defer hm.mu.RUnlock()
 
+	// 全文检索：只保留命中的房源
+	var scores map[string]float64
+	if strings.TrimSpace(query.Keyword) != "" {
+		scores = hm.index.search(query.Keyword)
+	}
+
+	// 按二级索引取候选，用户状态覆盖表只取一次
+	overrides := hm.userOverrides(userID)
+	commutes := hm.commutesFor(query)
 	var results []*House
-	for _, house := range hm.houses {
-		effStatus := hm.effectiveStatus(house.HouseID, house.Status, userID)
-		if hm.matchQuery(house, query, effStatus) {
-			copy := *house
-			copy.Status = effStatus
-			results = append(results, &copy)
+	for _, house := range hm.lookup.candidates(query) {
+		if scores != nil {
+			if _, ok := scores[house.HouseID]; !ok {
+				continue
+			}
+		}
+		effStatus := statusWith(house, overrides)
+		if !hm.matchQuery(house, query, effStatus) {
+			continue
+		}
+		copy := *house
+		copy.Status = effStatus
+		if commutes != nil && !commutes.apply(house, &copy) {
+			continue
 		}
+		results = append(results, &copy)
 	}
 
-	// 排序
-	hm.sortResults(results, query.SortBy, query.SortOrder)
+	// 排序：有关键词且未指定排序字段时按相关度
+	if scores != nil && query.SortBy == "" {
+		sort.Slice(results, func(i, j int) bool {
+			si, sj := scores[results[i].HouseID], scores[results[j].HouseID]
+			if si != sj {
+				return si > sj
+			}
+			return results[i].HouseID < results[j].HouseID
+		})
+	} else {
+		hm.sortResults(results, query.SortBy, query.SortOrder)
+	}
 
 	return results
 }
@@ -456,6 +522,39 @@ func (hm *HouseManager) matchQuery(house *House, query *HouseQuery, effectiveSta
 		return false
 	}
 
+	// 标签：Tags 须全部包含，AnyTags 包含任一即可
+	for _, tag := range query.Tags {
+		if !containsString(house.Tags, tag) {
+			return false
+		}
+	}
+	if len(query.AnyTags) > 0 && !containsAnyString(house.Tags, query.AnyTags) {
+		return false
+	}
+
+	// 卫生间数
+	if len(query.Bathrooms) > 0 && !containsInt(query.Bathrooms, house.Bathrooms) {
+		return false
+	}
+	if query.MinBathrooms > 0 && house.Bathrooms < query.MinBathrooms {
+		return false
+	}
+
+	// 楼层段（高层/中层/低层；低楼栋数据为“共N层”，指定楼层段时不匹配）
+	if len(query.Floors) > 0 && !containsString(query.Floors, house.Floor) {
+		return false
+	}
+
+	// 隐性噪音等级
+	if len(query.NoiseLevels) > 0 && !containsString(query.NoiseLevels, house.HiddenNoiseLevel) {
+		return false
+	}
+
+	// 挂牌平台
+	if len(query.ListingPlatforms) > 0 && !containsString(query.ListingPlatforms, house.ListingPlatform) {
+		return false
+	}
+
 	return true
 }
 
@@ -489,6 +588,11 @@ func (hm *HouseManager) sortResults(results []*House, sortBy, sortOrder string)
 			}
 			return results[i].SubwayDistance > results[j].SubwayDistance
 		})
+	case "commute":
+		// 单目的地按通勤分钟数，多目的地按综合分；未带通勤估算的房源排在最后
+		sort.SliceStable(results, func(i, j int) bool {
+			return commuteLess(results[i], results[j], asc)
+		})
 	}
 }
 
@@ -497,43 +601,11 @@ func (hm *HouseManager) GetStatistics(userID string) *HouseStatistics {
 	hm.mu.RLock()
 	defer hm.mu.RUnlock()
 
-	stats := &HouseStatistics{
-		Total:      len(hm.houses),
-		ByStatus:   make(map[string]int),
-		ByDistrict: make(map[string]int),
-		ByBedrooms: make(map[string]int),
-	}
-
-	var totalPrice int
-	minPrice := int(^uint(0) >> 1) // MaxInt
-	maxPrice := 0
-
-	for _, house := range hm.houses {
-		effStatus := hm.effectiveStatus(house.HouseID, house.Status, userID)
-		stats.ByStatus[effStatus]++
-
-		// 按行政区统计
-		stats.ByDistrict[house.District]++
-
-		// 按卧室数统计
-		key := fmt.Sprintf("%d", house.Bedrooms)
-		stats.ByBedrooms[key]++
-
-		// 价格统计
-		totalPrice += house.Price
-		if house.Price < minPrice {
-			minPrice = house.Price
-		}
-		if house.Price > maxPrice {
-			maxPrice = house.Price
-		}
-	}
-
-	if len(hm.houses) > 0 {
-		stats.PriceRange = PriceRange{
-			Min: minPrice,
-			Max: maxPrice,
-			Avg: totalPrice / len(hm.houses),
+	// 与用户无关的部分来自索引，ByStatus 只需按该用户的状态覆盖调整
+	stats := hm.lookup.statistics()
+	for houseID, status := range hm.userOverrides(userID) {
+		if house, ok := hm.houses[houseID]; ok {
+			moveCount(stats.ByStatus, house.Status, status)
 		}
 	}
 
@@ -555,64 +627,130 @@ func (hm *HouseManager) UpdateStatus(houseID string, status HouseStatus) error {
 		return fmt.Errorf("无效的状态值: %s", status)
 	}
 
+	hm.lookup.setStatus(house.Status, string(status))
 	house.Status = string(status)
 	return nil
 }
 
-// FindNearby 查询附近房屋；userID 非空时按该用户视角下的有效状态筛选可租
+// FindNearby 查询地标附近可租房屋，按距离升序；userID 非空时按该用户视角下的有效状态筛选可租
 func (hm *HouseManager) FindNearby(landmark *Landmark, maxDistance float64, userID string) []*HouseWithDistance {
+	return hm.FindWithinRadius(landmark.Latitude, landmark.Longitude, maxDistance, userID)
+}
+
+// FindWithinRadius 查询距 (lat, lng) 不超过 radiusM 米的可租房屋，按距离升序（基于网格空间索引）
+func (hm *HouseManager) FindWithinRadius(lat, lng, radiusM float64, userID string) []*HouseWithDistance {
 	hm.mu.RLock()
 	defer hm.mu.RUnlock()
 
-	var results []*HouseWithDistance
-	for _, house := range hm.houses {
-		effStatus := hm.effectiveStatus(house.HouseID, house.Status, userID)
-		if effStatus != string(HouseStatusAvailable) {
-			continue
-		}
+	overrides := hm.userOverrides(userID)
+	hits := hm.lookup.geo.radius(lat, lng, radiusM, hm.lookup.availableWith(overrides))
+	return hm.lookup.withDistance(hits, overrides)
+}
 
-		distance := calcDistance(house.Latitude, house.Longitude, landmark.Latitude, landmark.Longitude)
-		if distance <= maxDistance {
-			h := *house
-			h.Status = effStatus
-			walkingDist := estimateWalkingDistance(distance)
-			results = append(results, &HouseWithDistance{
-				House:              h,
-				DistanceToLandmark: distance,
-				WalkingDistance:    walkingDist,
-				WalkingDuration:    estimateWalkingDuration(walkingDist),
-			})
-		}
+// FindInBounds 查询经纬度矩形内的可租房屋，按 house_id 排序
+func (hm *HouseManager) FindInBounds(minLat, minLng, maxLat, maxLng float64, userID string) []*House {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
+	overrides := hm.userOverrides(userID)
+	indexes := hm.lookup.geo.bbox(minLat, minLng, maxLat, maxLng, hm.lookup.availableWith(overrides))
+	results := make([]*House, 0, len(indexes))
+	for _, i := range indexes {
+		copy := *hm.lookup.all[i]
+		copy.Status = statusWith(&copy, overrides)
+		results = append(results, &copy)
 	}
+	return results
+}
 
-	// 按距离排序
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].DistanceToLandmark < results[j].DistanceToLandmark
-	})
+// FindNearest 查询距 (lat, lng) 最近的 k 套可租房屋，按距离升序；maxDistance > 0 时只在该半径（米）内查找
+func (hm *HouseManager) FindNearest(lat, lng float64, k int, maxDistance float64, userID string) []*HouseWithDistance {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
 
-	return results
+	overrides := hm.userOverrides(userID)
+	hits := hm.lookup.geo.nearest(lat, lng, k, maxDistance, hm.lookup.availableWith(overrides))
+	return hm.lookup.withDistance(hits, overrides)
+}
+
+// CommunityMatch 小区名模糊匹配候选
+type CommunityMatch struct {
+	Community string  `json:"community"`
+	Score     float64 `json:"score"`      // 匹配分数 0~1
+	MatchType string  `json:"match_type"` // exact/substring/pinyin/initials/fuzzy
+	Total     int     `json:"total"`      // 该小区房源总数（不区分状态）
+}
+
+// MatchCommunities 按拼音、简拼、同音字、编辑距离模糊匹配小区名，返回按分数降序的候选（最多 limit 个，<=0 不限）
+func (hm *HouseManager) MatchCommunities(query string, limit int) []CommunityMatch {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+	return hm.matchCommunities(query, limit)
 }
 
-// GetByCommunity 按小区名查询可租房源；userID 非空时按该用户视角下的有效状态
+// matchCommunities 调用方须持有 hm.mu 读锁
+func (hm *HouseManager) matchCommunities(query string, limit int) []CommunityMatch {
+	cands := make([]nameCandidate, 0, len(hm.lookup.byCommunity))
+	for community := range hm.lookup.byCommunity {
+		score, typ := nameScore(query, community)
+		cands = append(cands, nameCandidate{key: community, score: score, typ: typ})
+	}
+	cands = rankCandidates(cands, limit)
+	matches := make([]CommunityMatch, len(cands))
+	for i, c := range cands {
+		matches[i] = CommunityMatch{Community: c.key, Score: roundScore(c.score), MatchType: c.typ, Total: len(hm.lookup.byCommunity[c.key])}
+	}
+	return matches
+}
+
+// ResolveCommunity 解析用户给出的小区名：存在同名小区时原样返回；否则返回模糊匹配候选，
+// 最高分候选足够可信（不低于 AcceptMatchScore 且明显领先第二名）时 resolved 为该小区，否则为空
+func (hm *HouseManager) ResolveCommunity(community string) (resolved string, candidates []CommunityMatch) {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+	return hm.resolveCommunity(community)
+}
+
+// resolveCommunity 调用方须持有 hm.mu 读锁
+func (hm *HouseManager) resolveCommunity(community string) (string, []CommunityMatch) {
+	if community == "" {
+		return "", nil
+	}
+	if _, ok := hm.lookup.byCommunity[community]; ok {
+		return community, nil
+	}
+	candidates := hm.matchCommunities(community, 5)
+	cands := make([]nameCandidate, len(candidates))
+	for i, c := range candidates {
+		cands[i] = nameCandidate{key: c.Community, score: c.Score}
+	}
+	if acceptBest(cands) {
+		return candidates[0].Community, candidates
+	}
+	return "", candidates
+}
+
+// GetByCommunity 按小区名查询可租房源；userID 非空时按该用户视角下的有效状态。
+// 小区名不存在时按 ResolveCommunity 模糊匹配（拼音、同音字、错别字），没有可信候选时返回空
 func (hm *HouseManager) GetByCommunity(community, userID string) []*House {
 	hm.mu.RLock()
 	defer hm.mu.RUnlock()
 
+	community, _ = hm.resolveCommunity(community)
 	if community == "" {
 		return nil
 	}
 
+	overrides := hm.userOverrides(userID)
 	var results []*House
-	for _, house := range hm.houses {
-		effStatus := hm.effectiveStatus(house.HouseID, house.Status, userID)
+	for _, house := range hm.lookup.byCommunity[community] {
+		effStatus := statusWith(house, overrides)
 		if effStatus != string(HouseStatusAvailable) {
 			continue
 		}
-		if house.Community == community {
-			copy := *house
-			copy.Status = effStatus
-			results = append(results, &copy)
-		}
+		copy := *house
+		copy.Status = effStatus
+		results = append(results, &copy)
 	}
 	return results
 }
@@ -627,6 +765,16 @@ func containsString(slice []string, item string) bool {
 	return false
 }
 
+// containsAnyString slice 中是否包含 items 任一元素
+func containsAnyString(slice []string, items []string) bool {
+	for _, item := range items {
+		if containsString(slice, item) {
+			return true
+		}
+	}
+	return false
+}
+
 func containsInt(slice []int, item int) bool {
 	for _, i := range slice {
 		if i == item {
@@ -0,0 +1,128 @@
+package fake_app
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// 全文检索各字段权重：小区名最重要，其次商圈、标签、地址
+var houseIndexFields = []struct {
+	weight float64
+	text   func(h *House) []string
+}{
+	{3.0, func(h *House) []string { return []string{h.Community} }},
+	{2.0, func(h *House) []string { return []string{h.Area} }},
+	{1.5, func(h *House) []string { return h.Tags }},
+	{1.0, func(h *House) []string { return []string{h.Address} }},
+}
+
+// houseIndex 房源倒排索引：词 -> 房源ID -> 字段权重之和。加载房源时构建，之后只读
+type houseIndex struct {
+	postings map[string]map[string]float64
+	docs     int
+}
+
+// newHouseIndex 对小区名、商圈、标签、地址分词建立倒排索引
+func newHouseIndex(houses map[string]*House) *houseIndex {
+	idx := &houseIndex{postings: make(map[string]map[string]float64), docs: len(houses)}
+	for id, h := range houses {
+		for _, f := range houseIndexFields {
+			seen := make(map[string]bool)
+			for _, text := range f.text(h) {
+				for _, tok := range tokenize(text) {
+					if seen[tok] {
+						continue
+					}
+					seen[tok] = true
+					p := idx.postings[tok]
+					if p == nil {
+						p = make(map[string]float64)
+						idx.postings[tok] = p
+					}
+					p[id] += f.weight
+				}
+			}
+		}
+	}
+	return idx
+}
+
+// search 返回命中房源的相关度分数（非 nil）。分数为命中词的 idf × 字段权重之和，
+// 再乘以查询词覆盖率，使「阳光100那套」中多余的「那套」不影响排序，同时完整命中的房源排在前面
+func (idx *houseIndex) search(query string) map[string]float64 {
+	scores := make(map[string]float64)
+	if idx == nil {
+		return scores
+	}
+	tokens := uniqueTokens(tokenize(query))
+	if len(tokens) == 0 {
+		return scores
+	}
+	matched := make(map[string]int)
+	for _, tok := range tokens {
+		p := idx.postings[tok]
+		if len(p) == 0 {
+			continue
+		}
+		idf := math.Log(1 + float64(idx.docs)/float64(len(p)))
+		for id, w := range p {
+			scores[id] += idf * w
+			matched[id]++
+		}
+	}
+	for id := range scores {
+		scores[id] *= float64(matched[id]) / float64(len(tokens))
+	}
+	return scores
+}
+
+// tokenize 中文按二元组（bigram）切分，单字词保留单字；字母数字串整体作为一个词（转小写）；其余字符为分隔符。
+// 如「阳光100(南区)」-> 阳光、100、南区
+func tokenize(text string) []string {
+	var tokens []string
+	var han, word []rune
+	flushHan := func() {
+		if len(han) == 1 {
+			tokens = append(tokens, string(han))
+		}
+		for i := 0; i+1 < len(han); i++ {
+			tokens = append(tokens, string(han[i:i+2]))
+		}
+		han = han[:0]
+	}
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, strings.ToLower(string(word)))
+		}
+		word = word[:0]
+	}
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			han = append(han, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushHan()
+			word = append(word, r)
+		default:
+			flushHan()
+			flushWord()
+		}
+	}
+	flushHan()
+	flushWord()
+	return tokens
+}
+
+func uniqueTokens(tokens []string) []string {
+	seen := make(map[string]bool, len(tokens))
+	out := tokens[:0]
+	for _, t := range tokens {
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
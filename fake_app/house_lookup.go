@@ -0,0 +1,260 @@
+package fake_app
+
+import (
+	"sort"
+	"strconv"
+)
+
+// 价格、面积分桶粒度
+const (
+	priceBucketSize = 1000 // 元/月
+	areaBucketSize  = 10   // 平米
+)
+
+// houseLookup 房源二级索引：加载房源时构建，查询时按选择性最强的条件取候选，避免全量扫描。
+// 各列表按 house_id 排序，结果顺序稳定；索引只依赖不可变字段，状态由 statusCounts 单独维护
+type houseLookup struct {
+	all         []*House
+	byDistrict  map[string][]*House
+	byArea      map[string][]*House
+	byBedrooms  map[int][]*House
+	byCommunity map[string][]*House
+	byStation   map[string][]*House
+	byPrice     map[int][]*House // price / priceBucketSize
+	byAreaSqm   map[int][]*House // int(area_sqm) / areaBucketSize
+	geo         *geoGrid         // 经纬度网格索引，点下标对应 all
+
+	// 统计信息中与用户无关的部分
+	statusCounts map[string]int // 基础状态分布，UpdateStatus 时同步
+	priceMin     int
+	priceMax     int
+	priceSum     int
+}
+
+// newHouseLookup 为全部房源建立二级索引
+func newHouseLookup(houses map[string]*House) *houseLookup {
+	l := &houseLookup{
+		all:          make([]*House, 0, len(houses)),
+		byDistrict:   make(map[string][]*House),
+		byArea:       make(map[string][]*House),
+		byBedrooms:   make(map[int][]*House),
+		byCommunity:  make(map[string][]*House),
+		byStation:    make(map[string][]*House),
+		byPrice:      make(map[int][]*House),
+		byAreaSqm:    make(map[int][]*House),
+		statusCounts: make(map[string]int),
+	}
+	for _, h := range houses {
+		l.all = append(l.all, h)
+	}
+	sort.Slice(l.all, func(i, j int) bool { return l.all[i].HouseID < l.all[j].HouseID })
+	l.geo = newGeoGrid(len(l.all), func(i int) (float64, float64, bool) {
+		return l.all[i].Latitude, l.all[i].Longitude, hasCoord(l.all[i].Latitude, l.all[i].Longitude)
+	})
+
+	for i, h := range l.all {
+		l.byDistrict[h.District] = append(l.byDistrict[h.District], h)
+		l.byArea[h.Area] = append(l.byArea[h.Area], h)
+		l.byBedrooms[h.Bedrooms] = append(l.byBedrooms[h.Bedrooms], h)
+		l.byCommunity[h.Community] = append(l.byCommunity[h.Community], h)
+		if h.SubwayStation != "" {
+			l.byStation[h.SubwayStation] = append(l.byStation[h.SubwayStation], h)
+		}
+		l.byPrice[h.Price/priceBucketSize] = append(l.byPrice[h.Price/priceBucketSize], h)
+		l.byAreaSqm[int(h.AreaSqm)/areaBucketSize] = append(l.byAreaSqm[int(h.AreaSqm)/areaBucketSize], h)
+
+		l.statusCounts[h.Status]++
+		l.priceSum += h.Price
+		if i == 0 || h.Price < l.priceMin {
+			l.priceMin = h.Price
+		}
+		if h.Price > l.priceMax {
+			l.priceMax = h.Price
+		}
+	}
+	return l
+}
+
+// candidates 返回满足查询中选择性最强条件的房源（各条件取并集后比较大小），调用方仍须用 matchQuery 完整校验；
+// 没有可用索引条件时返回全部房源
+func (l *houseLookup) candidates(q *HouseQuery) []*House {
+	var options [][][]*House
+	if len(q.Districts) > 0 {
+		options = append(options, stringBuckets(l.byDistrict, q.Districts))
+	}
+	if len(q.Areas) > 0 {
+		options = append(options, stringBuckets(l.byArea, q.Areas))
+	}
+	if len(q.Bedrooms) > 0 {
+		options = append(options, intBuckets(l.byBedrooms, q.Bedrooms))
+	}
+	if q.SubwayStation != "" {
+		options = append(options, [][]*House{l.byStation[q.SubwayStation]})
+	}
+	if q.MinPrice > 0 || q.MaxPrice > 0 {
+		options = append(options, rangeBuckets(l.byPrice, q.MinPrice, q.MaxPrice, priceBucketSize))
+	}
+	if q.MinArea > 0 || q.MaxArea > 0 {
+		options = append(options, rangeBuckets(l.byAreaSqm, q.MinArea, q.MaxArea, areaBucketSize))
+	}
+
+	best, bestSize := [][]*House(nil), len(l.all)+1
+	for _, lists := range options {
+		size := 0
+		for _, list := range lists {
+			size += len(list)
+		}
+		if size < bestSize {
+			best, bestSize = lists, size
+		}
+	}
+	if best == nil {
+		return l.all
+	}
+	if len(best) == 1 {
+		return best[0]
+	}
+	out := make([]*House, 0, bestSize)
+	for _, list := range best {
+		out = append(out, list...)
+	}
+	return out
+}
+
+// stringBuckets 取多个取值对应的列表（取值去重，各列表互不相交）
+func stringBuckets(index map[string][]*House, keys []string) [][]*House {
+	seen := make(map[string]bool, len(keys))
+	var lists [][]*House
+	for _, k := range keys {
+		if !seen[k] {
+			seen[k] = true
+			lists = append(lists, index[k])
+		}
+	}
+	return lists
+}
+
+func intBuckets(index map[int][]*House, keys []int) [][]*House {
+	seen := make(map[int]bool, len(keys))
+	var lists [][]*House
+	for _, k := range keys {
+		if !seen[k] {
+			seen[k] = true
+			lists = append(lists, index[k])
+		}
+	}
+	return lists
+}
+
+// rangeBuckets 按桶号升序取与 [min, max] 相交的分桶，保证多次查询结果顺序一致；min、max 为 0 表示不限
+func rangeBuckets(index map[int][]*House, min, max, size int) [][]*House {
+	buckets := make([]int, 0, len(index))
+	for bucket := range index {
+		if min > 0 && (bucket+1)*size <= min {
+			continue
+		}
+		if max > 0 && bucket*size > max {
+			continue
+		}
+		buckets = append(buckets, bucket)
+	}
+	sort.Ints(buckets)
+	lists := make([][]*House, len(buckets))
+	for i, bucket := range buckets {
+		lists[i] = index[bucket]
+	}
+	return lists
+}
+
+// statistics 基础统计（与用户无关），ByStatus 为基础状态分布，由调用方叠加用户的状态覆盖
+func (l *houseLookup) statistics() *HouseStatistics {
+	stats := &HouseStatistics{
+		Total:      len(l.all),
+		ByStatus:   make(map[string]int, len(l.statusCounts)),
+		ByDistrict: make(map[string]int, len(l.byDistrict)),
+		ByBedrooms: make(map[string]int, len(l.byBedrooms)),
+	}
+	for status, n := range l.statusCounts {
+		stats.ByStatus[status] = n
+	}
+	for district, list := range l.byDistrict {
+		stats.ByDistrict[district] = len(list)
+	}
+	for bedrooms, list := range l.byBedrooms {
+		stats.ByBedrooms[strconv.Itoa(bedrooms)] = len(list)
+	}
+	if len(l.all) > 0 {
+		stats.PriceRange = PriceRange{
+			Min: l.priceMin,
+			Max: l.priceMax,
+			Avg: l.priceSum / len(l.all),
+		}
+	}
+	return stats
+}
+
+// setStatus 基础状态变更时同步状态分布
+func (l *houseLookup) setStatus(from, to string) {
+	moveCount(l.statusCounts, from, to)
+}
+
+// moveCount 将一个计数从 from 移到 to，计数归零的键删除
+func moveCount(counts map[string]int, from, to string) {
+	if from == to {
+		return
+	}
+	if counts[from]--; counts[from] <= 0 {
+		delete(counts, from)
+	}
+	counts[to]++
+}
+
+// userOverrides 取出某用户状态覆盖表的副本：每次查询只加一次锁，之后逐套房源查表无需再加锁
+func (hm *HouseManager) userOverrides(userID string) map[string]string {
+	if userID == "" {
+		return nil
+	}
+	hm.overridesMu.RLock()
+	defer hm.overridesMu.RUnlock()
+	m := hm.userStatusOverrides[userID]
+	if len(m) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for id, s := range m {
+		out[id] = s
+	}
+	return out
+}
+
+// availableWith 返回空间查询的过滤函数：lookup.all 中第 i 套房源在给定状态覆盖表下是否可租
+func (l *houseLookup) availableWith(overrides map[string]string) func(i int) bool {
+	return func(i int) bool {
+		return statusWith(l.all[i], overrides) == string(HouseStatusAvailable)
+	}
+}
+
+// withDistance 将空间查询命中转换为带距离的房源副本（状态为有效状态）
+func (l *houseLookup) withDistance(hits []geoHit, overrides map[string]string) []*HouseWithDistance {
+	results := make([]*HouseWithDistance, 0, len(hits))
+	for _, hit := range hits {
+		h := *l.all[hit.index]
+		h.Status = statusWith(&h, overrides)
+		walkingDist := estimateWalkingDistance(hit.distance)
+		results = append(results, &HouseWithDistance{
+			House:              h,
+			DistanceToLandmark: hit.distance,
+			WalkingDistance:    walkingDist,
+			WalkingDuration:    estimateWalkingDuration(walkingDist),
+		})
+	}
+	return results
+}
+
+// statusWith 房源在给定状态覆盖表下的有效状态
+func statusWith(h *House, overrides map[string]string) string {
+	if s, ok := overrides[h.HouseID]; ok {
+		return s
+	}
+	return h.Status
+}
@@ -0,0 +1,302 @@
+package fake_app
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// 二级索引与改造前全量扫描的对比：scan* 为引入 houseLookup 之前的实现（遍历 hm.houses，每套房源单独加锁查用户状态覆盖），
+// 在随仓库的房源数据（data/database.json + database_2000.json）及其 4 倍扩充上运行。
+//
+//	go test ./fake_app -run '^$' -bench . -benchmem
+
+const benchUser = "bench_user"
+
+var (
+	benchOnce     sync.Once
+	benchManagers []benchManager
+)
+
+type benchManager struct {
+	name string
+	hm   *HouseManager
+}
+
+// loadBenchManagers 加载随仓库数据与 4 倍扩充数据，并为 benchUser 设置一批状态覆盖
+func loadBenchManagers(tb testing.TB) []benchManager {
+	tb.Helper()
+	benchOnce.Do(func() {
+		log.SetOutput(io.Discard)
+		defer log.SetOutput(os.Stderr)
+
+		hm, err := NewHouseManager("data")
+		if err != nil {
+			tb.Fatalf("加载房源数据失败: %v", err)
+		}
+		scaled := make(map[string]*House, len(hm.houses)*4)
+		for i := 0; i < 4; i++ {
+			for id, h := range hm.houses {
+				copy := *h
+				copy.HouseID = id + "_" + strconv.Itoa(i)
+				scaled[copy.HouseID] = &copy
+			}
+		}
+		for _, m := range []*HouseManager{hm, newManagerFromHouses(scaled)} {
+			for i, h := range m.lookup.all {
+				if i%20 == 0 {
+					m.UpdateStatusForUser(benchUser, h.HouseID, HouseStatusRented)
+				}
+			}
+			benchManagers = append(benchManagers, benchManager{name: fmt.Sprintf("houses=%d", len(m.houses)), hm: m})
+		}
+	})
+	if len(benchManagers) == 0 {
+		tb.Fatal("房源数据未加载")
+	}
+	return benchManagers
+}
+
+// newManagerFromHouses 用内存中的房源构建 HouseManager（与 loadHouses 相同的索引）
+func newManagerFromHouses(houses map[string]*House) *HouseManager {
+	hm := &HouseManager{
+		houses:              houses,
+		userStatusOverrides: make(map[string]map[string]string),
+		commutes:            newCommuteCache(),
+		appointments:        newAppointmentBook(),
+	}
+	hm.index = newHouseIndex(hm.houses)
+	hm.lookup = newHouseLookup(hm.houses)
+	return hm
+}
+
+// scanQuery 改造前的 Query（无关键词与通勤条件时）
+func (hm *HouseManager) scanQuery(query *HouseQuery, userID string) []*House {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
+	var results []*House
+	for _, house := range hm.houses {
+		effStatus := hm.effectiveStatus(house.HouseID, house.Status, userID)
+		if hm.matchQuery(house, query, effStatus) {
+			copy := *house
+			copy.Status = effStatus
+			results = append(results, &copy)
+		}
+	}
+	hm.sortResults(results, query.SortBy, query.SortOrder)
+	return results
+}
+
+// scanGetByCommunity 改造前的 GetByCommunity（小区名精确存在时）
+func (hm *HouseManager) scanGetByCommunity(community, userID string) []*House {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
+	var results []*House
+	for _, house := range hm.houses {
+		effStatus := hm.effectiveStatus(house.HouseID, house.Status, userID)
+		if effStatus != string(HouseStatusAvailable) {
+			continue
+		}
+		if house.Community == community {
+			copy := *house
+			copy.Status = effStatus
+			results = append(results, &copy)
+		}
+	}
+	return results
+}
+
+// scanFindNearby 改造前的 FindNearby：逐套计算距离后排序
+func (hm *HouseManager) scanFindNearby(landmark *Landmark, maxDistance float64, userID string) []*HouseWithDistance {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
+	var results []*HouseWithDistance
+	for _, house := range hm.houses {
+		effStatus := hm.effectiveStatus(house.HouseID, house.Status, userID)
+		if effStatus != string(HouseStatusAvailable) {
+			continue
+		}
+		distance := calcDistance(house.Latitude, house.Longitude, landmark.Latitude, landmark.Longitude)
+		if distance <= maxDistance {
+			h := *house
+			h.Status = effStatus
+			walkingDist := estimateWalkingDistance(distance)
+			results = append(results, &HouseWithDistance{
+				House:              h,
+				DistanceToLandmark: distance,
+				WalkingDistance:    walkingDist,
+				WalkingDuration:    estimateWalkingDuration(walkingDist),
+			})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].DistanceToLandmark < results[j].DistanceToLandmark
+	})
+	return results
+}
+
+// scanStatistics 改造前的 GetStatistics
+func (hm *HouseManager) scanStatistics(userID string) *HouseStatistics {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
+	stats := &HouseStatistics{
+		Total:      len(hm.houses),
+		ByStatus:   make(map[string]int),
+		ByDistrict: make(map[string]int),
+		ByBedrooms: make(map[string]int),
+	}
+	var totalPrice int
+	minPrice := int(^uint(0) >> 1)
+	maxPrice := 0
+	for _, house := range hm.houses {
+		stats.ByStatus[hm.effectiveStatus(house.HouseID, house.Status, userID)]++
+		stats.ByDistrict[house.District]++
+		stats.ByBedrooms[fmt.Sprintf("%d", house.Bedrooms)]++
+		totalPrice += house.Price
+		if house.Price < minPrice {
+			minPrice = house.Price
+		}
+		if house.Price > maxPrice {
+			maxPrice = house.Price
+		}
+	}
+	if len(hm.houses) > 0 {
+		stats.PriceRange = PriceRange{Min: minPrice, Max: maxPrice, Avg: totalPrice / len(hm.houses)}
+	}
+	return stats
+}
+
+// benchQueries 典型的 /api/houses 查询
+var benchQueries = []struct {
+	name  string
+	query HouseQuery
+}{
+	{"district", HouseQuery{Districts: []string{"海淀"}}},
+	{"district_bedrooms_price", HouseQuery{Districts: []string{"朝阳"}, Bedrooms: []int{2}, MaxPrice: 8000, SortBy: "price"}},
+	{"price_range", HouseQuery{MinPrice: 5000, MaxPrice: 6000}},
+	{"area_range", HouseQuery{MinArea: 80, MaxArea: 90, SortBy: "area"}},
+	{"unfiltered", HouseQuery{SortBy: "price"}},
+}
+
+// benchCenter 国贸附近
+var benchCenter = &Landmark{Name: "bench", Latitude: 39.9087, Longitude: 116.4605}
+
+func houseIDs(houses []*House) []string {
+	ids := make([]string, len(houses))
+	for i, h := range houses {
+		ids[i] = h.HouseID + "/" + h.Status
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestLookupMatchesFullScan(t *testing.T) {
+	for _, bm := range loadBenchManagers(t) {
+		hm := bm.hm
+		for _, user := range []string{"", benchUser} {
+			for _, bq := range benchQueries {
+				q := bq.query
+				want, got := houseIDs(hm.scanQuery(&q, user)), houseIDs(hm.Query(&q, user))
+				if fmt.Sprint(want) != fmt.Sprint(got) {
+					t.Errorf("%s %s user=%q: 索引查询 %d 条，全量扫描 %d 条", bm.name, bq.name, user, len(got), len(want))
+				}
+			}
+
+			community := hm.lookup.all[0].Community
+			if want, got := houseIDs(hm.scanGetByCommunity(community, user)), houseIDs(hm.GetByCommunity(community, user)); fmt.Sprint(want) != fmt.Sprint(got) {
+				t.Errorf("%s GetByCommunity(%s) user=%q 不一致", bm.name, community, user)
+			}
+
+			want, got := hm.scanFindNearby(benchCenter, 3000, user), hm.FindNearby(benchCenter, 3000, user)
+			if len(want) != len(got) {
+				t.Fatalf("%s FindNearby user=%q: 索引 %d 条，全量扫描 %d 条", bm.name, user, len(got), len(want))
+			}
+			for i := range want {
+				if want[i].DistanceToLandmark != got[i].DistanceToLandmark {
+					t.Errorf("%s FindNearby 第 %d 条距离 %.1f，期望 %.1f", bm.name, i, got[i].DistanceToLandmark, want[i].DistanceToLandmark)
+					break
+				}
+			}
+
+			if want, got := hm.scanStatistics(user), hm.GetStatistics(user); fmt.Sprint(want) != fmt.Sprint(got) {
+				t.Errorf("%s GetStatistics user=%q:\n索引 %+v\n扫描 %+v", bm.name, user, got, want)
+			}
+		}
+	}
+}
+
+func BenchmarkQuery(b *testing.B) {
+	for _, bm := range loadBenchManagers(b) {
+		for _, bq := range benchQueries {
+			q := bq.query
+			b.Run(bm.name+"/"+bq.name+"/scan", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					bm.hm.scanQuery(&q, benchUser)
+				}
+			})
+			b.Run(bm.name+"/"+bq.name+"/index", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					bm.hm.Query(&q, benchUser)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkGetByCommunity(b *testing.B) {
+	for _, bm := range loadBenchManagers(b) {
+		community := bm.hm.lookup.all[0].Community
+		b.Run(bm.name+"/scan", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				bm.hm.scanGetByCommunity(community, benchUser)
+			}
+		})
+		b.Run(bm.name+"/index", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				bm.hm.GetByCommunity(community, benchUser)
+			}
+		})
+	}
+}
+
+func BenchmarkFindNearby(b *testing.B) {
+	for _, bm := range loadBenchManagers(b) {
+		for _, radius := range []float64{1000, 3000} {
+			name := fmt.Sprintf("%s/radius=%.0fm", bm.name, radius)
+			b.Run(name+"/scan", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					bm.hm.scanFindNearby(benchCenter, radius, benchUser)
+				}
+			})
+			b.Run(name+"/index", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					bm.hm.FindNearby(benchCenter, radius, benchUser)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkGetStatistics(b *testing.B) {
+	for _, bm := range loadBenchManagers(b) {
+		b.Run(bm.name+"/scan", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				bm.hm.scanStatistics(benchUser)
+			}
+		})
+		b.Run(bm.name+"/index", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				bm.hm.GetStatistics(benchUser)
+			}
+		})
+	}
+}
@@ -0,0 +1,473 @@
+package fake_app
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 过滤条件运算符
+const (
+	FilterOpEq       = "eq"       // 等于；列表字段（tags）任一元素等于
+	FilterOpIn       = "in"       // 属于 values 之一；列表字段任一元素属于
+	FilterOpRange    = "range"    // min <= 值 <= max（闭区间，可只给一端）；数值字段按数值，字符串字段（如 available_from）按字典序
+	FilterOpContains = "contains" // 字符串字段包含子串；列表字段含有该元素
+	FilterOpExists   = "exists"   // 字段非空（非空字符串、非零数值、true、非空列表）
+)
+
+// HouseFilter 房源布尔过滤树。每个节点只能是以下之一：
+//
+//	{"and": [...]}、{"or": [...]}、{"not": {...}}，
+//	或条件 {"field": "price", "op": "range", "min": 3000, "max": 6000}。
+//
+// field 为 House 的 JSON 字段名；status 按当前用户视角下的有效状态匹配。
+type HouseFilter struct {
+	And []*HouseFilter `json:"and,omitempty"`
+	Or  []*HouseFilter `json:"or,omitempty"`
+	Not *HouseFilter   `json:"not,omitempty"`
+
+	Field  string        `json:"field,omitempty"`
+	Op     string        `json:"op,omitempty"`
+	Value  interface{}   `json:"value,omitempty"`  // eq、contains
+	Values []interface{} `json:"values,omitempty"` // in
+	Min    interface{}   `json:"min,omitempty"`    // range
+	Max    interface{}   `json:"max,omitempty"`    // range
+}
+
+// HouseSort 排序键
+type HouseSort struct {
+	Field string `json:"field"` // House 的 JSON 字段名（列表字段不可排序）
+	Order string `json:"order"` // asc（默认）或 desc
+}
+
+// HouseSearch 布尔搜索请求
+type HouseSearch struct {
+	Filter   *HouseFilter `json:"filter"` // 为空表示不过滤；未引用 status 字段时只返回可租房源
+	Sort     []HouseSort  `json:"sort"`   // 多键排序，最后按 house_id 保证分页稳定
+	Page     int          `json:"page"`
+	PageSize int          `json:"page_size"`
+}
+
+// houseMatcher 匹配一套房源，status 为当前用户视角下的有效状态
+type houseMatcher func(h *House, status string) bool
+
+// houseField House 的一个可过滤字段
+type houseField struct {
+	name  string
+	index int
+	kind  reflect.Kind // String、Int、Float64、Bool 或 Slice（[]string）
+}
+
+var (
+	houseFieldsOnce sync.Once
+	houseFields     map[string]houseField
+)
+
+// houseFieldByName 按 JSON 字段名查找 House 字段
+func houseFieldByName(name string) (houseField, bool) {
+	houseFieldsOnce.Do(func() {
+		houseFields = make(map[string]houseField)
+		t := reflect.TypeOf(House{})
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := strings.Split(f.Tag.Get("json"), ",")[0]
+			if tag == "" || tag == "-" {
+				continue
+			}
+			kind := f.Type.Kind()
+			if kind == reflect.Slice && f.Type.Elem().Kind() != reflect.String {
+				continue
+			}
+			houseFields[tag] = houseField{name: tag, index: i, kind: kind}
+		}
+	})
+	f, ok := houseFields[name]
+	return f, ok
+}
+
+// HouseFieldNames 返回可用于过滤与排序的字段名（排序后）
+func HouseFieldNames() []string {
+	houseFieldByName("")
+	names := make([]string, 0, len(houseFields))
+	for name := range houseFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// value 取字段值；status 字段返回有效状态
+func (f houseField) value(h *House, status string) reflect.Value {
+	if f.name == "status" {
+		return reflect.ValueOf(status)
+	}
+	return reflect.ValueOf(h).Elem().Field(f.index)
+}
+
+// compileFilter 校验并编译过滤树；usesStatus 表示树中引用了 status 字段
+func compileFilter(f *HouseFilter, path string) (m houseMatcher, usesStatus bool, err error) {
+	if f == nil {
+		return nil, false, fmt.Errorf("%s: 条件不能为空", path)
+	}
+	kinds := 0
+	for _, set := range []bool{f.And != nil, f.Or != nil, f.Not != nil, f.Field != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return nil, false, fmt.Errorf("%s: 节点须且只能包含 and、or、not、field 之一", path)
+	}
+
+	switch {
+	case f.And != nil || f.Or != nil:
+		children, name := f.And, "and"
+		if f.Or != nil {
+			children, name = f.Or, "or"
+		}
+		if len(children) == 0 {
+			return nil, false, fmt.Errorf("%s.%s: 至少需要一个条件", path, name)
+		}
+		matchers := make([]houseMatcher, len(children))
+		for i, c := range children {
+			cm, cs, err := compileFilter(c, fmt.Sprintf("%s.%s[%d]", path, name, i))
+			if err != nil {
+				return nil, false, err
+			}
+			matchers[i] = cm
+			usesStatus = usesStatus || cs
+		}
+		if name == "and" {
+			return func(h *House, status string) bool {
+				for _, cm := range matchers {
+					if !cm(h, status) {
+						return false
+					}
+				}
+				return true
+			}, usesStatus, nil
+		}
+		return func(h *House, status string) bool {
+			for _, cm := range matchers {
+				if cm(h, status) {
+					return true
+				}
+			}
+			return false
+		}, usesStatus, nil
+	case f.Not != nil:
+		cm, cs, err := compileFilter(f.Not, path+".not")
+		if err != nil {
+			return nil, false, err
+		}
+		return func(h *House, status string) bool { return !cm(h, status) }, cs, nil
+	}
+
+	field, ok := houseFieldByName(f.Field)
+	if !ok {
+		return nil, false, fmt.Errorf("%s: 未知字段 %q", path, f.Field)
+	}
+	m, err = compileClause(f, field)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %s %s: %w", path, f.Field, f.Op, err)
+	}
+	return m, field.name == "status", nil
+}
+
+// compileClause 编译单个字段条件
+func compileClause(f *HouseFilter, field houseField) (houseMatcher, error) {
+	switch f.Op {
+	case FilterOpExists:
+		return func(h *House, status string) bool {
+			v := field.value(h, status)
+			if field.kind == reflect.Slice {
+				return v.Len() > 0
+			}
+			return !v.IsZero()
+		}, nil
+
+	case FilterOpEq, FilterOpIn:
+		raw := f.Values
+		if f.Op == FilterOpEq {
+			if f.Value == nil {
+				return nil, fmt.Errorf("缺少 value")
+			}
+			raw = []interface{}{f.Value}
+		} else if len(raw) == 0 {
+			return nil, fmt.Errorf("values 不能为空")
+		}
+		set := make(map[interface{}]bool, len(raw))
+		for _, v := range raw {
+			key, err := scalarKey(field, v)
+			if err != nil {
+				return nil, err
+			}
+			set[key] = true
+		}
+		return func(h *House, status string) bool {
+			v := field.value(h, status)
+			if field.kind == reflect.Slice {
+				for i := 0; i < v.Len(); i++ {
+					if set[v.Index(i).String()] {
+						return true
+					}
+				}
+				return false
+			}
+			return set[valueKey(v)]
+		}, nil
+
+	case FilterOpContains:
+		sub, ok := f.Value.(string)
+		if !ok || sub == "" {
+			return nil, fmt.Errorf("value 须为非空字符串")
+		}
+		switch field.kind {
+		case reflect.String:
+			return func(h *House, status string) bool {
+				return strings.Contains(field.value(h, status).String(), sub)
+			}, nil
+		case reflect.Slice:
+			return func(h *House, status string) bool {
+				v := field.value(h, status)
+				for i := 0; i < v.Len(); i++ {
+					if v.Index(i).String() == sub {
+						return true
+					}
+				}
+				return false
+			}, nil
+		}
+		return nil, fmt.Errorf("仅适用于字符串或列表字段")
+
+	case FilterOpRange:
+		if f.Min == nil && f.Max == nil {
+			return nil, fmt.Errorf("min、max 至少提供一个")
+		}
+		switch field.kind {
+		case reflect.Int, reflect.Float64:
+			min, max, err := numericBounds(f.Min, f.Max)
+			if err != nil {
+				return nil, err
+			}
+			return func(h *House, status string) bool {
+				n := toFloat(field.value(h, status))
+				return (min == nil || n >= *min) && (max == nil || n <= *max)
+			}, nil
+		case reflect.String:
+			min, minOK := f.Min.(string)
+			max, maxOK := f.Max.(string)
+			if (f.Min != nil && !minOK) || (f.Max != nil && !maxOK) {
+				return nil, fmt.Errorf("字符串字段的 min、max 须为字符串")
+			}
+			return func(h *House, status string) bool {
+				s := field.value(h, status).String()
+				return (f.Min == nil || s >= min) && (f.Max == nil || s <= max)
+			}, nil
+		}
+		return nil, fmt.Errorf("仅适用于数值或字符串字段")
+	}
+	return nil, fmt.Errorf("未知运算符（可选 %s、%s、%s、%s、%s）", FilterOpEq, FilterOpIn, FilterOpRange, FilterOpContains, FilterOpExists)
+}
+
+// scalarKey 将 JSON 值转换为与字段类型一致的比较键
+func scalarKey(field houseField, v interface{}) (interface{}, error) {
+	switch field.kind {
+	case reflect.String, reflect.Slice:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("值 %v 须为字符串", v)
+		}
+		return s, nil
+	case reflect.Int, reflect.Float64:
+		n, err := toNumber(v)
+		if err != nil {
+			return nil, err
+		}
+		return n, nil
+	case reflect.Bool:
+		switch b := v.(type) {
+		case bool:
+			return b, nil
+		case string:
+			if parsed, err := strconv.ParseBool(b); err == nil {
+				return parsed, nil
+			}
+		}
+		return nil, fmt.Errorf("值 %v 须为布尔值", v)
+	}
+	return nil, fmt.Errorf("不支持的字段类型")
+}
+
+// valueKey 字段值的比较键，与 scalarKey 对应
+func valueKey(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Int, reflect.Float64:
+		return toFloat(v)
+	case reflect.Bool:
+		return v.Bool()
+	default:
+		return v.String()
+	}
+}
+
+func toFloat(v reflect.Value) float64 {
+	if v.Kind() == reflect.Int {
+		return float64(v.Int())
+	}
+	return v.Float()
+}
+
+// toNumber 接受 JSON 数值或数字字符串
+func toNumber(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case int:
+		return float64(n), nil
+	case string:
+		if f, err := strconv.ParseFloat(n, 64); err == nil {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("值 %v 须为数值", v)
+}
+
+func numericBounds(minV, maxV interface{}) (min, max *float64, err error) {
+	if minV != nil {
+		n, err := toNumber(minV)
+		if err != nil {
+			return nil, nil, err
+		}
+		min = &n
+	}
+	if maxV != nil {
+		n, err := toNumber(maxV)
+		if err != nil {
+			return nil, nil, err
+		}
+		max = &n
+	}
+	return min, max, nil
+}
+
+// compileSort 校验排序键并返回比较函数；最后按 house_id 升序
+func compileSort(keys []HouseSort) (func(a, b *House) bool, error) {
+	type sortKey struct {
+		field houseField
+		desc  bool
+	}
+	compiled := make([]sortKey, 0, len(keys))
+	for i, k := range keys {
+		field, ok := houseFieldByName(k.Field)
+		if !ok || field.kind == reflect.Slice {
+			return nil, fmt.Errorf("sort[%d]: 不可排序的字段 %q", i, k.Field)
+		}
+		switch k.Order {
+		case "", "asc", "desc":
+		default:
+			return nil, fmt.Errorf("sort[%d]: order 须为 asc 或 desc", i)
+		}
+		compiled = append(compiled, sortKey{field: field, desc: k.Order == "desc"})
+	}
+	return func(a, b *House) bool {
+		for _, k := range compiled {
+			c := compareValues(k.field.value(a, a.Status), k.field.value(b, b.Status))
+			if c == 0 {
+				continue
+			}
+			if k.desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return a.HouseID < b.HouseID
+	}, nil
+}
+
+func compareValues(a, b reflect.Value) int {
+	switch a.Kind() {
+	case reflect.Int, reflect.Float64:
+		x, y := toFloat(a), toFloat(b)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case reflect.Bool:
+		x, y := a.Bool(), b.Bool()
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		}
+		return 1
+	default:
+		return strings.Compare(a.String(), b.String())
+	}
+}
+
+// Search 按布尔过滤树搜索房源，返回当前页与总数；userID 非空时按该用户视角下的有效状态过滤与展示。
+// 过滤树未引用 status 时只返回可租房源（与 Query 一致）
+func (hm *HouseManager) Search(search *HouseSearch, userID string) ([]*House, int, error) {
+	var match houseMatcher
+	usesStatus := false
+	if search.Filter != nil {
+		var err error
+		match, usesStatus, err = compileFilter(search.Filter, "filter")
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	less, err := compileSort(search.Sort)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hm.mu.RLock()
+	overrides := hm.userOverrides(userID)
+	var results []*House
+	for _, house := range hm.lookup.all {
+		effStatus := statusWith(house, overrides)
+		if !usesStatus && effStatus != string(HouseStatusAvailable) {
+			continue
+		}
+		if match != nil && !match(house, effStatus) {
+			continue
+		}
+		copy := *house
+		copy.Status = effStatus
+		results = append(results, &copy)
+	}
+	hm.mu.RUnlock()
+
+	sort.Slice(results, func(i, j int) bool { return less(results[i], results[j]) })
+
+	page, pageSize := search.Page, search.PageSize
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	total := len(results)
+	// 先按页数判断是否越界，避免 (page-1)*pageSize 溢出为负数
+	if page-1 > total/pageSize {
+		return []*House{}, total, nil
+	}
+	start := (page - 1) * pageSize
+	if start >= total {
+		return []*House{}, total, nil
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+	return results[start:end], total, nil
+}
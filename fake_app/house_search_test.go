@@ -0,0 +1,33 @@
+package fake_app
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSearchPageOutOfRange(t *testing.T) {
+	hm := loadBenchManagers(t)[0].hm
+	_, total, err := hm.Search(&HouseSearch{PageSize: 20}, benchUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastPage := (total + 19) / 20
+
+	for _, page := range []int{lastPage + 1, math.MaxInt / 20, math.MaxInt/20 + 2, math.MaxInt} {
+		houses, gotTotal, err := hm.Search(&HouseSearch{Page: page, PageSize: 20}, benchUser)
+		if err != nil {
+			t.Fatalf("page=%d: %v", page, err)
+		}
+		if len(houses) != 0 || gotTotal != total {
+			t.Errorf("page=%d 应返回空页: len=%d total=%d", page, len(houses), gotTotal)
+		}
+	}
+
+	houses, _, err := hm.Search(&HouseSearch{Page: lastPage, PageSize: 20}, benchUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := total - (lastPage-1)*20; len(houses) != want {
+		t.Errorf("最后一页 %d 条, 期望 %d", len(houses), want)
+	}
+}
@@ -87,10 +87,14 @@ type LandmarkWithDistance struct {
 
 // LandmarkManager 地标数据管理器
 type LandmarkManager struct {
-	dataDir   string               // 数据目录路径
-	landmarks map[string]*Landmark // 内存中的地标缓存，key为ID
-	byName    map[string]string    // 名称到ID的索引，key为名称，value为ID
-	mu        sync.RWMutex         // 读写锁
+	dataDir    string               // 数据目录路径
+	landmarks  map[string]*Landmark // 内存中的地标缓存，key为ID
+	byName     map[string]string    // 名称到ID的索引，key为名称，value为ID
+	geoPoints  []*Landmark          // 按ID排序的地标，下标与 geo 中的点对应
+	geo        *geoGrid             // 经纬度网格索引，随数据加载重建
+	subway     *subwayGraph         // 地铁线网图，随数据加载重建
+	subwayOpts SubwayOptions        // 线网图的路线估算参数
+	mu         sync.RWMutex         // 读写锁
 }
 
 // NewLandmarkManager 创建新的地标管理器，启动时将所有地标数据加载到内存
@@ -101,9 +105,10 @@ func NewLandmarkManager(dataDir string) (*LandmarkManager, error) {
 	}
 
 	lm := &LandmarkManager{
-		dataDir:   dataDir,
-		landmarks: make(map[string]*Landmark),
-		byName:    make(map[string]string),
+		dataDir:    dataDir,
+		landmarks:  make(map[string]*Landmark),
+		byName:     make(map[string]string),
+		subwayOpts: DefaultSubwayOptions(),
 	}
 
 	// 从磁盘加载所有地标数据到内存
@@ -126,9 +131,23 @@ func (lm *LandmarkManager) loadAllData() error {
 	if err := lm.loadLandmarks(); err != nil {
 		return fmt.Errorf("加载地标数据失败: %w", err)
 	}
+	lm.buildGeoIndex()
+	lm.buildSubwayGraph()
 	return nil
 }
 
+// buildGeoIndex 为全部地标建立经纬度网格索引
+func (lm *LandmarkManager) buildGeoIndex() {
+	lm.geoPoints = make([]*Landmark, 0, len(lm.landmarks))
+	for _, landmark := range lm.landmarks {
+		lm.geoPoints = append(lm.geoPoints, landmark)
+	}
+	sort.Slice(lm.geoPoints, func(i, j int) bool { return lm.geoPoints[i].ID < lm.geoPoints[j].ID })
+	lm.geo = newGeoGrid(len(lm.geoPoints), func(i int) (float64, float64, bool) {
+		return lm.geoPoints[i].Latitude, lm.geoPoints[i].Longitude, hasCoord(lm.geoPoints[i].Latitude, lm.geoPoints[i].Longitude)
+	})
+}
+
 // loadJSON 加载JSON文件
 func (lm *LandmarkManager) loadJSON(filename string) (map[string]interface{}, error) {
 	filepath := filepath.Join(lm.dataDir, filename)
@@ -294,35 +313,87 @@ func (lm *LandmarkManager) loadLandmarks() error {
 // FindLandmarksNearPoint 查询某点周边某类地标，距离不超过 maxDistanceM 米，按距离排序
 // typeFilter 为空则不过滤类型；否则只保留 RawData["type"] == typeFilter 的 CategoryLandmark（如 shopping、park）
 func (lm *LandmarkManager) FindLandmarksNearPoint(lat, lng, maxDistanceM float64, typeFilter string) []*LandmarkWithDistance {
+	return lm.FindWithinRadius(lat, lng, maxDistanceM, LandmarkGeoFilter{Category: CategoryLandmark, Type: typeFilter})
+}
+
+// LandmarkGeoFilter 地标空间查询的筛选条件，字段为空表示不限
+type LandmarkGeoFilter struct {
+	Category LandmarkCategory // subway/company/landmark
+	Type     string           // RawData["type"]：商圈地标为 shopping/park 等，地铁站为 normal/transfer
+}
+
+// matches 地标是否满足筛选条件
+func (f LandmarkGeoFilter) matches(landmark *Landmark) bool {
+	if f.Category != "" && landmark.Category != f.Category {
+		return false
+	}
+	if f.Type != "" {
+		typ, _ := landmark.RawData["type"].(string)
+		return typ == f.Type
+	}
+	return true
+}
+
+// FindWithinRadius 查询距 (lat, lng) 不超过 radiusM 米的地标，按距离升序（基于网格空间索引）
+func (lm *LandmarkManager) FindWithinRadius(lat, lng, radiusM float64, filter LandmarkGeoFilter) []*LandmarkWithDistance {
 	lm.mu.RLock()
 	defer lm.mu.RUnlock()
 
-	var results []*LandmarkWithDistance
-	for _, landmark := range lm.landmarks {
-		if landmark.Category != CategoryLandmark {
-			continue
-		}
-		if typeFilter != "" {
-			typ, _ := landmark.RawData["type"].(string)
-			if typ != typeFilter {
-				continue
-			}
-		}
-		dist := calcDistance(landmark.Latitude, landmark.Longitude, lat, lng)
-		if dist <= maxDistanceM {
-			results = append(results, &LandmarkWithDistance{
-				Landmark: *landmark,
-				Distance: dist,
-			})
-		}
+	return lm.withDistance(lm.geo.radius(lat, lng, radiusM, lm.geoFilter(filter)))
+}
+
+// FindInBounds 查询经纬度矩形内的地标，按ID排序
+func (lm *LandmarkManager) FindInBounds(minLat, minLng, maxLat, maxLng float64, filter LandmarkGeoFilter) []*Landmark {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	indexes := lm.geo.bbox(minLat, minLng, maxLat, maxLng, lm.geoFilter(filter))
+	results := make([]*Landmark, 0, len(indexes))
+	for _, i := range indexes {
+		copy := *lm.geoPoints[i]
+		results = append(results, &copy)
+	}
+	return results
+}
+
+// FindNearest 查询距 (lat, lng) 最近的 k 个地标，按距离升序；maxDistanceM > 0 时只在该半径内查找
+func (lm *LandmarkManager) FindNearest(lat, lng float64, k int, maxDistanceM float64, filter LandmarkGeoFilter) []*LandmarkWithDistance {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	return lm.withDistance(lm.geo.nearest(lat, lng, k, maxDistanceM, lm.geoFilter(filter)))
+}
+
+// geoFilter 将筛选条件转换为空间索引的过滤函数
+func (lm *LandmarkManager) geoFilter(filter LandmarkGeoFilter) func(i int) bool {
+	if filter == (LandmarkGeoFilter{}) {
+		return nil
+	}
+	return func(i int) bool { return filter.matches(lm.geoPoints[i]) }
+}
+
+// withDistance 将空间查询命中转换为带距离的地标副本
+func (lm *LandmarkManager) withDistance(hits []geoHit) []*LandmarkWithDistance {
+	results := make([]*LandmarkWithDistance, 0, len(hits))
+	for _, hit := range hits {
+		results = append(results, &LandmarkWithDistance{
+			Landmark: *lm.geoPoints[hit.index],
+			Distance: hit.distance,
+		})
 	}
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].Distance < results[j].Distance
-	})
 	return results
 }
 
-// GetByName 根据名称查询地标（精确匹配）
+// LandmarkMatch 地标模糊匹配结果
+type LandmarkMatch struct {
+	Landmark    Landmark `json:"landmark"`
+	Score       float64  `json:"score"`        // 匹配分数 0~1
+	MatchType   string   `json:"match_type"`   // exact/substring/pinyin/initials/fuzzy
+	MatchedName string   `json:"matched_name"` // 命中的名称：名称、企业简称/英文名或地铁线路
+}
+
+// GetByName 根据名称查询地标：先精确匹配名称（企业含简称、英文名）；
+// 未命中时按 MatchByName 模糊匹配，最高分候选足够可信时返回该地标，否则返回 nil
 func (lm *LandmarkManager) GetByName(name string) *Landmark {
 	lm.mu.RLock()
 	defer lm.mu.RUnlock()
@@ -334,62 +405,86 @@ func (lm *LandmarkManager) GetByName(name string) *Landmark {
 			return &copy
 		}
 	}
+	if matches := lm.matchByName(name, 5, false); acceptBest(landmarkCandidates(matches)) {
+		return &matches[0].Landmark
+	}
 	return nil
 }
 
-// SearchByKeyword 根据关键词搜索地标（模糊匹配）
-func (lm *LandmarkManager) SearchByKeyword(keyword string) []*Landmark {
+// MatchByName 按拼音、简拼、同音字、编辑距离模糊匹配地标名称（企业含简称、英文名），
+// 返回按分数降序的候选（最多 limit 个，<=0 不限），用于名称有误时让用户确认
+func (lm *LandmarkManager) MatchByName(query string, limit int) []*LandmarkMatch {
 	lm.mu.RLock()
 	defer lm.mu.RUnlock()
+	return lm.matchByName(query, limit, false)
+}
 
-	var results []*Landmark
-	keywordLower := strings.ToLower(keyword)
+// SearchByKeyword 根据关键词搜索地标（模糊匹配），按匹配分数降序返回。
+// 匹配名称、企业简称与英文名（含拼音、同音字、错别字容错），地铁站还匹配线路名
+func (lm *LandmarkManager) SearchByKeyword(keyword string) []*LandmarkMatch {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+	return lm.matchByName(keyword, 0, true)
+}
 
-	for _, landmark := range lm.landmarks {
-		// 检查名称
-		if strings.Contains(strings.ToLower(landmark.Name), keywordLower) {
-			copy := *landmark
-			results = append(results, &copy)
-			continue
+// matchByName 对每个地标取各名称中的最高分；withLines 时地铁站线路名包含关键词也算命中。调用方须持有 lm.mu 读锁
+func (lm *LandmarkManager) matchByName(query string, limit int, withLines bool) []*LandmarkMatch {
+	best := make(map[string]*LandmarkMatch)
+	consider := func(id, name string, score float64, typ string) {
+		if m, ok := best[id]; !ok || score > m.Score {
+			best[id] = &LandmarkMatch{Score: score, MatchType: typ, MatchedName: name}
+		}
+	}
+	for name, id := range lm.byName {
+		if score, typ := nameScore(query, name); score > 0 {
+			consider(id, name, score, typ)
 		}
+	}
 
-		// 针对企业，检查简称和英文名
-		if landmark.Category == CategoryCompany {
-			if shortName, ok := landmark.RawData["short_name"].(string); ok {
-				if strings.Contains(strings.ToLower(shortName), keywordLower) {
-					copy := *landmark
-					results = append(results, &copy)
-					continue
-				}
+	// 针对地铁站，检查线路名
+	if keywordLower := strings.ToLower(strings.TrimSpace(query)); withLines && keywordLower != "" {
+		for id, landmark := range lm.landmarks {
+			if landmark.Category != CategorySubway {
+				continue
 			}
-			if nameEN, ok := landmark.RawData["name_en"].(string); ok {
-				if strings.Contains(strings.ToLower(nameEN), keywordLower) {
-					copy := *landmark
-					results = append(results, &copy)
-					continue
+			lines, _ := landmark.RawData["lines"].([]interface{})
+			for _, line := range lines {
+				if lineStr, ok := line.(string); ok && strings.Contains(strings.ToLower(lineStr), keywordLower) {
+					consider(id, lineStr, 0.7, MatchSubstring)
+					break
 				}
 			}
 		}
+	}
 
-		// 针对地铁站，检查线路名
-		if landmark.Category == CategorySubway {
-			if lines, ok := landmark.RawData["lines"].([]interface{}); ok {
-				for _, line := range lines {
-					if lineStr, ok := line.(string); ok {
-						if strings.Contains(strings.ToLower(lineStr), keywordLower) {
-							copy := *landmark
-							results = append(results, &copy)
-							break
-						}
-					}
-				}
-			}
+	cands := make([]nameCandidate, 0, len(best))
+	for id, m := range best {
+		cands = append(cands, nameCandidate{key: id, score: m.Score, typ: m.MatchType})
+	}
+	cands = rankCandidates(cands, limit)
+	results := make([]*LandmarkMatch, 0, len(cands))
+	for _, c := range cands {
+		landmark, ok := lm.landmarks[c.key]
+		if !ok {
+			continue
 		}
+		m := best[c.key]
+		m.Landmark = *landmark
+		m.Score = roundScore(m.Score)
+		results = append(results, m)
 	}
-
 	return results
 }
 
+// landmarkCandidates 转换为候选列表，供 acceptBest 判断
+func landmarkCandidates(matches []*LandmarkMatch) []nameCandidate {
+	cands := make([]nameCandidate, len(matches))
+	for i, m := range matches {
+		cands[i] = nameCandidate{key: m.Landmark.ID, score: m.Score}
+	}
+	return cands
+}
+
 // GetAll 获取全部地标信息
 func (lm *LandmarkManager) GetAll() []*Landmark {
 	lm.mu.RLock()
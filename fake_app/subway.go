@@ -0,0 +1,543 @@
+package fake_app
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// SubwayOptions 地铁路线估算参数，零值字段取默认值
+type SubwayOptions struct {
+	SpeedKmh          float64 `json:"speed_kmh"`          // 列车平均运行速度（公里/小时），默认 35
+	HopMinutes        float64 `json:"hop_minutes"`        // 每经过一站的附加时间（停靠、起步，分钟），默认 2
+	TransferMinutes   float64 `json:"transfer_minutes"`   // 站内换乘时间（分钟），默认 5
+	WalkSpeed         float64 `json:"walk_speed"`         // 步行速度（米/分钟），默认 80，步行距离按直线距离乘城市道路系数估算
+	MaxWalkM          float64 `json:"max_walk_m"`         // 起终点到地铁站的最大直线距离（米），默认 3000
+	StationCandidates int     `json:"station_candidates"` // 起终点各考虑的最近地铁站数，默认 3
+}
+
+// DefaultSubwayOptions 默认地铁路线估算参数
+func DefaultSubwayOptions() SubwayOptions {
+	return SubwayOptions{
+		SpeedKmh:          35,
+		HopMinutes:        2,
+		TransferMinutes:   5,
+		WalkSpeed:         80,
+		MaxWalkM:          3000,
+		StationCandidates: 3,
+	}
+}
+
+// withDefaults 零值字段取默认值
+func (o SubwayOptions) withDefaults() SubwayOptions {
+	def := DefaultSubwayOptions()
+	if o.SpeedKmh <= 0 {
+		o.SpeedKmh = def.SpeedKmh
+	}
+	if o.HopMinutes < 0 {
+		o.HopMinutes = 0
+	} else if o.HopMinutes == 0 {
+		o.HopMinutes = def.HopMinutes
+	}
+	if o.TransferMinutes < 0 {
+		o.TransferMinutes = 0
+	} else if o.TransferMinutes == 0 {
+		o.TransferMinutes = def.TransferMinutes
+	}
+	if o.WalkSpeed <= 0 {
+		o.WalkSpeed = def.WalkSpeed
+	}
+	if o.MaxWalkM <= 0 {
+		o.MaxWalkM = def.MaxWalkM
+	}
+	if o.StationCandidates <= 0 {
+		o.StationCandidates = def.StationCandidates
+	}
+	return o
+}
+
+// 路线分段方式
+const (
+	RouteModeWalk   = "walk"
+	RouteModeSubway = "subway"
+)
+
+// RouteLeg 路线中的一段：步行，或乘坐某条线路经过若干站
+type RouteLeg struct {
+	Mode      string   `json:"mode"`               // walk/subway
+	Line      string   `json:"line,omitempty"`     // 乘坐的线路，步行为空
+	From      string   `json:"from"`               // 起点名称
+	To        string   `json:"to"`                 // 终点名称
+	Stations  []string `json:"stations,omitempty"` // 乘车经过的站（含上下车站）
+	DistanceM int      `json:"distance_m"`         // 步行为估算步行距离，乘车为站间直线距离之和
+	Minutes   float64  `json:"minutes"`            // 本段耗时（分钟）
+}
+
+// RouteTransfer 一次换乘
+type RouteTransfer struct {
+	Station  string `json:"station"`
+	FromLine string `json:"from_line"`
+	ToLine   string `json:"to_line"`
+}
+
+// SubwayRoute 两点间的地铁（或纯步行）路线估算结果
+type SubwayRoute struct {
+	Legs         []RouteLeg      `json:"legs"`
+	Transfers    []RouteTransfer `json:"transfers"`
+	FromStation  string          `json:"from_station,omitempty"` // 上车站，纯步行时为空
+	ToStation    string          `json:"to_station,omitempty"`   // 下车站，纯步行时为空
+	WalkMinutes  float64         `json:"walk_minutes"`
+	RideMinutes  float64         `json:"ride_minutes"` // 乘车与换乘耗时
+	TotalMinutes int             `json:"total_minutes"`
+}
+
+// subwayEdge 同一线路上相邻两站之间的边
+type subwayEdge struct {
+	to       int
+	line     string
+	distance float64 // 直线距离（米）
+}
+
+// subwayStation 图中的站点；同名站（数据中重复的站）合并为一个
+type subwayStation struct {
+	name     string
+	lat, lng float64
+	lines    []string
+	edges    []subwayEdge
+}
+
+// subwayGraph 由地铁站数据构建的线网图，加载数据时构建，之后只读。
+// 站点数据不含线路上的站序，同一线路的站按直线距离连成最小生成树作为近似的线路走向
+type subwayGraph struct {
+	stations []*subwayStation
+	byName   map[string]int
+	opts     SubwayOptions
+}
+
+// newSubwayGraph 由地铁站地标构建线网图
+func newSubwayGraph(landmarks []*Landmark, opts SubwayOptions) *subwayGraph {
+	g := &subwayGraph{byName: make(map[string]int), opts: opts.withDefaults()}
+	sorted := make([]*Landmark, 0, len(landmarks))
+	for _, l := range landmarks {
+		if l.Category == CategorySubway && hasCoord(l.Latitude, l.Longitude) {
+			sorted = append(sorted, l)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	byLine := make(map[string][]int)
+	for _, l := range sorted {
+		idx, ok := g.byName[l.Name]
+		if !ok {
+			idx = len(g.stations)
+			g.byName[l.Name] = idx
+			g.stations = append(g.stations, &subwayStation{name: l.Name, lat: l.Latitude, lng: l.Longitude})
+		}
+		st := g.stations[idx]
+		lines, _ := l.RawData["lines"].([]interface{})
+		for _, v := range lines {
+			line, _ := v.(string)
+			if line == "" || containsString(st.lines, line) {
+				continue
+			}
+			st.lines = append(st.lines, line)
+			byLine[line] = append(byLine[line], idx)
+		}
+	}
+	for line, members := range byLine {
+		g.connectLine(line, members)
+	}
+	return g
+}
+
+// connectLine 用 Prim 算法把同一线路的站按直线距离连成最小生成树
+func (g *subwayGraph) connectLine(line string, members []int) {
+	if len(members) < 2 {
+		return
+	}
+	inTree := make([]bool, len(members))
+	best := make([]float64, len(members))
+	parent := make([]int, len(members))
+	for i := range best {
+		best[i] = math.Inf(1)
+		parent[i] = -1
+	}
+	best[0] = 0
+	for range members {
+		u := -1
+		for i := range members {
+			if !inTree[i] && (u < 0 || best[i] < best[u]) {
+				u = i
+			}
+		}
+		inTree[u] = true
+		if parent[u] >= 0 {
+			a, b := members[parent[u]], members[u]
+			g.stations[a].edges = append(g.stations[a].edges, subwayEdge{to: b, line: line, distance: best[u]})
+			g.stations[b].edges = append(g.stations[b].edges, subwayEdge{to: a, line: line, distance: best[u]})
+		}
+		su := g.stations[members[u]]
+		for i := range members {
+			if inTree[i] {
+				continue
+			}
+			si := g.stations[members[i]]
+			if d := calcDistance(su.lat, su.lng, si.lat, si.lng); d < best[i] {
+				best[i], parent[i] = d, u
+			}
+		}
+	}
+}
+
+// hopMinutes 相邻两站间的乘车时间
+func (g *subwayGraph) hopMinutes(distance float64) float64 {
+	return distance/(g.opts.SpeedKmh*1000/60) + g.opts.HopMinutes
+}
+
+// walk 两点间的估算步行距离（米）与时间（分钟）
+func (g *subwayGraph) walk(lat1, lng1, lat2, lng2 float64) (float64, float64) {
+	d := estimateWalkingDistance(calcDistance(lat1, lng1, lat2, lng2))
+	return d, d / g.opts.WalkSpeed
+}
+
+// routeState Dijkstra 状态：在某站、处于某条线路上（line 为空表示刚步行进站，尚未上车）
+type routeState struct {
+	station int
+	line    string
+}
+
+type routeItem struct {
+	state   routeState
+	minutes float64
+}
+
+type routeQueue []routeItem
+
+func (q routeQueue) Len() int            { return len(q) }
+func (q routeQueue) Less(i, j int) bool  { return q[i].minutes < q[j].minutes }
+func (q routeQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *routeQueue) Push(x interface{}) { *q = append(*q, x.(routeItem)) }
+func (q *routeQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// stationAccess 起终点到某站的步行接驳
+type stationAccess struct {
+	station   int
+	distanceM float64
+	minutes   float64
+}
+
+// nearestStations 距 (lat, lng) 最近的若干个站（直线距离不超过 MaxWalkM）
+func (g *subwayGraph) nearestStations(lat, lng float64) []stationAccess {
+	var out []stationAccess
+	for i, st := range g.stations {
+		if calcDistance(lat, lng, st.lat, st.lng) > g.opts.MaxWalkM {
+			continue
+		}
+		d, m := g.walk(lat, lng, st.lat, st.lng)
+		out = append(out, stationAccess{station: i, distanceM: d, minutes: m})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].minutes != out[j].minutes {
+			return out[i].minutes < out[j].minutes
+		}
+		return out[i].station < out[j].station
+	})
+	if len(out) > g.opts.StationCandidates {
+		out = out[:g.opts.StationCandidates]
+	}
+	return out
+}
+
+// search 从 origins 出发按耗时递增遍历（站点, 线路）状态（Dijkstra），每确定一个状态调用 visit，
+// visit 返回 true 时提前结束。返回各状态的前驱，用于回溯路线
+func (g *subwayGraph) search(origins []stationAccess, visit func(s routeState, minutes float64) bool) map[routeState]routeState {
+	dist := make(map[routeState]float64)
+	prev := make(map[routeState]routeState)
+	q := &routeQueue{}
+	for _, o := range origins {
+		s := routeState{station: o.station}
+		if cur, ok := dist[s]; !ok || o.minutes < cur {
+			dist[s] = o.minutes
+			heap.Push(q, routeItem{state: s, minutes: o.minutes})
+		}
+	}
+
+	for q.Len() > 0 {
+		item := heap.Pop(q).(routeItem)
+		s := item.state
+		if item.minutes > dist[s] {
+			continue
+		}
+		if visit(s, item.minutes) {
+			break
+		}
+		relax := func(next routeState, cost float64) {
+			if cur, ok := dist[next]; !ok || item.minutes+cost < cur {
+				dist[next] = item.minutes + cost
+				prev[next] = s
+				heap.Push(q, routeItem{state: next, minutes: item.minutes + cost})
+			}
+		}
+		for _, e := range g.stations[s.station].edges {
+			switch {
+			case s.line == "" || s.line == e.line:
+				relax(routeState{station: e.to, line: e.line}, g.hopMinutes(e.distance))
+			default:
+				// 在本站换乘到 e.line，再乘一站
+				relax(routeState{station: s.station, line: e.line}, g.opts.TransferMinutes)
+			}
+		}
+	}
+	return prev
+}
+
+// route 计算从 origins 进站、到 dests 出站的最短耗时路线；乘车与换乘按线网图估算。
+// 起点侧接驳时间计入初始耗时，终点侧在出站时加上；无可达路线时返回 nil
+func (g *subwayGraph) route(origins, dests []stationAccess) (*SubwayRoute, float64) {
+	destWalk := make(map[int]stationAccess, len(dests))
+	for _, d := range dests {
+		destWalk[d.station] = d
+	}
+	entry := make(map[int]stationAccess, len(origins))
+	for _, o := range origins {
+		if cur, ok := entry[o.station]; !ok || o.minutes < cur.minutes {
+			entry[o.station] = o
+		}
+	}
+
+	var bestEnd routeState
+	bestTotal := math.Inf(1)
+	prev := g.search(origins, func(s routeState, minutes float64) bool {
+		if minutes >= bestTotal {
+			return true
+		}
+		if d, ok := destWalk[s.station]; ok && minutes+d.minutes < bestTotal {
+			bestTotal, bestEnd = minutes+d.minutes, s
+		}
+		return false
+	})
+	if math.IsInf(bestTotal, 1) {
+		return nil, bestTotal
+	}
+
+	// 回溯状态序列
+	var path []routeState
+	for s := bestEnd; ; {
+		path = append(path, s)
+		p, ok := prev[s]
+		if !ok {
+			break
+		}
+		s = p
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return g.buildRoute(path, entry[path[0].station], destWalk[bestEnd.station]), bestTotal
+}
+
+// buildRoute 将状态序列整理为分段路线（不含起终点步行段的名称，由调用方补全）
+func (g *subwayGraph) buildRoute(path []routeState, in, out stationAccess) *SubwayRoute {
+	r := &SubwayRoute{Transfers: []RouteTransfer{}}
+	r.FromStation = g.stations[path[0].station].name
+	r.ToStation = g.stations[path[len(path)-1].station].name
+	r.Legs = append(r.Legs, RouteLeg{Mode: RouteModeWalk, To: r.FromStation, DistanceM: int(in.distanceM), Minutes: roundMinutes(in.minutes)})
+	r.WalkMinutes = in.minutes + out.minutes
+
+	var leg *RouteLeg
+	for i := 1; i < len(path); i++ {
+		from, to := path[i-1], path[i]
+		if from.station == to.station {
+			// 换乘
+			r.Transfers = append(r.Transfers, RouteTransfer{Station: g.stations[to.station].name, FromLine: from.line, ToLine: to.line})
+			r.RideMinutes += g.opts.TransferMinutes
+			leg = nil
+			continue
+		}
+		a, b := g.stations[from.station], g.stations[to.station]
+		d := calcDistance(a.lat, a.lng, b.lat, b.lng)
+		if leg == nil {
+			r.Legs = append(r.Legs, RouteLeg{Mode: RouteModeSubway, Line: to.line, From: a.name, Stations: []string{a.name}})
+			leg = &r.Legs[len(r.Legs)-1]
+		}
+		leg.To = b.name
+		leg.Stations = append(leg.Stations, b.name)
+		leg.DistanceM += int(d)
+		leg.Minutes += g.hopMinutes(d)
+		r.RideMinutes += g.hopMinutes(d)
+	}
+	for i := range r.Legs {
+		r.Legs[i].Minutes = roundMinutes(r.Legs[i].Minutes)
+	}
+	r.Legs = append(r.Legs, RouteLeg{Mode: RouteModeWalk, From: r.ToStation, DistanceM: int(out.distanceM), Minutes: roundMinutes(out.minutes)})
+	return r
+}
+
+// plan 估算两点间路线：起终点各取最近的若干个站步行接驳，乘车部分走线网图；
+// 纯步行更快或附近无站时返回纯步行路线
+func (g *subwayGraph) plan(fromName string, fromLat, fromLng float64, toName string, toLat, toLng float64) *SubwayRoute {
+	walkDist, walkMin := g.walk(fromLat, fromLng, toLat, toLng)
+	best := &SubwayRoute{
+		Legs:        []RouteLeg{{Mode: RouteModeWalk, From: fromName, To: toName, DistanceM: int(walkDist), Minutes: roundMinutes(walkMin)}},
+		Transfers:   []RouteTransfer{},
+		WalkMinutes: walkMin,
+	}
+	bestTotal := walkMin
+
+	if r, total := g.route(g.nearestStations(fromLat, fromLng), g.nearestStations(toLat, toLng)); r != nil && total < bestTotal {
+		r.Legs[0].From = fromName
+		r.Legs[len(r.Legs)-1].To = toName
+		best, bestTotal = r, total
+	}
+	best.WalkMinutes = roundMinutes(best.WalkMinutes)
+	best.RideMinutes = roundMinutes(best.RideMinutes)
+	best.TotalMinutes = int(math.Ceil(bestTotal - 1e-9))
+	return best
+}
+
+// CommuteEstimator 到固定目的地的通勤时间估算器：预先求出各地铁站到目的地的最短耗时（含出站步行），
+// 之后每个起点只需加上步行到附近站的时间，结果与 PlanRoute 的总耗时一致。创建后只读，可并发使用
+type CommuteEstimator struct {
+	graph            *subwayGraph
+	destLat, destLng float64
+	stationMinutes   map[int]float64 // 站点 -> 从该站上车到目的地的最短耗时
+}
+
+// newCommuteEstimator 从目的地附近的站反向遍历线网图；线网图为无向图且换乘对称，反向耗时即正向耗时
+func (g *subwayGraph) newCommuteEstimator(lat, lng float64) *CommuteEstimator {
+	e := &CommuteEstimator{graph: g, destLat: lat, destLng: lng, stationMinutes: make(map[int]float64)}
+	g.search(g.nearestStations(lat, lng), func(s routeState, minutes float64) bool {
+		if cur, ok := e.stationMinutes[s.station]; !ok || minutes < cur {
+			e.stationMinutes[s.station] = minutes
+		}
+		return false
+	})
+	return e
+}
+
+// Estimate 从 (lat, lng) 到目的地的通勤分钟数与上车站；纯步行更快或附近无可达站时 station 为空
+func (e *CommuteEstimator) Estimate(lat, lng float64) (minutes int, station string) {
+	_, best := e.graph.walk(lat, lng, e.destLat, e.destLng)
+	for _, a := range e.graph.nearestStations(lat, lng) {
+		if m, ok := e.stationMinutes[a.station]; ok && a.minutes+m < best {
+			best, station = a.minutes+m, e.graph.stations[a.station].name
+		}
+	}
+	return int(math.Ceil(best - 1e-9)), station
+}
+
+// roundMinutes 分钟数保留一位小数
+func roundMinutes(m float64) float64 {
+	return math.Round(m*10) / 10
+}
+
+// SubwayLineStations 线网图中某条线路的站点（按站名排序）与相邻站连接，用于查看推断出的线路走向
+type SubwayLineStations struct {
+	Line     string      `json:"line"`
+	Stations []string    `json:"stations"`
+	Links    [][2]string `json:"links"`
+}
+
+// SetSubwayOptions 设置地铁路线估算参数并重建线网图；零值字段取默认值
+func (lm *LandmarkManager) SetSubwayOptions(opts SubwayOptions) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.subwayOpts = opts.withDefaults()
+	lm.buildSubwayGraph()
+}
+
+// SubwayOptions 当前的地铁路线估算参数
+func (lm *LandmarkManager) SubwayOptions() SubwayOptions {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+	return lm.subwayOpts
+}
+
+// buildSubwayGraph 由已加载的地铁站重建线网图。调用方须持有 lm.mu 写锁
+func (lm *LandmarkManager) buildSubwayGraph() {
+	lm.subway = newSubwayGraph(lm.geoPoints, lm.subwayOpts)
+}
+
+// PlanRoute 估算两点间的通勤路线：步行到附近地铁站、乘车（含换乘）、出站步行到终点，
+// 纯步行更快时只返回一段步行。fromName、toName 仅用于展示
+func (lm *LandmarkManager) PlanRoute(fromName string, fromLat, fromLng float64, toName string, toLat, toLng float64) *SubwayRoute {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+	return lm.subway.plan(fromName, fromLat, fromLng, toName, toLat, toLng)
+}
+
+// CommuteEstimator 创建到 (lat, lng) 的通勤时间估算器，用于批量计算多个起点的通勤时间
+func (lm *LandmarkManager) CommuteEstimator(lat, lng float64) *CommuteEstimator {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+	return lm.subway.newCommuteEstimator(lat, lng)
+}
+
+// commuteEstimatorCurrent 估算器是否基于当前的线网图（Reload、SetSubwayOptions 后失效）
+func (lm *LandmarkManager) commuteEstimatorCurrent(e *CommuteEstimator) bool {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+	return e.graph == lm.subway
+}
+
+// PlanStationRoute 估算两个地铁站之间的乘车路线（不含步行接驳），站名须与地铁站数据一致
+func (lm *LandmarkManager) PlanStationRoute(from, to string) (*SubwayRoute, error) {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	g := lm.subway
+	a, ok := g.byName[from]
+	if !ok {
+		return nil, fmt.Errorf("未找到地铁站: %s", from)
+	}
+	b, ok := g.byName[to]
+	if !ok {
+		return nil, fmt.Errorf("未找到地铁站: %s", to)
+	}
+	r, total := g.route([]stationAccess{{station: a}}, []stationAccess{{station: b}})
+	if r == nil {
+		return nil, fmt.Errorf("%s 与 %s 之间没有可达的地铁线路", from, to)
+	}
+	// 去掉两端零长度的步行段
+	r.Legs = r.Legs[1 : len(r.Legs)-1]
+	r.RideMinutes = roundMinutes(r.RideMinutes)
+	r.TotalMinutes = int(math.Ceil(total - 1e-9))
+	return r, nil
+}
+
+// SubwayLines 线网图中的全部线路，按线路名排序
+func (lm *LandmarkManager) SubwayLines() []SubwayLineStations {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	g := lm.subway
+	byLine := make(map[string]*SubwayLineStations)
+	for i, st := range g.stations {
+		for _, line := range st.lines {
+			sl, ok := byLine[line]
+			if !ok {
+				sl = &SubwayLineStations{Line: line, Stations: []string{}, Links: [][2]string{}}
+				byLine[line] = sl
+			}
+			sl.Stations = append(sl.Stations, st.name)
+		}
+		for _, e := range st.edges {
+			if e.to > i {
+				byLine[e.line].Links = append(byLine[e.line].Links, [2]string{st.name, g.stations[e.to].name})
+			}
+		}
+	}
+	out := make([]SubwayLineStations, 0, len(byLine))
+	for _, sl := range byLine {
+		sort.Strings(sl.Stations)
+		out = append(out, *sl)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Line < out[j].Line })
+	return out
+}
@@ -26,6 +26,60 @@ type AnthropicMessageRequest struct {
 	TopP        *float32               `json:"top_p,omitempty"`
 }
 
+// UnmarshalJSON 兼容 system 为字符串或文本块数组（如带 cache_control 的 [{"type":"text","text":"..."}]），
+// 块数组按顺序拼接各 text 为 System
+func (r *AnthropicMessageRequest) UnmarshalJSON(data []byte) error {
+	type plain AnthropicMessageRequest
+	aux := struct {
+		*plain
+		System json.RawMessage `json:"system,omitempty"`
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	r.System = ""
+	if len(aux.System) == 0 || string(aux.System) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(aux.System, &r.System); err == nil {
+		return nil
+	}
+	var blocks []AnthropicContentBlock
+	if err := json.Unmarshal(aux.System, &blocks); err != nil {
+		return fmt.Errorf("system 须为字符串或文本块数组: %w", err)
+	}
+	var sb strings.Builder
+	for _, b := range blocks {
+		if b.Type == "text" {
+			if sb.Len() > 0 {
+				sb.WriteString("\n\n")
+			}
+			sb.WriteString(b.Text)
+		}
+	}
+	r.System = sb.String()
+	return nil
+}
+
+// AnthropicMessageOffsets 返回每条 Anthropic 消息转换后在 ConvertAnthropicToOpenAIRequest 消息列表中的起始下标，
+// 末尾再追加消息总数；用于把 OpenAI 侧插入消息的位置映射回原始请求体
+func AnthropicMessageOffsets(anthropicReq *AnthropicMessageRequest) ([]int, error) {
+	offsets := make([]int, 0, len(anthropicReq.Messages)+1)
+	pos := 0
+	if anthropicReq.System != "" {
+		pos = 1
+	}
+	for _, msg := range anthropicReq.Messages {
+		offsets = append(offsets, pos)
+		converted, err := convertAnthropicMessageToOpenAI(msg)
+		if err != nil {
+			return nil, fmt.Errorf("转换消息失败: %w", err)
+		}
+		pos += len(converted)
+	}
+	return append(offsets, pos), nil
+}
+
 // AnthropicMessage Anthropic 消息格式
 type AnthropicMessage struct {
 	Role    string                   `json:"role"`
@@ -324,7 +378,7 @@ func ConvertOpenAIToAnthropicResponse(openaiResp *openai.ChatCompletionResponse,
 	}
 
 	// 转换 stop_reason
-	stopReason := convertOpenAIStopReason(string(choice.FinishReason))
+	stopReason := ConvertOpenAIStopReason(string(choice.FinishReason))
 
 	return &AnthropicMessageResponse{
 		ID:         openaiResp.ID,
@@ -340,8 +394,8 @@ func ConvertOpenAIToAnthropicResponse(openaiResp *openai.ChatCompletionResponse,
 	}
 }
 
-// convertOpenAIStopReason 转换停止原因
-func convertOpenAIStopReason(reason string) string {
+// ConvertOpenAIStopReason 将 OpenAI finish_reason 转换为 Anthropic stop_reason
+func ConvertOpenAIStopReason(reason string) string {
 	switch reason {
 	case "stop":
 		return "end_turn"
@@ -423,6 +477,25 @@ func (w *AnthropicStreamWriter) SendContentBlockStart(blockType string) error {
 	return w.WriteEvent("content_block_start", data)
 }
 
+// SendToolUseBlockStart 发送 tool_use 内容块开始（携带上游的工具调用 ID 与函数名）
+func (w *AnthropicStreamWriter) SendToolUseBlockStart(id, name string) error {
+	if id == "" {
+		id = tools.GenerateToolCallID()
+	}
+	event := map[string]interface{}{
+		"type":  "content_block_start",
+		"index": w.index,
+		"content_block": map[string]interface{}{
+			"type":  "tool_use",
+			"id":    id,
+			"name":  name,
+			"input": map[string]interface{}{},
+		},
+	}
+	data, _ := json.Marshal(event)
+	return w.WriteEvent("content_block_start", data)
+}
+
 // SendContentBlockDelta 发送内容增量
 func (w *AnthropicStreamWriter) SendContentBlockDelta(delta map[string]interface{}) error {
 	event := map[string]interface{}{
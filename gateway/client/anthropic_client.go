@@ -8,6 +8,9 @@ import (
 	"io"
 	"net/http"
 	"strings"
+
+	"ocProxy/gateway/internal/logger"
+	"ocProxy/gateway/internal/telemetry"
 )
 
 // AnthropicClient Anthropic 协议客户端（原生转发）
@@ -25,7 +28,8 @@ func NewAnthropicClient(baseURL, apiKey, modelID string) *AnthropicClient {
 		baseURL: baseURL,
 		apiKey:  apiKey,
 		httpClient: &http.Client{
-			Timeout: 0, // 不设置超时，让流式请求可以持续
+			Timeout:   0,                           // 不设置超时，让流式请求可以持续
+			Transport: telemetry.NewTransport(nil), // 记录上游请求 span 并注入 traceparent
 		},
 	}
 }
@@ -44,16 +48,21 @@ func (c *AnthropicClient) Messages(ctx context.Context, requestBody []byte) (*ht
 	httpReq.Header.Set("anthropic-version", "2023-06-01")
 	httpReq.Header.Set("User-Agent", "ClaudeCode/0.1.0")
 	
+	call := logger.TraceFromContext(ctx).StartUpstream(url, requestBody)
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
+		call.End(0, err)
 		return nil, fmt.Errorf("HTTP 请求失败: %w", err)
 	}
 	
 	if resp.StatusCode >= 400 {
 		bodyBytes, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("API 错误 %d: %s", resp.StatusCode, string(bodyBytes))
+		err := fmt.Errorf("API 错误 %d: %s", resp.StatusCode, string(bodyBytes))
+		call.End(resp.StatusCode, err)
+		return nil, err
 	}
+	call.End(resp.StatusCode, nil)
 	
 	return resp, nil
 }
@@ -74,13 +83,8 @@ func (c *AnthropicClient) MessagesStream(ctx context.Context, requestBody []byte
 	
 	url := strings.TrimRight(c.baseURL, "/") + "/messages"
 	
-	// 流式请求使用 background context 避免被取消
-	reqCtx := ctx
-	if _, ok := ctx.Deadline(); ok {
-		reqCtx = context.Background()
-	}
-	
-	httpReq, err := http.NewRequestWithContext(reqCtx, http.MethodPost, url, bytes.NewReader(modifiedBody))
+	// 流式请求同样绑定 ctx，客户端断开时上游请求随之取消
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(modifiedBody))
 	if err != nil {
 		return nil, fmt.Errorf("创建 HTTP 请求失败: %w", err)
 	}
@@ -93,16 +97,21 @@ func (c *AnthropicClient) MessagesStream(ctx context.Context, requestBody []byte
 	httpReq.Header.Set("Cache-Control", "no-cache")
 	httpReq.Header.Set("Connection", "keep-alive")
 	
+	call := logger.TraceFromContext(ctx).StartUpstream(url, modifiedBody)
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
+		call.End(0, err)
 		return nil, fmt.Errorf("HTTP 请求失败: %w", err)
 	}
 	
 	if resp.StatusCode >= 400 {
 		bodyBytes, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("API 错误 %d: %s", resp.StatusCode, string(bodyBytes))
+		err := fmt.Errorf("API 错误 %d: %s", resp.StatusCode, string(bodyBytes))
+		call.End(resp.StatusCode, err)
+		return nil, err
 	}
+	call.End(resp.StatusCode, nil)
 	
 	return resp, nil
 }
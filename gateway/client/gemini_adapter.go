@@ -0,0 +1,576 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"ocProxy/tools"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// GeminiRequest generateContent 请求格式
+type GeminiRequest struct {
+	Contents          []GeminiContent         `json:"contents"`
+	SystemInstruction *GeminiContent          `json:"systemInstruction,omitempty"`
+	Tools             []GeminiTool            `json:"tools,omitempty"`
+	ToolConfig        *GeminiToolConfig       `json:"toolConfig,omitempty"`
+	GenerationConfig  *GeminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+// GeminiContent 一轮对话内容，role 为 user 或 model
+type GeminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []GeminiPart `json:"parts"`
+}
+
+// GeminiPart 内容片段（文本、图片、函数调用或函数结果）
+type GeminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	InlineData       *GeminiBlob             `json:"inlineData,omitempty"`
+	FileData         *GeminiFileData         `json:"fileData,omitempty"`
+	FunctionCall     *GeminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *GeminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+// GeminiBlob 内联的 base64 数据（data: URL 图片）
+type GeminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+// GeminiFileData 按 URI 引用的文件（http(s) 图片）
+type GeminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+// GeminiFunctionCall 模型发起的函数调用
+type GeminiFunctionCall struct {
+	Name string                 `json:"name"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// GeminiFunctionResponse 函数执行结果
+type GeminiFunctionResponse struct {
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
+}
+
+// GeminiTool 工具定义
+type GeminiTool struct {
+	FunctionDeclarations []GeminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+// GeminiFunctionDeclaration 函数声明
+type GeminiFunctionDeclaration struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  interface{} `json:"parameters,omitempty"`
+}
+
+// GeminiToolConfig 工具调用配置
+type GeminiToolConfig struct {
+	FunctionCallingConfig GeminiFunctionCallingConfig `json:"functionCallingConfig"`
+}
+
+// GeminiFunctionCallingConfig 函数调用模式：AUTO / ANY / NONE
+type GeminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+// GeminiGenerationConfig 生成参数
+type GeminiGenerationConfig struct {
+	Temperature      *float32 `json:"temperature,omitempty"`
+	TopP             *float32 `json:"topP,omitempty"`
+	MaxOutputTokens  int      `json:"maxOutputTokens,omitempty"`
+	StopSequences    []string `json:"stopSequences,omitempty"`
+	ResponseMimeType string   `json:"responseMimeType,omitempty"`
+}
+
+// GeminiResponse generateContent 响应（流式时每个 SSE 事件也是该结构）
+type GeminiResponse struct {
+	Candidates    []GeminiCandidate    `json:"candidates"`
+	UsageMetadata *GeminiUsageMetadata `json:"usageMetadata,omitempty"`
+	ModelVersion  string               `json:"modelVersion,omitempty"`
+	ResponseID    string               `json:"responseId,omitempty"`
+}
+
+// GeminiCandidate 候选结果
+type GeminiCandidate struct {
+	Content      GeminiContent `json:"content"`
+	FinishReason string        `json:"finishReason,omitempty"`
+	Index        int           `json:"index"`
+}
+
+// GeminiUsageMetadata 用量统计
+type GeminiUsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+// geminiUnsupportedSchemaKeys Gemini functionDeclarations 不接受的 JSON Schema 字段
+var geminiUnsupportedSchemaKeys = []string{"$schema", "additionalProperties", "$id", "$ref", "definitions"}
+
+// --- OpenAI 转 Gemini 请求 ---
+
+// ConvertOpenAIToGeminiRequest 将 OpenAI 请求转换为 Gemini generateContent 请求
+func ConvertOpenAIToGeminiRequest(req openai.ChatCompletionRequest) *GeminiRequest {
+	geminiReq := &GeminiRequest{}
+
+	// tool_call_id -> 函数名，tool 消息转换为 functionResponse 时需要函数名
+	toolNames := make(map[string]string)
+
+	var systemParts []GeminiPart
+	for _, msg := range req.Messages {
+		switch msg.Role {
+		case openai.ChatMessageRoleSystem:
+			if text := messageText(msg); text != "" {
+				systemParts = append(systemParts, GeminiPart{Text: text})
+			}
+
+		case openai.ChatMessageRoleAssistant:
+			content := GeminiContent{Role: "model"}
+			if text := messageText(msg); text != "" {
+				content.Parts = append(content.Parts, GeminiPart{Text: text})
+			}
+			for _, tc := range msg.ToolCalls {
+				toolNames[tc.ID] = tc.Function.Name
+				var args map[string]interface{}
+				if tc.Function.Arguments != "" {
+					json.Unmarshal([]byte(tc.Function.Arguments), &args)
+				}
+				content.Parts = append(content.Parts, GeminiPart{
+					FunctionCall: &GeminiFunctionCall{Name: tc.Function.Name, Args: args},
+				})
+			}
+			if len(content.Parts) > 0 {
+				geminiReq.Contents = appendGeminiContent(geminiReq.Contents, content)
+			}
+
+		case openai.ChatMessageRoleTool:
+			name := toolNames[msg.ToolCallID]
+			if name == "" {
+				name = msg.Name
+			}
+			part := GeminiPart{
+				FunctionResponse: &GeminiFunctionResponse{
+					Name:     name,
+					Response: toolResultObject(msg.Content),
+				},
+			}
+			geminiReq.Contents = appendGeminiContent(geminiReq.Contents, GeminiContent{Role: "user", Parts: []GeminiPart{part}})
+
+		default:
+			if parts := geminiUserParts(msg); len(parts) > 0 {
+				geminiReq.Contents = appendGeminiContent(geminiReq.Contents, GeminiContent{Role: "user", Parts: parts})
+			}
+		}
+	}
+	if len(systemParts) > 0 {
+		geminiReq.SystemInstruction = &GeminiContent{Parts: systemParts}
+	}
+
+	// 转换 tools
+	if len(req.Tools) > 0 {
+		var decls []GeminiFunctionDeclaration
+		for _, tool := range req.Tools {
+			if tool.Type != openai.ToolTypeFunction || tool.Function == nil {
+				continue
+			}
+			decls = append(decls, GeminiFunctionDeclaration{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				Parameters:  sanitizeGeminiSchema(tool.Function.Parameters),
+			})
+		}
+		if len(decls) > 0 {
+			geminiReq.Tools = []GeminiTool{{FunctionDeclarations: decls}}
+		}
+	}
+	if req.ToolChoice != nil && len(geminiReq.Tools) > 0 {
+		geminiReq.ToolConfig = convertToolChoiceToGemini(req.ToolChoice)
+	}
+
+	// 生成参数
+	genCfg := &GeminiGenerationConfig{
+		MaxOutputTokens: req.MaxTokens,
+		StopSequences:   req.Stop,
+	}
+	if req.Temperature > 0 {
+		temp := req.Temperature
+		genCfg.Temperature = &temp
+	}
+	if req.TopP > 0 {
+		topP := req.TopP
+		genCfg.TopP = &topP
+	}
+	if req.ResponseFormat != nil && req.ResponseFormat.Type == openai.ChatCompletionResponseFormatTypeJSONObject {
+		genCfg.ResponseMimeType = "application/json"
+	}
+	geminiReq.GenerationConfig = genCfg
+
+	return geminiReq
+}
+
+// appendGeminiContent 追加内容；与上一条 role 相同时合并 parts（Gemini 要求 user/model 交替）
+func appendGeminiContent(contents []GeminiContent, c GeminiContent) []GeminiContent {
+	if n := len(contents); n > 0 && contents[n-1].Role == c.Role {
+		contents[n-1].Parts = append(contents[n-1].Parts, c.Parts...)
+		return contents
+	}
+	return append(contents, c)
+}
+
+// messageText 取消息的文本内容（兼容 MultiContent）
+func messageText(msg openai.ChatCompletionMessage) string {
+	if msg.Content != "" || len(msg.MultiContent) == 0 {
+		return msg.Content
+	}
+	var sb strings.Builder
+	for _, part := range msg.MultiContent {
+		if part.Type == openai.ChatMessagePartTypeText {
+			sb.WriteString(part.Text)
+		}
+	}
+	return sb.String()
+}
+
+// geminiUserParts 用户消息的内容片段：文本与图片按原顺序转换，data: URL 图片内联，其余按 fileUri 引用
+func geminiUserParts(msg openai.ChatCompletionMessage) []GeminiPart {
+	if len(msg.MultiContent) == 0 {
+		if msg.Content == "" {
+			return nil
+		}
+		return []GeminiPart{{Text: msg.Content}}
+	}
+	var parts []GeminiPart
+	for _, part := range msg.MultiContent {
+		switch part.Type {
+		case openai.ChatMessagePartTypeText:
+			if part.Text != "" {
+				parts = append(parts, GeminiPart{Text: part.Text})
+			}
+		case openai.ChatMessagePartTypeImageURL:
+			if part.ImageURL == nil || part.ImageURL.URL == "" {
+				continue
+			}
+			if mimeType, data, ok := parseDataURL(part.ImageURL.URL); ok {
+				parts = append(parts, GeminiPart{InlineData: &GeminiBlob{MimeType: mimeType, Data: data}})
+			} else {
+				parts = append(parts, GeminiPart{FileData: &GeminiFileData{
+					MimeType: mime.TypeByExtension(path.Ext(strings.SplitN(part.ImageURL.URL, "?", 2)[0])),
+					FileURI:  part.ImageURL.URL,
+				}})
+			}
+		}
+	}
+	return parts
+}
+
+// parseDataURL 解析 data:<mime>;base64,<data>
+func parseDataURL(url string) (mimeType, data string, ok bool) {
+	if !strings.HasPrefix(url, "data:") {
+		return "", "", false
+	}
+	meta, data, found := strings.Cut(strings.TrimPrefix(url, "data:"), ";base64,")
+	if !found || data == "" {
+		return "", "", false
+	}
+	if meta == "" {
+		meta = "application/octet-stream"
+	}
+	return meta, data, true
+}
+
+// toolResultObject 将工具结果转为 functionResponse.response 对象：JSON 对象直接使用，否则包装为 {"content": ...}
+func toolResultObject(content string) map[string]interface{} {
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &obj); err == nil && obj != nil {
+		return obj
+	}
+	return map[string]interface{}{"content": content}
+}
+
+// sanitizeGeminiSchema 去掉 Gemini 不支持的 JSON Schema 字段（递归），返回新对象
+func sanitizeGeminiSchema(schema interface{}) interface{} {
+	if schema == nil {
+		return nil
+	}
+	// 非 map 类型（如 jsonschema.Definition）先经 JSON 转为通用结构
+	if _, ok := schema.(map[string]interface{}); !ok {
+		data, err := json.Marshal(schema)
+		if err != nil {
+			return schema
+		}
+		var generic interface{}
+		if err := json.Unmarshal(data, &generic); err != nil {
+			return schema
+		}
+		schema = generic
+	}
+	switch v := schema.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			skip := false
+			for _, bad := range geminiUnsupportedSchemaKeys {
+				if k == bad {
+					skip = true
+					break
+				}
+			}
+			if !skip {
+				out[k] = sanitizeGeminiSchema(val)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, val := range v {
+			out[i] = sanitizeGeminiSchema(val)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// convertToolChoiceToGemini 转换 tool_choice：none -> NONE，required -> ANY，指定函数 -> ANY + allowedFunctionNames
+func convertToolChoiceToGemini(choice interface{}) *GeminiToolConfig {
+	cfg := &GeminiToolConfig{FunctionCallingConfig: GeminiFunctionCallingConfig{Mode: "AUTO"}}
+	switch c := choice.(type) {
+	case string:
+		switch c {
+		case "none":
+			cfg.FunctionCallingConfig.Mode = "NONE"
+		case "required", "any":
+			cfg.FunctionCallingConfig.Mode = "ANY"
+		}
+	case map[string]interface{}:
+		if fn, ok := c["function"].(map[string]interface{}); ok {
+			if name, ok := fn["name"].(string); ok && name != "" {
+				cfg.FunctionCallingConfig.Mode = "ANY"
+				cfg.FunctionCallingConfig.AllowedFunctionNames = []string{name}
+			}
+		}
+	case openai.ToolChoice:
+		if c.Function.Name != "" {
+			cfg.FunctionCallingConfig.Mode = "ANY"
+			cfg.FunctionCallingConfig.AllowedFunctionNames = []string{c.Function.Name}
+		}
+	}
+	return cfg
+}
+
+// --- Gemini 转 OpenAI 响应 ---
+
+// ConvertGeminiToOpenAIResponse 将 Gemini 响应转换为 OpenAI 响应
+func ConvertGeminiToOpenAIResponse(geminiResp *GeminiResponse, model string) *openai.ChatCompletionResponse {
+	id := geminiResp.ResponseID
+	if id == "" {
+		id = tools.GenerateMessageID()
+	}
+	resp := &openai.ChatCompletionResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+	}
+	if geminiResp.UsageMetadata != nil {
+		resp.Usage = openai.Usage{
+			PromptTokens:     geminiResp.UsageMetadata.PromptTokenCount,
+			CompletionTokens: geminiResp.UsageMetadata.CandidatesTokenCount,
+			TotalTokens:      geminiResp.UsageMetadata.TotalTokenCount,
+		}
+	}
+	if len(geminiResp.Candidates) == 0 {
+		return resp
+	}
+
+	candidate := geminiResp.Candidates[0]
+	var content strings.Builder
+	var toolCalls []openai.ToolCall
+	for _, part := range candidate.Content.Parts {
+		if part.Text != "" {
+			content.WriteString(part.Text)
+		}
+		if part.FunctionCall != nil {
+			toolCalls = append(toolCalls, openai.ToolCall{
+				ID:   tools.GenerateToolCallID(),
+				Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      part.FunctionCall.Name,
+					Arguments: geminiArgsString(part.FunctionCall.Args),
+				},
+			})
+		}
+	}
+
+	resp.Choices = []openai.ChatCompletionChoice{
+		{
+			Message: openai.ChatCompletionMessage{
+				Role:      openai.ChatMessageRoleAssistant,
+				Content:   content.String(),
+				ToolCalls: toolCalls,
+			},
+			FinishReason: convertGeminiFinishReason(candidate.FinishReason, len(toolCalls) > 0),
+		},
+	}
+	return resp
+}
+
+// geminiArgsString 函数参数序列化为 JSON 字符串，空参数为 {}
+func geminiArgsString(args map[string]interface{}) string {
+	if len(args) == 0 {
+		return "{}"
+	}
+	return tools.MarshalToString(args)
+}
+
+// convertGeminiFinishReason 转换停止原因；存在函数调用时为 tool_calls
+func convertGeminiFinishReason(reason string, hasToolCalls bool) openai.FinishReason {
+	if hasToolCalls {
+		return openai.FinishReasonToolCalls
+	}
+	switch reason {
+	case "STOP":
+		return openai.FinishReasonStop
+	case "MAX_TOKENS":
+		return openai.FinishReasonLength
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return openai.FinishReasonContentFilter
+	case "":
+		return ""
+	default:
+		return openai.FinishReasonStop
+	}
+}
+
+// --- Gemini 流转 OpenAI 流 ---
+
+// NewGeminiStreamToOpenAI 将 Gemini streamGenerateContent 的 SSE 响应转换为 OpenAI chat.completion.chunk SSE 流。
+// 返回的 *http.Response 的 Body 输出 OpenAI 格式的 data: 行并以 data: [DONE] 结束，可直接交给 OpenAI 流的转发逻辑。
+func NewGeminiStreamToOpenAI(geminiResp *http.Response, model string) *http.Response {
+	pr, pw := io.Pipe()
+	go func() {
+		defer geminiResp.Body.Close()
+		pw.CloseWithError(convertGeminiStream(geminiResp.Body, pw, model))
+	}()
+
+	converted := *geminiResp
+	converted.Header = geminiResp.Header.Clone()
+	converted.Header.Set("Content-Type", "text/event-stream")
+	converted.Body = pr
+	return &converted
+}
+
+// convertGeminiStream 逐个读取 Gemini SSE 事件并写出 OpenAI chunk
+func convertGeminiStream(src io.Reader, dst io.Writer, model string) error {
+	reader := bufio.NewReader(src)
+	messageID := tools.GenerateMessageID()
+	created := time.Now().Unix()
+	toolCallIndex := 0
+	roleSent := false
+	sawToolCall := false
+
+	writeChunk := func(delta map[string]interface{}, finishReason interface{}, usage *GeminiUsageMetadata) error {
+		chunk := map[string]interface{}{
+			"id":      messageID,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   model,
+			"choices": []map[string]interface{}{
+				{
+					"index":         0,
+					"delta":         delta,
+					"finish_reason": finishReason,
+				},
+			},
+		}
+		if usage != nil {
+			chunk["usage"] = map[string]int{
+				"prompt_tokens":     usage.PromptTokenCount,
+				"completion_tokens": usage.CandidatesTokenCount,
+				"total_tokens":      usage.TotalTokenCount,
+			}
+		}
+		data, _ := json.Marshal(chunk)
+		_, err := fmt.Fprintf(dst, "data: %s\n\n", data)
+		return err
+	}
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			line = bytes.TrimSpace(line)
+			if bytes.HasPrefix(line, []byte("data:")) {
+				data := bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+				var event GeminiResponse
+				if jsonErr := json.Unmarshal(data, &event); jsonErr != nil {
+					log.Printf("[Gemini流] JSON解析失败: %v, 数据: %s", jsonErr, string(data))
+				} else if len(event.Candidates) > 0 {
+					candidate := event.Candidates[0]
+					if !roleSent {
+						if werr := writeChunk(map[string]interface{}{"role": "assistant"}, nil, nil); werr != nil {
+							return werr
+						}
+						roleSent = true
+					}
+					for _, part := range candidate.Content.Parts {
+						if part.Text != "" {
+							if werr := writeChunk(map[string]interface{}{"content": part.Text}, nil, nil); werr != nil {
+								return werr
+							}
+						}
+						if part.FunctionCall != nil {
+							sawToolCall = true
+							delta := map[string]interface{}{
+								"tool_calls": []map[string]interface{}{
+									{
+										"index": toolCallIndex,
+										"id":    tools.GenerateToolCallID(),
+										"type":  "function",
+										"function": map[string]interface{}{
+											"name":      part.FunctionCall.Name,
+											"arguments": geminiArgsString(part.FunctionCall.Args),
+										},
+									},
+								},
+							}
+							if werr := writeChunk(delta, nil, nil); werr != nil {
+								return werr
+							}
+							toolCallIndex++
+						}
+					}
+					if candidate.FinishReason != "" {
+						finish := convertGeminiFinishReason(candidate.FinishReason, sawToolCall)
+						if werr := writeChunk(map[string]interface{}{}, string(finish), event.UsageMetadata); werr != nil {
+							return werr
+						}
+					}
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(dst, "data: [DONE]\n\n")
+	return err
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"ocProxy/gateway/internal/logger"
+	"ocProxy/gateway/internal/telemetry"
+)
+
+// GeminiClient Google Gemini generateContent 协议客户端
+type GeminiClient struct {
+	model      string
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// NewGeminiClient 创建新的 Gemini 客户端；baseURL 形如 https://generativelanguage.googleapis.com/v1beta
+func NewGeminiClient(baseURL, apiKey, modelID string) *GeminiClient {
+	return &GeminiClient{
+		model:   modelID,
+		baseURL: baseURL,
+		apiKey:  apiKey,
+		httpClient: &http.Client{
+			Timeout:   0,                           // 不设置超时，让流式请求可以持续
+			Transport: telemetry.NewTransport(nil), // 记录上游请求 span 并注入 traceparent
+		},
+	}
+}
+
+// Model 返回上游模型 ID
+func (c *GeminiClient) Model() string {
+	return c.model
+}
+
+// endpoint 拼接 models/{model}:{method} 地址
+func (c *GeminiClient) endpoint(model, method string) string {
+	if model == "" {
+		model = c.model
+	}
+	model = strings.TrimPrefix(model, "models/")
+	return fmt.Sprintf("%s/models/%s:%s", strings.TrimRight(c.baseURL, "/"), url.PathEscape(model), method)
+}
+
+// doRequest 发起 POST 请求并检查状态码
+func (c *GeminiClient) doRequest(ctx context.Context, url string, body []byte, stream bool) (*http.Response, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建 HTTP 请求失败: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-goog-api-key", c.apiKey)
+	if stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+		httpReq.Header.Set("Cache-Control", "no-cache")
+	}
+
+	call := logger.TraceFromContext(ctx).StartUpstream(url, body)
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		call.End(0, err)
+		return nil, fmt.Errorf("HTTP 请求失败: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		err := fmt.Errorf("API 错误 %d: %s", resp.StatusCode, string(bodyBytes))
+		call.End(resp.StatusCode, err)
+		return nil, err
+	}
+	call.End(resp.StatusCode, nil)
+	return resp, nil
+}
+
+// GenerateContent 发送 models/{model}:generateContent 请求（非流式）
+func (c *GeminiClient) GenerateContent(ctx context.Context, model string, requestBody []byte) (*http.Response, error) {
+	return c.doRequest(ctx, c.endpoint(model, "generateContent"), requestBody, false)
+}
+
+// StreamGenerateContent 发送 models/{model}:streamGenerateContent?alt=sse 请求（流式，SSE）
+func (c *GeminiClient) StreamGenerateContent(ctx context.Context, model string, requestBody []byte) (*http.Response, error) {
+	return c.doRequest(ctx, c.endpoint(model, "streamGenerateContent")+"?alt=sse", requestBody, true)
+}
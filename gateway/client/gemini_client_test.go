@@ -0,0 +1,289 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// geminiStub 记录收到的请求并返回固定响应的 Gemini 替身服务
+type geminiStub struct {
+	path   string
+	query  string
+	apiKey string
+	body   GeminiRequest
+}
+
+func newGeminiStub(t *testing.T, contentType, response string) (*geminiStub, *httptest.Server) {
+	t.Helper()
+	stub := &geminiStub{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.path = r.URL.Path
+		stub.query = r.URL.RawQuery
+		stub.apiKey = r.Header.Get("x-goog-api-key")
+		if err := json.NewDecoder(r.Body).Decode(&stub.body); err != nil {
+			t.Errorf("解析请求体失败: %v", err)
+		}
+		w.Header().Set("Content-Type", contentType)
+		io.WriteString(w, response)
+	}))
+	t.Cleanup(srv.Close)
+	return stub, srv
+}
+
+func TestGeminiRequestConversion(t *testing.T) {
+	stub, srv := newGeminiStub(t, "application/json", `{"candidates":[]}`)
+	c := NewGeminiClient(srv.URL+"/v1beta/", "test-key", "gemini-test")
+
+	req := openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "你是租房助手"},
+			{Role: openai.ChatMessageRoleSystem, Content: "回答简洁"},
+			{Role: openai.ChatMessageRoleUser, MultiContent: []openai.ChatMessagePart{
+				{Type: openai.ChatMessagePartTypeText, Text: "这两套哪个好？"},
+				{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "data:image/png;base64,iVBORw0KGgo="}},
+				{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "https://example.com/house.jpg?size=large"}},
+			}},
+			{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{
+				ID:       "call_1",
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: "get_house", Arguments: `{"house_id":"HF_2001"}`},
+			}}},
+			{Role: openai.ChatMessageRoleTool, ToolCallID: "call_1", Content: "月租 5000"},
+			{Role: openai.ChatMessageRoleUser, Content: "还有别的吗"},
+		},
+		Tools: []openai.Tool{{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        "get_house",
+				Description: "查询房源",
+				Parameters: map[string]interface{}{
+					"$schema":              "http://json-schema.org/draft-07/schema#",
+					"type":                 "object",
+					"additionalProperties": false,
+					"properties": map[string]interface{}{
+						"house_id": map[string]interface{}{"type": "string"},
+					},
+				},
+			},
+		}},
+		ToolChoice:  "required",
+		Temperature: 0.3,
+		MaxTokens:   256,
+	}
+	body, err := json.Marshal(ConvertOpenAIToGeminiRequest(req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.GenerateContent(context.Background(), "models/gemini-pro", body)
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	resp.Body.Close()
+
+	if stub.path != "/v1beta/models/gemini-pro:generateContent" {
+		t.Errorf("path = %s", stub.path)
+	}
+	if stub.apiKey != "test-key" {
+		t.Errorf("x-goog-api-key = %q", stub.apiKey)
+	}
+
+	got := stub.body
+	if got.SystemInstruction == nil || len(got.SystemInstruction.Parts) != 2 ||
+		got.SystemInstruction.Parts[0].Text != "你是租房助手" || got.SystemInstruction.Parts[1].Text != "回答简洁" {
+		t.Errorf("systemInstruction = %+v", got.SystemInstruction)
+	}
+
+	// user（文本+图片）/ model（函数调用）/ user（函数结果+文本，同 role 合并）
+	if len(got.Contents) != 3 {
+		t.Fatalf("contents 数量 = %d, 期望 3: %+v", len(got.Contents), got.Contents)
+	}
+	user := got.Contents[0]
+	if user.Role != "user" || len(user.Parts) != 3 || user.Parts[0].Text != "这两套哪个好？" {
+		t.Fatalf("首条 user 内容 = %+v", user)
+	}
+	if blob := user.Parts[1].InlineData; blob == nil || blob.MimeType != "image/png" || blob.Data != "iVBORw0KGgo=" {
+		t.Errorf("inlineData = %+v", user.Parts[1].InlineData)
+	}
+	if file := user.Parts[2].FileData; file == nil || file.MimeType != "image/jpeg" || file.FileURI != "https://example.com/house.jpg?size=large" {
+		t.Errorf("fileData = %+v", user.Parts[2].FileData)
+	}
+	model := got.Contents[1]
+	if model.Role != "model" || len(model.Parts) != 1 || model.Parts[0].FunctionCall == nil ||
+		model.Parts[0].FunctionCall.Name != "get_house" || model.Parts[0].FunctionCall.Args["house_id"] != "HF_2001" {
+		t.Errorf("model 内容 = %+v", model)
+	}
+	last := got.Contents[2]
+	if last.Role != "user" || len(last.Parts) != 2 {
+		t.Fatalf("末条 user 内容 = %+v", last)
+	}
+	if fr := last.Parts[0].FunctionResponse; fr == nil || fr.Name != "get_house" || fr.Response["content"] != "月租 5000" {
+		t.Errorf("functionResponse = %+v", last.Parts[0].FunctionResponse)
+	}
+	if last.Parts[1].Text != "还有别的吗" {
+		t.Errorf("末条文本 = %q", last.Parts[1].Text)
+	}
+
+	if len(got.Tools) != 1 || len(got.Tools[0].FunctionDeclarations) != 1 {
+		t.Fatalf("tools = %+v", got.Tools)
+	}
+	decl := got.Tools[0].FunctionDeclarations[0]
+	params, _ := decl.Parameters.(map[string]interface{})
+	if decl.Name != "get_house" || decl.Description != "查询房源" || params["type"] != "object" {
+		t.Errorf("functionDeclaration = %+v", decl)
+	}
+	if _, ok := params["additionalProperties"]; ok {
+		t.Errorf("parameters 未去掉 additionalProperties: %v", params)
+	}
+	if _, ok := params["$schema"]; ok {
+		t.Errorf("parameters 未去掉 $schema: %v", params)
+	}
+	if got.ToolConfig == nil || got.ToolConfig.FunctionCallingConfig.Mode != "ANY" {
+		t.Errorf("toolConfig = %+v", got.ToolConfig)
+	}
+	if cfg := got.GenerationConfig; cfg == nil || cfg.MaxOutputTokens != 256 || cfg.Temperature == nil || *cfg.Temperature != 0.3 {
+		t.Errorf("generationConfig = %+v", got.GenerationConfig)
+	}
+}
+
+// streamChunk OpenAI chat.completion.chunk 中测试关心的字段
+type streamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Role      string            `json:"role"`
+			Content   string            `json:"content"`
+			ToolCalls []openai.ToolCall `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openai.Usage `json:"usage"`
+}
+
+// readOpenAIStream 读取转换后的 OpenAI SSE，返回各 chunk 与是否以 [DONE] 结束
+func readOpenAIStream(t *testing.T, body io.Reader) ([]streamChunk, bool) {
+	t.Helper()
+	var chunks []streamChunk
+	done := false
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		data := strings.TrimPrefix(line, "data: ")
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		var chunk streamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("解析 chunk 失败: %v, 数据: %s", err, data)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("读取流失败: %v", err)
+	}
+	return chunks, done
+}
+
+func TestGeminiStreamToOpenAI(t *testing.T) {
+	sse := strings.Join([]string{
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"为您找到"}]},"index":0}]}`,
+		``,
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"两套"},{"functionCall":{"name":"get_house","args":{"house_id":"HF_2001"}}}]},"index":0}]}`,
+		``,
+		`data: {"candidates":[{"content":{"role":"model","parts":[]},"finishReason":"STOP","index":0}],"usageMetadata":{"promptTokenCount":12,"candidatesTokenCount":7,"totalTokenCount":19}}`,
+		``,
+	}, "\n")
+	stub, srv := newGeminiStub(t, "text/event-stream", sse)
+	c := NewGeminiClient(srv.URL, "test-key", "gemini-test")
+
+	resp, err := c.StreamGenerateContent(context.Background(), "", []byte(`{"contents":[]}`))
+	if err != nil {
+		t.Fatalf("StreamGenerateContent: %v", err)
+	}
+	if stub.path != "/models/gemini-test:streamGenerateContent" || stub.query != "alt=sse" {
+		t.Errorf("请求地址 = %s?%s", stub.path, stub.query)
+	}
+
+	converted := NewGeminiStreamToOpenAI(resp, "gemini-test")
+	defer converted.Body.Close()
+	if ct := converted.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %s", ct)
+	}
+	chunks, done := readOpenAIStream(t, converted.Body)
+	if !done {
+		t.Error("流未以 data: [DONE] 结束")
+	}
+	if len(chunks) != 5 {
+		t.Fatalf("chunk 数量 = %d, 期望 5（role、两段文本、函数调用、结束）", len(chunks))
+	}
+	if chunks[0].Choices[0].Delta.Role != "assistant" {
+		t.Errorf("首个 chunk 应为 role: %+v", chunks[0])
+	}
+	if text := chunks[1].Choices[0].Delta.Content + chunks[2].Choices[0].Delta.Content; text != "为您找到两套" {
+		t.Errorf("文本 = %q", text)
+	}
+	calls := chunks[3].Choices[0].Delta.ToolCalls
+	if len(calls) != 1 || calls[0].ID == "" || calls[0].Function.Name != "get_house" || calls[0].Function.Arguments != `{"house_id":"HF_2001"}` {
+		t.Errorf("tool_calls = %+v", calls)
+	}
+	end := chunks[4]
+	if fr := end.Choices[0].FinishReason; fr == nil || *fr != string(openai.FinishReasonToolCalls) {
+		t.Errorf("存在函数调用时 finish_reason 应为 tool_calls: %v", fr)
+	}
+	if end.Usage == nil || end.Usage.PromptTokens != 12 || end.Usage.CompletionTokens != 7 || end.Usage.TotalTokens != 19 {
+		t.Errorf("usage = %+v", end.Usage)
+	}
+	for _, chunk := range chunks[:4] {
+		if chunk.Choices[0].FinishReason != nil {
+			t.Errorf("中间 chunk 不应带 finish_reason: %+v", chunk)
+		}
+	}
+}
+
+func TestGeminiStreamFinishReasons(t *testing.T) {
+	cases := map[string]openai.FinishReason{
+		"STOP":       openai.FinishReasonStop,
+		"MAX_TOKENS": openai.FinishReasonLength,
+		"SAFETY":     openai.FinishReasonContentFilter,
+		"RECITATION": openai.FinishReasonContentFilter,
+		"OTHER":      openai.FinishReasonStop,
+	}
+	for reason, want := range cases {
+		sse := `data: {"candidates":[{"content":{"role":"model","parts":[{"text":"好的"}]},"finishReason":"` + reason + `","index":0}]}` + "\n\n"
+		_, srv := newGeminiStub(t, "text/event-stream", sse)
+		resp, err := NewGeminiClient(srv.URL, "k", "gemini-test").StreamGenerateContent(context.Background(), "", []byte(`{}`))
+		if err != nil {
+			t.Fatalf("%s: %v", reason, err)
+		}
+		converted := NewGeminiStreamToOpenAI(resp, "gemini-test")
+		chunks, _ := readOpenAIStream(t, converted.Body)
+		converted.Body.Close()
+		last := chunks[len(chunks)-1].Choices[0].FinishReason
+		if last == nil || *last != string(want) {
+			t.Errorf("%s: finish_reason = %v, 期望 %s", reason, last, want)
+		}
+	}
+}
+
+func TestGeminiUpstreamError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":{"message":"API key not valid"}}`)
+	}))
+	defer srv.Close()
+
+	_, err := NewGeminiClient(srv.URL, "bad", "gemini-test").GenerateContent(context.Background(), "", []byte(`{}`))
+	if err == nil || !strings.Contains(err.Error(), "400") || !strings.Contains(err.Error(), "API key not valid") {
+		t.Errorf("err = %v", err)
+	}
+}
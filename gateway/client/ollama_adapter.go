@@ -0,0 +1,318 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"ocProxy/tools"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// OllamaChatRequest Ollama /api/chat 请求格式
+type OllamaChatRequest struct {
+	Model     string                 `json:"model"`
+	Messages  []OllamaMessage        `json:"messages"`
+	Tools     []openai.Tool          `json:"tools,omitempty"` // 与 OpenAI tools 格式一致
+	Stream    bool                   `json:"stream"`
+	Format    interface{}            `json:"format,omitempty"` // "json" 或 JSON Schema
+	Options   map[string]interface{} `json:"options,omitempty"`
+	KeepAlive string                 `json:"keep_alive,omitempty"`
+}
+
+// OllamaMessage Ollama 消息格式
+type OllamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []OllamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"` // role=tool 时对应的函数名
+}
+
+// OllamaToolCall Ollama 工具调用，arguments 为 JSON 对象而非字符串
+type OllamaToolCall struct {
+	Function OllamaFunctionCall `json:"function"`
+}
+
+// OllamaFunctionCall 函数调用
+type OllamaFunctionCall struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// OllamaChatResponse /api/chat 响应；流式时每行 NDJSON 也是该结构，最后一行 done=true
+type OllamaChatResponse struct {
+	Model           string        `json:"model"`
+	CreatedAt       string        `json:"created_at"`
+	Message         OllamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason,omitempty"`
+	PromptEvalCount int           `json:"prompt_eval_count,omitempty"`
+	EvalCount       int           `json:"eval_count,omitempty"`
+	Error           string        `json:"error,omitempty"`
+}
+
+// --- OpenAI 转 Ollama 请求 ---
+
+// ConvertOpenAIToOllamaRequest 将 OpenAI 请求转换为 Ollama /api/chat 请求；
+// defaultOptions 为配置中的 options（如 num_ctx），请求中的 temperature/top_p/max_tokens/stop/seed 覆盖同名项
+func ConvertOpenAIToOllamaRequest(req openai.ChatCompletionRequest, keepAlive string, defaultOptions map[string]interface{}) *OllamaChatRequest {
+	ollamaReq := &OllamaChatRequest{
+		Model:     req.Model,
+		Stream:    req.Stream,
+		KeepAlive: keepAlive,
+	}
+
+	toolNames := make(map[string]string)
+	for _, msg := range req.Messages {
+		om := OllamaMessage{
+			Role:    msg.Role,
+			Content: messageText(msg),
+		}
+		for _, part := range msg.MultiContent {
+			if part.Type == openai.ChatMessagePartTypeImageURL && part.ImageURL != nil {
+				if img := dataURLBase64(part.ImageURL.URL); img != "" {
+					om.Images = append(om.Images, img)
+				}
+			}
+		}
+		for _, tc := range msg.ToolCalls {
+			toolNames[tc.ID] = tc.Function.Name
+			args := map[string]interface{}{}
+			if tc.Function.Arguments != "" {
+				json.Unmarshal([]byte(tc.Function.Arguments), &args)
+			}
+			om.ToolCalls = append(om.ToolCalls, OllamaToolCall{
+				Function: OllamaFunctionCall{Name: tc.Function.Name, Arguments: args},
+			})
+		}
+		if msg.Role == openai.ChatMessageRoleTool {
+			om.ToolName = toolNames[msg.ToolCallID]
+			if om.ToolName == "" {
+				om.ToolName = msg.Name
+			}
+		}
+		ollamaReq.Messages = append(ollamaReq.Messages, om)
+	}
+
+	for _, tool := range req.Tools {
+		if tool.Type == openai.ToolTypeFunction && tool.Function != nil {
+			ollamaReq.Tools = append(ollamaReq.Tools, tool)
+		}
+	}
+
+	options := make(map[string]interface{}, len(defaultOptions)+5)
+	for k, v := range defaultOptions {
+		options[k] = v
+	}
+	if req.Temperature > 0 {
+		options["temperature"] = req.Temperature
+	}
+	if req.TopP > 0 {
+		options["top_p"] = req.TopP
+	}
+	if req.MaxTokens > 0 {
+		options["num_predict"] = req.MaxTokens
+	}
+	if len(req.Stop) > 0 {
+		options["stop"] = req.Stop
+	}
+	if req.Seed != nil {
+		options["seed"] = *req.Seed
+	}
+	if len(options) > 0 {
+		ollamaReq.Options = options
+	}
+
+	if req.ResponseFormat != nil && req.ResponseFormat.Type == openai.ChatCompletionResponseFormatTypeJSONObject {
+		ollamaReq.Format = "json"
+	}
+	return ollamaReq
+}
+
+// dataURLBase64 从 data:image/...;base64,xxx 中取出 base64 部分；非 data URL 返回空（Ollama 只接受 base64 图片）
+func dataURLBase64(url string) string {
+	const marker = ";base64,"
+	if idx := bytes.Index([]byte(url), []byte(marker)); idx >= 0 {
+		return url[idx+len(marker):]
+	}
+	return ""
+}
+
+// --- Ollama 转 OpenAI 响应 ---
+
+// ConvertOllamaToOpenAIResponse 将 Ollama 非流式响应转换为 OpenAI 响应
+func ConvertOllamaToOpenAIResponse(ollamaResp *OllamaChatResponse, model string) *openai.ChatCompletionResponse {
+	var toolCalls []openai.ToolCall
+	for _, tc := range ollamaResp.Message.ToolCalls {
+		toolCalls = append(toolCalls, openai.ToolCall{
+			ID:   tools.GenerateToolCallID(),
+			Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{
+				Name:      tc.Function.Name,
+				Arguments: ollamaArgsString(tc.Function.Arguments),
+			},
+		})
+	}
+
+	return &openai.ChatCompletionResponse{
+		ID:      tools.GenerateMessageID(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []openai.ChatCompletionChoice{
+			{
+				Message: openai.ChatCompletionMessage{
+					Role:      openai.ChatMessageRoleAssistant,
+					Content:   ollamaResp.Message.Content,
+					ToolCalls: toolCalls,
+				},
+				FinishReason: convertOllamaDoneReason(ollamaResp.DoneReason, len(toolCalls) > 0),
+			},
+		},
+		Usage: openai.Usage{
+			PromptTokens:     ollamaResp.PromptEvalCount,
+			CompletionTokens: ollamaResp.EvalCount,
+			TotalTokens:      ollamaResp.PromptEvalCount + ollamaResp.EvalCount,
+		},
+	}
+}
+
+// ollamaArgsString 函数参数序列化为 JSON 字符串，空参数为 {}
+func ollamaArgsString(args map[string]interface{}) string {
+	if len(args) == 0 {
+		return "{}"
+	}
+	return tools.MarshalToString(args)
+}
+
+// convertOllamaDoneReason 转换结束原因；存在工具调用时为 tool_calls
+func convertOllamaDoneReason(reason string, hasToolCalls bool) openai.FinishReason {
+	if hasToolCalls {
+		return openai.FinishReasonToolCalls
+	}
+	switch reason {
+	case "length":
+		return openai.FinishReasonLength
+	default:
+		return openai.FinishReasonStop
+	}
+}
+
+// --- Ollama NDJSON 流转 OpenAI SSE 流 ---
+
+// NewOllamaStreamToOpenAI 将 Ollama /api/chat 的 NDJSON 流转换为 OpenAI chat.completion.chunk SSE 流。
+// 返回的 *http.Response 的 Body 输出 OpenAI 格式的 data: 行并以 data: [DONE] 结束。
+func NewOllamaStreamToOpenAI(ollamaResp *http.Response, model string) *http.Response {
+	pr, pw := io.Pipe()
+	go func() {
+		defer ollamaResp.Body.Close()
+		pw.CloseWithError(convertOllamaStream(ollamaResp.Body, pw, model))
+	}()
+
+	converted := *ollamaResp
+	converted.Header = ollamaResp.Header.Clone()
+	converted.Header.Set("Content-Type", "text/event-stream")
+	converted.Body = pr
+	return &converted
+}
+
+// convertOllamaStream 逐行读取 NDJSON 并写出 OpenAI chunk
+func convertOllamaStream(src io.Reader, dst io.Writer, model string) error {
+	reader := bufio.NewReader(src)
+	messageID := tools.GenerateMessageID()
+	created := time.Now().Unix()
+	toolCallIndex := 0
+	roleSent := false
+
+	writeChunk := func(delta map[string]interface{}, finishReason interface{}, usage map[string]int) error {
+		chunk := map[string]interface{}{
+			"id":      messageID,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   model,
+			"choices": []map[string]interface{}{
+				{
+					"index":         0,
+					"delta":         delta,
+					"finish_reason": finishReason,
+				},
+			},
+		}
+		if usage != nil {
+			chunk["usage"] = usage
+		}
+		data, _ := json.Marshal(chunk)
+		_, err := fmt.Fprintf(dst, "data: %s\n\n", data)
+		return err
+	}
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			var event OllamaChatResponse
+			if jsonErr := json.Unmarshal(line, &event); jsonErr != nil {
+				log.Printf("[Ollama流] JSON解析失败: %v, 数据: %s", jsonErr, string(line))
+			} else if event.Error != "" {
+				return fmt.Errorf("Ollama 流错误: %s", event.Error)
+			} else {
+				if !roleSent {
+					if werr := writeChunk(map[string]interface{}{"role": "assistant"}, nil, nil); werr != nil {
+						return werr
+					}
+					roleSent = true
+				}
+				if event.Message.Content != "" {
+					if werr := writeChunk(map[string]interface{}{"content": event.Message.Content}, nil, nil); werr != nil {
+						return werr
+					}
+				}
+				for _, tc := range event.Message.ToolCalls {
+					delta := map[string]interface{}{
+						"tool_calls": []map[string]interface{}{
+							{
+								"index": toolCallIndex,
+								"id":    tools.GenerateToolCallID(),
+								"type":  "function",
+								"function": map[string]interface{}{
+									"name":      tc.Function.Name,
+									"arguments": ollamaArgsString(tc.Function.Arguments),
+								},
+							},
+						},
+					}
+					if werr := writeChunk(delta, nil, nil); werr != nil {
+						return werr
+					}
+					toolCallIndex++
+				}
+				if event.Done {
+					finish := convertOllamaDoneReason(event.DoneReason, toolCallIndex > 0)
+					usage := map[string]int{
+						"prompt_tokens":     event.PromptEvalCount,
+						"completion_tokens": event.EvalCount,
+						"total_tokens":      event.PromptEvalCount + event.EvalCount,
+					}
+					if werr := writeChunk(map[string]interface{}{}, string(finish), usage); werr != nil {
+						return werr
+					}
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(dst, "data: [DONE]\n\n")
+	return err
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"ocProxy/gateway/internal/logger"
+	"ocProxy/gateway/internal/telemetry"
+)
+
+// OllamaClient Ollama 原生 /api/chat 协议客户端
+type OllamaClient struct {
+	model      string
+	baseURL    string
+	keepAlive  string                 // 模型在内存中保留时长，如 5m、-1；空则使用 Ollama 默认值
+	options    map[string]interface{} // 默认 options，如 num_ctx、num_gpu
+	httpClient *http.Client
+}
+
+// NewOllamaClient 创建新的 Ollama 客户端；baseURL 形如 http://localhost:11434
+func NewOllamaClient(baseURL, modelID, keepAlive string, options map[string]interface{}) *OllamaClient {
+	return &OllamaClient{
+		model:     modelID,
+		baseURL:   baseURL,
+		keepAlive: keepAlive,
+		options:   options,
+		httpClient: &http.Client{
+			Timeout:   0,                           // 不设置超时，让流式请求可以持续
+			Transport: telemetry.NewTransport(nil), // 记录上游请求 span 并注入 traceparent
+		},
+	}
+}
+
+// Model 返回上游模型 ID
+func (c *OllamaClient) Model() string {
+	return c.model
+}
+
+// KeepAlive 返回配置的 keep_alive
+func (c *OllamaClient) KeepAlive() string {
+	return c.keepAlive
+}
+
+// Options 返回配置的默认 options
+func (c *OllamaClient) Options() map[string]interface{} {
+	return c.options
+}
+
+// Chat 发送 POST /api/chat 请求；requestBody 中的 stream 字段决定响应为单个 JSON 还是 NDJSON 流
+func (c *OllamaClient) Chat(ctx context.Context, requestBody []byte) (*http.Response, error) {
+	url := strings.TrimRight(c.baseURL, "/") + "/api/chat"
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("创建 HTTP 请求失败: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	call := logger.TraceFromContext(ctx).StartUpstream(url, requestBody)
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		call.End(0, err)
+		return nil, fmt.Errorf("HTTP 请求失败: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		err := fmt.Errorf("API 错误 %d: %s", resp.StatusCode, string(bodyBytes))
+		call.End(resp.StatusCode, err)
+		return nil, err
+	}
+	call.End(resp.StatusCode, nil)
+	return resp, nil
+}
@@ -10,6 +10,9 @@ import (
 	"net/http"
 	"strings"
 
+	"ocProxy/gateway/internal/logger"
+	"ocProxy/gateway/internal/telemetry"
+
 	"github.com/sashabaranov/go-openai"
 )
 
@@ -28,19 +31,16 @@ func NewOpenAIClient(baseURL, apiKey, modelID string) *OpenAIClient {
 		baseURL: baseURL,
 		apiKey:  apiKey,
 		httpClient: &http.Client{
-			Timeout: 0, // 不设置超时，让流式请求可以持续
+			Timeout:   0,                           // 不设置超时，让流式请求可以持续
+			Transport: telemetry.NewTransport(nil), // 记录上游请求 span 并注入 traceparent
 		},
 	}
 }
 
-// doRequest 统一发起 POST /chat/completions 请求。stream 为 true 时使用 context.Background() 避免流被取消。
+// doRequest 统一发起 POST /chat/completions 请求。流式请求同样绑定 ctx，客户端断开时上游请求随之取消。
 func (c *OpenAIClient) doRequest(ctx context.Context, body []byte, stream bool) (*http.Response, error) {
 	url := strings.TrimRight(c.baseURL, "/") + "/chat/completions"
-	reqCtx := ctx
-	if stream {
-		reqCtx = context.Background()
-	}
-	httpReq, err := http.NewRequestWithContext(reqCtx, http.MethodPost, url, bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("创建HTTP请求失败: %w", err)
 	}
@@ -53,17 +53,22 @@ func (c *OpenAIClient) doRequest(ctx context.Context, body []byte, stream bool)
 		httpReq.Header.Set("Cache-Control", "no-cache")
 		httpReq.Header.Set("Connection", "keep-alive")
 	}
+	call := logger.TraceFromContext(ctx).StartUpstream(url, body)
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
 		log.Printf("[错误] HTTP 请求失败: %v", err)
+		call.End(0, err)
 		return nil, fmt.Errorf("HTTP 请求失败: %w", err)
 	}
 	if resp.StatusCode >= 400 {
 		bodyBytes, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
 		log.Printf("[错误] API 错误: %d, %s", resp.StatusCode, string(bodyBytes))
-		return nil, fmt.Errorf("API 错误 %d: %s", resp.StatusCode, string(bodyBytes))
+		err := fmt.Errorf("API 错误 %d: %s", resp.StatusCode, string(bodyBytes))
+		call.End(resp.StatusCode, err)
+		return nil, err
 	}
+	call.End(resp.StatusCode, nil)
 	return resp, nil
 }
 
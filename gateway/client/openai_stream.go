@@ -0,0 +1,85 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// NewOpenAIStreamFromResponse 将完整的非流式 OpenAI 响应包装为 chat.completion.chunk SSE 流，
+// 用于网关需要先拿到完整结果（如结构化输出校验）但客户端请求了 stream 的场景
+func NewOpenAIStreamFromResponse(resp *openai.ChatCompletionResponse) *http.Response {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeResponseAsChunks(resp, pw))
+	}()
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       pr,
+	}
+}
+
+// writeResponseAsChunks 依次写出 role、content、tool_calls、finish_reason 四类 chunk 并以 [DONE] 结束
+func writeResponseAsChunks(resp *openai.ChatCompletionResponse, dst io.Writer) error {
+	writeChunk := func(index int, delta map[string]interface{}, finishReason interface{}, usage *openai.Usage) error {
+		chunk := map[string]interface{}{
+			"id":      resp.ID,
+			"object":  "chat.completion.chunk",
+			"created": resp.Created,
+			"model":   resp.Model,
+			"choices": []map[string]interface{}{
+				{
+					"index":         index,
+					"delta":         delta,
+					"finish_reason": finishReason,
+				},
+			},
+		}
+		if usage != nil {
+			chunk["usage"] = usage
+		}
+		data, _ := json.Marshal(chunk)
+		_, err := fmt.Fprintf(dst, "data: %s\n\n", data)
+		return err
+	}
+
+	for i, choice := range resp.Choices {
+		last := i == len(resp.Choices)-1
+		if err := writeChunk(choice.Index, map[string]interface{}{"role": openai.ChatMessageRoleAssistant}, nil, nil); err != nil {
+			return err
+		}
+		if choice.Message.Content != "" {
+			if err := writeChunk(choice.Index, map[string]interface{}{"content": choice.Message.Content}, nil, nil); err != nil {
+				return err
+			}
+		}
+		if len(choice.Message.ToolCalls) > 0 {
+			calls := make([]map[string]interface{}, 0, len(choice.Message.ToolCalls))
+			for j, tc := range choice.Message.ToolCalls {
+				calls = append(calls, map[string]interface{}{
+					"index":    j,
+					"id":       tc.ID,
+					"type":     tc.Type,
+					"function": tc.Function,
+				})
+			}
+			if err := writeChunk(choice.Index, map[string]interface{}{"tool_calls": calls}, nil, nil); err != nil {
+				return err
+			}
+		}
+		var usage *openai.Usage
+		if last {
+			usage = &resp.Usage
+		}
+		if err := writeChunk(choice.Index, map[string]interface{}{}, string(choice.FinishReason), usage); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(dst, "data: [DONE]\n\n")
+	return err
+}
@@ -15,14 +15,111 @@ type Config struct {
 	// PreprocessEnabled 是否启用前处理：工作模型请求时先用聊天模型判断是否需要工具调用
 	PreprocessEnabled bool          `yaml:"preprocess_enabled"`
 	Logging           LoggingConfig `yaml:"logging"`
-	// SkillDirs 技能目录列表，从每个目录读取所有 SKILL.md，每条文件内容作为一条 user 消息插入 system 之后；为空或未配置则不注入
+	// SkillDirs 技能目录列表，从每个目录读取所有 SKILL.md，按与最后一条 user 消息的相关性选择后，
+	// 每个技能正文作为一条 user 消息插入 system 之后；为空或未配置则不注入
 	SkillDirs []string `yaml:"skill_dirs"`
+	// SkillSelection 技能选择参数
+	SkillSelection SkillSelectionConfig `yaml:"skill_selection"`
+	// SkillLibrary 技能库：文件监听、初始禁用的技能与模型/用户技能集
+	SkillLibrary SkillLibraryConfig `yaml:"skill_library"`
+	// Middlewares 请求/响应拦截器管道，按顺序执行；为空则使用默认的 skill_inject、prompt_log
+	Middlewares []MiddlewareConfig `yaml:"middlewares"`
+	// Sessions 服务端会话配置
+	Sessions SessionConfig `yaml:"sessions"`
+	// Telemetry 分布式追踪（W3C traceparent 传播与 span 导出）
+	Telemetry TelemetryConfig `yaml:"telemetry"`
+	// Admin 运行时管理接口 /api/admin
+	Admin AdminConfig `yaml:"admin"`
+	// Subway 地铁线网图的路线估算参数（/api/route）
+	Subway SubwayConfig `yaml:"subway"`
+}
+
+// SubwayConfig 地铁路线估算参数，未配置（0）的字段取默认值
+type SubwayConfig struct {
+	SpeedKmh          float64 `yaml:"speed_kmh"`          // 列车平均运行速度（公里/小时），默认 35
+	HopMinutes        float64 `yaml:"hop_minutes"`        // 每经过一站的附加时间（分钟），默认 2；负数表示 0
+	TransferMinutes   float64 `yaml:"transfer_minutes"`   // 换乘时间（分钟），默认 5；负数表示 0
+	WalkSpeed         float64 `yaml:"walk_speed"`         // 步行速度（米/分钟），默认 80
+	MaxWalkM          float64 `yaml:"max_walk_m"`         // 起终点到地铁站的最大直线距离（米），默认 3000
+	StationCandidates int     `yaml:"station_candidates"` // 起终点各考虑的最近地铁站数，默认 3
+}
+
+// AdminConfig 管理接口配置；token 为空时管理接口不可用
+type AdminConfig struct {
+	Token string `yaml:"token"` // 请求头 Authorization: Bearer <token>、X-Admin-Token 或 Basic 认证密码须与之一致
+}
+
+// TelemetryConfig 分布式追踪配置；enabled 为 true 时所有路由传播 traceparent 并记录 span，
+// otlp_endpoint 与 file 均未配置时只传播不导出
+type TelemetryConfig struct {
+	Enabled       bool              `yaml:"enabled"`
+	ServiceName   string            `yaml:"service_name"`   // 导出的 service.name，默认 ocProxy-gateway
+	OTLPEndpoint  string            `yaml:"otlp_endpoint"`  // OTLP/HTTP collector 地址，如 http://localhost:4318（自动补 /v1/traces）
+	OTLPHeaders   map[string]string `yaml:"otlp_headers"`   // 导出请求附加的请求头，如鉴权
+	File          string            `yaml:"file"`           // 本地 span 文件（每批一行 OTLP JSON），空则不写
+	FlushInterval int               `yaml:"flush_interval"` // 批量导出间隔秒数，默认 5
+}
+
+// SkillSelectionConfig 技能按相关性选择的参数
+type SkillSelectionConfig struct {
+	TokenBudget int     `yaml:"token_budget"` // 注入技能正文的总 token 上限，默认 4000；-1 不限制
+	MaxSkills   int     `yaml:"max_skills"`   // 最多注入的技能数，0 不限制
+	MinScore    float64 `yaml:"min_score"`    // 未命中 triggers 时 BM25 分数下限，默认 1.0
+}
+
+// SkillLibraryConfig 技能库配置；技能启动时加载到内存，SKILL.md 变更后自动重新加载
+type SkillLibraryConfig struct {
+	WatchInterval int                 `yaml:"watch_interval"` // 检查 SKILL.md 变更的间隔秒数，默认 2；-1 不监听（可调用 /api/skills/reload）
+	Disabled      []string            `yaml:"disabled"`       // 初始禁用的技能名
+	ModelSets     map[string][]string `yaml:"model_sets"`     // 请求模型 -> 可注入的技能名（支持通配符），未配置的模型不限制
+	UserSets      map[string][]string `yaml:"user_sets"`      // 用户 ID -> 可注入的技能名（支持通配符），未配置的用户不限制
+}
+
+// SessionConfig 服务端会话配置
+type SessionConfig struct {
+	Dir              string `yaml:"dir"`                // 会话文件目录，默认 sessions；首次创建会话时才创建
+	MaxContextTokens int    `yaml:"max_context_tokens"` // 发往上游的历史上下文 token 上限，超出时丢弃最早的消息；0 不裁剪
+}
+
+// MiddlewareConfig 单个拦截器配置
+type MiddlewareConfig struct {
+	Name    string                 `yaml:"name"`    // 已注册的拦截器类型名
+	Enabled *bool                  `yaml:"enabled"` // 未配置视为启用
+	Options map[string]interface{} `yaml:"options"` // 拦截器自定义参数
 }
 
 // LoggingConfig 日志文件配置，文件名为空则不保存对应日志
 type LoggingConfig struct {
 	PromptLogFile   string `yaml:"prompt_log_file"`   // prompt 日志文件名，空则不保存
 	ResponseLogFile string `yaml:"response_log_file"` // response 日志文件名，空则不保存
+	TraceLogFile    string `yaml:"trace_log_file"`    // 请求链路 trace 日志文件名（JSONL，每个请求一行），空则不保存
+
+	Rotation  LogRotationConfig `yaml:"rotation"`  // 以上日志文件共用的切分与保留策略
+	Redaction RedactionConfig   `yaml:"redaction"` // 写盘前脱敏
+}
+
+// LogRotationConfig 日志切分与保留配置，max_size_mb 与 interval 均未配置时不切分
+type LogRotationConfig struct {
+	MaxSizeMB  int    `yaml:"max_size_mb"`  // 单个文件超过该大小（MB）时切分
+	Interval   string `yaml:"interval"`     // 按时间切分：hourly 或 daily
+	MaxBackups int    `yaml:"max_backups"`  // 最多保留的归档文件数，0 不限制
+	MaxAgeDays int    `yaml:"max_age_days"` // 归档文件最长保留天数，0 不限制
+	Compress   bool   `yaml:"compress"`     // 归档文件 gzip 压缩
+}
+
+// RedactionConfig 日志脱敏配置
+type RedactionConfig struct {
+	Enabled *bool `yaml:"enabled"` // 默认开启，显式设为 false 关闭
+	// Rules 脱敏规则，按顺序执行；为空使用全部内置规则（api_key、id_card、phone、email）。
+	// 只填 name 时引用同名内置规则
+	Rules []RedactRuleConfig `yaml:"rules"`
+}
+
+// RedactRuleConfig 单条脱敏规则
+type RedactRuleConfig struct {
+	Name        string `yaml:"name"`
+	Pattern     string `yaml:"pattern"`     // 正则（RE2 语法）
+	Replacement string `yaml:"replacement"` // 替换文本，按字面写入，不能包含双引号等会破坏 JSON 的字符
 }
 
 // ModelConfig 模型配置
@@ -31,13 +128,31 @@ type ModelConfig struct {
 	APIKey    string `yaml:"api_key"`
 	ModelName string `yaml:"model_name"` // 用户请求使用的模型名，用于判断 chat/work 路由
 	ModelID   string `yaml:"model_id"`   // 实际请求远端 API 的模型 ID
-	APIFormat string `yaml:"api_format"` // API 格式: openai 或 anthropic，默认 openai
+	APIFormat string `yaml:"api_format"` // API 格式: openai、anthropic、gemini 或 ollama，默认 openai
+
+	// 以下仅 api_format 为 ollama 时生效
+	KeepAlive string                 `yaml:"keep_alive"` // 模型在内存中保留时长，如 5m、-1（常驻）
+	Options   map[string]interface{} `yaml:"options"`    // Ollama options，如 num_ctx、num_gpu
+
+	// response_format 为 json_schema 时的结构化输出模拟方式：tool（强制单工具）或 prompt（schema 注入提示词）；
+	// 空则 anthropic 使用 tool，其余使用 prompt
+	StructuredOutput        string `yaml:"structured_output"`
+	StructuredOutputRetries int    `yaml:"structured_output_retries"` // 输出不符合 schema 时的重试次数，默认 2
+
+	StreamIdleTimeout int `yaml:"stream_idle_timeout"` // 流式响应上游连续无数据的超时秒数，超时以错误事件结束流；0 不限制
 }
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
 	Port string `yaml:"port"`
 	Host string `yaml:"host"`
+	// StreamKeepAlive 流式响应等待上游期间发送 SSE 保活注释（": keepalive"）的间隔秒数；0 不发送
+	StreamKeepAlive int `yaml:"stream_keepalive"`
+	// DrainTimeout 收到停机信号后等待进行中请求（含 SSE 流）结束的最长秒数，超时后强制关闭连接；默认 30
+	DrainTimeout int `yaml:"drain_timeout"`
+	// DrainDelay 收到停机信号后 /ready 先返回 503、仍正常接受新请求的秒数，留给负载均衡摘除实例，之后才关闭监听；
+	// 默认 0（立即关闭监听，排空只覆盖进行中的请求）
+	DrainDelay int `yaml:"drain_delay"`
 }
 
 // LoadConfig 从文件加载配置
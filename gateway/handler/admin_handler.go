@@ -0,0 +1,368 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"ocProxy/gateway/config"
+	"ocProxy/gateway/service"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// 可重新加载的数据
+const (
+	reloadHouses    = "houses"
+	reloadLandmarks = "landmarks"
+	reloadRank      = "rank"
+	reloadUsers     = "users"
+)
+
+// 模型角色
+const (
+	modelRoleChat = "chat"
+	modelRoleWork = "work"
+)
+
+// PreprocessRequest 切换前处理请求
+type PreprocessRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// ModelUpstreamRequest 切换模型上游请求，未提供的字段保持不变；model_name 决定路由，不可修改
+type ModelUpstreamRequest struct {
+	BaseURL   *string `json:"base_url"`
+	APIKey    *string `json:"api_key"`
+	ModelID   *string `json:"model_id"`
+	APIFormat *string `json:"api_format"`
+}
+
+// ModelUpstream 模型上游（api_key 已脱敏）
+type ModelUpstream struct {
+	Role      string `json:"role"`
+	ModelName string `json:"model_name"`
+	ModelID   string `json:"model_id"`
+	BaseURL   string `json:"base_url"`
+	APIKey    string `json:"api_key"`
+	APIFormat string `json:"api_format"`
+}
+
+// proxy 返回当前的代理服务；一次请求内应只取一次，保证切换上游时同一请求前后一致
+func (h *Handler) proxy() *service.ProxyService {
+	h.serviceMu.RLock()
+	defer h.serviceMu.RUnlock()
+	return h.service
+}
+
+// effectiveConfig 返回当前生效配置的副本
+func (h *Handler) effectiveConfig() config.Config {
+	h.serviceMu.RLock()
+	defer h.serviceMu.RUnlock()
+	return h.cfg
+}
+
+// updateConfig 在当前配置的副本上执行 fn，成功后按新配置重建代理服务并替换；进行中的请求继续使用旧服务
+func (h *Handler) updateConfig(fn func(cfg *config.Config) error) (config.Config, error) {
+	h.serviceMu.Lock()
+	defer h.serviceMu.Unlock()
+	cfg := h.cfg
+	if err := fn(&cfg); err != nil {
+		return h.cfg, err
+	}
+	h.service = service.NewProxyService(&cfg)
+	h.cfg = cfg
+	return cfg, nil
+}
+
+// adminAuth 管理接口鉴权：未配置 admin.token 时返回 503，token 不匹配时返回 401。
+// token 取自 X-Admin-Token、Authorization: Bearer，或 Basic 认证的密码（供浏览器访问 /debug/traces）
+func (h *Handler) adminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimSpace(h.effectiveConfig().Admin.Token)
+		if token == "" {
+			writeOpenAIError(w, http.StatusServiceUnavailable, "server_error", "admin_disabled", "管理接口未启用（未配置 admin.token）")
+			return
+		}
+		got := r.Header.Get("X-Admin-Token")
+		if auth := r.Header.Get("Authorization"); got == "" && strings.HasPrefix(auth, "Bearer ") {
+			got = strings.TrimPrefix(auth, "Bearer ")
+		} else if _, password, ok := r.BasicAuth(); got == "" && ok {
+			got = password
+		}
+		if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(got)), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="ocProxy admin"`)
+			writeOpenAIError(w, http.StatusUnauthorized, "authentication_error", "invalid_admin_token", "管理接口 token 无效")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// maskSecret 脱敏：保留末 4 位，过短时全部隐藏
+func maskSecret(v string) string {
+	if v == "" {
+		return ""
+	}
+	if len(v) <= 8 {
+		return "****"
+	}
+	return "****" + v[len(v)-4:]
+}
+
+// isSecretKey 判断配置项是否为敏感信息
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range []string{"api_key", "token", "secret", "password"} {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskConfigValue 递归脱敏配置：敏感键的字符串值以及请求头（如 otlp_headers）的全部值
+func maskConfigValue(v interface{}, maskAll bool) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			t[k] = maskConfigValue(child, maskAll || isSecretKey(k) || strings.HasSuffix(strings.ToLower(k), "headers"))
+		}
+		return t
+	case []interface{}:
+		for i, child := range t {
+			t[i] = maskConfigValue(child, maskAll)
+		}
+		return t
+	case string:
+		if maskAll {
+			return maskSecret(t)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// maskedConfig 将配置按 YAML 键名转换为 map 并脱敏
+func maskedConfig(cfg config.Config) (map[string]interface{}, error) {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	maskConfigValue(out, false)
+	return out, nil
+}
+
+// modelUpstream 返回角色对应的模型上游信息
+func modelUpstream(cfg config.Config, role string) ModelUpstream {
+	mc := cfg.ChatModel
+	if role == modelRoleWork {
+		mc = cfg.WorkModel
+	}
+	format := mc.APIFormat
+	if format == "" {
+		format = "openai"
+	}
+	name := mc.ModelName
+	if name == "" {
+		name = mc.ModelID
+	}
+	return ModelUpstream{
+		Role:      role,
+		ModelName: name,
+		ModelID:   mc.ModelID,
+		BaseURL:   mc.BaseURL,
+		APIKey:    maskSecret(mc.APIKey),
+		APIFormat: format,
+	}
+}
+
+// GetAdminConfig 查看当前生效配置，api_key、token 等敏感信息已脱敏
+// GET /api/admin/config
+func (h *Handler) GetAdminConfig(w http.ResponseWriter, r *http.Request) {
+	cfg, err := maskedConfig(h.effectiveConfig())
+	if err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, "server_error", "config_encode_failed", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cfg)
+}
+
+// SetPreprocess 开启或关闭前处理
+// PUT /api/admin/preprocess，请求体 {"enabled": true}
+func (h *Handler) SetPreprocess(w http.ResponseWriter, r *http.Request) {
+	var req PreprocessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "invalid_request", "请求体须为 {\"enabled\": true|false}")
+		return
+	}
+	cfg, _ := h.updateConfig(func(cfg *config.Config) error {
+		cfg.PreprocessEnabled = *req.Enabled
+		return nil
+	})
+	log.Printf("[Admin] 前处理 preprocess_enabled=%v", cfg.PreprocessEnabled)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"preprocess_enabled": cfg.PreprocessEnabled})
+}
+
+// GetModelUpstreams 查看 chat、work 模型的上游
+// GET /api/admin/models
+func (h *Handler) GetModelUpstreams(w http.ResponseWriter, r *http.Request) {
+	cfg := h.effectiveConfig()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"object": "list",
+		"data":   []ModelUpstream{modelUpstream(cfg, modelRoleChat), modelUpstream(cfg, modelRoleWork)},
+	})
+}
+
+// SetModelUpstream 切换 chat 或 work 模型的上游（base_url、api_key、model_id、api_format），新请求立即生效
+// PUT /api/admin/models/{role}
+func (h *Handler) SetModelUpstream(w http.ResponseWriter, r *http.Request) {
+	role := mux.Vars(r)["role"]
+	if role != modelRoleChat && role != modelRoleWork {
+		writeOpenAIError(w, http.StatusNotFound, "invalid_request_error", "model_not_found", fmt.Sprintf("未知的模型角色: %s（可选 %s、%s）", role, modelRoleChat, modelRoleWork))
+		return
+	}
+	var req ModelUpstreamRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "invalid_request", fmt.Sprintf("Invalid request: %v", err))
+		return
+	}
+	cfg, err := h.updateConfig(func(cfg *config.Config) error {
+		mc := &cfg.ChatModel
+		if role == modelRoleWork {
+			mc = &cfg.WorkModel
+		}
+		if req.BaseURL != nil {
+			if strings.TrimSpace(*req.BaseURL) == "" {
+				return fmt.Errorf("base_url 不能为空")
+			}
+			mc.BaseURL = strings.TrimSpace(*req.BaseURL)
+		}
+		if req.APIKey != nil {
+			mc.APIKey = *req.APIKey
+		}
+		if req.ModelID != nil {
+			if strings.TrimSpace(*req.ModelID) == "" {
+				return fmt.Errorf("model_id 不能为空")
+			}
+			if mc.ModelName == "" {
+				mc.ModelName = mc.ModelID // 保持路由使用的模型名不变
+			}
+			mc.ModelID = strings.TrimSpace(*req.ModelID)
+		}
+		if req.APIFormat != nil {
+			switch *req.APIFormat {
+			case "openai", "anthropic", "gemini", "ollama":
+				mc.APIFormat = *req.APIFormat
+			default:
+				return fmt.Errorf("不支持的 api_format: %s（可选 openai、anthropic、gemini、ollama）", *req.APIFormat)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "invalid_request", err.Error())
+		return
+	}
+	up := modelUpstream(cfg, role)
+	log.Printf("[Admin] %s 模型上游切换为 %s (%s, model_id=%s)", role, up.BaseURL, up.APIFormat, up.ModelID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(up)
+}
+
+// ReloadData 从磁盘重新加载模拟数据：houses（同时清空用户状态覆盖）、landmarks、rank、users
+// POST /api/admin/reload/{target}
+func (h *Handler) ReloadData(w http.ResponseWriter, r *http.Request) {
+	target := mux.Vars(r)["target"]
+	var reload func() error
+	var count func() int
+	switch target {
+	case reloadHouses:
+		if h.houseManager != nil {
+			reload = h.houseManager.Reload
+			count = func() int { return len(h.houseManager.GetAll("")) }
+		}
+	case reloadLandmarks:
+		if h.landmarkManager != nil {
+			reload = h.landmarkManager.Reload
+			count = func() int { return len(h.landmarkManager.GetAll()) }
+		}
+	case reloadRank:
+		if h.rankManager != nil {
+			reload = h.rankManager.ReloadData
+			count = h.rankManager.GetRankCount
+		}
+	case reloadUsers:
+		if h.userManager != nil {
+			reload = h.userManager.ReloadUsers
+			count = h.userManager.GetUserCount
+		}
+	default:
+		writeOpenAIError(w, http.StatusNotFound, "invalid_request_error", "reload_target_not_found",
+			fmt.Sprintf("未知的重新加载目标: %s（可选 %s、%s、%s、%s）", target, reloadHouses, reloadLandmarks, reloadRank, reloadUsers))
+		return
+	}
+	if reload == nil {
+		writeOpenAIError(w, http.StatusServiceUnavailable, "server_error", target+"_unavailable", fmt.Sprintf("%s 数据未初始化", target))
+		return
+	}
+	if err := reload(); err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, "server_error", "reload_failed", fmt.Sprintf("重新加载 %s 失败: %v", target, err))
+		return
+	}
+	log.Printf("[Admin] 已重新加载 %s", target)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"target": target, "count": count()})
+}
+
+// RestoreUser 从备份（user.json.backup）恢复用户数据
+// POST /api/admin/users/{user_id}/restore
+func (h *Handler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	if h.userManager == nil {
+		writeOpenAIError(w, http.StatusServiceUnavailable, "server_error", "users_unavailable", "用户数据未初始化")
+		return
+	}
+	userID := mux.Vars(r)["user_id"]
+	// 用户 ID 即工作区子目录名，拒绝路径分隔符与 ..
+	if userID == "" || userID == "." || userID == ".." || filepath.Base(userID) != userID || strings.ContainsAny(userID, `/\`) {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "invalid_user_id", fmt.Sprintf("用户 ID 无效: %q", userID))
+		return
+	}
+	if err := h.userManager.RestoreFromBackup(userID); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "restore_failed", err.Error())
+		return
+	}
+	user, err := h.userManager.GetUser(userID)
+	if err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, "server_error", "restore_failed", err.Error())
+		return
+	}
+	log.Printf("[Admin] 用户 %s 已从备份恢复", userID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// SetupAdminRoutes 设置管理接口路由，均需 admin token
+func (h *Handler) SetupAdminRoutes(r *mux.Router) {
+	admin := r.PathPrefix("/api/admin").Subrouter()
+	admin.Use(h.adminAuth)
+	admin.HandleFunc("/config", h.GetAdminConfig).Methods("GET")
+	admin.HandleFunc("/preprocess", h.SetPreprocess).Methods("PUT")
+	admin.HandleFunc("/models", h.GetModelUpstreams).Methods("GET")
+	admin.HandleFunc("/models/{role}", h.SetModelUpstream).Methods("PUT")
+	admin.HandleFunc("/reload/{target}", h.ReloadData).Methods("POST")
+	admin.HandleFunc("/users/{user_id}/restore", h.RestoreUser).Methods("POST")
+}
@@ -1,10 +1,10 @@
 package handler
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
@@ -12,6 +12,9 @@ import (
 
 	"ocProxy/gateway/client"
 	"ocProxy/gateway/config"
+	"ocProxy/gateway/internal/logger"
+	"ocProxy/gateway/internal/middleware"
+	"ocProxy/gateway/internal/stream"
 	"ocProxy/gateway/service"
 
 	"github.com/sashabaranov/go-openai"
@@ -27,10 +30,11 @@ type AnthropicHandler struct {
 	workModelName  string
 	chatModelID    string
 	workModelID    string
+	pipeline       *middleware.Pipeline
 }
 
-// NewAnthropicHandler 创建新的 Anthropic 处理器
-func NewAnthropicHandler(svc *service.ProxyService, cfg *config.Config) *AnthropicHandler {
+// NewAnthropicHandler 创建新的 Anthropic 处理器；pipeline 为与 ChatCompletion 共用的拦截器管道，可为 nil
+func NewAnthropicHandler(svc *service.ProxyService, cfg *config.Config, pipeline *middleware.Pipeline) *AnthropicHandler {
 	return &AnthropicHandler{
 		service:       svc,
 		cfg:           cfg,
@@ -40,6 +44,7 @@ func NewAnthropicHandler(svc *service.ProxyService, cfg *config.Config) *Anthrop
 		workModelName: svc.GetWorkModelName(),
 		chatModelID:   svc.GetChatModelID(),
 		workModelID:   svc.GetWorkModelID(),
+		pipeline:      pipeline,
 	}
 }
 
@@ -70,35 +75,152 @@ func (h *AnthropicHandler) Messages(w http.ResponseWriter, r *http.Request) {
 	useWorkModel := h.isWorkModel(anthropicReq.Model)
 
 	// 检查是否需要直通模式（Anthropic 格式直接转发）
-	apiFormat := h.service.GetChatAPIFormat()
-	if useWorkModel {
-		apiFormat = h.service.GetWorkAPIFormat()
-	}
+	apiFormat := h.apiFormat(useWorkModel)
 
-	// 如果是 anthropic 格式，直接转发请求
+	// 拦截器统一作用于 OpenAI 形式的请求
+	openaiReq, err := client.ConvertAnthropicToOpenAIRequest(&anthropicReq)
+	if err != nil {
+		log.Printf("[错误] 转换请求失败: %v", err)
+		client.WriteAnthropicError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	rc := middleware.NewRequestContext(ctx, middleware.StreamFormatAnthropic, anthropicReq.Model, useWorkModel, anthropicReq.Stream)
+	rc.User = userIDFromRequest(r)
+	var finishErr error
+	defer func() {
+		h.pipeline.Finish(rc, finishErr)
+		logger.TraceFromContext(ctx).SetError(finishErr)
+	}()
+	logger.TraceFromContext(ctx).SetConversation("", firstUserText(openaiReq.Messages))
+
+	// 如果是 anthropic 格式，直接转发请求（拦截器插入了消息时才回写请求体）
 	if apiFormat == "anthropic" {
-		h.handleAnthropicDirect(ctx, w, bodyBytes, useWorkModel, anthropicReq.Stream)
+		h.service.TraceRouting(ctx, anthropicReq.Model, useWorkModel, useWorkModel, false, "anthropic_direct")
+		before := append([]openai.ChatCompletionMessage(nil), openaiReq.Messages...)
+		err := h.pipeline.ProcessRequest(rc, openaiReq)
+		logger.TraceFromContext(ctx).SetRequest(openaiReq, anthropicReq.Stream)
+		if err != nil {
+			finishErr = err
+			log.Printf("[错误] 请求拦截器处理失败: %v", err)
+			client.WriteAnthropicError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		if messagesSnapshot(openaiReq.Messages) != messagesSnapshot(before) {
+			spliced, err := h.spliceAnthropicMessages(bodyBytes, &anthropicReq, before, openaiReq.Messages)
+			if err != nil {
+				log.Printf("[警告] 拦截器对消息的改写无法无损回写到 Anthropic 请求体，按原请求转发: %v", err)
+			} else {
+				bodyBytes = spliced
+			}
+		}
+		finishErr = h.handleAnthropicDirect(ctx, w, rc, bodyBytes, useWorkModel, anthropicReq.Stream)
 		return
 	}
 
 	// 否则转换为 OpenAI 请求处理
-	openaiReq, err := client.ConvertAnthropicToOpenAIRequest(&anthropicReq)
+	h.service.TraceRouting(ctx, anthropicReq.Model, useWorkModel, useWorkModel, false, "")
+	err = h.pipeline.ProcessRequest(rc, openaiReq)
+	logger.TraceFromContext(ctx).SetRequest(openaiReq, anthropicReq.Stream)
 	if err != nil {
-		log.Printf("[错误] 转换请求失败: %v", err)
+		finishErr = err
+		log.Printf("[错误] 请求拦截器处理失败: %v", err)
 		client.WriteAnthropicError(w, http.StatusBadRequest, "invalid_request", err.Error())
 		return
 	}
 
 	// 处理流式/非流式请求
 	if anthropicReq.Stream {
-		h.handleStreamRequest(ctx, w, openaiReq, useWorkModel, anthropicReq.Model)
+		finishErr = h.handleStreamRequest(ctx, w, rc, openaiReq, useWorkModel, anthropicReq.Model)
 	} else {
-		h.handleNonStreamRequest(ctx, w, openaiReq, useWorkModel, anthropicReq.Model)
+		finishErr = h.handleNonStreamRequest(ctx, w, rc, openaiReq, useWorkModel, anthropicReq.Model)
+	}
+}
+
+// messagesSnapshot 序列化消息用于判断拦截器是否改写了消息
+func messagesSnapshot(messages []openai.ChatCompletionMessage) string {
+	data, _ := json.Marshal(messages)
+	return string(data)
+}
+
+// spliceAnthropicMessages 把拦截器插入的消息（如 skill_inject 注入的技能）拼接进原始请求体的 messages 数组，
+// 客户端原有的 system 块、cache_control、图片、thinking、结构化 tool_result 等内容保持原样。
+// 仅支持在某条 Anthropic 消息边界处插入一段连续的非 system 消息，其余改写返回错误（调用方按原请求转发）
+func (h *AnthropicHandler) spliceAnthropicMessages(bodyBytes []byte, anthropicReq *client.AnthropicMessageRequest, before, after []openai.ChatCompletionMessage) ([]byte, error) {
+	pos, inserted, ok := insertedMessages(before, after)
+	if !ok {
+		return nil, fmt.Errorf("拦截器修改或删除了原有消息")
+	}
+	for _, msg := range inserted {
+		if msg.Role == openai.ChatMessageRoleSystem {
+			return nil, fmt.Errorf("拦截器插入了 system 消息")
+		}
+	}
+
+	offsets, err := client.AnthropicMessageOffsets(anthropicReq)
+	if err != nil {
+		return nil, err
+	}
+	// OpenAI 消息下标 -> 原始 messages 下标；插入在开头的 system 之前或之后都对应 messages 开头
+	at := -1
+	if pos <= offsets[0] {
+		at = 0
+	} else {
+		for i, offset := range offsets {
+			if offset == pos {
+				at = i
+				break
+			}
+		}
+	}
+	if at < 0 {
+		return nil, fmt.Errorf("插入位置 %d 位于一条 Anthropic 消息转换出的多条消息之间", pos)
+	}
+
+	var reqMap map[string]json.RawMessage
+	if err := json.Unmarshal(bodyBytes, &reqMap); err != nil {
+		return nil, err
+	}
+	var messages []json.RawMessage
+	if err := json.Unmarshal(reqMap["messages"], &messages); err != nil {
+		return nil, err
+	}
+	converted := h.service.ConvertToAnthropicRequest(openai.ChatCompletionRequest{Messages: inserted})
+	spliced := make([]json.RawMessage, 0, len(messages)+len(converted.Messages))
+	spliced = append(spliced, messages[:at]...)
+	for _, msg := range converted.Messages {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		spliced = append(spliced, data)
+	}
+	spliced = append(spliced, messages[at:]...)
+	if reqMap["messages"], err = json.Marshal(spliced); err != nil {
+		return nil, err
+	}
+	return json.Marshal(reqMap)
+}
+
+// insertedMessages 判断 after 是否为在 before 的某个位置插入一段连续消息，返回插入位置与插入的消息
+func insertedMessages(before, after []openai.ChatCompletionMessage) (int, []openai.ChatCompletionMessage, bool) {
+	if len(after) <= len(before) {
+		return 0, nil, false
+	}
+	prefix := 0
+	for prefix < len(before) && messagesSnapshot(before[prefix:prefix+1]) == messagesSnapshot(after[prefix:prefix+1]) {
+		prefix++
 	}
+	for i := prefix; i < len(before); i++ {
+		j := i + len(after) - len(before)
+		if messagesSnapshot(before[i:i+1]) != messagesSnapshot(after[j:j+1]) {
+			return 0, nil, false
+		}
+	}
+	return prefix, after[prefix : prefix+len(after)-len(before)], true
 }
 
-// handleAnthropicDirect 直接转发 Anthropic 请求（不转换格式）
-func (h *AnthropicHandler) handleAnthropicDirect(ctx context.Context, w http.ResponseWriter, bodyBytes []byte, useWorkModel bool, stream bool) {
+// handleAnthropicDirect 直接转发 Anthropic 请求（不转换格式），返回的错误供拦截器结束回调使用
+func (h *AnthropicHandler) handleAnthropicDirect(ctx context.Context, w http.ResponseWriter, rc *middleware.RequestContext, bodyBytes []byte, useWorkModel bool, streaming bool) error {
 	var anthropicClient *client.AnthropicClient
 	modelID := h.chatModelID
 	modelType := "聊天"
@@ -114,27 +236,27 @@ func (h *AnthropicHandler) handleAnthropicDirect(ctx context.Context, w http.Res
 	if anthropicClient == nil {
 		log.Printf("[错误] %s 模型的 Anthropic 客户端未初始化", modelType)
 		client.WriteAnthropicError(w, http.StatusInternalServerError, "server_error", "Anthropic client not initialized")
-		return
+		return fmt.Errorf("%s 模型的 Anthropic 客户端未初始化", modelType)
 	}
 
-	log.Printf("[Anthropic] 直接转发到 %s 模型 (%s): %s", modelType, map[bool]string{true: "流式", false: "非流式"}[stream], modelID)
+	log.Printf("[Anthropic] 直接转发到 %s 模型 (%s): %s", modelType, map[bool]string{true: "流式", false: "非流式"}[streaming], modelID)
 
-	// 修改请求体中的模型名
-	var reqMap map[string]interface{}
+	// 修改请求体中的模型名，其余字段按原始 JSON 转发
+	var reqMap map[string]json.RawMessage
 	if err := json.Unmarshal(bodyBytes, &reqMap); err != nil {
 		client.WriteAnthropicError(w, http.StatusBadRequest, "invalid_request", err.Error())
-		return
+		return err
 	}
-	reqMap["model"] = modelID
+	reqMap["model"], _ = json.Marshal(modelID)
 	modifiedBody, _ := json.Marshal(reqMap)
 
-	if stream {
+	if streaming {
 		// 流式请求
 		resp, err := anthropicClient.MessagesStream(ctx, modifiedBody)
 		if err != nil {
 			log.Printf("[错误] Anthropic 流式请求失败: %v", err)
 			client.WriteAnthropicError(w, http.StatusInternalServerError, "api_error", err.Error())
-			return
+			return err
 		}
 		defer resp.Body.Close()
 
@@ -147,37 +269,63 @@ func (h *AnthropicHandler) handleAnthropicDirect(ctx context.Context, w http.Res
 
 		flusher, ok := w.(http.Flusher)
 		if !ok {
-			return
+			return fmt.Errorf("streaming not supported")
 		}
+		out := h.pipeline.WrapStream(rc, w)
 
-		reader := bufio.NewReader(resp.Body)
+		reader := stream.NewLineReader(ctx, resp.Body, h.streamOptions(useWorkModel), stream.KeepAliveWriter(out, flusher))
+		defer reader.Close()
 		for {
-			line, err := reader.ReadBytes('\n')
+			line, err := reader.ReadLine()
 			if err == io.EOF {
 				break
 			}
 			if err != nil {
-				log.Printf("[错误] 读取流失败: %v", err)
-				return
+				if !stream.IsClientGone(err) {
+					log.Printf("[错误] 读取流失败: %v", err)
+					stream.WriteAnthropicError(out, err)
+					flusher.Flush()
+				}
+				return err
 			}
-			w.Write(line)
+			out.Write(line)
 			flusher.Flush()
 		}
-	} else {
-		// 非流式请求
-		resp, err := anthropicClient.Messages(ctx, modifiedBody)
-		if err != nil {
-			log.Printf("[错误] Anthropic 请求失败: %v", err)
-			client.WriteAnthropicError(w, http.StatusInternalServerError, "api_error", err.Error())
-			return
-		}
-		defer resp.Body.Close()
+		return nil
+	}
 
-		// 直接转发响应
+	// 非流式请求
+	resp, err := anthropicClient.Messages(ctx, modifiedBody)
+	if err != nil {
+		log.Printf("[错误] Anthropic 请求失败: %v", err)
+		client.WriteAnthropicError(w, http.StatusInternalServerError, "api_error", err.Error())
+		return err
+	}
+	defer resp.Body.Close()
+
+	// 无响应拦截器时直接转发响应
+	if !h.pipeline.HasResponseInterceptors() {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(resp.StatusCode)
 		io.Copy(w, resp.Body)
+		return nil
 	}
+
+	// 有响应拦截器时转换为 OpenAI 响应处理后再转回
+	var anthropicResp client.AnthropicMessageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&anthropicResp); err != nil {
+		client.WriteAnthropicError(w, http.StatusInternalServerError, "api_error", err.Error())
+		return err
+	}
+	openaiResp := h.service.ConvertAnthropicResponse(&anthropicResp, modelID)
+	if err := h.pipeline.ProcessResponse(rc, openaiResp); err != nil {
+		log.Printf("[错误] 响应拦截器处理失败: %v", err)
+		client.WriteAnthropicError(w, http.StatusInternalServerError, "api_error", err.Error())
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(client.ConvertOpenAIToAnthropicResponse(openaiResp, rc.Model))
+	return nil
 }
 
 // isWorkModel 判断是否为工作模型
@@ -195,17 +343,55 @@ func (h *AnthropicHandler) isWorkModel(model string) bool {
 	return true
 }
 
+// apiFormat 返回 chat/work 模型的上游 API 格式
+func (h *AnthropicHandler) apiFormat(useWorkModel bool) string {
+	if useWorkModel {
+		return h.service.GetWorkAPIFormat()
+	}
+	return h.service.GetChatAPIFormat()
+}
+
+// chat 按上游格式发起非流式调用，统一返回 OpenAI 响应
+func (h *AnthropicHandler) chat(ctx context.Context, req openai.ChatCompletionRequest, useWorkModel bool) (*openai.ChatCompletionResponse, error) {
+	switch h.apiFormat(useWorkModel) {
+	case "gemini":
+		return h.service.GeminiChat(ctx, req, useWorkModel)
+	case "ollama":
+		return h.service.OllamaChat(ctx, req, useWorkModel)
+	}
+	if useWorkModel {
+		return h.workClient.Chat(ctx, req)
+	}
+	return h.chatClient.Chat(ctx, req)
+}
+
+// chatStream 按上游格式发起流式调用，返回 Body 为 OpenAI SSE 的响应
+func (h *AnthropicHandler) chatStream(ctx context.Context, req openai.ChatCompletionRequest, useWorkModel bool) (*http.Response, error) {
+	switch h.apiFormat(useWorkModel) {
+	case "gemini":
+		return h.service.GeminiChatStream(ctx, req, useWorkModel)
+	case "ollama":
+		return h.service.OllamaChatStream(ctx, req, useWorkModel)
+	}
+	if useWorkModel {
+		return h.workClient.ChatStream(ctx, req)
+	}
+	return h.chatClient.ChatStream(ctx, req)
+}
+
+// streamOptions 返回 chat/work 模型的流读取选项
+func (h *AnthropicHandler) streamOptions(useWorkModel bool) stream.Options {
+	return stream.Options{
+		KeepAlive:   h.service.StreamKeepAlive(),
+		IdleTimeout: h.service.StreamIdleTimeout(useWorkModel),
+	}
+}
+
 // handleNonStreamRequest 处理非流式请求
-func (h *AnthropicHandler) handleNonStreamRequest(ctx context.Context, w http.ResponseWriter, openaiReq *openai.ChatCompletionRequest, useWorkModel bool, originalModel string) {
-	// 选择客户端
-	var targetClient *client.OpenAIClient
-	var modelID string
+func (h *AnthropicHandler) handleNonStreamRequest(ctx context.Context, w http.ResponseWriter, rc *middleware.RequestContext, openaiReq *openai.ChatCompletionRequest, useWorkModel bool, originalModel string) error {
+	modelID := h.chatModelID
 	if useWorkModel {
-		targetClient = h.workClient
 		modelID = h.workModelID
-	} else {
-		targetClient = h.chatClient
-		modelID = h.chatModelID
 	}
 
 	// 设置模型 ID
@@ -213,12 +399,17 @@ func (h *AnthropicHandler) handleNonStreamRequest(ctx context.Context, w http.Re
 
 	log.Printf("[Anthropic] 调用 %s 模型 (非流式): %s", map[bool]string{true: "工作", false: "聊天"}[useWorkModel], modelID)
 
-	// 调用 OpenAI 客户端
-	resp, err := targetClient.Chat(ctx, *openaiReq)
+	// 调用上游（非 OpenAI 格式在 chat 内部转换）
+	resp, err := h.chat(ctx, *openaiReq, useWorkModel)
 	if err != nil {
 		log.Printf("[错误] 调用模型失败: %v", err)
 		client.WriteAnthropicError(w, http.StatusInternalServerError, "api_error", err.Error())
-		return
+		return err
+	}
+	if err := h.pipeline.ProcessResponse(rc, resp); err != nil {
+		log.Printf("[错误] 响应拦截器处理失败: %v", err)
+		client.WriteAnthropicError(w, http.StatusInternalServerError, "api_error", err.Error())
+		return err
 	}
 
 	// 转换为 Anthropic 响应
@@ -227,19 +418,14 @@ func (h *AnthropicHandler) handleNonStreamRequest(ctx context.Context, w http.Re
 	// 返回响应
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(anthropicResp)
+	return nil
 }
 
 // handleStreamRequest 处理流式请求
-func (h *AnthropicHandler) handleStreamRequest(ctx context.Context, w http.ResponseWriter, openaiReq *openai.ChatCompletionRequest, useWorkModel bool, originalModel string) {
-	// 选择客户端
-	var targetClient *client.OpenAIClient
-	var modelID string
+func (h *AnthropicHandler) handleStreamRequest(ctx context.Context, w http.ResponseWriter, rc *middleware.RequestContext, openaiReq *openai.ChatCompletionRequest, useWorkModel bool, originalModel string) error {
+	modelID := h.chatModelID
 	if useWorkModel {
-		targetClient = h.workClient
 		modelID = h.workModelID
-	} else {
-		targetClient = h.chatClient
-		modelID = h.chatModelID
 	}
 
 	// 设置模型 ID
@@ -247,12 +433,12 @@ func (h *AnthropicHandler) handleStreamRequest(ctx context.Context, w http.Respo
 
 	log.Printf("[Anthropic] 调用 %s 模型 (流式): %s", map[bool]string{true: "工作", false: "聊天"}[useWorkModel], modelID)
 
-	// 调用 OpenAI 客户端获取流
-	streamResp, err := targetClient.ChatStream(ctx, *openaiReq)
+	// 调用上游获取流（统一为 OpenAI SSE）
+	streamResp, err := h.chatStream(ctx, *openaiReq, useWorkModel)
 	if err != nil {
 		log.Printf("[错误] 创建流失败: %v", err)
 		client.WriteAnthropicError(w, http.StatusInternalServerError, "api_error", err.Error())
-		return
+		return err
 	}
 	defer streamResp.Body.Close()
 
@@ -266,31 +452,49 @@ func (h *AnthropicHandler) handleStreamRequest(ctx context.Context, w http.Respo
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		client.WriteAnthropicError(w, http.StatusInternalServerError, "server_error", "Streaming not supported")
-		return
+		return fmt.Errorf("streaming not supported")
 	}
 
-	// 创建流式写入器
-	writer := client.NewAnthropicStreamWriter(w, originalModel)
+	// 创建流式写入器（写出的事件经过 chunk 拦截器）
+	out := h.pipeline.WrapStream(rc, w)
+	writer := client.NewAnthropicStreamWriter(out, originalModel)
 
 	// 发送消息开始事件
 	if err := writer.SendMessageStart(); err != nil {
 		log.Printf("[错误] 发送消息开始事件失败: %v", err)
-		return
+		return err
 	}
 
-	// 解析并转发 SSE 流
-	reader := bufio.NewReader(streamResp.Body)
-	var contentBlockStarted bool
+	// 解析并转发 SSE 流（客户端断开时取消上游，上游空闲超时时以 error 事件结束）
+	reader := stream.NewLineReader(ctx, streamResp.Body, h.streamOptions(useWorkModel), stream.KeepAliveWriter(out, flusher))
+	defer reader.Close()
+	var contentBlockStarted bool // 当前是否有打开的内容块（text 或 tool_use）
+	var toolBlockOpen bool       // 当前打开的是否为 tool_use 块
+	currentToolIndex := -1       // 当前 tool_use 块对应的 OpenAI tool_calls index
 	var outputTokens int
+	stopReason := "end_turn"
+
+	closeBlock := func() error {
+		if !contentBlockStarted {
+			return nil
+		}
+		contentBlockStarted = false
+		toolBlockOpen = false
+		return writer.SendContentBlockStop()
+	}
 
 	for {
-		line, err := reader.ReadBytes('\n')
+		line, err := reader.ReadLine()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			log.Printf("[错误] 读取流失败: %v", err)
-			return
+			if !stream.IsClientGone(err) {
+				log.Printf("[错误] 读取流失败: %v", err)
+				stream.WriteAnthropicError(out, err)
+				flusher.Flush()
+			}
+			return err
 		}
 
 		// 处理 SSE 行
@@ -300,11 +504,11 @@ func (h *AnthropicHandler) handleStreamRequest(ctx context.Context, w http.Respo
 		}
 
 		// 解析 data: 行
-		if !bytes.HasPrefix(line, []byte("data: ")) {
+		if !bytes.HasPrefix(line, []byte("data:")) {
 			continue
 		}
 
-		data := bytes.TrimPrefix(line, []byte("data: "))
+		data := bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
 
 		// 检查 [DONE]
 		if bytes.Equal(data, []byte("[DONE]")) {
@@ -325,67 +529,91 @@ func (h *AnthropicHandler) handleStreamRequest(ctx context.Context, w http.Respo
 		choice := streamResp.Choices[0]
 		delta := choice.Delta
 
-		// 处理角色（只在开始时）
-		if delta.Role != "" && !contentBlockStarted {
-			// 开始文本内容块
-			if err := writer.SendContentBlockStart("text"); err != nil {
-				log.Printf("[错误] 发送内容块开始失败: %v", err)
-				return
+		// 处理文本内容增量（工具块打开时先关闭）
+		if delta.Content != "" {
+			if toolBlockOpen {
+				if err := closeBlock(); err != nil {
+					log.Printf("[错误] 发送内容块结束失败: %v", err)
+					return err
+				}
 			}
-			contentBlockStarted = true
-		}
-
-		// 处理文本内容增量
-		if delta.Content != "" && contentBlockStarted {
-			deltaEvent := map[string]string{
+			if !contentBlockStarted {
+				if err := writer.SendContentBlockStart("text"); err != nil {
+					log.Printf("[错误] 发送内容块开始失败: %v", err)
+					return err
+				}
+				contentBlockStarted = true
+			}
+			if err := writer.SendContentBlockDelta(map[string]interface{}{
 				"type": "text_delta",
 				"text": delta.Content,
-			}
-			deltaData, _ := json.Marshal(deltaEvent)
-			if err := writer.WriteEvent("content_block_delta", deltaData); err != nil {
+			}); err != nil {
 				log.Printf("[错误] 发送内容增量失败: %v", err)
-				return
+				return err
 			}
 			outputTokens++
 		}
 
-		// 处理工具调用（Anthropic 也支持工具调用）
-		if len(delta.ToolCalls) > 0 {
-			// 简化处理：工具调用在流式响应中比较复杂
-			// 这里只处理文本内容，工具调用需要更复杂的转换
-			for _, tc := range delta.ToolCalls {
-				if tc.Function.Arguments != "" {
-					// 累积工具调用参数
-					log.Printf("[Anthropic] 工具调用参数: %s", tc.Function.Arguments)
+		// 处理工具调用：新的 index 开启 tool_use 块，arguments 作为 input_json_delta 转发
+		for _, tc := range delta.ToolCalls {
+			idx := currentToolIndex
+			if tc.Index != nil {
+				idx = *tc.Index
+			} else if tc.ID != "" {
+				idx = currentToolIndex + 1
+			}
+			if !toolBlockOpen || idx != currentToolIndex {
+				if err := closeBlock(); err != nil {
+					log.Printf("[错误] 发送内容块结束失败: %v", err)
+					return err
+				}
+				if err := writer.SendToolUseBlockStart(tc.ID, tc.Function.Name); err != nil {
+					log.Printf("[错误] 发送 tool_use 块开始失败: %v", err)
+					return err
+				}
+				contentBlockStarted = true
+				toolBlockOpen = true
+				currentToolIndex = idx
+			}
+			if tc.Function.Arguments != "" {
+				if err := writer.SendContentBlockDelta(map[string]interface{}{
+					"type":         "input_json_delta",
+					"partial_json": tc.Function.Arguments,
+				}); err != nil {
+					log.Printf("[错误] 发送工具参数增量失败: %v", err)
+					return err
 				}
 			}
 		}
+
+		if choice.FinishReason != "" {
+			stopReason = client.ConvertOpenAIStopReason(string(choice.FinishReason))
+		}
 	}
 
 	// 结束内容块
-	if contentBlockStarted {
-		if err := writer.SendContentBlockStop(); err != nil {
-			log.Printf("[错误] 发送内容块结束失败: %v", err)
-			return
-		}
+	if err := closeBlock(); err != nil {
+		log.Printf("[错误] 发送内容块结束失败: %v", err)
+		return err
 	}
 
 	// 发送消息增量（用量和停止原因）
 	usage := &client.AnthropicUsage{
 		OutputTokens: outputTokens,
 	}
-	if err := writer.SendMessageDelta(usage, "end_turn"); err != nil {
+	if err := writer.SendMessageDelta(usage, stopReason); err != nil {
 		log.Printf("[错误] 发送消息增量失败: %v", err)
-		return
+		return err
 	}
 
 	// 发送消息停止事件
 	if err := writer.SendMessageStop(); err != nil {
 		log.Printf("[错误] 发送消息停止事件失败: %v", err)
-		return
+		return err
 	}
 
 	flusher.Flush()
+	return nil
 }
 
 // 修复：添加缺少的 context 包导入修复
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ocProxy/gateway/client"
+	"ocProxy/gateway/config"
+	"ocProxy/gateway/internal/skill"
+	"ocProxy/gateway/service"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// passthroughBody 带 system 块数组、cache_control、图片、thinking 与结构化 tool_result 的 Anthropic 请求
+const passthroughBody = `{
+	"model": "claude-test",
+	"max_tokens": 1024,
+	"system": [{"type": "text", "text": "你是租房助手", "cache_control": {"type": "ephemeral"}}],
+	"messages": [
+		{"role": "user", "content": [
+			{"type": "text", "text": "这套房怎么样？"},
+			{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "iVBORw0KGgo="}}
+		]},
+		{"role": "assistant", "content": [
+			{"type": "thinking", "thinking": "需要查询房源", "signature": "sig-1"},
+			{"type": "tool_use", "id": "toolu_1", "name": "get_house", "input": {"house_id": "HF_2001"}}
+		]},
+		{"role": "user", "content": [
+			{"type": "tool_result", "tool_use_id": "toolu_1", "content": [{"type": "text", "text": "月租 5000"}], "cache_control": {"type": "ephemeral"}}
+		]}
+	],
+	"metadata": {"user_id": "u-1"}
+}`
+
+func newPassthroughHandler() *AnthropicHandler {
+	return &AnthropicHandler{service: service.NewProxyService(&config.Config{})}
+}
+
+func parsePassthrough(t *testing.T) (*client.AnthropicMessageRequest, []openai.ChatCompletionMessage) {
+	t.Helper()
+	var req client.AnthropicMessageRequest
+	if err := json.Unmarshal([]byte(passthroughBody), &req); err != nil {
+		t.Fatalf("解析请求失败: %v", err)
+	}
+	if req.System != "你是租房助手" {
+		t.Fatalf("system 块数组应拼接为文本: %q", req.System)
+	}
+	openaiReq, err := client.ConvertAnthropicToOpenAIRequest(&req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &req, openaiReq.Messages
+}
+
+func decodeGeneric(t *testing.T, data []byte) map[string]interface{} {
+	t.Helper()
+	var v map[string]interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestSpliceAnthropicMessagesKeepsOriginalContent(t *testing.T) {
+	req, before := parsePassthrough(t)
+	after := skill.Inject(before, []*skill.Skill{{Content: "技能一"}, {Content: "技能二"}})
+
+	body, err := newPassthroughHandler().spliceAnthropicMessages([]byte(passthroughBody), req, before, after)
+	if err != nil {
+		t.Fatalf("spliceAnthropicMessages: %v", err)
+	}
+
+	original := decodeGeneric(t, []byte(passthroughBody))
+	got := decodeGeneric(t, body)
+	for key, want := range original {
+		if key == "messages" {
+			continue
+		}
+		if !reflect.DeepEqual(got[key], want) {
+			t.Errorf("%s 被改写: %v, 期望 %v", key, got[key], want)
+		}
+	}
+
+	messages := got["messages"].([]interface{})
+	originalMessages := original["messages"].([]interface{})
+	injected := len(messages) - len(originalMessages)
+	if injected < 1 {
+		t.Fatalf("未插入技能消息: %v", messages)
+	}
+	var injectedText string
+	for _, m := range messages[:injected] {
+		msg := m.(map[string]interface{})
+		if msg["role"] != "user" {
+			t.Errorf("技能消息 role = %v", msg["role"])
+		}
+		data, _ := json.Marshal(msg["content"])
+		injectedText += string(data)
+	}
+	for _, want := range []string{"技能一", "技能二"} {
+		if !strings.Contains(injectedText, want) {
+			t.Errorf("技能消息缺少 %s: %s", want, injectedText)
+		}
+	}
+	if !reflect.DeepEqual(messages[injected:], originalMessages) {
+		t.Errorf("原有消息被改写:\n%v\n期望:\n%v", messages[injected:], originalMessages)
+	}
+}
+
+func TestSpliceAnthropicMessagesAtMessageBoundary(t *testing.T) {
+	req, before := parsePassthrough(t)
+	// 插入到 assistant（tool_use）之后、tool_result 之前：对应原始 messages 下标 2
+	offsets, err := client.AnthropicMessageOffsets(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos := offsets[2]
+	after := append(append(append([]openai.ChatCompletionMessage(nil), before[:pos]...),
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "补充说明"}), before[pos:]...)
+
+	body, err := newPassthroughHandler().spliceAnthropicMessages([]byte(passthroughBody), req, before, after)
+	if err != nil {
+		t.Fatalf("spliceAnthropicMessages: %v", err)
+	}
+	messages := decodeGeneric(t, body)["messages"].([]interface{})
+	originalMessages := decodeGeneric(t, []byte(passthroughBody))["messages"].([]interface{})
+	if len(messages) != len(originalMessages)+1 {
+		t.Fatalf("messages 数量 = %d", len(messages))
+	}
+	if !reflect.DeepEqual(messages[:2], originalMessages[:2]) || !reflect.DeepEqual(messages[3:], originalMessages[2:]) {
+		t.Errorf("原有消息被改写: %v", messages)
+	}
+	data, _ := json.Marshal(messages[2])
+	if !strings.Contains(string(data), "补充说明") {
+		t.Errorf("插入的消息 = %s", data)
+	}
+}
+
+func TestSpliceAnthropicMessagesRejectsLossyChanges(t *testing.T) {
+	req, before := parsePassthrough(t)
+	h := newPassthroughHandler()
+
+	modified := append([]openai.ChatCompletionMessage(nil), before...)
+	modified[1].Content = "改写后的问题"
+	modified = append(modified, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "追加"})
+	if _, err := h.spliceAnthropicMessages([]byte(passthroughBody), req, before, modified); err == nil {
+		t.Error("修改原有消息时应返回错误")
+	}
+
+	withSystem := append([]openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: "额外 system"}}, before...)
+	if _, err := h.spliceAnthropicMessages([]byte(passthroughBody), req, before, withSystem); err == nil {
+		t.Error("插入 system 消息时应返回错误")
+	}
+}
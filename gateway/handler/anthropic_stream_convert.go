@@ -1,7 +1,6 @@
 package handler
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -11,19 +10,20 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"ocProxy/gateway/internal/stream"
 )
 
 // AnthropicMessages 处理 Anthropic /v1/messages 请求
 func (h *Handler) AnthropicMessages(w http.ResponseWriter, r *http.Request) {
-	anthropicHandler := NewAnthropicHandler(h.service, nil)
+	anthropicHandler := NewAnthropicHandler(h.proxy(), nil, h.pipeline)
 	anthropicHandler.Messages(w, r)
 }
 
-// proxyAnthropicStreamToOpenAI 将 Anthropic 流式响应转换为 OpenAI 格式
-func (h *Handler) proxyAnthropicStreamToOpenAI(ctx context.Context, w http.ResponseWriter, streamResp *http.Response, flusher http.Flusher) {
-	defer streamResp.Body.Close()
-
-	reader := bufio.NewReader(streamResp.Body)
+// proxyAnthropicStreamToOpenAI 将 Anthropic 流式响应转换为 OpenAI 格式；客户端断开或上游空闲超时时返回错误
+func (h *Handler) proxyAnthropicStreamToOpenAI(ctx context.Context, w http.ResponseWriter, streamResp *http.Response, flusher http.Flusher, opts stream.Options) error {
+	reader := stream.NewLineReader(ctx, streamResp.Body, opts, stream.KeepAliveWriter(w, flusher))
+	defer reader.Close()
 	var messageID string
 
 	// 跟踪当前 tool_use 块的状态
@@ -36,19 +36,19 @@ func (h *Handler) proxyAnthropicStreamToOpenAI(ctx context.Context, w http.Respo
 	toolCallIndex := 0
 
 	for {
-		if ctx.Err() != nil {
-			return
-		}
-
-		line, err := reader.ReadBytes('\n')
+		line, err := reader.ReadLine()
 		if err == io.EOF {
 			fmt.Fprintf(w, "data: [DONE]\n\n")
 			flusher.Flush()
 			break
 		}
 		if err != nil {
-			log.Printf("[错误] 读取 Anthropic 流: %v", err)
-			return
+			if !stream.IsClientGone(err) {
+				log.Printf("[错误] 读取 Anthropic 流: %v", err)
+				stream.WriteOpenAIError(w, err)
+				flusher.Flush()
+			}
+			return err
 		}
 
 		line = bytes.TrimSpace(line)
@@ -246,4 +246,5 @@ func (h *Handler) proxyAnthropicStreamToOpenAI(ctx context.Context, w http.Respo
 			flusher.Flush()
 		}
 	}
+	return nil
 }
@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"ocProxy/fake_app"
+	"ocProxy/gateway/internal/telemetry"
+
+	"github.com/gorilla/mux"
+)
+
+// AppointmentHandler 看房预约的 HTTP 处理器，预约按 X-User-ID 隔离
+type AppointmentHandler struct {
+	houseManager *fake_app.HouseManager
+}
+
+// NewAppointmentHandler 创建看房预约 HTTP 处理器
+func NewAppointmentHandler(houseManager *fake_app.HouseManager) *AppointmentHandler {
+	return &AppointmentHandler{houseManager: houseManager}
+}
+
+// AppointmentRequest 预约或改期请求体：start 与 date+time 二选一
+type AppointmentRequest struct {
+	HouseID string `json:"house_id"` // 预约时必填
+	Start   string `json:"start"`    // 开始时间，如 2026-03-05 10:00
+	Date    string `json:"date"`     // 日期，如 2026-03-05
+	Time    string `json:"time"`     // 整点时间，如 10:00
+	Note    string `json:"note"`
+}
+
+// startTime 合成开始时间
+func (req *AppointmentRequest) startTime() string {
+	if s := strings.TrimSpace(req.Start); s != "" {
+		return s
+	}
+	return strings.TrimSpace(req.Date) + " " + strings.TrimSpace(req.Time)
+}
+
+// SetupAppointmentRoutes 设置看房预约路由
+func (h *AppointmentHandler) SetupAppointmentRoutes(r *mux.Router) {
+	r.HandleFunc("/api/houses/{id}/viewing_slots", h.GetViewingSlots).Methods("GET")
+	r.HandleFunc("/api/appointments", h.CreateAppointment).Methods("POST")
+	r.HandleFunc("/api/appointments", h.ListAppointments).Methods("GET")
+	r.HandleFunc("/api/appointments/{id}", h.GetAppointment).Methods("GET")
+	r.HandleFunc("/api/appointments/{id}", h.RescheduleAppointment).Methods("PUT", "PATCH")
+	r.HandleFunc("/api/appointments/{id}", h.CancelAppointment).Methods("DELETE")
+}
+
+// GetViewingSlots 某房源某天的看房时段（每天 9:00-21:00 整点）及当前用户能否预约；请求头 X-User-ID 必填
+// GET /api/houses/{id}/viewing_slots?date=2026-03-05
+func (h *AppointmentHandler) GetViewingSlots(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireUser(w, r)
+	if !ok {
+		return
+	}
+	houseID := mux.Vars(r)["id"]
+	date := strings.TrimSpace(r.URL.Query().Get("date"))
+	if date == "" {
+		writeAppointmentError(w, http.StatusBadRequest, "请提供 date 参数，如 2026-03-05")
+		return
+	}
+	slots, err := h.houseManager.ViewingSlots(userID, houseID, date)
+	if err != nil {
+		writeAppointmentErr(w, err)
+		return
+	}
+	writeAppointmentResponse(w, map[string]interface{}{
+		"house_id": houseID,
+		"date":     date,
+		"slots":    slots,
+	})
+}
+
+// CreateAppointment 预约看房；房源须为当前用户视角下可租（已租、下架拒绝），同一时段不能重复预约；请求头 X-User-ID 必填
+// POST /api/appointments，请求体 JSON: {"house_id": "HF_2001", "start": "2026-03-05 10:00", "note": "下班后看房"}
+// 或 {"house_id": "HF_2001", "date": "2026-03-05", "time": "10:00"}
+func (h *AppointmentHandler) CreateAppointment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireUser(w, r)
+	if !ok {
+		return
+	}
+	var req AppointmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.HouseID) == "" {
+		writeAppointmentError(w, http.StatusBadRequest, "请求体需为 JSON，且包含 house_id 与 start（或 date、time），如 {\"house_id\": \"HF_2001\", \"start\": \"2026-03-05 10:00\"}")
+		return
+	}
+
+	span := startHouseSpan(r.Context(), "CreateAppointment", userID)
+	appointment, err := h.houseManager.CreateAppointment(userID, strings.TrimSpace(req.HouseID), req.startTime(), req.Note)
+	span.SetAttributes(telemetry.Attr("house.id", req.HouseID))
+	if err != nil {
+		span.SetError(err)
+		span.End()
+		writeAppointmentErr(w, err)
+		return
+	}
+	span.End()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(HouseHTTPResponse{
+		Code:    0,
+		Message: "success",
+		Data:    appointment,
+	})
+}
+
+// ListAppointments 当前用户的预约，按开始时间排序；请求头 X-User-ID 必填
+// GET /api/appointments?house_id=HF_2001&status=scheduled
+func (h *AppointmentHandler) ListAppointments(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireUser(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	status := fake_app.AppointmentStatus(strings.TrimSpace(q.Get("status")))
+	if status != "" && status != fake_app.AppointmentScheduled && status != fake_app.AppointmentCancelled {
+		writeAppointmentError(w, http.StatusBadRequest, "status 须为 scheduled 或 cancelled")
+		return
+	}
+	items := h.houseManager.ListAppointments(userID, strings.TrimSpace(q.Get("house_id")), status)
+	writeAppointmentResponse(w, map[string]interface{}{
+		"total": len(items),
+		"items": items,
+	})
+}
+
+// GetAppointment 按ID查询当前用户的预约；请求头 X-User-ID 必填
+// GET /api/appointments/{id}
+func (h *AppointmentHandler) GetAppointment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireUser(w, r)
+	if !ok {
+		return
+	}
+	appointment, err := h.houseManager.GetAppointment(userID, mux.Vars(r)["id"])
+	if err != nil {
+		writeAppointmentErr(w, err)
+		return
+	}
+	writeAppointmentResponse(w, appointment)
+}
+
+// RescheduleAppointment 改期，校验同预约；请求头 X-User-ID 必填
+// PUT/PATCH /api/appointments/{id}，请求体 JSON: {"start": "2026-03-06 15:00"} 或 {"date": "2026-03-06", "time": "15:00"}
+func (h *AppointmentHandler) RescheduleAppointment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireUser(w, r)
+	if !ok {
+		return
+	}
+	var req AppointmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.startTime()) == "" {
+		writeAppointmentError(w, http.StatusBadRequest, "请求体需为 JSON，且包含 start（或 date、time），如 {\"start\": \"2026-03-06 15:00\"}")
+		return
+	}
+	appointment, err := h.houseManager.RescheduleAppointment(userID, mux.Vars(r)["id"], req.startTime())
+	if err != nil {
+		writeAppointmentErr(w, err)
+		return
+	}
+	writeAppointmentResponse(w, appointment)
+}
+
+// CancelAppointment 取消预约（保留记录，状态改为 cancelled）；请求头 X-User-ID 必填
+// DELETE /api/appointments/{id}
+func (h *AppointmentHandler) CancelAppointment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireUser(w, r)
+	if !ok {
+		return
+	}
+	appointment, err := h.houseManager.CancelAppointment(userID, mux.Vars(r)["id"])
+	if err != nil {
+		writeAppointmentErr(w, err)
+		return
+	}
+	writeAppointmentResponse(w, appointment)
+}
+
+// requireUser 校验 X-User-ID 必填，为空时写 400
+func (h *AppointmentHandler) requireUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID := userIDFromRequest(r)
+	if userID == "" {
+		writeAppointmentError(w, http.StatusBadRequest, "请提供请求头 X-User-ID 以标识当前用户")
+		return "", false
+	}
+	return userID, true
+}
+
+// writeAppointmentErr 按错误类型写响应：不存在 404，冲突、房源不可预约、已取消 409，时间无效 400
+func writeAppointmentErr(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, fake_app.ErrHouseNotFound), errors.Is(err, fake_app.ErrAppointmentNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, fake_app.ErrAppointmentConflict), errors.Is(err, fake_app.ErrHouseNotViewable),
+		errors.Is(err, fake_app.ErrAppointmentClosed):
+		status = http.StatusConflict
+	}
+	writeAppointmentError(w, status, err.Error())
+}
+
+func writeAppointmentResponse(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HouseHTTPResponse{
+		Code:    0,
+		Message: "success",
+		Data:    data,
+	})
+}
+
+func writeAppointmentError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(HouseHTTPResponse{
+		Code:    status,
+		Message: message,
+	})
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"ocProxy/gateway/client"
+	"ocProxy/gateway/internal/middleware"
+	"ocProxy/gateway/internal/tokenizer"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// TokenCountResponse OpenAI 侧 token 估算响应
+type TokenCountResponse struct {
+	Object         string `json:"object"`
+	Model          string `json:"model"`
+	InputTokens    int    `json:"input_tokens"`
+	MessagesTokens int    `json:"messages_tokens"`
+	ToolsTokens    int    `json:"tools_tokens"`
+	SkillMessages  int    `json:"skill_messages"` // 请求拦截器插入的消息条数（默认管道下为注入的 SKILL.md）
+}
+
+// CountTokens 本地估算 OpenAI chat 请求的输入 token 数（不请求上游）
+// POST /v1/chat/completions/count_tokens，请求体与 /v1/chat/completions 一致；按网关实际发送的内容（经配置的请求拦截器处理后）计数
+func (h *Handler) CountTokens(w http.ResponseWriter, r *http.Request) {
+	var req openai.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": map[string]interface{}{
+				"message": fmt.Sprintf("Invalid request: %v", err),
+				"type":    "invalid_request_error",
+				"code":    "invalid_request",
+			},
+		})
+		return
+	}
+
+	before := len(req.Messages)
+	if err := h.interceptForCount(r, middleware.StreamFormatOpenAI, requestUser(r, req.User), &req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "middleware_rejected", err.Error())
+		return
+	}
+
+	messagesTokens := tokenizer.CountMessages(req.Messages)
+	toolsTokens := tokenizer.CountTools(req.Tools)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TokenCountResponse{
+		Object:         "chat.completion.token_count",
+		Model:          req.Model,
+		InputTokens:    messagesTokens + toolsTokens,
+		MessagesTokens: messagesTokens,
+		ToolsTokens:    toolsTokens,
+		SkillMessages:  len(req.Messages) - before,
+	})
+}
+
+// AnthropicCountTokens 处理 Anthropic /v1/messages/count_tokens 请求，本地估算输入 token 数
+// 请求体与 /v1/messages 一致，响应 {"input_tokens": N}；system、tools 及请求拦截器插入的消息均计入
+func (h *Handler) AnthropicCountTokens(w http.ResponseWriter, r *http.Request) {
+	anthropicReq, err := client.ParseAnthropicRequest(r.Body)
+	if err != nil {
+		log.Printf("[错误] 解析 count_tokens 请求失败: %v", err)
+		client.WriteAnthropicError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	openaiReq, err := client.ConvertAnthropicToOpenAIRequest(anthropicReq)
+	if err != nil {
+		client.WriteAnthropicError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	if err := h.interceptForCount(r, middleware.StreamFormatAnthropic, userIDFromRequest(r), openaiReq); err != nil {
+		client.WriteAnthropicError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{
+		"input_tokens": tokenizer.CountRequest(*openaiReq),
+	})
+}
+
+// interceptForCount 以 DryRun 方式执行配置的请求拦截器（不调用上游），使计数与实际发送给上游的请求一致；
+// 未配置 skill_inject 时不计入技能，其他拦截器对消息的改写同样计入
+func (h *Handler) interceptForCount(r *http.Request, protocol, user string, req *openai.ChatCompletionRequest) error {
+	rc := middleware.NewRequestContext(r.Context(), protocol, req.Model, h.proxy().DetermineModelType(req.Model), req.Stream)
+	rc.User = user
+	rc.DryRun = true
+	err := h.pipeline.ProcessRequest(rc, req)
+	h.pipeline.Finish(rc, err)
+	return err
+}
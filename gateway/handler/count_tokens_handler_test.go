@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ocProxy/gateway/config"
+	"ocProxy/gateway/internal/middleware"
+	"ocProxy/gateway/internal/skill"
+	"ocProxy/gateway/service"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// appendNote 在末尾追加一条 user 消息的请求拦截器，记录是否以 DryRun 调用
+type appendNote struct{ dryRuns []bool }
+
+func (a *appendNote) Name() string { return "append_note" }
+
+func (a *appendNote) InterceptRequest(rc *middleware.RequestContext, req *openai.ChatCompletionRequest) error {
+	a.dryRuns = append(a.dryRuns, rc.DryRun)
+	req.Messages = append(req.Messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "请用中文回答，并给出房源编号"})
+	return nil
+}
+
+func countTokensHandler(t *testing.T, middlewares []config.MiddlewareConfig, extra ...middleware.Interceptor) *Handler {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "house-search")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := "---\nname: house-search\ntriggers: [租房]\n---\n查询房源时先确认区域与预算。\n"
+	if err := os.WriteFile(filepath.Join(dir, "SKILL.md"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lib, err := skill.NewLibrary([]string{filepath.Dir(dir)}, skill.SelectOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline, err := middleware.Build(middlewares, middleware.Env{Skills: lib})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ic := range extra {
+		pipeline.Use(ic)
+	}
+	return &Handler{service: service.NewProxyService(&config.Config{}), skills: lib, pipeline: pipeline}
+}
+
+const countBody = `{"model":"chat","messages":[{"role":"user","content":"我想在海淀租房"}]}`
+
+func postCount(t *testing.T, h *Handler) TokenCountResponse {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.CountTokens(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions/count_tokens", strings.NewReader(countBody)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp TokenCountResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestCountTokensFollowsPipeline(t *testing.T) {
+	withSkills := postCount(t, countTokensHandler(t, nil))
+	if withSkills.SkillMessages != 1 {
+		t.Fatalf("默认管道应注入 1 条技能消息, got %d", withSkills.SkillMessages)
+	}
+
+	without := postCount(t, countTokensHandler(t, []config.MiddlewareConfig{{Name: "prompt_log"}}))
+	if without.SkillMessages != 0 || without.InputTokens >= withSkills.InputTokens {
+		t.Errorf("管道不含 skill_inject 时不应计入技能: %+v（含技能 %+v）", without, withSkills)
+	}
+
+	note := &appendNote{}
+	rewritten := postCount(t, countTokensHandler(t, []config.MiddlewareConfig{{Name: "prompt_log"}}, note))
+	if rewritten.SkillMessages != 1 || rewritten.InputTokens <= without.InputTokens {
+		t.Errorf("其他请求拦截器的改写应计入: %+v", rewritten)
+	}
+	if len(note.dryRuns) != 1 || !note.dryRuns[0] {
+		t.Errorf("count_tokens 应以 DryRun 执行拦截器: %v", note.dryRuns)
+	}
+}
+
+func TestAnthropicCountTokensFollowsPipeline(t *testing.T) {
+	body := `{"model":"chat","max_tokens":10,"messages":[{"role":"user","content":"我想在海淀租房"}]}`
+	count := func(h *Handler) int {
+		rec := httptest.NewRecorder()
+		h.AnthropicCountTokens(rec, httptest.NewRequest(http.MethodPost, "/v1/messages/count_tokens", strings.NewReader(body)))
+		var resp map[string]int
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("状态码 = %d: %s", rec.Code, rec.Body.String())
+		}
+		return resp["input_tokens"]
+	}
+	if with, without := count(countTokensHandler(t, nil)), count(countTokensHandler(t, []config.MiddlewareConfig{{Name: "prompt_log"}})); with <= without {
+		t.Errorf("仅在管道包含 skill_inject 时计入技能: with=%d without=%d", with, without)
+	}
+}
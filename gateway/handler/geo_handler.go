@@ -0,0 +1,405 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"ocProxy/fake_app"
+	"ocProxy/gateway/internal/telemetry"
+
+	"github.com/gorilla/mux"
+)
+
+// 空间查询参数默认值与上限
+const (
+	geoDefaultRadius = 2000.0  // 默认半径（米）
+	geoMaxRadius     = 50000.0 // 半径上限（米）
+	geoDefaultLimit  = 100     // radius/bbox 默认返回条数
+	geoMaxLimit      = 500     // radius/bbox 返回条数上限
+	geoDefaultK      = 10      // nearest 默认返回条数
+	geoMaxK          = 100     // nearest 返回条数上限
+)
+
+// GeoHandler 房源、地标空间查询（半径、矩形、k 近邻）的 HTTP 处理器
+type GeoHandler struct {
+	houseManager    *fake_app.HouseManager
+	landmarkManager *fake_app.LandmarkManager
+}
+
+// NewGeoHandler 创建空间查询 HTTP 处理器；任一管理器为 nil 时对应接口返回 503
+func NewGeoHandler(houseManager *fake_app.HouseManager, landmarkManager *fake_app.LandmarkManager) *GeoHandler {
+	return &GeoHandler{
+		houseManager:    houseManager,
+		landmarkManager: landmarkManager,
+	}
+}
+
+// GeoPoint 空间查询的中心点
+type GeoPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Source    string  `json:"source,omitempty"` // 中心点来源：地标或小区名称，直接给经纬度时为空
+}
+
+// GeoResponse 空间查询响应
+type GeoResponse struct {
+	Center *GeoPoint   `json:"center,omitempty"` // bbox 查询无中心点
+	Total  int         `json:"total"`            // 命中总数（截断前）
+	Items  interface{} `json:"items"`            // radius/nearest 为带距离的结果（按距离升序），bbox 为按ID排序的结果
+}
+
+// SetupGeoRoutes 设置空间查询路由
+func (h *GeoHandler) SetupGeoRoutes(r *mux.Router) {
+	// 房源（只返回可租，按 X-User-ID 视角）
+	r.HandleFunc("/api/geo/houses/radius", h.HousesWithinRadius).Methods("GET")
+	r.HandleFunc("/api/geo/houses/bbox", h.HousesInBounds).Methods("GET")
+	r.HandleFunc("/api/geo/houses/nearest", h.NearestHouses).Methods("GET")
+	// 地标（支持 category、type 筛选）
+	r.HandleFunc("/api/geo/landmarks/radius", h.LandmarksWithinRadius).Methods("GET")
+	r.HandleFunc("/api/geo/landmarks/bbox", h.LandmarksInBounds).Methods("GET")
+	r.HandleFunc("/api/geo/landmarks/nearest", h.NearestLandmarks).Methods("GET")
+}
+
+// HousesWithinRadius 查询中心点半径内的可租房源，按距离升序；请求头 X-User-ID 必填
+// GET /api/geo/houses/radius?lat=40.05&lng=116.30&radius_m=1500、?landmark=西二旗站&radius_m=1000
+func (h *GeoHandler) HousesWithinRadius(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.houseRequest(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	center, status, err := h.parseCenter(q, userID)
+	if err != nil {
+		writeGeoError(w, status, err.Error())
+		return
+	}
+	radius, err := parseRadius(q)
+	if err != nil {
+		writeGeoError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := parseGeoInt(q, "limit", geoDefaultLimit, geoMaxLimit)
+	if err != nil {
+		writeGeoError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	span := startHouseSpan(r.Context(), "FindWithinRadius", userID)
+	houses := h.houseManager.FindWithinRadius(center.Latitude, center.Longitude, radius, userID)
+	span.SetAttributes(telemetry.Attr("geo.radius_m", radius), telemetry.Attr("house.returned", len(houses)))
+	span.End()
+
+	total := len(houses)
+	if len(houses) > limit {
+		houses = houses[:limit]
+	}
+	writeGeoResponse(w, GeoResponse{Center: center, Total: total, Items: houses})
+}
+
+// HousesInBounds 查询经纬度矩形内的可租房源，按 house_id 排序；请求头 X-User-ID 必填
+// GET /api/geo/houses/bbox?min_lat=40.03&min_lng=116.28&max_lat=40.07&max_lng=116.33
+func (h *GeoHandler) HousesInBounds(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.houseRequest(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	minLat, minLng, maxLat, maxLng, err := parseBounds(q)
+	if err != nil {
+		writeGeoError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := parseGeoInt(q, "limit", geoDefaultLimit, geoMaxLimit)
+	if err != nil {
+		writeGeoError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	span := startHouseSpan(r.Context(), "FindInBounds", userID)
+	houses := h.houseManager.FindInBounds(minLat, minLng, maxLat, maxLng, userID)
+	span.SetAttributes(telemetry.Attr("house.returned", len(houses)))
+	span.End()
+
+	total := len(houses)
+	if len(houses) > limit {
+		houses = houses[:limit]
+	}
+	writeGeoResponse(w, GeoResponse{Total: total, Items: houses})
+}
+
+// NearestHouses 查询距中心点最近的 k 套可租房源，按距离升序；请求头 X-User-ID 必填
+// GET /api/geo/houses/nearest?landmark=百度科技园&k=5、?lat=40.05&lng=116.30&k=10&max_distance_m=3000
+func (h *GeoHandler) NearestHouses(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.houseRequest(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	center, status, err := h.parseCenter(q, userID)
+	if err != nil {
+		writeGeoError(w, status, err.Error())
+		return
+	}
+	k, maxDistance, err := parseNearest(q)
+	if err != nil {
+		writeGeoError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	span := startHouseSpan(r.Context(), "FindNearest", userID)
+	houses := h.houseManager.FindNearest(center.Latitude, center.Longitude, k, maxDistance, userID)
+	span.SetAttributes(telemetry.Attr("geo.k", k), telemetry.Attr("house.returned", len(houses)))
+	span.End()
+
+	writeGeoResponse(w, GeoResponse{Center: center, Total: len(houses), Items: houses})
+}
+
+// LandmarksWithinRadius 查询中心点半径内的地标，按距离升序
+// GET /api/geo/landmarks/radius?community=保利锦上(二期)&radius_m=3000&category=landmark&type=shopping
+func (h *GeoHandler) LandmarksWithinRadius(w http.ResponseWriter, r *http.Request) {
+	if !h.landmarkRequest(w) {
+		return
+	}
+	q := r.URL.Query()
+	center, status, err := h.parseCenter(q, userIDFromRequest(r))
+	if err != nil {
+		writeGeoError(w, status, err.Error())
+		return
+	}
+	radius, err := parseRadius(q)
+	if err != nil {
+		writeGeoError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := parseGeoInt(q, "limit", geoDefaultLimit, geoMaxLimit)
+	if err != nil {
+		writeGeoError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	items := h.landmarkManager.FindWithinRadius(center.Latitude, center.Longitude, radius, parseLandmarkGeoFilter(q))
+	total := len(items)
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	writeGeoResponse(w, GeoResponse{Center: center, Total: total, Items: items})
+}
+
+// LandmarksInBounds 查询经纬度矩形内的地标，按ID排序
+// GET /api/geo/landmarks/bbox?min_lat=39.90&min_lng=116.40&max_lat=39.95&max_lng=116.48&category=subway
+func (h *GeoHandler) LandmarksInBounds(w http.ResponseWriter, r *http.Request) {
+	if !h.landmarkRequest(w) {
+		return
+	}
+	q := r.URL.Query()
+	minLat, minLng, maxLat, maxLng, err := parseBounds(q)
+	if err != nil {
+		writeGeoError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := parseGeoInt(q, "limit", geoDefaultLimit, geoMaxLimit)
+	if err != nil {
+		writeGeoError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	landmarks := h.landmarkManager.FindInBounds(minLat, minLng, maxLat, maxLng, parseLandmarkGeoFilter(q))
+	total := len(landmarks)
+	if len(landmarks) > limit {
+		landmarks = landmarks[:limit]
+	}
+	items := make([]*LandmarkResponse, 0, len(landmarks))
+	for _, lm := range landmarks {
+		items = append(items, convertToLandmarkResponse(lm))
+	}
+	writeGeoResponse(w, GeoResponse{Total: total, Items: items})
+}
+
+// NearestLandmarks 查询距中心点最近的 k 个地标，按距离升序
+// GET /api/geo/landmarks/nearest?lat=40.05&lng=116.30&k=3&category=subway
+func (h *GeoHandler) NearestLandmarks(w http.ResponseWriter, r *http.Request) {
+	if !h.landmarkRequest(w) {
+		return
+	}
+	q := r.URL.Query()
+	center, status, err := h.parseCenter(q, userIDFromRequest(r))
+	if err != nil {
+		writeGeoError(w, status, err.Error())
+		return
+	}
+	k, maxDistance, err := parseNearest(q)
+	if err != nil {
+		writeGeoError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	items := h.landmarkManager.FindNearest(center.Latitude, center.Longitude, k, maxDistance, parseLandmarkGeoFilter(q))
+	writeGeoResponse(w, GeoResponse{Center: center, Total: len(items), Items: items})
+}
+
+// houseRequest 校验房源空间查询的前置条件（房屋服务可用、X-User-ID 必填），不满足时写错误响应
+func (h *GeoHandler) houseRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if h.houseManager == nil {
+		writeGeoError(w, http.StatusServiceUnavailable, "房屋服务不可用")
+		return "", false
+	}
+	userID := userIDFromRequest(r)
+	if userID == "" {
+		writeGeoError(w, http.StatusBadRequest, "请提供请求头 X-User-ID 以标识当前用户")
+		return "", false
+	}
+	return userID, true
+}
+
+// landmarkRequest 校验地标服务可用，不可用时写 503
+func (h *GeoHandler) landmarkRequest(w http.ResponseWriter) bool {
+	if h.landmarkManager == nil {
+		writeGeoError(w, http.StatusServiceUnavailable, "地标服务不可用")
+		return false
+	}
+	return true
+}
+
+// parseCenter 解析中心点，三选一：lat+lng 经纬度；landmark 地标ID或名称（支持拼音、错别字）；
+// community 小区名（取该小区第一套可租房源的坐标）。出错时返回对应的 HTTP 状态码
+func (h *GeoHandler) parseCenter(q url.Values, userID string) (*GeoPoint, int, error) {
+	if q.Get("lat") != "" || q.Get("lng") != "" {
+		lat, err := parseCoord(q, "lat", 90)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		lng, err := parseCoord(q, "lng", 180)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		return &GeoPoint{Latitude: lat, Longitude: lng}, 0, nil
+	}
+	if name := strings.TrimSpace(q.Get("landmark")); name != "" {
+		if h.landmarkManager == nil {
+			return nil, http.StatusServiceUnavailable, fmt.Errorf("地标服务不可用")
+		}
+		landmark := h.landmarkManager.GetByID(name)
+		if landmark == nil {
+			landmark = h.landmarkManager.GetByName(name)
+		}
+		if landmark == nil {
+			return nil, http.StatusNotFound, fmt.Errorf("未找到地标: %s", name)
+		}
+		return &GeoPoint{Latitude: landmark.Latitude, Longitude: landmark.Longitude, Source: landmark.Name}, 0, nil
+	}
+	if community := strings.TrimSpace(q.Get("community")); community != "" {
+		if h.houseManager == nil {
+			return nil, http.StatusServiceUnavailable, fmt.Errorf("房屋服务不可用")
+		}
+		resolved, _ := h.houseManager.ResolveCommunity(community)
+		houses := h.houseManager.GetByCommunity(resolved, userID)
+		if len(houses) == 0 {
+			return nil, http.StatusNotFound, fmt.Errorf("未找到小区或该小区暂无可租房源: %s", community)
+		}
+		return &GeoPoint{Latitude: houses[0].Latitude, Longitude: houses[0].Longitude, Source: resolved}, 0, nil
+	}
+	return nil, http.StatusBadRequest, fmt.Errorf("请提供中心点：lat 与 lng、landmark 或 community")
+}
+
+// parseCoord 解析必填的经度或纬度，绝对值不超过 bound
+func parseCoord(q url.Values, name string, bound float64) (float64, error) {
+	v, err := strconv.ParseFloat(q.Get(name), 64)
+	if err != nil || v < -bound || v > bound {
+		return 0, fmt.Errorf("%s 参数无效，须为 -%g~%g 之间的数字", name, bound, bound)
+	}
+	return v, nil
+}
+
+// parseBounds 解析 min_lat、min_lng、max_lat、max_lng
+func parseBounds(q url.Values) (minLat, minLng, maxLat, maxLng float64, err error) {
+	if minLat, err = parseCoord(q, "min_lat", 90); err != nil {
+		return
+	}
+	if minLng, err = parseCoord(q, "min_lng", 180); err != nil {
+		return
+	}
+	if maxLat, err = parseCoord(q, "max_lat", 90); err != nil {
+		return
+	}
+	if maxLng, err = parseCoord(q, "max_lng", 180); err != nil {
+		return
+	}
+	if minLat > maxLat || minLng > maxLng {
+		err = fmt.Errorf("矩形范围无效：min_lat、min_lng 须分别不大于 max_lat、max_lng")
+	}
+	return
+}
+
+// parseRadius 解析 radius_m（米），默认 geoDefaultRadius，上限 geoMaxRadius
+func parseRadius(q url.Values) (float64, error) {
+	s := q.Get("radius_m")
+	if s == "" {
+		return geoDefaultRadius, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v <= 0 || v > geoMaxRadius {
+		return 0, fmt.Errorf("radius_m 参数无效，须为 0~%g 之间的数字（米）", geoMaxRadius)
+	}
+	return v, nil
+}
+
+// parseNearest 解析 k 与可选的 max_distance_m（米，0 表示不限）
+func parseNearest(q url.Values) (int, float64, error) {
+	k, err := parseGeoInt(q, "k", geoDefaultK, geoMaxK)
+	if err != nil {
+		return 0, 0, err
+	}
+	maxDistance := 0.0
+	if s := q.Get("max_distance_m"); s != "" {
+		if maxDistance, err = strconv.ParseFloat(s, 64); err != nil || maxDistance < 0 {
+			return 0, 0, fmt.Errorf("max_distance_m 参数无效，须为非负数字（米）")
+		}
+	}
+	return k, maxDistance, nil
+}
+
+// parseGeoInt 解析正整数参数，缺省取 def，超过 max 时按 max
+func parseGeoInt(q url.Values, name string, def, max int) (int, error) {
+	s := q.Get(name)
+	if s == "" {
+		return def, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("%s 参数无效，须为正整数", name)
+	}
+	if v > max {
+		v = max
+	}
+	return v, nil
+}
+
+// parseLandmarkGeoFilter 解析地标筛选：category=subway|company|landmark，type=shopping|park|...
+func parseLandmarkGeoFilter(q url.Values) fake_app.LandmarkGeoFilter {
+	return fake_app.LandmarkGeoFilter{
+		Category: fake_app.LandmarkCategory(strings.TrimSpace(q.Get("category"))),
+		Type:     strings.TrimSpace(q.Get("type")),
+	}
+}
+
+func writeGeoResponse(w http.ResponseWriter, data GeoResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HouseHTTPResponse{
+		Code:    0,
+		Message: "success",
+		Data:    data,
+	})
+}
+
+func writeGeoError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(HouseHTTPResponse{
+		Code:    status,
+		Message: message,
+	})
+}
@@ -1,20 +1,27 @@
 package handler
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"ocProxy/fake_app"
 	gamerank "ocProxy/game/rank"
 	gameuser "ocProxy/game/user"
 	"ocProxy/gateway/config"
 	"ocProxy/gateway/internal/logger"
+	"ocProxy/gateway/internal/middleware"
+	"ocProxy/gateway/internal/session"
 	"ocProxy/gateway/internal/skill"
+	"ocProxy/gateway/internal/stream"
+	"ocProxy/gateway/internal/telemetry"
+	"ocProxy/gateway/internal/traceview"
 	"ocProxy/gateway/service"
 
 	"github.com/gorilla/mux"
@@ -23,18 +30,35 @@ import (
 
 // Handler HTTP 请求处理器
 type Handler struct {
-	service         *service.ProxyService
-	promptLogger    *logger.PromptLogger
-	responseLogger  *logger.ResponseLogger
-	skillDirs       []string // 技能目录列表，每个目录下 SKILL.md 内容作为一条 user 消息注入 system 之后
-	userManager     *gameuser.UserManager
-	userHandler     *gameuser.Handler
-	rankManager     *gamerank.RankManager
-	rankHandler     *gamerank.Handler
-	landmarkManager *fake_app.LandmarkManager
-	landmarkHandler *LandmarkHandler
-	houseManager    *fake_app.HouseManager
-	houseHandler    *HouseHandler
+	serviceMu        sync.RWMutex
+	service          *service.ProxyService // 通过 proxy() 读取，管理接口修改配置后整体替换
+	cfg              config.Config         // 当前生效的配置，管理接口修改后同步更新
+	promptLogger     *logger.PromptLogger
+	responseLogger   *logger.ResponseLogger
+	traceLogger      *logger.TraceLogger
+	traceLogs        *traceview.Cache // trace 日志（含归档）的解析缓存，供 /debug/traces 读取；未配置时为 nil
+	skills           *skill.Library   // 技能库，相关技能正文作为 user 消息注入 system 之后；未配置 skill_dirs 时为 nil
+	pipeline         *middleware.Pipeline
+	userManager      *gameuser.UserManager
+	userHandler      *gameuser.Handler
+	rankManager      *gamerank.RankManager
+	rankHandler      *gamerank.Handler
+	landmarkManager  *fake_app.LandmarkManager
+	landmarkHandler  *LandmarkHandler
+	houseManager     *fake_app.HouseManager
+	houseHandler     *HouseHandler
+	geoHandler       *GeoHandler
+	routeHandler     *RouteHandler
+	appointments     *AppointmentHandler
+	sessionStore     *session.Store // 服务端会话存储，初始化失败时为 nil
+	sessionMaxTokens int
+	tracer           *telemetry.Tracer // 分布式追踪，未开启时为 nil
+	landmarkErr      error             // 地标管理器初始化错误，供 /ready 展示
+	houseErr         error             // 房屋管理器初始化错误，供 /ready 展示
+
+	draining         atomic.Bool // 收到停机信号后为 true，/ready 返回 503
+	inflightRequests atomic.Int64
+	inflightStreams  atomic.Int64
 }
 
 // NewHandler 创建新的处理器。若配置中未指定日志文件名，则不创建对应 logger，不保存 prompt/response。
@@ -42,16 +66,21 @@ func NewHandler(svc *service.ProxyService, cfg *config.Config) (*Handler, error)
 	var promptLogger *logger.PromptLogger
 	var responseLogger *logger.ResponseLogger
 
+	logOpts, err := loggerOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	if cfg != nil && strings.TrimSpace(cfg.Logging.PromptLogFile) != "" {
 		var err error
-		promptLogger, err = logger.NewPromptLogger(strings.TrimSpace(cfg.Logging.PromptLogFile))
+		promptLogger, err = logger.NewPromptLogger(strings.TrimSpace(cfg.Logging.PromptLogFile), logOpts)
 		if err != nil {
 			return nil, fmt.Errorf("创建 PromptLogger 失败: %w", err)
 		}
 	}
 	if cfg != nil && strings.TrimSpace(cfg.Logging.ResponseLogFile) != "" {
 		var err error
-		responseLogger, err = logger.NewResponseLogger(strings.TrimSpace(cfg.Logging.ResponseLogFile))
+		responseLogger, err = logger.NewResponseLogger(strings.TrimSpace(cfg.Logging.ResponseLogFile), logOpts)
 		if err != nil {
 			if promptLogger != nil {
 				promptLogger.Close()
@@ -59,16 +88,44 @@ func NewHandler(svc *service.ProxyService, cfg *config.Config) (*Handler, error)
 			return nil, fmt.Errorf("创建 ResponseLogger 失败: %w", err)
 		}
 	}
-
-	var skillDirs []string
-	if cfg != nil {
-		for _, d := range cfg.SkillDirs {
-			if s := strings.TrimSpace(d); s != "" {
-				skillDirs = append(skillDirs, s)
+	var traceLogger *logger.TraceLogger
+	var traceLogs *traceview.Cache
+	if cfg != nil && strings.TrimSpace(cfg.Logging.TraceLogFile) != "" {
+		var err error
+		traceLogFile := strings.TrimSpace(cfg.Logging.TraceLogFile)
+		traceLogs = traceview.NewCache(traceLogFile)
+		traceLogger, err = logger.NewTraceLogger(traceLogFile, logOpts)
+		if err != nil {
+			if promptLogger != nil {
+				promptLogger.Close()
+			}
+			if responseLogger != nil {
+				responseLogger.Close()
 			}
+			return nil, fmt.Errorf("创建 TraceLogger 失败: %w", err)
 		}
 	}
 
+	// 初始化技能库（可选，失败不影响其他功能）
+	var skills *skill.Library
+	if cfg != nil {
+		skills = newSkillLibrary(cfg)
+	}
+
+	// 构建请求/响应拦截器管道
+	var middlewareCfgs []config.MiddlewareConfig
+	if cfg != nil {
+		middlewareCfgs = cfg.Middlewares
+	}
+	pipeline, err := middleware.Build(middlewareCfgs, middleware.Env{
+		Skills:         skills,
+		PromptLogger:   promptLogger,
+		ResponseLogger: responseLogger,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("构建 middleware 管道失败: %w", err)
+	}
+
 	// 初始化用户管理器
 	userManager, err := gameuser.NewUserManager("workspace")
 	if err != nil {
@@ -86,48 +143,168 @@ func NewHandler(svc *service.ProxyService, cfg *config.Config) (*Handler, error)
 	// 初始化地标数据管理器（可选，失败不影响其他功能）
 	var landmarkManager *fake_app.LandmarkManager
 	var landmarkHandler *LandmarkHandler
-	landmarkManager, err = fake_app.NewLandmarkManager("fake_app/data")
-	if err != nil {
-		log.Printf("[警告] 初始化地标管理器失败: %v，地标查询功能不可用", err)
+	landmarkManager, landmarkErr := fake_app.NewLandmarkManager("fake_app/data")
+	if landmarkErr != nil {
+		log.Printf("[警告] 初始化地标管理器失败: %v，地标查询功能不可用", landmarkErr)
 	} else {
 		landmarkHandler = NewLandmarkHandler(landmarkManager)
+		if cfg != nil {
+			landmarkManager.SetSubwayOptions(fake_app.SubwayOptions{
+				SpeedKmh:          cfg.Subway.SpeedKmh,
+				HopMinutes:        cfg.Subway.HopMinutes,
+				TransferMinutes:   cfg.Subway.TransferMinutes,
+				WalkSpeed:         cfg.Subway.WalkSpeed,
+				MaxWalkM:          cfg.Subway.MaxWalkM,
+				StationCandidates: cfg.Subway.StationCandidates,
+			})
+		}
 		log.Printf("[LandmarkManager] 初始化完成，共 %d 个地标", len(landmarkManager.GetAll()))
 	}
 
 	// 初始化房屋管理器（可选，失败不影响其他功能）
 	var houseManager *fake_app.HouseManager
 	var houseHandler *HouseHandler
-	houseManager, err = fake_app.NewHouseManager("fake_app/data")
-	if err != nil {
-		log.Printf("[警告] 初始化房屋管理器失败: %v，房屋查询功能不可用", err)
+	var appointmentHandler *AppointmentHandler
+	houseManager, houseErr := fake_app.NewHouseManager("fake_app/data")
+	if houseErr != nil {
+		log.Printf("[警告] 初始化房屋管理器失败: %v，房屋查询功能不可用", houseErr)
 	} else {
 		houseHandler = NewHouseHandler(houseManager, landmarkManager)
+		appointmentHandler = NewAppointmentHandler(houseManager)
+		if landmarkErr == nil {
+			houseManager.SetLandmarkManager(landmarkManager)
+		}
 		log.Printf("[HouseManager] 初始化完成，共 %d 套房源", len(houseManager.GetAll("")))
 	}
 
+	// 房源、地标空间查询：两者任一可用即注册
+	var geoHandler *GeoHandler
+	if landmarkErr == nil || houseErr == nil {
+		geoHandler = NewGeoHandler(houseManager, landmarkManager)
+	}
+
+	// 地铁通勤路线估算：依赖地标管理器中的地铁站数据
+	var routeHandler *RouteHandler
+	if landmarkErr == nil {
+		routeHandler = NewRouteHandler(houseManager, landmarkManager)
+	}
+
+	// 初始化服务端会话存储（可选，失败不影响其他功能）；目录在首次创建会话时才创建
+	sessionDir := "sessions"
+	var sessionMaxTokens int
+	if cfg != nil {
+		if d := strings.TrimSpace(cfg.Sessions.Dir); d != "" {
+			sessionDir = d
+		}
+		sessionMaxTokens = cfg.Sessions.MaxContextTokens
+	}
+	sessionStore, err := session.NewStore(sessionDir)
+	if err != nil {
+		log.Printf("[警告] 初始化会话存储失败: %v，服务端会话功能不可用", err)
+		sessionStore = nil
+	}
+
+	var tracer *telemetry.Tracer
+	if cfg != nil && cfg.Telemetry.Enabled {
+		tracer = newTracer(cfg.Telemetry)
+	}
+
+	var effective config.Config
+	if cfg != nil {
+		effective = *cfg
+	}
+
 	return &Handler{
-		service:         svc,
-		promptLogger:    promptLogger,
-		responseLogger:  responseLogger,
-		skillDirs:       skillDirs,
-		userManager:     userManager,
-		userHandler:     userHandler,
-		rankManager:     rankManager,
-		rankHandler:     rankHandler,
-		landmarkManager: landmarkManager,
-		landmarkHandler: landmarkHandler,
-		houseManager:    houseManager,
-		houseHandler:    houseHandler,
+		service:          svc,
+		cfg:              effective,
+		promptLogger:     promptLogger,
+		responseLogger:   responseLogger,
+		traceLogger:      traceLogger,
+		traceLogs:        traceLogs,
+		skills:           skills,
+		pipeline:         pipeline,
+		userManager:      userManager,
+		userHandler:      userHandler,
+		rankManager:      rankManager,
+		rankHandler:      rankHandler,
+		landmarkManager:  landmarkManager,
+		landmarkHandler:  landmarkHandler,
+		houseManager:     houseManager,
+		houseHandler:     houseHandler,
+		geoHandler:       geoHandler,
+		routeHandler:     routeHandler,
+		appointments:     appointmentHandler,
+		sessionStore:     sessionStore,
+		sessionMaxTokens: sessionMaxTokens,
+		tracer:           tracer,
+		landmarkErr:      landmarkErr,
+		houseErr:         houseErr,
 	}, nil
 }
 
+// loggerOptions 根据配置生成日志文件的切分与脱敏选项
+func loggerOptions(cfg *config.Config) (logger.Options, error) {
+	var opts logger.Options
+	if cfg == nil {
+		return opts, nil
+	}
+	rot := cfg.Logging.Rotation
+	opts.Rotate = logger.RotateOptions{
+		MaxSizeMB:  rot.MaxSizeMB,
+		Interval:   strings.TrimSpace(rot.Interval),
+		MaxBackups: rot.MaxBackups,
+		MaxAgeDays: rot.MaxAgeDays,
+		Compress:   rot.Compress,
+	}
+	red := cfg.Logging.Redaction
+	if red.Enabled == nil || *red.Enabled {
+		rules := make([]logger.RedactRule, 0, len(red.Rules))
+		for _, r := range red.Rules {
+			rules = append(rules, logger.RedactRule{Name: r.Name, Pattern: r.Pattern, Replacement: r.Replacement})
+		}
+		redactor, err := logger.NewRedactor(rules)
+		if err != nil {
+			return opts, fmt.Errorf("日志脱敏配置无效: %w", err)
+		}
+		opts.Redactor = redactor
+	}
+	return opts, nil
+}
+
 // ChatCompletion 处理 OpenAI 标准的聊天完成请求
 func (h *Handler) ChatCompletion(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	body, req, ok := readChatRequest(w, r)
+	if !ok {
+		return
+	}
+
+	// 带 session_id 时走服务端会话：请求只含新增消息，历史由网关拼接
+	if sessionID := sessionIDFromBody(body); sessionID != "" {
+		h.sessionChat(w, r, sessionID, req, body)
+		return
+	}
+
+	h.serveChatCompletion(w, r, req, body, nil)
+}
 
-	// 解析 OpenAI 标准请求体
-	var req openai.ChatCompletionRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+// readChatRequest 读取并解析 OpenAI 聊天请求体，失败时写出 400 并返回 ok=false
+func readChatRequest(w http.ResponseWriter, r *http.Request) (body []byte, req openai.ChatCompletionRequest, ok bool) {
+	// 解析 OpenAI 标准请求体；保留原始请求体以读取 go-openai 未定义的 response_format.json_schema
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("[错误] 读取请求体失败: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": map[string]interface{}{
+				"message": fmt.Sprintf("Invalid request: %v", err),
+				"type":    "invalid_request_error",
+				"code":    "invalid_request",
+			},
+		})
+		return nil, req, false
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
 		log.Printf("[错误] 解析请求体失败: %v", err)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -138,32 +315,56 @@ func (h *Handler) ChatCompletion(w http.ResponseWriter, r *http.Request) {
 				"code":    "invalid_request",
 			},
 		})
-		return
+		return nil, req, false
 	}
 
-	// 在 system 消息之后注入各 skill_dirs 下 SKILL.md 内容（每条一条 user 消息）
-	if len(h.skillDirs) > 0 {
-		injected, injectErr := skill.InjectAfterSystem(req.Messages, h.skillDirs)
-		if injectErr != nil {
-			log.Printf("[警告] skill 注入失败: %v", injectErr)
-		} else {
-			req.Messages = injected
-		}
-	}
+	return body, req, true
+}
 
-	// 保存请求到 prompt.jsonl
-	if h.promptLogger != nil && len(req.Messages) > 0 {
-		if err := h.promptLogger.Log(req.Messages); err != nil {
-			log.Printf("[警告] 保存请求日志失败: %v", err)
-		}
-	}
+// serveChatCompletion 执行拦截器、调用上游并写出响应；onAssistant 非空时在成功后回调最终的 assistant 消息
+func (h *Handler) serveChatCompletion(w http.ResponseWriter, r *http.Request, req openai.ChatCompletionRequest, body []byte, onAssistant func(openai.ChatCompletionMessage)) {
+	ctx := r.Context()
+	// 整个请求使用同一份代理服务，管理接口切换上游不影响进行中的请求
+	svc := h.proxy()
 
 	// 根据请求的 model 字段判断使用哪个模型
-	useWorkModel := h.service.DetermineModelType(req.Model)
+	useWorkModel := svc.DetermineModelType(req.Model)
+
+	// 执行请求拦截器（默认：注入 SKILL.md、保存 prompt 日志）
+	rc := middleware.NewRequestContext(ctx, middleware.StreamFormatOpenAI, req.Model, useWorkModel, req.Stream)
+	rc.User = requestUser(r, req.User)
+	var finishErr error
+	defer func() {
+		h.pipeline.Finish(rc, finishErr)
+		logger.TraceFromContext(ctx).SetError(finishErr)
+	}()
+	logger.TraceFromContext(ctx).SetConversation(req.User, firstUserText(req.Messages))
+	err := h.pipeline.ProcessRequest(rc, &req)
+	logger.TraceFromContext(ctx).SetRequest(req, req.Stream)
+	if err != nil {
+		finishErr = err
+		log.Printf("[错误] 请求拦截器处理失败: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": map[string]interface{}{
+				"message": err.Error(),
+				"type":    "invalid_request_error",
+				"code":    "middleware_rejected",
+			},
+		})
+		return
+	}
 
-	// 直接处理请求
-	result, err := h.service.ProcessRequest(ctx, req, useWorkModel)
+	// response_format 为 json_schema 时由网关保证输出符合 schema，否则直接处理请求
+	var result interface{}
+	if format, _ := service.ParseJSONSchemaFormat(body); format != nil {
+		result, err = svc.ProcessStructuredRequest(ctx, req, format, useWorkModel)
+	} else {
+		result, err = svc.ProcessRequest(ctx, req, useWorkModel)
+	}
 	if err != nil {
+		finishErr = err
 		log.Printf("[错误] 处理请求失败 (模型=%s, 流式=%v): %v", req.Model, req.Stream, err)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -201,69 +402,57 @@ func (h *Handler) ChatCompletion(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		flusher.Flush()
 
+		// 会话请求记录客户端实际收到的内容（经过拦截器之后）
+		var recorder *session.StreamRecorder
+		if onAssistant != nil {
+			recorder = session.NewStreamRecorder(w)
+			w = recorder
+		}
+
+		// 之后写出的每个 SSE chunk 都经过 chunk 拦截器
+		w = h.pipeline.WrapStream(rc, w)
+
+		opts := stream.Options{KeepAlive: svc.StreamKeepAlive()}
 		if streamResp, ok := result.(*service.StreamResponse); ok {
 			// StreamResponse：带 API 格式信息的流式响应
+			opts.IdleTimeout = streamResp.IdleTimeout
 			if streamResp.APIFormat == "anthropic" {
 				// 转换 Anthropic 流到 OpenAI 流
-				h.proxyAnthropicStreamToOpenAI(ctx, w, streamResp.Response, flusher)
+				finishErr = h.proxyAnthropicStreamToOpenAI(ctx, w, streamResp.Response, flusher, opts)
 			} else {
 				// 直接转发 Body（OpenAI 格式）
-				defer streamResp.Response.Body.Close()
-				reader := bufio.NewReader(streamResp.Response.Body)
-				for {
-					if ctx.Err() != nil {
-						return
-					}
-					line, err := reader.ReadBytes('\n')
-					if err == io.EOF {
-						break
-					}
-					if err != nil {
-						log.Printf("[错误] 读取流式响应: %v", err)
-						return
-					}
-					if len(line) > 0 {
-						if _, writeErr := w.Write(line); writeErr != nil {
-							return
-						}
-					} else {
-						w.Write([]byte("\n"))
-					}
-					flusher.Flush()
-				}
+				finishErr = forwardOpenAIStream(ctx, w, streamResp.Response, flusher, opts)
 			}
 		} else if streamResp, ok := result.(*http.Response); ok {
 			// 直接转发 *http.Response（兼容简化预处理返回的流）
-			defer streamResp.Body.Close()
-			reader := bufio.NewReader(streamResp.Body)
-			for {
-				if ctx.Err() != nil {
-					return
-				}
-				line, err := reader.ReadBytes('\n')
-				if err == io.EOF {
-					break
-				}
-				if err != nil {
-					log.Printf("[错误] 读取流式响应: %v", err)
-					return
-				}
-				if len(line) > 0 {
-					if _, writeErr := w.Write(line); writeErr != nil {
-						return
-					}
-				} else {
-					w.Write([]byte("\n"))
-				}
-				flusher.Flush()
-			}
+			finishErr = forwardOpenAIStream(ctx, w, streamResp, flusher, opts)
+		}
+		if recorder != nil && finishErr == nil {
+			onAssistant(recorder.Message())
 		}
 	} else {
 		// 非流式响应
 		w.Header().Set("Content-Type", "application/json")
 		if resp, ok := result.(*openai.ChatCompletionResponse); ok {
+			if err := h.pipeline.ProcessResponse(rc, resp); err != nil {
+				finishErr = err
+				log.Printf("[错误] 响应拦截器处理失败: %v", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"error": map[string]interface{}{
+						"message": err.Error(),
+						"type":    "server_error",
+						"code":    "middleware_error",
+					},
+				})
+				return
+			}
+			if onAssistant != nil && len(resp.Choices) > 0 {
+				onAssistant(resp.Choices[0].Message)
+			}
 			json.NewEncoder(w).Encode(resp)
 		} else {
+			finishErr = fmt.Errorf("invalid response type %T", result)
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]interface{}{
 				"error": map[string]interface{}{
@@ -276,6 +465,42 @@ func (h *Handler) ChatCompletion(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// forwardOpenAIStream 逐行转发 OpenAI SSE 流；客户端断开时取消上游，上游空闲超时时写出错误事件结束流
+func forwardOpenAIStream(ctx context.Context, w http.ResponseWriter, resp *http.Response, flusher http.Flusher, opts stream.Options) error {
+	reader := stream.NewLineReader(ctx, resp.Body, opts, stream.KeepAliveWriter(w, flusher))
+	defer reader.Close()
+	for {
+		line, err := reader.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if !stream.IsClientGone(err) {
+				log.Printf("[错误] 读取流式响应: %v", err)
+				stream.WriteOpenAIError(w, err)
+				flusher.Flush()
+			}
+			return err
+		}
+		if len(line) > 0 {
+			if _, writeErr := w.Write(line); writeErr != nil {
+				return writeErr
+			}
+		} else {
+			w.Write([]byte("\n"))
+		}
+		flusher.Flush()
+	}
+}
+
+// requestUser 请求用户：优先取请求头 X-User-ID，其次取请求体 user
+func requestUser(r *http.Request, bodyUser string) string {
+	if u := userIDFromRequest(r); u != "" {
+		return u
+	}
+	return strings.TrimSpace(bodyUser)
+}
+
 // HealthCheck 健康检查
 func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -286,10 +511,33 @@ func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 
 // SetupRoutes 设置路由
 func (h *Handler) SetupRoutes(r *mux.Router) {
+	// 分布式追踪：所有路由传播 traceparent 并记录 server span，须在其他中间件之前注册
+	r.Use(telemetry.Middleware(h.tracer))
+
+	// 统计进行中的请求与 SSE 流，停机时等待其结束
+	r.Use(h.trackInflight)
+
 	r.HandleFunc("/health", h.HealthCheck).Methods("GET")
-	r.HandleFunc("/v1/chat/completions", h.ChatCompletion).Methods("POST")
+	r.HandleFunc("/ready", h.Ready).Methods("GET")
+	r.HandleFunc("/v1/chat/completions", h.traced(middleware.StreamFormatOpenAI, h.ChatCompletion)).Methods("POST")
+	// 本地估算 token 数（OpenAI 侧工具接口）
+	r.HandleFunc("/v1/chat/completions/count_tokens", h.CountTokens).Methods("POST")
 	// Anthropic 协议支持
-	r.HandleFunc("/v1/messages", h.AnthropicMessages).Methods("POST")
+	r.HandleFunc("/v1/messages", h.traced(middleware.StreamFormatAnthropic, h.AnthropicMessages)).Methods("POST")
+	r.HandleFunc("/v1/messages/count_tokens", h.AnthropicCountTokens).Methods("POST")
+
+	// 服务端会话路由
+	h.SetupSessionRoutes(r)
+
+	// 技能管理路由
+	h.SetupSkillRoutes(r)
+
+	// 运行时管理路由（需 admin token）
+	h.SetupAdminRoutes(r)
+
+	// trace 查看器；fake_app 接口调用记录 trace 供查看器关联工具调用结果
+	h.SetupTraceViewerRoutes(r)
+	r.Use(h.traceFakeApp)
 
 	// 用户管理路由
 	if h.userHandler != nil {
@@ -310,6 +558,21 @@ func (h *Handler) SetupRoutes(r *mux.Router) {
 	if h.houseHandler != nil {
 		h.houseHandler.SetupHouseRoutes(r)
 	}
+
+	// 看房预约路由
+	if h.appointments != nil {
+		h.appointments.SetupAppointmentRoutes(r)
+	}
+
+	// 空间查询路由
+	if h.geoHandler != nil {
+		h.geoHandler.SetupGeoRoutes(r)
+	}
+
+	// 地铁路线路由
+	if h.routeHandler != nil {
+		h.routeHandler.SetupRouteRoutes(r)
+	}
 }
 
 // Close 关闭处理器，释放资源
@@ -317,6 +580,13 @@ func (h *Handler) Close() error {
 	if h.promptLogger != nil {
 		_ = h.promptLogger.Close()
 	}
+	if h.traceLogger != nil {
+		_ = h.traceLogger.Close()
+	}
+	h.skills.Close()
+	if err := h.tracer.Shutdown(); err != nil {
+		log.Printf("[警告] 关闭 span 导出失败: %v", err)
+	}
 	if h.responseLogger != nil {
 		return h.responseLogger.Close()
 	}
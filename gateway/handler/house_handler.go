@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"ocProxy/fake_app"
+	"ocProxy/gateway/internal/telemetry"
 
 	"github.com/gorilla/mux"
 )
@@ -41,6 +42,13 @@ type HouseListResponse struct {
 	Items    []*fake_app.House `json:"items"`
 }
 
+// CommunityHouseListResponse 按小区名查房响应：小区名不存在时附带模糊匹配候选
+type CommunityHouseListResponse struct {
+	HouseListResponse
+	Community  string                    `json:"community"`            // 实际匹配到的小区名，未找到时为空
+	Candidates []fake_app.CommunityMatch `json:"candidates,omitempty"` // 模糊匹配候选（拼音、同音字、错别字），按分数降序
+}
+
 // HouseNearbyResponse 附近房屋响应
 type HouseNearbyResponse struct {
 	Landmark struct {
@@ -78,6 +86,8 @@ func (h *HouseHandler) SetupHouseRoutes(r *mux.Router) {
 	r.HandleFunc("/api/houses/init", h.InitHouses).Methods("POST")
 	// 查询房屋列表
 	r.HandleFunc("/api/houses", h.GetHouses).Methods("GET")
+	// 布尔过滤树搜索（and/or/not 组合任意字段条件）
+	r.HandleFunc("/api/houses/search", h.SearchHouses).Methods("POST")
 	// 按小区名查房源（指代、地铁信息等，支撑评测集）
 	r.HandleFunc("/api/houses/by_community", h.GetHousesByCommunity).Methods("GET")
 	// 某小区周边某类地标（商超/公园，支撑评测集）
@@ -93,7 +103,10 @@ func (h *HouseHandler) SetupHouseRoutes(r *mux.Router) {
 }
 
 // GetHouses 查询房屋列表
-// 支持多种筛选条件；请求头 X-User-ID 必填，按该用户视角返回状态
+// 支持多种筛选条件；请求头 X-User-ID 必填，按该用户视角返回状态。
+// commute_to=国贸&commute_max=40 按地铁线网图估算到该地标的通勤时间并筛选，结果带 commute，可 sort_by=commute；
+// 多个目的地逗号分隔（如两人各自的公司）：commute_to=望京,中关村&commute_max=40,50&commute_rank=max，
+// 结果带 commutes 与综合分 commute_score
 func (h *HouseHandler) GetHouses(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -102,9 +115,15 @@ func (h *HouseHandler) GetHouses(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	query := parseHouseQuery(r)
+	if !h.resolveCommutes(w, r, query) {
+		return
+	}
 
 	// 执行查询
+	span := startHouseSpan(r.Context(), "QueryWithPagination", userID)
 	houses, total := h.houseManager.QueryWithPagination(query, userID)
+	span.SetAttributes(telemetry.Attr("house.total", total), telemetry.Attr("house.returned", len(houses)))
+	span.End()
 
 	json.NewEncoder(w).Encode(HouseHTTPResponse{
 		Code:    0,
@@ -118,6 +137,74 @@ func (h *HouseHandler) GetHouses(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// maxSearchPage /api/houses/search 的最大页码
+const maxSearchPage = 10000
+
+// SearchHouses 按布尔过滤树搜索房源，支持多键排序与分页；请求头 X-User-ID 必填，按该用户视角匹配和返回状态
+// POST /api/houses/search，请求体 JSON:
+// {"filter": {"and": [{"field": "district", "op": "in", "values": ["海淀", "朝阳"]}, {"not": {"field": "tags", "op": "contains", "value": "近高架"}}]},
+// "sort": [{"field": "price", "order": "asc"}], "page": 1, "page_size": 20}
+func (h *HouseHandler) SearchHouses(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID := userIDFromRequest(r)
+	if h.requireUserID(w, userID) {
+		return
+	}
+	var search fake_app.HouseSearch
+	if err := json.NewDecoder(r.Body).Decode(&search); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(HouseHTTPResponse{
+			Code:    400,
+			Message: "请求体需为 JSON，如 {\"filter\": {\"field\": \"district\", \"op\": \"eq\", \"value\": \"海淀\"}}",
+		})
+		return
+	}
+	if search.Page <= 0 {
+		search.Page = 1
+	}
+	if search.Page > maxSearchPage {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(HouseHTTPResponse{
+			Code:    400,
+			Message: "page 不能超过 " + strconv.Itoa(maxSearchPage),
+		})
+		return
+	}
+	if search.PageSize <= 0 {
+		search.PageSize = 20
+	}
+	if search.PageSize > 100 {
+		search.PageSize = 100
+	}
+
+	span := startHouseSpan(r.Context(), "Search", userID)
+	houses, total, err := h.houseManager.Search(&search, userID)
+	if err != nil {
+		span.SetError(err)
+		span.End()
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(HouseHTTPResponse{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+	span.SetAttributes(telemetry.Attr("house.total", total), telemetry.Attr("house.returned", len(houses)))
+	span.End()
+
+	json.NewEncoder(w).Encode(HouseHTTPResponse{
+		Code:    0,
+		Message: "success",
+		Data: HouseListResponse{
+			Total:    total,
+			Page:     search.Page,
+			PageSize: search.PageSize,
+			Items:    houses,
+		},
+	})
+}
+
 // InitHouses 初始化指定用户的房源数据：清空该用户的状态覆盖（租赁/退租等），使该用户视角恢复为初始数据。评测或比赛每启动新题目时调用。
 // POST /api/houses/init，请求头必填 X-User-ID，仅重置该用户。
 func (h *HouseHandler) InitHouses(w http.ResponseWriter, r *http.Request) {
@@ -135,7 +222,7 @@ func (h *HouseHandler) InitHouses(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(HouseHTTPResponse{
 		Code:    0,
 		Message: "success",
-		Data:    map[string]string{"action": "reset_user", "user_id": userID, "message": "该用户状态覆盖已清空，房源恢复为初始状态"},
+		Data:    map[string]string{"action": "reset_user", "user_id": userID, "message": "该用户状态覆盖与看房预约已清空，房源恢复为初始状态"},
 	})
 }
 
@@ -208,7 +295,10 @@ func (h *HouseHandler) GetHouseByID(w http.ResponseWriter, r *http.Request) {
 	}
 	vars := mux.Vars(r)
 	id := vars["id"]
+	span := startHouseSpan(r.Context(), "GetByID", userID)
 	house := h.houseManager.GetByID(id, userID)
+	span.SetAttributes(telemetry.Attr("house.id", id), telemetry.Attr("house.found", house != nil))
+	span.End()
 	if house == nil {
 		w.WriteHeader(http.StatusNotFound)
 		json.NewEncoder(w).Encode(HouseHTTPResponse{
@@ -268,7 +358,10 @@ func (h *HouseHandler) GetNearbyHouses(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 查询附近房屋（按当前用户视角筛选可租）
+	span := startHouseSpan(r.Context(), "FindNearby", userID)
 	houses := h.houseManager.FindNearby(landmark, maxDistance, userID)
+	span.SetAttributes(telemetry.Attr("landmark.id", landmark.ID), telemetry.Attr("house.returned", len(houses)))
+	span.End()
 
 	response := HouseNearbyResponse{
 		Total: len(houses),
@@ -294,7 +387,9 @@ func (h *HouseHandler) GetHouseStatistics(w http.ResponseWriter, r *http.Request
 	if h.requireUserID(w, userID) {
 		return
 	}
+	span := startHouseSpan(r.Context(), "GetStatistics", userID)
 	stats := h.houseManager.GetStatistics(userID)
+	span.End()
 
 	json.NewEncoder(w).Encode(HouseHTTPResponse{
 		Code:    0,
@@ -303,8 +398,9 @@ func (h *HouseHandler) GetHouseStatistics(w http.ResponseWriter, r *http.Request
 	})
 }
 
-// GetHousesByCommunity 按小区名查询可租房源（支撑评测：指代、查地铁信息等）；请求头 X-User-ID 必填
-// GET /api/houses/by_community?community=建清园(南区)
+// GetHousesByCommunity 按小区名查询可租房源（支撑评测：指代、查地铁信息等）；请求头 X-User-ID 必填。
+// 小区名不存在时按拼音、简拼、同音字、错别字模糊匹配：有可信候选则返回其房源，并在 candidates 中列出候选及分数
+// GET /api/houses/by_community?community=建清园(南区)、community=jianqingyuan
 func (h *HouseHandler) GetHousesByCommunity(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -321,16 +417,31 @@ func (h *HouseHandler) GetHousesByCommunity(w http.ResponseWriter, r *http.Reque
 		})
 		return
 	}
-	houses := h.houseManager.GetByCommunity(community, userID)
+	span := startHouseSpan(r.Context(), "GetByCommunity", userID)
+	resolved, candidates := h.houseManager.ResolveCommunity(community)
+	var houses []*fake_app.House
+	if resolved != "" {
+		houses = h.houseManager.GetByCommunity(resolved, userID)
+	}
+	span.SetAttributes(telemetry.Attr("house.community", community), telemetry.Attr("house.resolved_community", resolved), telemetry.Attr("house.returned", len(houses)))
+	span.End()
 
+	message := "success"
+	if resolved == "" && len(candidates) > 0 {
+		message = "未找到小区: " + community + "，是否为 candidates 中的小区之一？"
+	}
 	json.NewEncoder(w).Encode(HouseHTTPResponse{
 		Code:    0,
-		Message: "success",
-		Data: HouseListResponse{
-			Total:    len(houses),
-			Page:     1,
-			PageSize: len(houses),
-			Items:    houses,
+		Message: message,
+		Data: CommunityHouseListResponse{
+			HouseListResponse: HouseListResponse{
+				Total:    len(houses),
+				Page:     1,
+				PageSize: len(houses),
+				Items:    houses,
+			},
+			Community:  resolved,
+			Candidates: candidates,
 		},
 	})
 }
@@ -370,7 +481,10 @@ func (h *HouseHandler) GetNearbyLandmarks(w http.ResponseWriter, r *http.Request
 		})
 		return
 	}
+	span := startHouseSpan(r.Context(), "GetByCommunity", userID)
 	houses := h.houseManager.GetByCommunity(community, userID)
+	span.SetAttributes(telemetry.Attr("house.community", community), telemetry.Attr("house.returned", len(houses)))
+	span.End()
 	if len(houses) == 0 {
 		json.NewEncoder(w).Encode(HouseHTTPResponse{
 			Code:    0,
@@ -418,6 +532,9 @@ func parseHouseQuery(r *http.Request) *fake_app.HouseQuery {
 		PageSize: 20,
 	}
 
+	// 全文检索关键词
+	query.Keyword = strings.TrimSpace(q.Get("q"))
+
 	// 行政区
 	if d := q.Get("district"); d != "" {
 		query.Districts = strings.Split(d, ",")
@@ -486,6 +603,17 @@ func parseHouseQuery(r *http.Request) *fake_app.HouseQuery {
 		query.CommuteToXierqiMax, _ = strconv.Atoi(c)
 	}
 
+	// 标签与隐性属性
+	query.Tags = splitParam(q.Get("tags"))
+	query.AnyTags = splitParam(q.Get("tags_any"))
+	query.Bathrooms = splitIntParam(q.Get("bathrooms"))
+	if b := q.Get("min_bathrooms"); b != "" {
+		query.MinBathrooms, _ = strconv.Atoi(b)
+	}
+	query.Floors = splitParam(q.Get("floor"))
+	query.NoiseLevels = splitParam(q.Get("hidden_noise_level"))
+	query.ListingPlatforms = splitParam(q.Get("listing_platform"))
+
 	// 排序
 	query.SortBy = q.Get("sort_by")
 	query.SortOrder = q.Get("sort_order")
@@ -509,3 +637,103 @@ func parseHouseQuery(r *http.Request) *fake_app.HouseQuery {
 
 	return query
 }
+
+// resolveCommutes 解析通勤目的地参数并写入 query，出错时写错误响应并返回 false：
+// commute_to 地标ID或名称（支持拼音、错别字），多个逗号分隔；commute_max 各目的地的通勤上限（分钟），
+// 只给一个值时对所有目的地生效；commute_weights 各目的地权重（weighted 排序用）；commute_rank 为 sum/max/weighted
+func (h *HouseHandler) resolveCommutes(w http.ResponseWriter, r *http.Request, query *fake_app.HouseQuery) bool {
+	q := r.URL.Query()
+	names := splitParam(q.Get("commute_to"))
+	if len(names) == 0 {
+		return true
+	}
+	fail := func(status int, message string) bool {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(HouseHTTPResponse{
+			Code:    status,
+			Message: message,
+		})
+		return false
+	}
+	if h.landmarkManager == nil {
+		return fail(http.StatusServiceUnavailable, "地标服务不可用，无法按 commute_to 计算通勤时间")
+	}
+
+	maxes, ok := commuteParamValues(q.Get("commute_max"), len(names))
+	if !ok {
+		return fail(http.StatusBadRequest, "commute_max 须为非负整数（分钟），个数为 1 或与 commute_to 相同")
+	}
+	weights, ok := commuteParamValues(q.Get("commute_weights"), len(names))
+	if !ok {
+		return fail(http.StatusBadRequest, "commute_weights 须为非负数，个数为 1 或与 commute_to 相同")
+	}
+	rank := strings.TrimSpace(q.Get("commute_rank"))
+	if !fake_app.ValidCommuteRank(rank) {
+		return fail(http.StatusBadRequest, "commute_rank 须为 sum、max 或 weighted")
+	}
+
+	targets := make([]fake_app.CommuteTarget, 0, len(names))
+	for i, name := range names {
+		landmark := h.landmarkManager.GetByID(name)
+		if landmark == nil {
+			landmark = h.landmarkManager.GetByName(name)
+		}
+		if landmark == nil {
+			return fail(http.StatusNotFound, "未找到通勤目的地: "+name)
+		}
+		targets = append(targets, fake_app.CommuteTarget{Landmark: landmark, Weight: weights[i], MaxMinutes: int(maxes[i])})
+	}
+	if len(targets) == 1 {
+		query.CommuteTo, query.CommuteMax = targets[0].Landmark, targets[0].MaxMinutes
+		return true
+	}
+	query.CommuteTargets = targets
+	query.CommuteRank = rank
+	return true
+}
+
+// commuteParamValues 解析逗号分隔的非负数列表，结果长度为 n：未填为全 0，只填一个值时对所有目的地生效
+func commuteParamValues(v string, n int) ([]float64, bool) {
+	out := make([]float64, n)
+	parts := splitParam(v)
+	if len(parts) == 0 {
+		return out, true
+	}
+	if len(parts) != 1 && len(parts) != n {
+		return nil, false
+	}
+	for i := range out {
+		part := parts[0]
+		if len(parts) == n {
+			part = parts[i]
+		}
+		f, err := strconv.ParseFloat(part, 64)
+		if err != nil || f < 0 {
+			return nil, false
+		}
+		out[i] = f
+	}
+	return out, true
+}
+
+// splitParam 拆分逗号分隔的参数，去掉空白与空项
+func splitParam(v string) []string {
+	var out []string
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// splitIntParam 拆分逗号分隔的整数参数，忽略无法解析的项
+func splitIntParam(v string) []int {
+	var out []int
+	for _, part := range splitParam(v) {
+		if n, err := strconv.Atoi(part); err == nil {
+			out = append(out, n)
+		}
+	}
+	return out
+}
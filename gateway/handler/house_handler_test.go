@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSearchHousesRejectsHugePage(t *testing.T) {
+	h := &HouseHandler{}
+	req := httptest.NewRequest(http.MethodPost, "/api/houses/search", strings.NewReader(`{"page": 9223372036854775807, "page_size": 100}`))
+	req.Header.Set("X-User-ID", "u-1")
+	rec := httptest.NewRecorder()
+	h.SearchHouses(rec, req)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "page") {
+		t.Errorf("状态码 = %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -29,6 +29,11 @@ type LandmarkResponse struct {
 	Longitude float64                `json:"longitude"`
 	Latitude  float64                `json:"latitude"`
 	Details   map[string]interface{} `json:"details,omitempty"`
+
+	// 仅模糊匹配结果
+	Score       float64 `json:"score,omitempty"`
+	MatchType   string  `json:"match_type,omitempty"`
+	MatchedName string  `json:"matched_name,omitempty"`
 }
 
 // LandmarkListResponse 地标列表响应
@@ -48,7 +53,7 @@ type LandmarkHTTPResponse struct {
 func (h *LandmarkHandler) SetupLandmarkRoutes(r *mux.Router) {
 	// 获取全部地标（支持类别筛选）
 	r.HandleFunc("/api/landmarks", h.GetAllLandmarks).Methods("GET")
-	// 根据名称精确查询
+	// 根据名称查询（精确匹配，未命中时拼音/错别字模糊匹配）
 	r.HandleFunc("/api/landmarks/name/{name}", h.GetByName).Methods("GET")
 	// 关键词搜索（模糊匹配）
 	r.HandleFunc("/api/landmarks/search", h.SearchByKeyword).Methods("GET")
@@ -74,6 +79,19 @@ func convertToLandmarkResponse(lm *fake_app.Landmark) *LandmarkResponse {
 	}
 }
 
+// convertMatchesToLandmarkResponses 转换模糊匹配结果，附带分数与命中的名称
+func convertMatchesToLandmarkResponses(matches []*fake_app.LandmarkMatch) []*LandmarkResponse {
+	items := make([]*LandmarkResponse, 0, len(matches))
+	for _, m := range matches {
+		item := convertToLandmarkResponse(&m.Landmark)
+		item.Score = m.Score
+		item.MatchType = m.MatchType
+		item.MatchedName = m.MatchedName
+		items = append(items, item)
+	}
+	return items
+}
+
 // GetAllLandmarks 获取全部地标信息
 // 支持查询参数：category=subway|company|landmark，district=行政区名
 func (h *LandmarkHandler) GetAllLandmarks(w http.ResponseWriter, r *http.Request) {
@@ -114,9 +132,10 @@ func (h *LandmarkHandler) GetAllLandmarks(w http.ResponseWriter, r *http.Request
 	})
 }
 
-// GetByName 根据名称精确查询地标
+// GetByName 根据名称查询地标：精确匹配优先，未命中时按拼音、简拼、错别字模糊匹配可信的唯一候选；
+// 仍未找到时返回 404，data 中带模糊匹配候选（含分数）供确认
 // URL 格式: /api/landmarks/name/{name}
-// 示例: /api/landmarks/name/西二旗站
+// 示例: /api/landmarks/name/西二旗站、/api/landmarks/name/xierqi
 func (h *LandmarkHandler) GetByName(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -137,11 +156,17 @@ func (h *LandmarkHandler) GetByName(w http.ResponseWriter, r *http.Request) {
 
 	landmark := h.manager.GetByName(name)
 	if landmark == nil {
+		candidates := convertMatchesToLandmarkResponses(h.manager.MatchByName(name, 5))
 		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(LandmarkHTTPResponse{
+		resp := LandmarkHTTPResponse{
 			Code:    404,
 			Message: "未找到地标: " + name,
-		})
+		}
+		if len(candidates) > 0 {
+			resp.Message += "，是否为以下地标之一？"
+			resp.Data = LandmarkListResponse{Total: len(candidates), Items: candidates}
+		}
+		json.NewEncoder(w).Encode(resp)
 		return
 	}
 
@@ -171,25 +196,22 @@ func (h *LandmarkHandler) SearchByKeyword(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// 执行搜索
+	// 执行搜索（按匹配分数降序）
 	results := h.manager.SearchByKeyword(keyword)
 
 	// 如果指定了类别，进行过滤
 	if category != "" {
-		filtered := make([]*fake_app.Landmark, 0)
-		for _, lm := range results {
-			if string(lm.Category) == category {
-				filtered = append(filtered, lm)
+		filtered := make([]*fake_app.LandmarkMatch, 0)
+		for _, m := range results {
+			if string(m.Landmark.Category) == category {
+				filtered = append(filtered, m)
 			}
 		}
 		results = filtered
 	}
 
 	// 转换为响应结构
-	items := make([]*LandmarkResponse, 0, len(results))
-	for _, lm := range results {
-		items = append(items, convertToLandmarkResponse(lm))
-	}
+	items := convertMatchesToLandmarkResponses(results)
 
 	json.NewEncoder(w).Encode(LandmarkHTTPResponse{
 		Code:    0,
@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 子系统状态
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable" // 初始化失败
+	statusUnreachable = "unreachable" // 上游探测失败
+)
+
+// upstreamProbeTimeout 上游探测超时
+const upstreamProbeTimeout = 3 * time.Second
+
+// SubsystemStatus 单个子系统的就绪状态
+type SubsystemStatus struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	LatencyMS int64  `json:"latency_ms,omitempty"` // 仅上游探测
+}
+
+// ReadyResponse /ready 响应
+type ReadyResponse struct {
+	Status           string            `json:"status"` // ready、not_ready 或 draining
+	InflightRequests int64             `json:"inflight_requests"`
+	InflightStreams  int64             `json:"inflight_streams"`
+	Subsystems       []SubsystemStatus `json:"subsystems"`
+}
+
+// Ready 深度就绪检查：各管理器是否初始化成功，upstream=true 时并发探测 chat、work 模型上游是否可达。
+// 全部正常返回 200，任一子系统异常或服务正在停机时返回 503
+// GET /ready
+func (h *Handler) Ready(w http.ResponseWriter, r *http.Request) {
+	subsystems := []SubsystemStatus{
+		managerStatus("user", h.userManager != nil, nil, func() string {
+			return fmt.Sprintf("%d 个用户", h.userManager.GetUserCount())
+		}),
+		managerStatus("rank", h.rankManager != nil, nil, func() string {
+			return fmt.Sprintf("%d 条排行数据", h.rankManager.GetRankCount())
+		}),
+		managerStatus("landmark", h.landmarkManager != nil, h.landmarkErr, func() string {
+			return fmt.Sprintf("%d 个地标", len(h.landmarkManager.GetAll()))
+		}),
+		managerStatus("house", h.houseManager != nil, h.houseErr, func() string {
+			return fmt.Sprintf("%d 套房源", len(h.houseManager.GetAll("")))
+		}),
+	}
+	if probe, _ := strconv.ParseBool(r.URL.Query().Get("upstream")); probe {
+		subsystems = append(subsystems, h.probeUpstreams(r.Context())...)
+	}
+
+	resp := ReadyResponse{
+		Status:           "ready",
+		InflightRequests: h.inflightRequests.Load(),
+		InflightStreams:  h.inflightStreams.Load(),
+		Subsystems:       subsystems,
+	}
+	for _, s := range subsystems {
+		if s.Status != statusOK {
+			resp.Status = "not_ready"
+		}
+	}
+	if h.draining.Load() {
+		resp.Status = "draining"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Status != "ready" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// managerStatus 管理器状态：已初始化时 detail 为数据量，否则为初始化错误
+func managerStatus(name string, ok bool, initErr error, detail func() string) SubsystemStatus {
+	if !ok {
+		s := SubsystemStatus{Name: name, Status: statusUnavailable, Detail: "未初始化"}
+		if initErr != nil {
+			s.Detail = initErr.Error()
+		}
+		return s
+	}
+	return SubsystemStatus{Name: name, Status: statusOK, Detail: detail()}
+}
+
+// probeUpstreams 并发探测 chat、work 模型的 base_url：收到任意 HTTP 响应即视为可达
+func (h *Handler) probeUpstreams(ctx context.Context) []SubsystemStatus {
+	cfg := h.effectiveConfig()
+	targets := []struct{ role, baseURL string }{
+		{modelRoleChat, cfg.ChatModel.BaseURL},
+		{modelRoleWork, cfg.WorkModel.BaseURL},
+	}
+	out := make([]SubsystemStatus, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, role, baseURL string) {
+			defer wg.Done()
+			out[i] = probeUpstream(ctx, "upstream."+role, baseURL)
+		}(i, t.role, t.baseURL)
+	}
+	wg.Wait()
+	return out
+}
+
+func probeUpstream(ctx context.Context, name, baseURL string) SubsystemStatus {
+	baseURL = strings.TrimSpace(baseURL)
+	if baseURL == "" {
+		return SubsystemStatus{Name: name, Status: statusUnavailable, Detail: "未配置 base_url"}
+	}
+	ctx, cancel := context.WithTimeout(ctx, upstreamProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL, nil)
+	if err != nil {
+		return SubsystemStatus{Name: name, Status: statusUnreachable, Detail: err.Error()}
+	}
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	latency := time.Since(start).Milliseconds()
+	if err != nil {
+		return SubsystemStatus{Name: name, Status: statusUnreachable, Detail: err.Error(), LatencyMS: latency}
+	}
+	resp.Body.Close()
+	return SubsystemStatus{Name: name, Status: statusOK, Detail: fmt.Sprintf("%s 响应 HTTP %d", baseURL, resp.StatusCode), LatencyMS: latency}
+}
+
+// trackInflight 路由中间件：统计进行中的请求与 SSE 流，供 /ready 展示和停机时等待
+func (h *Handler) trackInflight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.inflightRequests.Add(1)
+		defer h.inflightRequests.Add(-1)
+		sw := &streamWriter{ResponseWriter: w, h: h}
+		defer sw.done()
+		next.ServeHTTP(sw, r)
+	})
+}
+
+// streamWriter 在写出响应头时识别 text/event-stream 响应并计数，保留 Flush 以支持 SSE
+type streamWriter struct {
+	http.ResponseWriter
+	h         *Handler
+	checked   bool
+	streaming bool
+}
+
+func (w *streamWriter) check() {
+	if w.checked {
+		return
+	}
+	w.checked = true
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		w.streaming = true
+		w.h.inflightStreams.Add(1)
+	}
+}
+
+func (w *streamWriter) done() {
+	if w.streaming {
+		w.h.inflightStreams.Add(-1)
+	}
+}
+
+func (w *streamWriter) WriteHeader(code int) {
+	w.check()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.check()
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *streamWriter) Flush() {
+	w.check()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *streamWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// StartDrain 进入停机排空状态：/ready 返回 503，负载均衡不再分配新请求
+func (h *Handler) StartDrain() {
+	h.draining.Store(true)
+}
+
+// InflightStreams 进行中的 SSE 流数量
+func (h *Handler) InflightStreams() int64 {
+	return h.inflightStreams.Load()
+}
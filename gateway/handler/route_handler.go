@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"ocProxy/fake_app"
+
+	"github.com/gorilla/mux"
+)
+
+// 路线端点类型
+const (
+	placeHouse      = "house"
+	placeLandmark   = "landmark"
+	placeCommunity  = "community"
+	placeCoordinate = "coordinate"
+)
+
+// RouteHandler 地铁通勤路线估算的 HTTP 处理器
+type RouteHandler struct {
+	houseManager    *fake_app.HouseManager
+	landmarkManager *fake_app.LandmarkManager
+}
+
+// NewRouteHandler 创建路线估算 HTTP 处理器；houseManager 为 nil 时端点不支持房源与小区
+func NewRouteHandler(houseManager *fake_app.HouseManager, landmarkManager *fake_app.LandmarkManager) *RouteHandler {
+	return &RouteHandler{
+		houseManager:    houseManager,
+		landmarkManager: landmarkManager,
+	}
+}
+
+// RoutePlace 路线端点
+type RoutePlace struct {
+	Query     string  `json:"query"` // 请求中的原始值
+	Type      string  `json:"type"`  // house/landmark/community/coordinate
+	Name      string  `json:"name"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// RouteResponse 路线估算响应
+type RouteResponse struct {
+	From  *RoutePlace           `json:"from"`
+	To    *RoutePlace           `json:"to"`
+	Route *fake_app.SubwayRoute `json:"route"`
+}
+
+// SetupRouteRoutes 设置路线估算路由
+func (h *RouteHandler) SetupRouteRoutes(r *mux.Router) {
+	r.HandleFunc("/api/route", h.PlanRoute).Methods("GET")
+	r.HandleFunc("/api/route/lines", h.GetLines).Methods("GET")
+}
+
+// PlanRoute 估算两地间的地铁通勤路线：步行到最近的地铁站、乘车与换乘、出站步行到终点
+// GET /api/route?from=HF_2001&to=百度科技园、?from=40.05,116.30&to=国贸站、?from=西二旗站&to=望京站
+//
+// from、to 可为房源ID、地标ID或名称（含地铁站，支持拼音、错别字）、小区名或 "纬度,经度"
+func (h *RouteHandler) PlanRoute(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	fromQuery, toQuery := strings.TrimSpace(q.Get("from")), strings.TrimSpace(q.Get("to"))
+	if fromQuery == "" || toQuery == "" {
+		writeRouteError(w, http.StatusBadRequest, "请提供 from 与 to 参数")
+		return
+	}
+	userID := userIDFromRequest(r)
+	from, err := h.resolvePlace(fromQuery, userID)
+	if err != nil {
+		writeRouteError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	to, err := h.resolvePlace(toQuery, userID)
+	if err != nil {
+		writeRouteError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	route := h.landmarkManager.PlanRoute(from.Name, from.Latitude, from.Longitude, to.Name, to.Latitude, to.Longitude)
+	writeRouteResponse(w, RouteResponse{From: from, To: to, Route: route})
+}
+
+// GetLines 查看线网图：每条线路的站点与推断出的相邻站连接
+// GET /api/route/lines
+func (h *RouteHandler) GetLines(w http.ResponseWriter, r *http.Request) {
+	writeRouteResponse(w, map[string]interface{}{
+		"lines":   h.landmarkManager.SubwayLines(),
+		"options": h.landmarkManager.SubwayOptions(),
+	})
+}
+
+// resolvePlace 解析路线端点，依次尝试 "纬度,经度"、房源ID、地标ID、地标名称、小区名
+func (h *RouteHandler) resolvePlace(query, userID string) (*RoutePlace, error) {
+	if lat, lng, ok := parseLatLng(query); ok {
+		return &RoutePlace{Query: query, Type: placeCoordinate, Name: query, Latitude: lat, Longitude: lng}, nil
+	}
+	if h.houseManager != nil {
+		if house := h.houseManager.GetByID(query, userID); house != nil {
+			return &RoutePlace{Query: query, Type: placeHouse, Name: house.Community, Latitude: house.Latitude, Longitude: house.Longitude}, nil
+		}
+	}
+	landmark := h.landmarkManager.GetByID(query)
+	if landmark == nil {
+		landmark = h.landmarkManager.GetByName(query)
+	}
+	if landmark != nil {
+		return &RoutePlace{Query: query, Type: placeLandmark, Name: landmark.Name, Latitude: landmark.Latitude, Longitude: landmark.Longitude}, nil
+	}
+	if h.houseManager != nil {
+		resolved, _ := h.houseManager.ResolveCommunity(query)
+		if houses := h.houseManager.GetByCommunity(resolved, userID); len(houses) > 0 {
+			return &RoutePlace{Query: query, Type: placeCommunity, Name: resolved, Latitude: houses[0].Latitude, Longitude: houses[0].Longitude}, nil
+		}
+	}
+	return nil, fmt.Errorf("未找到地点: %s（可为房源ID、地标ID或名称、小区名或 纬度,经度）", query)
+}
+
+// parseLatLng 解析 "纬度,经度"
+func parseLatLng(s string) (float64, float64, bool) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	lat, err1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	lng, err2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err1 != nil || err2 != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return 0, 0, false
+	}
+	return lat, lng, true
+}
+
+func writeRouteResponse(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HouseHTTPResponse{
+		Code:    0,
+		Message: "success",
+		Data:    data,
+	})
+}
+
+func writeRouteError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(HouseHTTPResponse{
+		Code:    status,
+		Message: message,
+	})
+}
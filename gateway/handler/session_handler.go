@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"ocProxy/gateway/internal/logger"
+	"ocProxy/gateway/internal/middleware"
+	"ocProxy/gateway/internal/session"
+
+	"github.com/gorilla/mux"
+	"github.com/sashabaranov/go-openai"
+)
+
+// CreateSessionRequest 创建会话请求
+type CreateSessionRequest struct {
+	Model    string                         `json:"model"`
+	Messages []openai.ChatCompletionMessage `json:"messages"` // 初始消息，如 system
+	Metadata map[string]string              `json:"metadata"`
+}
+
+// SessionListResponse 会话列表响应
+type SessionListResponse struct {
+	Object string            `json:"object"`
+	Data   []session.Summary `json:"data"`
+}
+
+// writeOpenAIError 以 OpenAI 错误格式写出错误
+func writeOpenAIError(w http.ResponseWriter, status int, errType, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    errType,
+			"code":    code,
+		},
+	})
+}
+
+// writeSessionError 会话读写错误：不存在为 404，其余为 500
+func writeSessionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, session.ErrNotFound) {
+		writeOpenAIError(w, http.StatusNotFound, "invalid_request_error", "session_not_found", err.Error())
+		return
+	}
+	writeOpenAIError(w, http.StatusInternalServerError, "server_error", "session_error", err.Error())
+}
+
+// sessionIDFromBody 读取请求体中的 session_id 字段（非 OpenAI 标准字段）
+func sessionIDFromBody(body []byte) string {
+	var raw struct {
+		SessionID string `json:"session_id"`
+	}
+	json.Unmarshal(body, &raw)
+	return raw.SessionID
+}
+
+// requireSessionStore 会话存储不可用时写 503 并返回 true
+func (h *Handler) requireSessionStore(w http.ResponseWriter) bool {
+	if h.sessionStore != nil {
+		return false
+	}
+	writeOpenAIError(w, http.StatusServiceUnavailable, "server_error", "sessions_unavailable", "会话存储不可用")
+	return true
+}
+
+// CreateSession 创建会话
+// POST /v1/sessions
+func (h *Handler) CreateSession(w http.ResponseWriter, r *http.Request) {
+	if h.requireSessionStore(w) {
+		return
+	}
+	var req CreateSessionRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "invalid_request", fmt.Sprintf("Invalid request: %v", err))
+			return
+		}
+	}
+	sess, err := h.sessionStore.Create(req.Model, req.Messages, req.Metadata)
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	log.Printf("[Session] 创建会话 %s, model=%s, 初始消息数=%d", sess.ID, sess.Model, len(sess.Messages))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sess)
+}
+
+// ListSessions 列出会话（按更新时间倒序）
+// GET /v1/sessions
+func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	if h.requireSessionStore(w) {
+		return
+	}
+	summaries, err := h.sessionStore.List()
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SessionListResponse{Object: "list", Data: summaries})
+}
+
+// GetSession 获取会话详情（含完整消息历史）
+// GET /v1/sessions/{id}
+func (h *Handler) GetSession(w http.ResponseWriter, r *http.Request) {
+	if h.requireSessionStore(w) {
+		return
+	}
+	sess, err := h.sessionStore.Get(mux.Vars(r)["id"])
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sess)
+}
+
+// ExportSession 导出会话为附件：format=json（默认，完整会话）或 jsonl（每行一条消息）
+// GET /v1/sessions/{id}/export
+func (h *Handler) ExportSession(w http.ResponseWriter, r *http.Request) {
+	if h.requireSessionStore(w) {
+		return
+	}
+	sess, err := h.sessionStore.Get(mux.Vars(r)["id"])
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, sess.ID))
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(sess)
+	case "jsonl":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.jsonl"`, sess.ID))
+		enc := json.NewEncoder(w)
+		for _, msg := range sess.Messages {
+			enc.Encode(msg)
+		}
+	default:
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "invalid_format", "format 仅支持 json 或 jsonl")
+	}
+}
+
+// DeleteSession 删除会话
+// DELETE /v1/sessions/{id}
+func (h *Handler) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	if h.requireSessionStore(w) {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	if err := h.sessionStore.Delete(id); err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	log.Printf("[Session] 删除会话 %s", id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      id,
+		"object":  "session.deleted",
+		"deleted": true,
+	})
+}
+
+// SessionChatCompletion 会话内的聊天请求，请求体与 /v1/chat/completions 一致但 messages 只含本轮新增消息；
+// OpenAI SDK 可将 base_url 设为 /v1/sessions/{id} 直接使用
+// POST /v1/sessions/{id}/chat/completions
+func (h *Handler) SessionChatCompletion(w http.ResponseWriter, r *http.Request) {
+	body, req, ok := readChatRequest(w, r)
+	if !ok {
+		return
+	}
+	h.sessionChat(w, r, mux.Vars(r)["id"], req, body)
+}
+
+// sessionChat 拼接历史与新增消息、按 token 预算裁剪后调用上游；成功后将新增消息与 assistant 回复追加到会话
+func (h *Handler) sessionChat(w http.ResponseWriter, r *http.Request, sessionID string, req openai.ChatCompletionRequest, body []byte) {
+	if h.requireSessionStore(w) {
+		return
+	}
+	// 会话不存在（含非法 ID）时不加锁直接返回
+	unlock, err := h.sessionStore.Lock(sessionID)
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	defer unlock()
+	logger.TraceFromContext(r.Context()).SetSessionID(sessionID)
+
+	sess, err := h.sessionStore.Get(sessionID)
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	newMessages := req.Messages
+	if len(newMessages) == 0 {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "invalid_request", "messages 不能为空")
+		return
+	}
+	if req.Model == "" {
+		req.Model = sess.Model
+	}
+
+	history := make([]openai.ChatCompletionMessage, 0, len(sess.Messages)+len(newMessages))
+	history = append(history, sess.Messages...)
+	history = append(history, newMessages...)
+	req.Messages = session.TrimContext(history, h.sessionMaxTokens)
+	log.Printf("[Session] 会话 %s: 历史=%d, 新增=%d, 发送=%d", sessionID, len(sess.Messages), len(newMessages), len(req.Messages))
+
+	h.serveChatCompletion(w, r, req, body, func(reply openai.ChatCompletionMessage) {
+		toAppend := append(append([]openai.ChatCompletionMessage(nil), newMessages...), reply)
+		if _, err := h.sessionStore.Append(sessionID, toAppend...); err != nil {
+			log.Printf("[警告] 会话 %s 追加消息失败: %v", sessionID, err)
+		}
+	})
+}
+
+// SetupSessionRoutes 设置会话路由
+func (h *Handler) SetupSessionRoutes(r *mux.Router) {
+	r.HandleFunc("/v1/sessions", h.CreateSession).Methods("POST")
+	r.HandleFunc("/v1/sessions", h.ListSessions).Methods("GET")
+	r.HandleFunc("/v1/sessions/{id}", h.GetSession).Methods("GET")
+	r.HandleFunc("/v1/sessions/{id}", h.DeleteSession).Methods("DELETE")
+	r.HandleFunc("/v1/sessions/{id}/export", h.ExportSession).Methods("GET")
+	r.HandleFunc("/v1/sessions/{id}/chat/completions", h.traced(middleware.StreamFormatOpenAI, h.SessionChatCompletion)).Methods("POST")
+}
@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"ocProxy/gateway/config"
+	"ocProxy/gateway/internal/skill"
+
+	"github.com/gorilla/mux"
+)
+
+// SkillInfo 技能列表项
+type SkillInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Triggers    []string `json:"triggers,omitempty"`
+	Models      []string `json:"models,omitempty"`
+	Path        string   `json:"path"`
+	Tokens      int      `json:"tokens"`
+	Enabled     bool     `json:"enabled"`
+}
+
+// SkillDetail 技能详情，含注入的正文
+type SkillDetail struct {
+	SkillInfo
+	Content string `json:"content"`
+}
+
+// SkillListResponse 技能列表响应
+type SkillListResponse struct {
+	Object   string      `json:"object"`
+	Data     []SkillInfo `json:"data"`
+	LoadedAt time.Time   `json:"loaded_at"`
+}
+
+// SkillSetRequest 设置技能集请求
+type SkillSetRequest struct {
+	Skills []string `json:"skills"` // 技能名，支持通配符；为空表示删除该技能集
+}
+
+// newSkillLibrary 根据配置创建技能库并开始监听文件变更；未配置 skill_dirs 或加载失败时返回 nil
+func newSkillLibrary(cfg *config.Config) *skill.Library {
+	var dirs []string
+	for _, d := range cfg.SkillDirs {
+		if s := strings.TrimSpace(d); s != "" {
+			dirs = append(dirs, s)
+		}
+	}
+	if len(dirs) == 0 {
+		return nil
+	}
+	opts := skill.SelectOptions{
+		TokenBudget: cfg.SkillSelection.TokenBudget,
+		MaxSkills:   cfg.SkillSelection.MaxSkills,
+		MinScore:    cfg.SkillSelection.MinScore,
+	}
+	libCfg := cfg.SkillLibrary
+	lib, err := skill.NewLibrary(dirs, opts, libCfg.Disabled)
+	if err != nil {
+		log.Printf("[警告] 加载技能失败: %v，不注入技能", err)
+		return nil
+	}
+	for model, names := range libCfg.ModelSets {
+		if err := lib.SetSkillSet(skill.SetKindModel, model, names); err != nil {
+			log.Printf("[警告] 技能集 model_sets.%s 无效: %v", model, err)
+		}
+	}
+	for user, names := range libCfg.UserSets {
+		if err := lib.SetSkillSet(skill.SetKindUser, user, names); err != nil {
+			log.Printf("[警告] 技能集 user_sets.%s 无效: %v", user, err)
+		}
+	}
+	if libCfg.WatchInterval >= 0 {
+		lib.Watch(time.Duration(libCfg.WatchInterval) * time.Second)
+	}
+	log.Printf("[Skill] 技能库初始化完成，共 %d 个技能", len(lib.Skills()))
+	return lib
+}
+
+// requireSkills 技能库不可用时写 503 并返回 true
+func (h *Handler) requireSkills(w http.ResponseWriter) bool {
+	if h.skills != nil {
+		return false
+	}
+	writeOpenAIError(w, http.StatusServiceUnavailable, "server_error", "skills_unavailable", "技能库不可用（未配置 skill_dirs 或加载失败）")
+	return true
+}
+
+// writeSkillError 技能不存在为 404，其余为 400
+func writeSkillError(w http.ResponseWriter, err error) {
+	if errors.Is(err, skill.ErrNotFound) {
+		writeOpenAIError(w, http.StatusNotFound, "invalid_request_error", "skill_not_found", err.Error())
+		return
+	}
+	writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "invalid_request", err.Error())
+}
+
+func (h *Handler) skillInfo(s *skill.Skill) SkillInfo {
+	return SkillInfo{
+		Name:        s.Name,
+		Description: s.Description,
+		Triggers:    s.Triggers,
+		Models:      s.Models,
+		Path:        s.Path,
+		Tokens:      s.Tokens,
+		Enabled:     h.skills.Enabled(s.Name),
+	}
+}
+
+// ListSkills 列出已加载的技能及启用状态
+// GET /api/skills
+func (h *Handler) ListSkills(w http.ResponseWriter, r *http.Request) {
+	if h.requireSkills(w) {
+		return
+	}
+	skills := h.skills.Skills()
+	data := make([]SkillInfo, 0, len(skills))
+	for _, s := range skills {
+		data = append(data, h.skillInfo(s))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SkillListResponse{Object: "list", Data: data, LoadedAt: h.skills.LoadedAt()})
+}
+
+// GetSkill 获取技能详情（含正文）
+// GET /api/skills/{name}
+func (h *Handler) GetSkill(w http.ResponseWriter, r *http.Request) {
+	if h.requireSkills(w) {
+		return
+	}
+	s, err := h.skills.Get(mux.Vars(r)["name"])
+	if err != nil {
+		writeSkillError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SkillDetail{SkillInfo: h.skillInfo(s), Content: s.Content})
+}
+
+// setSkillEnabled 返回启用或禁用技能的处理函数
+// POST /api/skills/{name}/enable、POST /api/skills/{name}/disable
+func (h *Handler) setSkillEnabled(enabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.requireSkills(w) {
+			return
+		}
+		name := mux.Vars(r)["name"]
+		if err := h.skills.SetEnabled(name, enabled); err != nil {
+			writeSkillError(w, err)
+			return
+		}
+		s, err := h.skills.Get(name)
+		if err != nil {
+			writeSkillError(w, err)
+			return
+		}
+		log.Printf("[Skill] 技能 %s enabled=%v", name, enabled)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.skillInfo(s))
+	}
+}
+
+// ReloadSkills 立即重新扫描 skill_dirs，文件有变化时重新加载
+// POST /api/skills/reload
+func (h *Handler) ReloadSkills(w http.ResponseWriter, r *http.Request) {
+	if h.requireSkills(w) {
+		return
+	}
+	changed, err := h.skills.Reload()
+	if err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, "server_error", "skill_reload_failed", fmt.Sprintf("重新加载技能失败: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"changed":   changed,
+		"count":     len(h.skills.Skills()),
+		"loaded_at": h.skills.LoadedAt(),
+	})
+}
+
+// GetSkillSets 获取模型与用户技能集
+// GET /api/skills/sets
+func (h *Handler) GetSkillSets(w http.ResponseWriter, r *http.Request) {
+	if h.requireSkills(w) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.skills.Sets())
+}
+
+// PutSkillSet 设置模型或用户的技能集，kind 为 models 或 users
+// PUT /api/skills/sets/{kind}/{key}
+func (h *Handler) PutSkillSet(w http.ResponseWriter, r *http.Request) {
+	if h.requireSkills(w) {
+		return
+	}
+	var req SkillSetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "invalid_request", fmt.Sprintf("Invalid request: %v", err))
+		return
+	}
+	h.updateSkillSet(w, r, req.Skills)
+}
+
+// DeleteSkillSet 删除模型或用户的技能集，恢复为不限制
+// DELETE /api/skills/sets/{kind}/{key}
+func (h *Handler) DeleteSkillSet(w http.ResponseWriter, r *http.Request) {
+	if h.requireSkills(w) {
+		return
+	}
+	h.updateSkillSet(w, r, nil)
+}
+
+func (h *Handler) updateSkillSet(w http.ResponseWriter, r *http.Request, names []string) {
+	vars := mux.Vars(r)
+	if err := h.skills.SetSkillSet(vars["kind"], vars["key"], names); err != nil {
+		writeSkillError(w, err)
+		return
+	}
+	log.Printf("[Skill] 技能集 %s/%s = %v", vars["kind"], vars["key"], names)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.skills.Sets())
+}
+
+// SetupSkillRoutes 设置技能管理路由；查询接口公开，修改运行时技能的接口与 /api/admin 一样需要 admin token
+func (h *Handler) SetupSkillRoutes(r *mux.Router) {
+	admin := func(fn http.HandlerFunc) http.Handler { return h.adminAuth(fn) }
+	r.HandleFunc("/api/skills", h.ListSkills).Methods("GET")
+	r.Handle("/api/skills/reload", admin(h.ReloadSkills)).Methods("POST")
+	r.HandleFunc("/api/skills/sets", h.GetSkillSets).Methods("GET")
+	r.Handle("/api/skills/sets/{kind}/{key}", admin(h.PutSkillSet)).Methods("PUT")
+	r.Handle("/api/skills/sets/{kind}/{key}", admin(h.DeleteSkillSet)).Methods("DELETE")
+	r.HandleFunc("/api/skills/{name}", h.GetSkill).Methods("GET")
+	r.Handle("/api/skills/{name}/enable", admin(h.setSkillEnabled(true))).Methods("POST")
+	r.Handle("/api/skills/{name}/disable", admin(h.setSkillEnabled(false))).Methods("POST")
+}
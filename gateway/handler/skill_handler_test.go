@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ocProxy/gateway/config"
+	"ocProxy/gateway/internal/skill"
+
+	"github.com/gorilla/mux"
+)
+
+func skillRouter(t *testing.T) (*mux.Router, *skill.Library) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "send-email"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := "---\nname: send-email\ndescription: 发送邮件\n---\n发送邮件前先确认收件人。\n"
+	if err := os.WriteFile(filepath.Join(dir, "send-email", "SKILL.md"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lib, err := skill.NewLibrary([]string{dir}, skill.SelectOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{cfg: config.Config{Admin: config.AdminConfig{Token: "s3cret"}}, skills: lib}
+	r := mux.NewRouter()
+	h.SetupSkillRoutes(r)
+	return r, lib
+}
+
+func TestSkillMutationsRequireAdminToken(t *testing.T) {
+	r, lib := skillRouter(t)
+	mutations := []struct{ method, path, body string }{
+		{http.MethodPost, "/api/skills/reload", ""},
+		{http.MethodPost, "/api/skills/send-email/disable", ""},
+		{http.MethodPost, "/api/skills/send-email/enable", ""},
+		{http.MethodPut, "/api/skills/sets/users/u-1", `{"skills":["send-email"]}`},
+		{http.MethodDelete, "/api/skills/sets/users/u-1", ""},
+	}
+
+	for _, m := range mutations {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(m.method, m.path, strings.NewReader(m.body)))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("无 token 时 %s %s 状态码 = %d, 期望 401", m.method, m.path, rec.Code)
+		}
+	}
+	if !lib.Enabled("send-email") {
+		t.Fatal("未鉴权的请求不应禁用技能")
+	}
+
+	for _, p := range []string{"/api/skills", "/api/skills/sets", "/api/skills/send-email"} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, p, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("查询接口 %s 状态码 = %d, 期望 200", p, rec.Code)
+		}
+	}
+
+	for _, m := range mutations {
+		req := httptest.NewRequest(m.method, m.path, strings.NewReader(m.body))
+		req.Header.Set("X-Admin-Token", "s3cret")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("带 token 时 %s %s 状态码 = %d: %s", m.method, m.path, rec.Code, rec.Body.String())
+		}
+	}
+}
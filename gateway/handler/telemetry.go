@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"ocProxy/gateway/config"
+	"ocProxy/gateway/internal/telemetry"
+)
+
+// newTracer 根据配置创建 Tracer；exporter 创建失败时记录警告，仍传播 traceparent
+func newTracer(cfg config.TelemetryConfig) *telemetry.Tracer {
+	var exporters []telemetry.Exporter
+	if endpoint := strings.TrimSpace(cfg.OTLPEndpoint); endpoint != "" {
+		exporters = append(exporters, telemetry.NewOTLPExporter(endpoint, cfg.OTLPHeaders))
+	}
+	if file := strings.TrimSpace(cfg.File); file != "" {
+		fe, err := telemetry.NewFileExporter(file)
+		if err != nil {
+			log.Printf("[警告] 创建 span 文件失败: %v，span 不写入本地文件", err)
+		} else {
+			exporters = append(exporters, fe)
+		}
+	}
+	var exporter telemetry.Exporter
+	if len(exporters) > 0 {
+		exporter = telemetry.MultiExporter(exporters...)
+	}
+	return telemetry.NewTracer(exporter, telemetry.TracerOptions{
+		ServiceName:   strings.TrimSpace(cfg.ServiceName),
+		FlushInterval: time.Duration(cfg.FlushInterval) * time.Second,
+	})
+}
+
+// startHouseSpan 为 HouseManager 查询开始 span，op 为方法名（如 QueryWithPagination）
+func startHouseSpan(ctx context.Context, op, userID string) *telemetry.Span {
+	_, span := telemetry.Start(ctx, "HouseManager."+op, telemetry.SpanKindInternal,
+		telemetry.Attr("house.op", op),
+		telemetry.Attr("user.id", userID),
+	)
+	return span
+}
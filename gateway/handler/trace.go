@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"ocProxy/gateway/internal/logger"
+	"ocProxy/gateway/internal/telemetry"
+	"ocProxy/gateway/internal/traceview"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// traced 为聊天接口开启请求链路 trace：在 context 中放入 Trace 供拦截器、路由与上游客户端记录，
+// 包装 ResponseWriter 记录（流式时重组）最终响应，请求结束后写入 trace_log_file。未配置 trace 日志时原样返回。
+// 客户端可通过 X-Request-Id 指定 trace ID；未指定且开启了分布式追踪时使用 W3C trace ID，
+// 便于在 trace 日志与 span 之间对照。响应头 X-Trace-Id 返回实际使用的 ID。
+func (h *Handler) traced(protocol string, next http.HandlerFunc) http.HandlerFunc {
+	if h.traceLogger == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		traceID := r.Header.Get("X-Request-Id")
+		if sc := telemetry.SpanFromContext(r.Context()).SpanContext(); traceID == "" && sc.IsValid() {
+			traceID = sc.TraceIDString()
+		}
+		trace := logger.NewTrace(traceID, protocol, r.Method, r.URL.Path)
+		trace.SetConversation(strings.TrimSpace(r.Header.Get("X-User-ID")), "")
+		w.Header().Set("X-Trace-Id", trace.ID())
+		tw := logger.NewTraceWriter(w, trace)
+		defer func() {
+			if err := h.traceLogger.Log(tw.Finish()); err != nil {
+				log.Printf("[警告] 保存 trace 日志失败: %v", err)
+			}
+		}()
+		next(tw, r.WithContext(logger.WithTrace(r.Context(), trace)))
+	}
+}
+
+// traceTitleMaxRunes trace 会话标题最大字符数
+const traceTitleMaxRunes = 80
+
+// firstUserText 取首条 user 消息文本作为 trace 会话标题，应在技能注入前调用
+func firstUserText(messages []openai.ChatCompletionMessage) string {
+	for _, m := range messages {
+		if m.Role != openai.ChatMessageRoleUser {
+			continue
+		}
+		text := m.Content
+		if text == "" {
+			for _, p := range m.MultiContent {
+				if p.Type == openai.ChatMessagePartTypeText {
+					text = p.Text
+					break
+				}
+			}
+		}
+		text = strings.Join(strings.Fields(text), " ")
+		if r := []rune(text); len(r) > traceTitleMaxRunes {
+			text = string(r[:traceTitleMaxRunes]) + "…"
+		}
+		return text
+	}
+	return ""
+}
+
+// isFakeAppPath 判断是否为 fake_app 数据接口（房源、地标、看房预约），这些调用即 agent 的工具调用
+func isFakeAppPath(path string) bool {
+	return strings.HasPrefix(path, "/api/houses") || strings.HasPrefix(path, "/api/landmarks") ||
+		strings.HasPrefix(path, "/api/appointments")
+}
+
+// traceFakeApp 路由中间件：为 fake_app 接口调用记录 trace（请求参数与返回结果），
+// 查看器按 X-User-ID 与时间段将其关联到对话，展示工具调用的实际结果
+func (h *Handler) traceFakeApp(next http.Handler) http.Handler {
+	if h.traceLogger == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isFakeAppPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h.traced(traceview.ProtocolFakeApp, func(w http.ResponseWriter, r *http.Request) {
+			request := map[string]interface{}{}
+			if q := r.URL.Query(); len(q) > 0 {
+				request["query"] = q
+			}
+			if r.Body != nil && r.ContentLength != 0 {
+				body, err := io.ReadAll(r.Body)
+				if err == nil && len(body) > 0 {
+					request["body"] = json.RawMessage(body)
+					if !json.Valid(body) {
+						request["body"] = string(body)
+					}
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+			}
+			logger.TraceFromContext(r.Context()).SetRequest(request, false)
+			next.ServeHTTP(w, r)
+		})(w, r)
+	})
+}
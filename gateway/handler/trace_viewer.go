@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ocProxy/gateway/internal/traceview"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultTraceListLimit 对话列表默认条数
+const defaultTraceListLimit = 200
+
+// TraceConversationList 对话列表响应
+type TraceConversationList struct {
+	Object string              `json:"object"`
+	Data   []traceview.Summary `json:"data"`
+	Users  []string            `json:"users"` // 日志中出现过的用户，供筛选
+}
+
+// TraceViewerPage 返回内嵌的 trace 查看器页面
+// GET /debug/traces
+func (h *Handler) TraceViewerPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(traceview.IndexHTML)
+}
+
+// loadTraces 读取 trace 日志；未配置 trace_log_file 时写 503 并返回 ok=false
+func (h *Handler) loadTraces(w http.ResponseWriter) ([]*traceview.Record, bool) {
+	if h.traceLogs == nil {
+		writeOpenAIError(w, http.StatusServiceUnavailable, "server_error", "trace_disabled", "未配置 logging.trace_log_file，没有可查看的 trace")
+		return nil, false
+	}
+	records, err := h.traceLogs.Load()
+	if err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, "server_error", "trace_load_failed", "读取 trace 日志失败: "+err.Error())
+		return nil, false
+	}
+	return records, true
+}
+
+// ListTraceConversations 对话列表，支持 user、model、from、to、error、limit 筛选
+// GET /debug/traces/api/conversations
+func (h *Handler) ListTraceConversations(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := traceview.Filter{
+		User:  strings.TrimSpace(q.Get("user")),
+		Model: strings.TrimSpace(q.Get("model")),
+		Limit: defaultTraceListLimit,
+	}
+	var err error
+	if filter.From, err = parseTraceTime(q.Get("from")); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "invalid_from", "from 格式无效: "+err.Error())
+		return
+	}
+	if filter.To, err = parseTraceTime(q.Get("to")); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "invalid_to", "to 格式无效: "+err.Error())
+		return
+	}
+	if v := q.Get("error"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "invalid_error", "error 仅支持 true 或 false")
+			return
+		}
+		filter.Error = &b
+	}
+	if v := q.Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			filter.Limit = n
+		}
+	}
+
+	records, ok := h.loadTraces(w)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TraceConversationList{
+		Object: "list",
+		Data:   traceview.List(records, filter),
+		Users:  traceview.Users(records),
+	})
+}
+
+// GetTraceConversation 对话详情：各轮请求（消息、路由、上游请求、响应、耗时）与关联的 fake_app 调用
+// GET /debug/traces/api/conversations/{id}
+func (h *Handler) GetTraceConversation(w http.ResponseWriter, r *http.Request) {
+	records, ok := h.loadTraces(w)
+	if !ok {
+		return
+	}
+	detail := traceview.Get(records, mux.Vars(r)["id"])
+	if detail == nil {
+		writeOpenAIError(w, http.StatusNotFound, "invalid_request_error", "conversation_not_found", "对话不存在")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+// parseTraceTime 解析筛选时间：RFC3339、本地时间 2006-01-02T15:04（浏览器 datetime-local）或 Unix 秒
+func parseTraceTime(v string) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, &time.ParseError{Value: v, Message: ": 支持 RFC3339、2006-01-02T15:04 或 Unix 秒"}
+}
+
+// SetupTraceViewerRoutes 设置 trace 查看器路由；trace 含完整的提示词与模型输出，与管理接口一样需要 admin token
+// （浏览器中以 Basic 认证输入，密码为 token）
+func (h *Handler) SetupTraceViewerRoutes(r *mux.Router) {
+	traces := r.PathPrefix("/debug/traces").Subrouter()
+	traces.Use(h.adminAuth)
+	traces.HandleFunc("", h.TraceViewerPage).Methods("GET")
+	traces.HandleFunc("/api/conversations", h.ListTraceConversations).Methods("GET")
+	traces.HandleFunc("/api/conversations/{id}", h.GetTraceConversation).Methods("GET")
+}
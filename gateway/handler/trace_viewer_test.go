@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"ocProxy/gateway/config"
+	"ocProxy/gateway/internal/traceview"
+
+	"github.com/gorilla/mux"
+)
+
+func traceViewerRouter(t *testing.T, token string) *mux.Router {
+	t.Helper()
+	h := &Handler{
+		cfg:       config.Config{Admin: config.AdminConfig{Token: token}},
+		traceLogs: traceview.NewCache(filepath.Join(t.TempDir(), "trace.jsonl")),
+	}
+	r := mux.NewRouter()
+	h.SetupTraceViewerRoutes(r)
+	return r
+}
+
+func TestTraceViewerRequiresAdminToken(t *testing.T) {
+	paths := []string{"/debug/traces", "/debug/traces/api/conversations", "/debug/traces/api/conversations/abc"}
+
+	r := traceViewerRouter(t, "")
+	for _, p := range paths {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, p, nil))
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("未配置 admin.token 时 %s 状态码 = %d, 期望 503", p, rec.Code)
+		}
+	}
+
+	r = traceViewerRouter(t, "s3cret")
+	for _, p := range paths {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, p, nil))
+		if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("无 token 时 %s 状态码 = %d, WWW-Authenticate = %q", p, rec.Code, rec.Header().Get("WWW-Authenticate"))
+		}
+	}
+
+	for name, set := range map[string]func(*http.Request){
+		"basic":  func(req *http.Request) { req.SetBasicAuth("admin", "s3cret") },
+		"bearer": func(req *http.Request) { req.Header.Set("Authorization", "Bearer s3cret") },
+		"header": func(req *http.Request) { req.Header.Set("X-Admin-Token", "s3cret") },
+	} {
+		for _, p := range paths[:2] {
+			req := httptest.NewRequest(http.MethodGet, p, nil)
+			set(req)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Errorf("%s 认证后 %s 状态码 = %d: %s", name, p, rec.Code, rec.Body.String())
+			}
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/traces", nil)
+	req.SetBasicAuth("admin", "wrong")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("错误的 Basic 密码状态码 = %d, 期望 401", rec.Code)
+	}
+}
@@ -0,0 +1,354 @@
+// Package jsonschema 提供结构化输出所需的最小 JSON Schema 校验与 JSON 提取。
+// 支持 type、properties、required、additionalProperties、items、enum、const、
+// 数值/长度/数量范围、pattern、anyOf/oneOf/allOf 以及本文档内的 $ref（#/$defs、#/definitions）。
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxErrors 单次校验最多收集的错误数，避免重试提示过长
+const maxErrors = 10
+
+// ValidationError 校验失败，Errors 为按路径描述的错误列表
+type ValidationError struct {
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Errors, "; ")
+}
+
+// Validate 校验 value（encoding/json 解码得到的值）是否符合 schema；通过返回 nil，否则返回 *ValidationError
+func Validate(schema map[string]interface{}, value interface{}) error {
+	v := &validator{root: schema}
+	v.validate(schema, value, "$")
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: v.errors}
+}
+
+type validator struct {
+	root   map[string]interface{}
+	errors []string
+}
+
+func (v *validator) addf(path, format string, args ...interface{}) {
+	if len(v.errors) < maxErrors {
+		v.errors = append(v.errors, path+": "+fmt.Sprintf(format, args...))
+	}
+}
+
+func (v *validator) validate(schema map[string]interface{}, value interface{}, path string) {
+	if schema == nil {
+		return
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved := v.resolveRef(ref)
+		if resolved == nil {
+			v.addf(path, "无法解析 $ref %s", ref)
+			return
+		}
+		v.validate(resolved, value, path)
+		return
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(t, value) {
+		v.addf(path, "类型应为 %v，实际为 %s", t, typeName(value))
+		return
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.addf(path, "取值应为 %v 之一", enum)
+		}
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(c, value) {
+		v.addf(path, "取值应为 %v", c)
+	}
+
+	switch val := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(schema, val, path)
+	case []interface{}:
+		v.validateArray(schema, val, path)
+	case string:
+		v.validateString(schema, val, path)
+	case float64:
+		v.validateNumber(schema, val, path)
+	}
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, s := range all {
+			if sub, ok := s.(map[string]interface{}); ok {
+				v.validate(sub, value, path)
+			}
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		if v.countMatches(anyOf, value) == 0 {
+			v.addf(path, "不满足 anyOf 中的任一 schema")
+		}
+	}
+	if one, ok := schema["oneOf"].([]interface{}); ok {
+		if n := v.countMatches(one, value); n != 1 {
+			v.addf(path, "应恰好满足 oneOf 中的一个 schema，实际满足 %d 个", n)
+		}
+	}
+}
+
+// countMatches 统计 value 满足的子 schema 数量（子校验的错误不计入结果）
+func (v *validator) countMatches(schemas []interface{}, value interface{}) int {
+	n := 0
+	for _, s := range schemas {
+		sub, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		child := &validator{root: v.root}
+		child.validate(sub, value, "$")
+		if len(child.errors) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func (v *validator) validateObject(schema map[string]interface{}, obj map[string]interface{}, path string) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, has := obj[name]; !has {
+					v.addf(path, "缺少必填字段 %q", name)
+				}
+			}
+		}
+	}
+	props, _ := schema["properties"].(map[string]interface{})
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		childPath := path + "." + k
+		if ps, ok := props[k].(map[string]interface{}); ok {
+			v.validate(ps, obj[k], childPath)
+			continue
+		}
+		switch ap := schema["additionalProperties"].(type) {
+		case bool:
+			if !ap {
+				v.addf(path, "不允许出现字段 %q", k)
+			}
+		case map[string]interface{}:
+			v.validate(ap, obj[k], childPath)
+		}
+	}
+
+	if n, ok := number(schema["minProperties"]); ok && float64(len(obj)) < n {
+		v.addf(path, "字段数应不少于 %v", n)
+	}
+	if n, ok := number(schema["maxProperties"]); ok && float64(len(obj)) > n {
+		v.addf(path, "字段数应不多于 %v", n)
+	}
+}
+
+func (v *validator) validateArray(schema map[string]interface{}, arr []interface{}, path string) {
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		for i, item := range arr {
+			v.validate(items, item, fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+	if n, ok := number(schema["minItems"]); ok && float64(len(arr)) < n {
+		v.addf(path, "元素数应不少于 %v", n)
+	}
+	if n, ok := number(schema["maxItems"]); ok && float64(len(arr)) > n {
+		v.addf(path, "元素数应不多于 %v", n)
+	}
+	if unique, ok := schema["uniqueItems"].(bool); ok && unique {
+		for i := 0; i < len(arr); i++ {
+			for j := i + 1; j < len(arr); j++ {
+				if jsonEqual(arr[i], arr[j]) {
+					v.addf(path, "元素 %d 与 %d 重复", i, j)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) validateString(schema map[string]interface{}, s string, path string) {
+	length := float64(utf8.RuneCountInString(s))
+	if n, ok := number(schema["minLength"]); ok && length < n {
+		v.addf(path, "长度应不少于 %v", n)
+	}
+	if n, ok := number(schema["maxLength"]); ok && length > n {
+		v.addf(path, "长度应不超过 %v", n)
+	}
+	if p, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(p)
+		if err == nil && !re.MatchString(s) {
+			v.addf(path, "不匹配模式 %s", p)
+		}
+	}
+}
+
+func (v *validator) validateNumber(schema map[string]interface{}, f float64, path string) {
+	if n, ok := number(schema["minimum"]); ok && f < n {
+		v.addf(path, "应不小于 %v", n)
+	}
+	if n, ok := number(schema["maximum"]); ok && f > n {
+		v.addf(path, "应不大于 %v", n)
+	}
+	if n, ok := number(schema["exclusiveMinimum"]); ok && f <= n {
+		v.addf(path, "应大于 %v", n)
+	}
+	if n, ok := number(schema["exclusiveMaximum"]); ok && f >= n {
+		v.addf(path, "应小于 %v", n)
+	}
+	if n, ok := number(schema["multipleOf"]); ok && n > 0 {
+		if q := f / n; math.Abs(q-math.Round(q)) > 1e-9 {
+			v.addf(path, "应为 %v 的倍数", n)
+		}
+	}
+}
+
+// resolveRef 解析文档内引用，如 #/$defs/Item、#/definitions/Item
+func (v *validator) resolveRef(ref string) map[string]interface{} {
+	if ref == "#" {
+		return v.root
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil
+	}
+	var cur interface{} = v.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = m[part]
+	}
+	resolved, _ := cur.(map[string]interface{})
+	return resolved
+}
+
+// matchesType 判断 value 是否符合 type（字符串或字符串数组）
+func matchesType(t interface{}, value interface{}) bool {
+	switch tt := t.(type) {
+	case string:
+		return matchesSingleType(tt, value)
+	case []interface{}:
+		for _, x := range tt {
+			if s, ok := x.(string); ok && matchesSingleType(s, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchesSingleType(t string, value interface{}) bool {
+	switch t {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == math.Trunc(f)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return true
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func jsonEqual(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+// ExtractJSON 从模型输出中提取 JSON 值：兼容 ```json 代码块以及前后夹带说明文字的情况
+func ExtractJSON(text string) (interface{}, error) {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "```") {
+		if nl := strings.Index(text, "\n"); nl >= 0 {
+			text = text[nl+1:]
+		}
+		text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err == nil {
+		return value, nil
+	}
+
+	// 截取第一个 { 或 [ 到最后一个 } 或 ] 之间的内容再试一次
+	start := strings.IndexAny(text, "{[")
+	end := strings.LastIndexAny(text, "}]")
+	if start >= 0 && end > start {
+		if err := json.Unmarshal([]byte(text[start:end+1]), &value); err == nil {
+			return value, nil
+		}
+	}
+	return nil, fmt.Errorf("输出不是合法 JSON")
+}
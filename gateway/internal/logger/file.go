@@ -0,0 +1,33 @@
+package logger
+
+// Options 日志文件选项：切分保留策略与写盘前脱敏
+type Options struct {
+	Rotate   RotateOptions
+	Redactor *Redactor // nil 不脱敏
+}
+
+// jsonlFile 各 logger 共用的 JSONL 文件：每次写入一行，写盘前脱敏，按 Rotate 切分
+type jsonlFile struct {
+	file     *rotatingFile
+	redactor *Redactor
+}
+
+func openJSONLFile(filePath string, opts Options) (*jsonlFile, error) {
+	file, err := openRotatingFile(filePath, opts.Rotate)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonlFile{file: file, redactor: opts.Redactor}, nil
+}
+
+// writeLine 脱敏后追加一行并 Sync
+func (j *jsonlFile) writeLine(data []byte) error {
+	line := append(j.redactor.Redact(data), '\n')
+	_, err := j.file.Write(line)
+	return err
+}
+
+// Close 关闭文件
+func (j *jsonlFile) Close() error {
+	return j.file.Close()
+}
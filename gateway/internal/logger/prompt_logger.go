@@ -2,22 +2,19 @@ package logger
 
 import (
 	"encoding/json"
-	"os"
-	"sync"
 
 	"github.com/sashabaranov/go-openai"
 )
 
 // PromptLogger 用于记录用户请求的 messages（仅最后一条）
 type PromptLogger struct {
-	file     *os.File
-	mu       sync.Mutex
+	file     *jsonlFile
 	filePath string
 }
 
 // NewPromptLogger 创建新的 PromptLogger
-func NewPromptLogger(filePath string) (*PromptLogger, error) {
-	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+func NewPromptLogger(filePath string, opts Options) (*PromptLogger, error) {
+	file, err := openJSONLFile(filePath, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -33,8 +30,6 @@ func (p *PromptLogger) Log(messages []openai.ChatCompletionMessage) error {
 	if len(messages) == 0 {
 		return nil
 	}
-	p.mu.Lock()
-	defer p.mu.Unlock()
 
 	// lastOnly := messages[len(messages)-1:]
 	data := map[string]interface{}{
@@ -45,16 +40,10 @@ func (p *PromptLogger) Log(messages []openai.ChatCompletionMessage) error {
 		return err
 	}
 
-	_, err = p.file.WriteString(string(jsonData) + "\n")
-	if err != nil {
-		return err
-	}
-	return p.file.Sync()
+	return p.file.writeLine(jsonData)
 }
 
 // Close 关闭文件
 func (p *PromptLogger) Close() error {
-	p.mu.Lock()
-	defer p.mu.Unlock()
 	return p.file.Close()
 }
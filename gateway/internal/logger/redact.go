@@ -0,0 +1,114 @@
+package logger
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// RedactRule 脱敏规则：匹配 Pattern 的内容替换为 Replacement
+type RedactRule struct {
+	Name        string
+	Pattern     string
+	Replacement string
+}
+
+// BuiltinRedactRules 内置脱敏规则，按顺序执行（身份证号先于手机号，避免 18 位号码被部分替换）
+var BuiltinRedactRules = []RedactRule{
+	{Name: "api_key", Pattern: `sk-[A-Za-z0-9_\-]{16,}`, Replacement: "sk-***"},
+	{Name: "id_card", Pattern: `[1-9]\d{5}(?:18|19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]`, Replacement: "[ID_CARD]"},
+	{Name: "phone", Pattern: `(?:\+?86[- ]?)?1[3-9]\d{9}`, Replacement: "[PHONE]"},
+	{Name: "email", Pattern: `[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`, Replacement: "[EMAIL]"},
+}
+
+// Redactor 写盘前对日志内容执行脱敏；nil 时不处理
+type Redactor struct {
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	name        string
+	re          *regexp.Regexp
+	replacement []byte
+}
+
+// NewRedactor 编译脱敏规则；rules 为空时使用全部内置规则。
+// 只填 Name 的规则引用同名内置规则，Replacement 为空时替换为 [REDACTED]
+func NewRedactor(rules []RedactRule) (*Redactor, error) {
+	if len(rules) == 0 {
+		rules = BuiltinRedactRules
+	}
+	r := &Redactor{}
+	for _, rule := range rules {
+		if rule.Pattern == "" {
+			builtin, ok := builtinRedactRule(rule.Name)
+			if !ok {
+				return nil, fmt.Errorf("未知的内置脱敏规则: %s", rule.Name)
+			}
+			if rule.Replacement == "" {
+				rule.Replacement = builtin.Replacement
+			}
+			rule.Pattern = builtin.Pattern
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("脱敏规则 %s 正则无效: %w", rule.Name, err)
+		}
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = "[REDACTED]"
+		}
+		r.rules = append(r.rules, compiledRule{name: rule.Name, re: re, replacement: []byte(replacement)})
+	}
+	return r, nil
+}
+
+func builtinRedactRule(name string) (RedactRule, bool) {
+	for _, rule := range BuiltinRedactRules {
+		if rule.Name == name {
+			return rule, true
+		}
+	}
+	return RedactRule{}, false
+}
+
+// Redact 依次应用所有规则；替换内容按字面写入（不展开 $1 等分组引用）。
+// 以数字开头或结尾的匹配若紧邻其他数字则跳过，避免把更长数字串（如订单号）中的一段当作手机号；
+// 不使用 \b 是因为 JSON 转义（如 \n138...）会让号码前没有单词边界
+func (r *Redactor) Redact(data []byte) []byte {
+	if r == nil {
+		return data
+	}
+	for _, rule := range r.rules {
+		data = rule.replace(data)
+	}
+	return data
+}
+
+func (c compiledRule) replace(data []byte) []byte {
+	matches := c.re.FindAllIndex(data, -1)
+	if len(matches) == 0 {
+		return data
+	}
+	out := make([]byte, 0, len(data))
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if start == end {
+			continue
+		}
+		if isDigit(data[start]) && start > 0 && isDigit(data[start-1]) {
+			continue
+		}
+		if isDigit(data[end-1]) && end < len(data) && isDigit(data[end]) {
+			continue
+		}
+		out = append(out, data[last:start]...)
+		out = append(out, c.replacement...)
+		last = end
+	}
+	return append(out, data[last:]...)
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
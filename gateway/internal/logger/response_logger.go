@@ -2,22 +2,19 @@ package logger
 
 import (
 	"encoding/json"
-	"os"
-	"sync"
 
 	"github.com/sashabaranov/go-openai"
 )
 
 // ResponseLogger 用于记录模型响应到 response.jsonl
 type ResponseLogger struct {
-	file     *os.File
-	mu       sync.Mutex
+	file     *jsonlFile
 	filePath string
 }
 
 // NewResponseLogger 创建新的 ResponseLogger
-func NewResponseLogger(filePath string) (*ResponseLogger, error) {
-	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+func NewResponseLogger(filePath string, opts Options) (*ResponseLogger, error) {
+	file, err := openJSONLFile(filePath, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -34,24 +31,15 @@ func (r *ResponseLogger) Log(resp *openai.ChatCompletionResponse) error {
 		return nil
 	}
 
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
 	jsonData, err := json.Marshal(resp)
 	if err != nil {
 		return err
 	}
 
-	_, err = r.file.WriteString(string(jsonData) + "\n")
-	if err != nil {
-		return err
-	}
-	return r.file.Sync()
+	return r.file.writeLine(jsonData)
 }
 
 // Close 关闭文件
 func (r *ResponseLogger) Close() error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
 	return r.file.Close()
 }
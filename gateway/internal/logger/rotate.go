@@ -0,0 +1,267 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 按时间切分的周期
+const (
+	RotateHourly = "hourly"
+	RotateDaily  = "daily"
+)
+
+// backupTimeFormat 归档文件名中的时间格式
+const backupTimeFormat = "20060102T150405"
+
+// RotateOptions 日志切分与保留选项，零值表示不切分
+type RotateOptions struct {
+	MaxSizeMB  int    // 单个文件超过该大小（MB）时切分，0 不按大小切分
+	Interval   string // 按时间切分：hourly 或 daily，空不按时间切分
+	MaxBackups int    // 最多保留的归档文件数，0 不限制
+	MaxAgeDays int    // 归档文件最长保留天数，0 不限制
+	Compress   bool   // 归档文件是否 gzip 压缩
+}
+
+// rotatingFile 可切分的追加写文件：当前文件为 path，归档为 <name>-<时间>.<ext>[.gz]
+type rotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	opts     RotateOptions
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	wg       sync.WaitGroup // 后台压缩与清理
+}
+
+func openRotatingFile(path string, opts RotateOptions) (*rotatingFile, error) {
+	switch opts.Interval {
+	case "", RotateHourly, RotateDaily:
+	default:
+		return nil, fmt.Errorf("不支持的日志切分周期: %s（可选 hourly、daily）", opts.Interval)
+	}
+	f := &rotatingFile{path: path, opts: opts}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open 打开（或创建）当前文件；已有文件按其修改时间计算时间周期
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = time.Now()
+	if info.Size() > 0 {
+		f.openedAt = info.ModTime()
+	}
+	return nil
+}
+
+// Write 写入一条完整记录并 Sync；写入前按大小或时间判断是否需要切分
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.shouldRotate(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			log.Printf("[警告] 日志切分失败 (%s): %v", f.path, err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	if err != nil {
+		return n, err
+	}
+	return n, f.file.Sync()
+}
+
+func (f *rotatingFile) shouldRotate(incoming int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.opts.MaxSizeMB > 0 && f.size+incoming > int64(f.opts.MaxSizeMB)<<20 {
+		return true
+	}
+	return f.opts.Interval != "" && periodStart(f.openedAt, f.opts.Interval) != periodStart(time.Now(), f.opts.Interval)
+}
+
+// periodStart 返回时间所在切分周期的起点
+func periodStart(t time.Time, interval string) time.Time {
+	if interval == RotateHourly {
+		return t.Truncate(time.Hour)
+	}
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// rotate 将当前文件重命名为归档并重新打开；压缩与过期清理在后台进行
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	backup := f.backupName(time.Now())
+	if err := os.Rename(f.path, backup); err != nil {
+		// 重命名失败时继续写原文件
+		if openErr := f.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		if f.opts.Compress {
+			if err := compressFile(backup); err != nil {
+				log.Printf("[警告] 压缩日志归档失败 (%s): %v", backup, err)
+			}
+		}
+		f.prune()
+	}()
+	return nil
+}
+
+// backupName 生成归档文件名，同一秒内多次切分时追加序号
+func (f *rotatingFile) backupName(t time.Time) string {
+	dir, name := filepath.Split(f.path)
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	stamp := t.Format(backupTimeFormat)
+	candidate := filepath.Join(dir, fmt.Sprintf("%s-%s%s", base, stamp, ext))
+	for i := 1; fileExists(candidate) || fileExists(candidate+".gz"); i++ {
+		candidate = filepath.Join(dir, fmt.Sprintf("%s-%s.%d%s", base, stamp, i, ext))
+	}
+	return candidate
+}
+
+// prune 按保留数量与天数删除旧归档
+func (f *rotatingFile) prune() {
+	if f.opts.MaxBackups <= 0 && f.opts.MaxAgeDays <= 0 {
+		return
+	}
+	dir, name := filepath.Split(f.path)
+	if dir == "" {
+		dir = "."
+	}
+	ext := filepath.Ext(name)
+	prefix := strings.TrimSuffix(name, ext) + "-"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	type backupFile struct {
+		path    string
+		modTime time.Time
+	}
+	var backups []backupFile
+	for _, e := range entries {
+		n := e.Name()
+		if e.IsDir() || !strings.HasPrefix(n, prefix) {
+			continue
+		}
+		rest := strings.TrimSuffix(strings.TrimSuffix(n, ".gz"), ext)
+		if _, err := time.Parse(backupTimeFormat, strings.SplitN(strings.TrimPrefix(rest, prefix), ".", 2)[0]); err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backupFile{path: filepath.Join(dir, n), modTime: info.ModTime()})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].modTime.After(backups[j].modTime) })
+
+	cutoff := time.Now().AddDate(0, 0, -f.opts.MaxAgeDays)
+	for i, b := range backups {
+		expired := f.opts.MaxAgeDays > 0 && b.modTime.Before(cutoff)
+		if (f.opts.MaxBackups > 0 && i >= f.opts.MaxBackups) || expired {
+			if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+				log.Printf("[警告] 删除过期日志归档失败 (%s): %v", b.path, err)
+			}
+		}
+	}
+}
+
+// Close 将文件刷盘后关闭，并等待后台压缩完成
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	var err error
+	if f.file != nil {
+		if syncErr := f.file.Sync(); syncErr != nil {
+			err = syncErr
+		}
+		if closeErr := f.file.Close(); err == nil {
+			err = closeErr
+		}
+		f.file = nil
+	}
+	f.mu.Unlock()
+	f.wg.Wait()
+	return err
+}
+
+// compressFile 将文件压缩为 .gz 后删除原文件
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	src.Close()
+	return os.Remove(path)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,326 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// TraceLogger 将每个请求的完整链路（入站请求、路由、上游请求、最终响应、耗时与错误）按 JSONL 写入文件，一个请求一行
+type TraceLogger struct {
+	file     *jsonlFile
+	filePath string
+}
+
+// NewTraceLogger 创建新的 TraceLogger
+func NewTraceLogger(filePath string, opts Options) (*TraceLogger, error) {
+	file, err := openJSONLFile(filePath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TraceLogger{
+		file:     file,
+		filePath: filePath,
+	}, nil
+}
+
+// Log 写入一条 trace 记录
+func (t *TraceLogger) Log(record *TraceRecord) error {
+	if record == nil {
+		return nil
+	}
+	jsonData, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return t.file.writeLine(jsonData)
+}
+
+// Close 关闭文件
+func (t *TraceLogger) Close() error {
+	return t.file.Close()
+}
+
+// TraceRecord 一个请求的 trace 记录
+type TraceRecord struct {
+	TraceID     string          `json:"trace_id"`
+	Time        string          `json:"time"`     // 请求开始时间（RFC3339Nano）
+	Protocol    string          `json:"protocol"` // 入站协议：openai、anthropic，fake_app 接口为 fake_app
+	Method      string          `json:"method"`
+	Path        string          `json:"path"`
+	User        string          `json:"user,omitempty"`       // X-User-ID 请求头或请求体 user 字段
+	Title       string          `json:"title,omitempty"`      // 会话标题：技能注入前的首条 user 消息，用于归并同一对话的多轮请求
+	SessionID   string          `json:"session_id,omitempty"` // 服务端会话 ID
+	Stream      bool            `json:"stream"`
+	Request     interface{}     `json:"request,omitempty"` // 经拦截器（技能注入等）处理后的入站请求
+	Routing     *TraceRouting   `json:"routing,omitempty"`
+	Skills      *TraceSkills    `json:"skills,omitempty"`   // 技能选择结果
+	Upstream    []*UpstreamCall `json:"upstream,omitempty"` // 实际发出的上游请求，结构化输出重试时有多条
+	Status      int             `json:"status"`             // 返回给客户端的 HTTP 状态码
+	Response    interface{}     `json:"response,omitempty"` // 最终响应，流式时由 SSE chunk 重组
+	Error       string          `json:"error,omitempty"`
+	FirstByteMs int64           `json:"first_byte_ms,omitempty"` // 首个响应字节耗时
+	DurationMs  int64           `json:"duration_ms"`
+}
+
+// TraceRouting 路由决策
+type TraceRouting struct {
+	RequestedModel string `json:"requested_model"`
+	RequestedWork  bool   `json:"requested_work"` // 按请求 model 判断是否为工作模型
+	Preprocess     bool   `json:"preprocess"`     // 是否触发前处理改走聊天模型
+	Target         string `json:"target"`         // 实际使用的模型：chat 或 work
+	ModelID        string `json:"model_id"`
+	APIFormat      string `json:"api_format"`
+	Mode           string `json:"mode,omitempty"` // 特殊处理方式，如 anthropic_direct、structured_output
+}
+
+// TraceSkills 技能选择结果
+type TraceSkills struct {
+	Budget     int          `json:"budget"` // token 预算，负数表示不限制
+	UsedTokens int          `json:"used_tokens"`
+	Selected   []TraceSkill `json:"selected"`
+	Skipped    []TraceSkill `json:"skipped,omitempty"`
+}
+
+// TraceSkill 一个技能的评分与选择情况
+type TraceSkill struct {
+	Name    string   `json:"name"`
+	Path    string   `json:"path"`
+	Score   float64  `json:"score"`
+	Tokens  int      `json:"tokens"`
+	Matched []string `json:"matched,omitempty"` // 命中的 triggers
+	Reason  string   `json:"reason,omitempty"`  // 未选中原因：model、low_score、budget、max_skills
+}
+
+// UpstreamCall 一次上游请求
+type UpstreamCall struct {
+	URL        string          `json:"url"`
+	Request    json.RawMessage `json:"request"`
+	Status     int             `json:"status,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	StartMs    int64           `json:"start_ms"`    // 相对请求开始的偏移
+	DurationMs int64           `json:"duration_ms"` // 到收到响应头为止；流式响应不含读流时间
+
+	trace *Trace
+	start time.Time
+}
+
+// Trace 一个请求的 trace 收集器，各阶段通过 context 取得并写入；nil 时所有方法为空操作
+type Trace struct {
+	mu     sync.Mutex
+	start  time.Time
+	record TraceRecord
+}
+
+type traceContextKey struct{}
+
+// NewTrace 创建 trace，traceID 为空时自动生成
+func NewTrace(traceID, protocol, method, path string) *Trace {
+	if traceID == "" {
+		traceID = NewTraceID()
+	}
+	now := time.Now()
+	return &Trace{
+		start: now,
+		record: TraceRecord{
+			TraceID:  traceID,
+			Time:     now.Format(time.RFC3339Nano),
+			Protocol: protocol,
+			Method:   method,
+			Path:     path,
+		},
+	}
+}
+
+// NewTraceID 生成 32 位十六进制 trace ID
+func NewTraceID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithTrace 将 trace 放入 context
+func WithTrace(ctx context.Context, t *Trace) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, t)
+}
+
+// TraceFromContext 取出 context 中的 trace，未开启 trace 时返回 nil
+func TraceFromContext(ctx context.Context) *Trace {
+	if ctx == nil {
+		return nil
+	}
+	t, _ := ctx.Value(traceContextKey{}).(*Trace)
+	return t
+}
+
+// ID 返回 trace ID
+func (t *Trace) ID() string {
+	if t == nil {
+		return ""
+	}
+	return t.record.TraceID
+}
+
+// SetRequest 记录经拦截器处理后的入站请求
+func (t *Trace) SetRequest(req interface{}, stream bool) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record.Request = snapshot(req)
+	t.record.Stream = stream
+}
+
+// SetConversation 记录用户与会话标题；只在尚未设置时写入，先设置者（如 X-User-ID 请求头）优先
+func (t *Trace) SetConversation(user, title string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.record.User == "" {
+		t.record.User = user
+	}
+	if t.record.Title == "" {
+		t.record.Title = title
+	}
+}
+
+// SetSessionID 记录服务端会话 ID
+func (t *Trace) SetSessionID(id string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record.SessionID = id
+}
+
+// SetRouting 记录路由决策
+func (t *Trace) SetRouting(routing TraceRouting) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record.Routing = &routing
+}
+
+// SetSkills 记录技能选择结果
+func (t *Trace) SetSkills(skills *TraceSkills) {
+	if t == nil || skills == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record.Skills = skills
+}
+
+// StartUpstream 记录即将发出的上游请求，返回的 UpstreamCall 在收到响应后调用 End
+func (t *Trace) StartUpstream(url string, body []byte) *UpstreamCall {
+	if t == nil {
+		return nil
+	}
+	now := time.Now()
+	call := &UpstreamCall{
+		URL:     url,
+		Request: rawJSON(body),
+		StartMs: now.Sub(t.start).Milliseconds(),
+		trace:   t,
+		start:   now,
+	}
+	t.mu.Lock()
+	t.record.Upstream = append(t.record.Upstream, call)
+	t.mu.Unlock()
+	return call
+}
+
+// End 记录上游响应状态与错误
+func (c *UpstreamCall) End(status int, err error) {
+	if c == nil {
+		return
+	}
+	c.trace.mu.Lock()
+	defer c.trace.mu.Unlock()
+	c.Status = status
+	c.DurationMs = time.Since(c.start).Milliseconds()
+	if err != nil {
+		c.Error = err.Error()
+	}
+}
+
+// SetResponse 记录最终响应
+func (t *Trace) SetResponse(resp interface{}) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record.Response = snapshot(resp)
+}
+
+// SetError 记录请求错误，err 为 nil 时忽略
+func (t *Trace) SetError(err error) {
+	if t == nil || err == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record.Error = err.Error()
+}
+
+// markFirstByte 记录首字节时间，仅第一次有效
+func (t *Trace) markFirstByte() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.record.FirstByteMs == 0 {
+		t.record.FirstByteMs = max(time.Since(t.start).Milliseconds(), 1)
+	}
+}
+
+// Finish 结束 trace，返回最终记录（之后不应再写入）
+func (t *Trace) Finish(status int) *TraceRecord {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record.Status = status
+	t.record.DurationMs = time.Since(t.start).Milliseconds()
+	return &t.record
+}
+
+// snapshot 序列化保存当前状态，避免之后请求对象被修改影响记录
+func snapshot(v interface{}) interface{} {
+	switch x := v.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return rawJSON(x)
+	case json.RawMessage:
+		return rawJSON(x)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return json.RawMessage(data)
+}
+
+// rawJSON 合法 JSON 原样保存，否则保存为字符串
+func rawJSON(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	if json.Valid(body) {
+		return append(json.RawMessage(nil), body...)
+	}
+	data, _ := json.Marshal(string(body))
+	return data
+}
@@ -0,0 +1,445 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// maxTraceBodyBytes 非流式响应体最多记录的字节数，超出部分截断
+const maxTraceBodyBytes = 4 << 20
+
+// TraceWriter 包装写给客户端的 ResponseWriter：记录状态码与首字节时间，
+// SSE 响应按行重组为完整响应（OpenAI chat.completion 或 Anthropic message），其余响应记录响应体
+type TraceWriter struct {
+	http.ResponseWriter
+	trace     *Trace
+	status    int
+	sse       bool
+	pending   []byte
+	body      bytes.Buffer
+	truncated bool
+	assembler streamAssembler
+}
+
+// NewTraceWriter 创建记录响应的 ResponseWriter，请求结束后调用 Finish
+func NewTraceWriter(w http.ResponseWriter, t *Trace) *TraceWriter {
+	return &TraceWriter{ResponseWriter: w, trace: t}
+}
+
+// WriteHeader 记录状态码并根据 Content-Type 判断是否为 SSE
+func (tw *TraceWriter) WriteHeader(code int) {
+	if tw.status == 0 {
+		tw.status = code
+		tw.sse = strings.HasPrefix(tw.Header().Get("Content-Type"), "text/event-stream")
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+// Write 透传并记录
+func (tw *TraceWriter) Write(b []byte) (int, error) {
+	if tw.status == 0 {
+		tw.WriteHeader(http.StatusOK)
+	}
+	if len(b) > 0 {
+		tw.trace.markFirstByte()
+	}
+	n, err := tw.ResponseWriter.Write(b)
+	if tw.sse {
+		tw.pending = append(tw.pending, b[:n]...)
+		for {
+			idx := bytes.IndexByte(tw.pending, '\n')
+			if idx < 0 {
+				break
+			}
+			tw.assembler.feed(bytes.TrimSpace(tw.pending[:idx]))
+			tw.pending = tw.pending[idx+1:]
+		}
+	} else if !tw.truncated {
+		room := maxTraceBodyBytes - tw.body.Len()
+		if n > room {
+			tw.body.Write(b[:room])
+			tw.truncated = true
+		} else {
+			tw.body.Write(b[:n])
+		}
+	}
+	return n, err
+}
+
+// Flush 透传 http.Flusher
+func (tw *TraceWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 供 http.ResponseController 取得底层 ResponseWriter
+func (tw *TraceWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// Status 返回写给客户端的状态码，未写出时为 200
+func (tw *TraceWriter) Status() int {
+	if tw.status == 0 {
+		return http.StatusOK
+	}
+	return tw.status
+}
+
+// Finish 将重组的响应写入 trace 并返回最终记录
+func (tw *TraceWriter) Finish() *TraceRecord {
+	if tw.sse {
+		if len(tw.pending) > 0 {
+			tw.assembler.feed(bytes.TrimSpace(tw.pending))
+			tw.pending = nil
+		}
+		if resp := tw.assembler.result(); resp != nil {
+			tw.trace.SetResponse(resp)
+		}
+		if tw.assembler.errPayload != nil {
+			tw.trace.mu.Lock()
+			if tw.trace.record.Error == "" {
+				tw.trace.record.Error = string(tw.assembler.errPayload)
+			}
+			tw.trace.mu.Unlock()
+		}
+	} else if tw.body.Len() > 0 {
+		body := tw.body.Bytes()
+		if tw.truncated {
+			tw.trace.SetResponse(string(body) + "...(truncated)")
+		} else {
+			tw.trace.SetResponse(body)
+		}
+	}
+	return tw.trace.Finish(tw.Status())
+}
+
+// streamAssembler 由 SSE data 负载重组完整响应；按负载内容自动区分 OpenAI chunk 与 Anthropic 事件
+type streamAssembler struct {
+	openai     *openaiAssembly
+	anthropic  *anthropicAssembly
+	errPayload json.RawMessage // 流中的 error 事件
+}
+
+func (a *streamAssembler) feed(line []byte) {
+	if !bytes.HasPrefix(line, []byte("data:")) {
+		return
+	}
+	data := bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+	if len(data) == 0 || bytes.Equal(data, []byte("[DONE]")) {
+		return
+	}
+	var head struct {
+		Type  string          `json:"type"`
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return
+	}
+	if len(head.Error) > 0 {
+		a.errPayload = append(json.RawMessage(nil), head.Error...)
+		return
+	}
+	if head.Type != "" {
+		if a.anthropic == nil {
+			a.anthropic = &anthropicAssembly{blocks: make(map[int]*anthropicBlock)}
+		}
+		a.anthropic.feed(head.Type, data)
+		return
+	}
+	if a.openai == nil {
+		a.openai = &openaiAssembly{choices: make(map[int]*openaiChoice)}
+	}
+	a.openai.feed(data)
+}
+
+func (a *streamAssembler) result() interface{} {
+	if a.anthropic != nil {
+		return a.anthropic.result()
+	}
+	if a.openai != nil {
+		return a.openai.result()
+	}
+	return nil
+}
+
+// openaiAssembly 重组 chat.completion.chunk
+type openaiAssembly struct {
+	id      string
+	model   string
+	created int64
+	choices map[int]*openaiChoice
+	usage   json.RawMessage
+}
+
+type openaiChoice struct {
+	role         string
+	content      strings.Builder
+	reasoning    strings.Builder
+	toolCalls    map[int]*openaiToolCall
+	lastTool     int
+	finishReason string
+}
+
+type openaiToolCall struct {
+	ID        string
+	Type      string
+	Name      strings.Builder
+	Arguments strings.Builder
+}
+
+func (o *openaiAssembly) feed(data []byte) {
+	var chunk struct {
+		ID      string `json:"id"`
+		Model   string `json:"model"`
+		Created int64  `json:"created"`
+		Choices []struct {
+			Index int `json:"index"`
+			Delta struct {
+				Role             string `json:"role"`
+				Content          string `json:"content"`
+				ReasoningContent string `json:"reasoning_content"`
+				ToolCalls        []struct {
+					Index    *int   `json:"index"`
+					ID       string `json:"id"`
+					Type     string `json:"type"`
+					Function struct {
+						Name      string `json:"name"`
+						Arguments string `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
+			} `json:"delta"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage json.RawMessage `json:"usage"`
+	}
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return
+	}
+	if chunk.ID != "" {
+		o.id = chunk.ID
+	}
+	if chunk.Model != "" {
+		o.model = chunk.Model
+	}
+	if chunk.Created != 0 {
+		o.created = chunk.Created
+	}
+	if len(chunk.Usage) > 0 && !bytes.Equal(chunk.Usage, []byte("null")) {
+		o.usage = append(json.RawMessage(nil), chunk.Usage...)
+	}
+	for _, c := range chunk.Choices {
+		choice, ok := o.choices[c.Index]
+		if !ok {
+			choice = &openaiChoice{toolCalls: make(map[int]*openaiToolCall), lastTool: -1}
+			o.choices[c.Index] = choice
+		}
+		if c.Delta.Role != "" {
+			choice.role = c.Delta.Role
+		}
+		choice.content.WriteString(c.Delta.Content)
+		choice.reasoning.WriteString(c.Delta.ReasoningContent)
+		for _, tc := range c.Delta.ToolCalls {
+			idx := choice.lastTool
+			if tc.Index != nil {
+				idx = *tc.Index
+			} else if tc.ID != "" {
+				idx = choice.lastTool + 1
+			}
+			choice.lastTool = idx
+			call, ok := choice.toolCalls[idx]
+			if !ok {
+				call = &openaiToolCall{Type: "function"}
+				choice.toolCalls[idx] = call
+			}
+			if tc.ID != "" {
+				call.ID = tc.ID
+			}
+			if tc.Type != "" {
+				call.Type = tc.Type
+			}
+			call.Name.WriteString(tc.Function.Name)
+			call.Arguments.WriteString(tc.Function.Arguments)
+		}
+		if c.FinishReason != "" {
+			choice.finishReason = c.FinishReason
+		}
+	}
+}
+
+func (o *openaiAssembly) result() interface{} {
+	indexes := make([]int, 0, len(o.choices))
+	for idx := range o.choices {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	choices := make([]map[string]interface{}, 0, len(indexes))
+	for _, idx := range indexes {
+		c := o.choices[idx]
+		role := c.role
+		if role == "" {
+			role = "assistant"
+		}
+		message := map[string]interface{}{
+			"role":    role,
+			"content": c.content.String(),
+		}
+		if c.reasoning.Len() > 0 {
+			message["reasoning_content"] = c.reasoning.String()
+		}
+		if len(c.toolCalls) > 0 {
+			toolIdx := make([]int, 0, len(c.toolCalls))
+			for i := range c.toolCalls {
+				toolIdx = append(toolIdx, i)
+			}
+			sort.Ints(toolIdx)
+			calls := make([]map[string]interface{}, 0, len(toolIdx))
+			for _, i := range toolIdx {
+				tc := c.toolCalls[i]
+				calls = append(calls, map[string]interface{}{
+					"id":   tc.ID,
+					"type": tc.Type,
+					"function": map[string]interface{}{
+						"name":      tc.Name.String(),
+						"arguments": tc.Arguments.String(),
+					},
+				})
+			}
+			message["tool_calls"] = calls
+		}
+		choices = append(choices, map[string]interface{}{
+			"index":         idx,
+			"message":       message,
+			"finish_reason": c.finishReason,
+		})
+	}
+
+	resp := map[string]interface{}{
+		"id":      o.id,
+		"object":  "chat.completion",
+		"created": o.created,
+		"model":   o.model,
+		"choices": choices,
+	}
+	if o.usage != nil {
+		resp["usage"] = o.usage
+	}
+	return resp
+}
+
+// anthropicAssembly 重组 Anthropic Messages 流事件
+type anthropicAssembly struct {
+	message      map[string]interface{}
+	blocks       map[int]*anthropicBlock
+	stopReason   interface{}
+	stopSequence interface{}
+	usage        map[string]interface{}
+}
+
+type anthropicBlock struct {
+	block   map[string]interface{}
+	text    strings.Builder // text / thinking 增量
+	partial strings.Builder // tool_use 的 input_json_delta
+}
+
+func (a *anthropicAssembly) feed(eventType string, data []byte) {
+	var event struct {
+		Index        int                    `json:"index"`
+		Message      map[string]interface{} `json:"message"`
+		ContentBlock map[string]interface{} `json:"content_block"`
+		Delta        map[string]interface{} `json:"delta"`
+		Usage        map[string]interface{} `json:"usage"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return
+	}
+	switch eventType {
+	case "message_start":
+		a.message = event.Message
+		if u, ok := event.Message["usage"].(map[string]interface{}); ok {
+			a.usage = u
+		}
+	case "content_block_start":
+		a.blocks[event.Index] = &anthropicBlock{block: event.ContentBlock}
+	case "content_block_delta":
+		b, ok := a.blocks[event.Index]
+		if !ok {
+			b = &anthropicBlock{block: map[string]interface{}{"type": "text"}}
+			a.blocks[event.Index] = b
+		}
+		switch event.Delta["type"] {
+		case "text_delta":
+			s, _ := event.Delta["text"].(string)
+			b.text.WriteString(s)
+		case "thinking_delta":
+			s, _ := event.Delta["thinking"].(string)
+			b.text.WriteString(s)
+		case "input_json_delta":
+			s, _ := event.Delta["partial_json"].(string)
+			b.partial.WriteString(s)
+		case "signature_delta":
+			b.block["signature"] = event.Delta["signature"]
+		}
+	case "message_delta":
+		if v, ok := event.Delta["stop_reason"]; ok {
+			a.stopReason = v
+		}
+		if v, ok := event.Delta["stop_sequence"]; ok {
+			a.stopSequence = v
+		}
+		if a.usage == nil {
+			a.usage = make(map[string]interface{})
+		}
+		for k, v := range event.Usage {
+			a.usage[k] = v
+		}
+	}
+}
+
+func (a *anthropicAssembly) result() interface{} {
+	resp := map[string]interface{}{"type": "message", "role": "assistant"}
+	for k, v := range a.message {
+		resp[k] = v
+	}
+
+	indexes := make([]int, 0, len(a.blocks))
+	for idx := range a.blocks {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+	content := make([]map[string]interface{}, 0, len(indexes))
+	for _, idx := range indexes {
+		b := a.blocks[idx]
+		block := make(map[string]interface{}, len(b.block)+1)
+		for k, v := range b.block {
+			block[k] = v
+		}
+		switch block["type"] {
+		case "text":
+			block["text"] = b.text.String()
+		case "thinking":
+			block["thinking"] = b.text.String()
+		case "tool_use":
+			if b.partial.Len() > 0 {
+				var input interface{}
+				if err := json.Unmarshal([]byte(b.partial.String()), &input); err == nil {
+					block["input"] = input
+				} else {
+					block["input"] = b.partial.String()
+				}
+			}
+		}
+		content = append(content, block)
+	}
+	resp["content"] = content
+	resp["stop_reason"] = a.stopReason
+	resp["stop_sequence"] = a.stopSequence
+	if a.usage != nil {
+		resp["usage"] = a.usage
+	}
+	return resp
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"log"
+	"math"
+
+	"ocProxy/gateway/internal/logger"
+	"ocProxy/gateway/internal/skill"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func init() {
+	Register("skill_inject", newSkillInjector)
+	Register("prompt_log", newPromptLog)
+	Register("response_log", newResponseLog)
+}
+
+// skillInjector 在 system 消息之后注入技能库中与最后一条 user 消息相关的技能正文，选择结果写入请求 trace
+type skillInjector struct {
+	library *skill.Library
+}
+
+func newSkillInjector(options map[string]interface{}, env Env) (Interceptor, error) {
+	if env.Skills == nil {
+		return nil, nil // 未配置 skill_dirs 时不启用
+	}
+	return &skillInjector{library: env.Skills}, nil
+}
+
+func (s *skillInjector) Name() string { return "skill_inject" }
+
+// InterceptRequest 按请求模型与用户的技能集选择技能，不影响请求的其他部分
+func (s *skillInjector) InterceptRequest(rc *RequestContext, req *openai.ChatCompletionRequest) error {
+	injected, sel := s.library.Inject(req.Messages, rc.Model, rc.User)
+	req.Messages = injected
+	logger.TraceFromContext(rc.Context).SetSkills(traceSkills(sel))
+	return nil
+}
+
+// traceSkills 将技能选择结果转换为 trace 记录
+func traceSkills(sel *skill.Selection) *logger.TraceSkills {
+	if sel == nil {
+		return nil
+	}
+	ts := &logger.TraceSkills{Budget: sel.Budget, UsedTokens: sel.UsedTokens}
+	for _, c := range sel.Selected {
+		ts.Selected = append(ts.Selected, traceSkill(c))
+	}
+	for _, c := range sel.Skipped {
+		ts.Skipped = append(ts.Skipped, traceSkill(c))
+	}
+	return ts
+}
+
+func traceSkill(c *skill.Candidate) logger.TraceSkill {
+	return logger.TraceSkill{
+		Name:    c.Skill.Name,
+		Path:    c.Skill.Path,
+		Score:   math.Round(c.Score*1000) / 1000,
+		Tokens:  c.Skill.Tokens,
+		Matched: c.Matched,
+		Reason:  c.Reason,
+	}
+}
+
+// promptLog 将请求消息写入 prompt 日志
+type promptLog struct {
+	logger *logger.PromptLogger
+}
+
+func newPromptLog(options map[string]interface{}, env Env) (Interceptor, error) {
+	if env.PromptLogger == nil {
+		return nil, nil // 未配置 prompt_log_file 时不启用
+	}
+	return &promptLog{logger: env.PromptLogger}, nil
+}
+
+func (p *promptLog) Name() string { return "prompt_log" }
+
+func (p *promptLog) InterceptRequest(rc *RequestContext, req *openai.ChatCompletionRequest) error {
+	if rc.DryRun || len(req.Messages) == 0 {
+		return nil
+	}
+	if err := p.logger.Log(req.Messages); err != nil {
+		log.Printf("[警告] 保存请求日志失败: %v", err)
+	}
+	return nil
+}
+
+// responseLog 将非流式响应写入 response 日志
+type responseLog struct {
+	logger *logger.ResponseLogger
+}
+
+func newResponseLog(options map[string]interface{}, env Env) (Interceptor, error) {
+	if env.ResponseLogger == nil {
+		return nil, nil // 未配置 response_log_file 时不启用
+	}
+	return &responseLog{logger: env.ResponseLogger}, nil
+}
+
+func (r *responseLog) Name() string { return "response_log" }
+
+func (r *responseLog) InterceptResponse(rc *RequestContext, resp *openai.ChatCompletionResponse) error {
+	if err := r.logger.Log(resp); err != nil {
+		log.Printf("[警告] 保存响应日志失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+// Package middleware 提供 ChatCompletion / Anthropic Messages 请求链路上的可插拔拦截器管道。
+// 拦截器按配置顺序执行，可实现 RequestInterceptor、ResponseInterceptor、ChunkInterceptor、
+// FinishObserver 中的任意组合；通过 Register 注册新类型后即可在配置 middlewares 中引用。
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"ocProxy/gateway/config"
+	"ocProxy/gateway/internal/logger"
+	"ocProxy/gateway/internal/skill"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 流式响应格式
+const (
+	StreamFormatOpenAI    = "openai"    // chat.completion.chunk
+	StreamFormatAnthropic = "anthropic" // Anthropic Messages 事件
+)
+
+// RequestContext 一次请求在管道中的上下文，拦截器之间可通过 Values 传递数据
+type RequestContext struct {
+	Context      context.Context
+	Protocol     string // 入站协议：openai 或 anthropic
+	Model        string // 客户端请求的模型名
+	User         string // 请求用户：X-User-ID 请求头或 OpenAI 请求体 user，可能为空
+	UseWorkModel bool
+	Stream       bool
+	StreamFormat string // 写给客户端的流格式：StreamFormatOpenAI 或 StreamFormatAnthropic
+	DryRun       bool   // 只执行请求拦截器、不调用上游（如 count_tokens），拦截器应跳过日志等副作用
+	Values       map[string]interface{}
+}
+
+// NewRequestContext 创建请求上下文
+func NewRequestContext(ctx context.Context, protocol, model string, useWorkModel, stream bool) *RequestContext {
+	return &RequestContext{
+		Context:      ctx,
+		Protocol:     protocol,
+		Model:        model,
+		UseWorkModel: useWorkModel,
+		Stream:       stream,
+		StreamFormat: protocol,
+		Values:       make(map[string]interface{}),
+	}
+}
+
+// Interceptor 拦截器基础接口
+type Interceptor interface {
+	Name() string
+}
+
+// RequestInterceptor 调用上游前处理请求，可修改 messages、tools 等；返回错误则终止请求
+type RequestInterceptor interface {
+	Interceptor
+	InterceptRequest(rc *RequestContext, req *openai.ChatCompletionRequest) error
+}
+
+// ResponseInterceptor 处理非流式响应（Anthropic 入站时为转换前的 OpenAI 响应）
+type ResponseInterceptor interface {
+	Interceptor
+	InterceptResponse(rc *RequestContext, resp *openai.ChatCompletionResponse) error
+}
+
+// ChunkInterceptor 处理写给客户端的每个 SSE data 负载（不含 [DONE]），格式见 rc.StreamFormat。
+// 返回新的负载；返回 nil 表示丢弃该 chunk（连同所在 SSE 事件的 event: 行）；返回错误则中断流。
+type ChunkInterceptor interface {
+	Interceptor
+	InterceptChunk(rc *RequestContext, data []byte) ([]byte, error)
+}
+
+// FinishObserver 请求结束（响应写完或出错）时回调，可用于统计
+type FinishObserver interface {
+	Interceptor
+	OnFinish(rc *RequestContext, err error)
+}
+
+// Env 内置拦截器可用的依赖
+type Env struct {
+	Skills         *skill.Library // 未配置 skill_dirs 时为 nil
+	PromptLogger   *logger.PromptLogger
+	ResponseLogger *logger.ResponseLogger
+}
+
+// Factory 根据配置项 options 创建拦截器
+type Factory func(options map[string]interface{}, env Env) (Interceptor, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register 注册拦截器类型；同名重复注册会覆盖
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+}
+
+// Registered 返回已注册的拦截器类型名（排序后）
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultMiddlewares 未配置 middlewares 时使用的默认管道，与原有行为一致：先注入技能，再记录 prompt
+var DefaultMiddlewares = []config.MiddlewareConfig{
+	{Name: "skill_inject"},
+	{Name: "prompt_log"},
+}
+
+// Pipeline 按顺序执行的拦截器集合
+type Pipeline struct {
+	requests  []RequestInterceptor
+	responses []ResponseInterceptor
+	chunks    []ChunkInterceptor
+	finishers []FinishObserver
+}
+
+// Build 根据配置创建管道；cfgs 为空时使用 DefaultMiddlewares，enabled 为 false 的项跳过
+func Build(cfgs []config.MiddlewareConfig, env Env) (*Pipeline, error) {
+	if len(cfgs) == 0 {
+		cfgs = DefaultMiddlewares
+	}
+	p := &Pipeline{}
+	for _, c := range cfgs {
+		if c.Enabled != nil && !*c.Enabled {
+			continue
+		}
+		registryMu.RLock()
+		factory, ok := registry[c.Name]
+		registryMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("未知的 middleware: %s（可用: %v）", c.Name, Registered())
+		}
+		ic, err := factory(c.Options, env)
+		if err != nil {
+			return nil, fmt.Errorf("创建 middleware %s 失败: %w", c.Name, err)
+		}
+		if ic == nil {
+			continue
+		}
+		p.Use(ic)
+	}
+	return p, nil
+}
+
+// Use 追加拦截器，按其实现的接口分别加入对应阶段
+func (p *Pipeline) Use(ic Interceptor) {
+	if v, ok := ic.(RequestInterceptor); ok {
+		p.requests = append(p.requests, v)
+	}
+	if v, ok := ic.(ResponseInterceptor); ok {
+		p.responses = append(p.responses, v)
+	}
+	if v, ok := ic.(ChunkInterceptor); ok {
+		p.chunks = append(p.chunks, v)
+	}
+	if v, ok := ic.(FinishObserver); ok {
+		p.finishers = append(p.finishers, v)
+	}
+}
+
+// ProcessRequest 依次执行请求拦截器
+func (p *Pipeline) ProcessRequest(rc *RequestContext, req *openai.ChatCompletionRequest) error {
+	if p == nil {
+		return nil
+	}
+	for _, ic := range p.requests {
+		if err := ic.InterceptRequest(rc, req); err != nil {
+			return fmt.Errorf("middleware %s: %w", ic.Name(), err)
+		}
+	}
+	return nil
+}
+
+// HasResponseInterceptors 是否存在响应拦截器
+func (p *Pipeline) HasResponseInterceptors() bool {
+	return p != nil && len(p.responses) > 0
+}
+
+// ProcessResponse 依次执行响应拦截器
+func (p *Pipeline) ProcessResponse(rc *RequestContext, resp *openai.ChatCompletionResponse) error {
+	if p == nil {
+		return nil
+	}
+	for _, ic := range p.responses {
+		if err := ic.InterceptResponse(rc, resp); err != nil {
+			return fmt.Errorf("middleware %s: %w", ic.Name(), err)
+		}
+	}
+	return nil
+}
+
+// ProcessChunk 依次执行 chunk 拦截器；任一拦截器丢弃后不再继续
+func (p *Pipeline) ProcessChunk(rc *RequestContext, data []byte) ([]byte, error) {
+	if p == nil {
+		return data, nil
+	}
+	for _, ic := range p.chunks {
+		out, err := ic.InterceptChunk(rc, data)
+		if err != nil {
+			return nil, fmt.Errorf("middleware %s: %w", ic.Name(), err)
+		}
+		if out == nil {
+			return nil, nil
+		}
+		data = out
+	}
+	return data, nil
+}
+
+// Finish 通知所有观察者请求结束
+func (p *Pipeline) Finish(rc *RequestContext, err error) {
+	if p == nil {
+		return
+	}
+	for _, ic := range p.finishers {
+		ic.OnFinish(rc, err)
+	}
+}
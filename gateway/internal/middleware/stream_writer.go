@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// streamWriter 按行拦截写给客户端的 SSE，data 行交给 chunk 拦截器处理
+type streamWriter struct {
+	http.ResponseWriter
+	pipeline *Pipeline
+	rc       *RequestContext
+	pending  []byte // 尚未凑成完整一行的数据
+	held     []byte // 当前事件中 data 行之前的行（event:、id: 等），等 data 行保留后再一起写出
+	dropping bool   // 当前事件的 data 已被丢弃，直到空行为止的行都不写出
+}
+
+// WrapStream 返回会对 SSE data 行执行 chunk 拦截器的 ResponseWriter；无 chunk 拦截器时原样返回 w
+func (p *Pipeline) WrapStream(rc *RequestContext, w http.ResponseWriter) http.ResponseWriter {
+	if p == nil || len(p.chunks) == 0 {
+		return w
+	}
+	return &streamWriter{ResponseWriter: w, pipeline: p, rc: rc}
+}
+
+// Write 缓冲到完整行后处理并写出；返回值始终为输入长度，使调用方不感知改写后的长度变化
+func (s *streamWriter) Write(b []byte) (int, error) {
+	s.pending = append(s.pending, b...)
+	for {
+		idx := bytes.IndexByte(s.pending, '\n')
+		if idx < 0 {
+			break
+		}
+		line := append([]byte(nil), s.pending[:idx+1]...)
+		s.pending = s.pending[idx+1:]
+
+		out, err := s.transform(line)
+		if err != nil {
+			return 0, err
+		}
+		if len(out) > 0 {
+			if _, err := s.ResponseWriter.Write(out); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(b), nil
+}
+
+// transform 处理单行，按 SSE 事件（以空行结束）整体保留或丢弃：data 行之前的 event: 等行先缓存，
+// data 行被拦截器丢弃时连同缓存的行与结束空行一起丢弃，避免客户端收到没有 data 的事件；
+// 非 data 行与 [DONE] 原样返回
+func (s *streamWriter) transform(line []byte) ([]byte, error) {
+	trimmed := bytes.TrimRight(line, "\r\n")
+	if len(trimmed) == 0 {
+		// 事件结束
+		if s.dropping {
+			s.dropping = false
+			return nil, nil
+		}
+		return s.release(line), nil
+	}
+	if s.dropping {
+		return nil, nil
+	}
+	if !bytes.HasPrefix(trimmed, []byte("data:")) {
+		if bytes.HasPrefix(trimmed, []byte(":")) && len(s.held) == 0 {
+			return line, nil // 事件之间的注释（如 keepalive）
+		}
+		s.held = append(s.held, line...)
+		return nil, nil
+	}
+	payload := bytes.TrimSpace(bytes.TrimPrefix(trimmed, []byte("data:")))
+	if len(payload) == 0 || bytes.Equal(payload, []byte("[DONE]")) {
+		return s.release(line), nil
+	}
+	out, err := s.pipeline.ProcessChunk(s.rc, payload)
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		s.held = nil
+		s.dropping = true
+		return nil, nil
+	}
+	result := make([]byte, 0, len(out)+8)
+	result = append(result, "data: "...)
+	result = append(result, out...)
+	return s.release(append(result, '\n')), nil
+}
+
+// release 返回缓存的行加上 line，并清空缓存
+func (s *streamWriter) release(line []byte) []byte {
+	if len(s.held) == 0 {
+		return line
+	}
+	out := append(s.held, line...)
+	s.held = nil
+	return out
+}
+
+// Flush 透传 http.Flusher
+func (s *streamWriter) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+// dropPing 丢弃 Anthropic ping 事件，并给其余负载打标记
+type dropPing struct{}
+
+func (dropPing) Name() string { return "drop_ping" }
+
+func (dropPing) InterceptChunk(rc *RequestContext, data []byte) ([]byte, error) {
+	if bytes.Contains(data, []byte(`"type":"ping"`)) {
+		return nil, nil
+	}
+	return bytes.Replace(data, []byte(`"text":"a"`), []byte(`"text":"A"`), 1), nil
+}
+
+func TestStreamWriterDropsWholeEvent(t *testing.T) {
+	p := &Pipeline{}
+	p.Use(dropPing{})
+	rec := httptest.NewRecorder()
+	w := p.WrapStream(NewRequestContext(context.Background(), StreamFormatAnthropic, "m", false, true), rec)
+
+	// 逐段写入，模拟事件行与 data 行分开到达
+	for _, part := range []string{
+		"event: message_start\n", "data: {\"type\":\"message_start\"}\n\n",
+		"event: ping\n", "data: {\"type\":\"ping\"}\n", "\n",
+		": keepalive\n\n",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"text\":\"a\"}}\n\n",
+		"event: ping\ndata: {\"type\":\"ping\"}\n\n",
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n",
+	} {
+		if n, err := w.Write([]byte(part)); err != nil || n != len(part) {
+			t.Fatalf("Write(%q) = %d, %v", part, n, err)
+		}
+	}
+
+	want := "event: message_start\ndata: {\"type\":\"message_start\"}\n\n" +
+		": keepalive\n\n" +
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"text\":\"A\"}}\n\n" +
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("输出:\n%q\n期望:\n%q", got, want)
+	}
+}
+
+func TestStreamWriterOpenAIChunks(t *testing.T) {
+	p := &Pipeline{}
+	p.Use(dropPing{})
+	rec := httptest.NewRecorder()
+	w := p.WrapStream(NewRequestContext(context.Background(), StreamFormatOpenAI, "m", false, true), rec)
+	w.Write([]byte("data: {\"type\":\"ping\"}\n\ndata: {\"text\":\"a\"}\n\ndata: [DONE]\n\n"))
+
+	if got, want := rec.Body.String(), "data: {\"text\":\"A\"}\n\ndata: [DONE]\n\n"; got != want {
+		t.Errorf("输出 %q, 期望 %q", got, want)
+	}
+}
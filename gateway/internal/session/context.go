@@ -0,0 +1,46 @@
+package session
+
+import (
+	"ocProxy/gateway/internal/tokenizer"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// TrimContext 按 token 预算裁剪发给上游的上下文（存储的完整历史不受影响）：
+// 开头的 system 消息始终保留，其余消息从最新往前保留到预算用尽；
+// 窗口起点落在 tool 消息上时向前扩展到对应的 assistant tool_calls，避免工具结果脱离调用（此时可能略超预算）。
+// 最后一条消息无论预算都会保留。maxTokens <= 0 时不裁剪。
+func TrimContext(messages []openai.ChatCompletionMessage, maxTokens int) []openai.ChatCompletionMessage {
+	if maxTokens <= 0 || tokenizer.CountMessages(messages) <= maxTokens {
+		return messages
+	}
+
+	head := 0
+	for head < len(messages) && messages[head].Role == openai.ChatMessageRoleSystem {
+		head++
+	}
+	if head >= len(messages) {
+		return messages
+	}
+	budget := maxTokens - tokenizer.CountMessages(messages[:head])
+
+	start := len(messages) - 1
+	used := tokenizer.CountMessages(messages[start:])
+	for start > head {
+		// 单条计数含回复起始开销，估算略偏保守
+		cost := tokenizer.CountMessages(messages[start-1 : start])
+		if used+cost > budget {
+			break
+		}
+		used += cost
+		start--
+	}
+	// 起点为 tool 消息时向前扩展到发起调用的 assistant 消息
+	for start > head && messages[start].Role == openai.ChatMessageRoleTool {
+		start--
+	}
+
+	trimmed := make([]openai.ChatCompletionMessage, 0, head+len(messages)-start)
+	trimmed = append(trimmed, messages[:head]...)
+	return append(trimmed, messages[start:]...)
+}
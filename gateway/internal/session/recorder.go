@@ -0,0 +1,103 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// StreamRecorder 包装写给客户端的 OpenAI SSE 流，原样写出的同时累积 assistant 消息（content 与 tool_calls），
+// 用于流结束后写入会话历史
+type StreamRecorder struct {
+	http.ResponseWriter
+	pending   []byte
+	content   strings.Builder
+	toolCalls map[int]*openai.ToolCall
+	lastIndex int
+}
+
+// NewStreamRecorder 创建流记录器
+func NewStreamRecorder(w http.ResponseWriter) *StreamRecorder {
+	return &StreamRecorder{ResponseWriter: w, toolCalls: make(map[int]*openai.ToolCall), lastIndex: -1}
+}
+
+// Write 原样写出，并按行解析 data 负载
+func (r *StreamRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.pending = append(r.pending, b[:n]...)
+	for {
+		idx := bytes.IndexByte(r.pending, '\n')
+		if idx < 0 {
+			break
+		}
+		r.feed(bytes.TrimSpace(r.pending[:idx]))
+		r.pending = r.pending[idx+1:]
+	}
+	return n, err
+}
+
+// Flush 透传 http.Flusher
+func (r *StreamRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *StreamRecorder) feed(line []byte) {
+	if !bytes.HasPrefix(line, []byte("data:")) {
+		return
+	}
+	data := bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+	if len(data) == 0 || bytes.Equal(data, []byte("[DONE]")) {
+		return
+	}
+	var chunk openai.ChatCompletionStreamResponse
+	if err := json.Unmarshal(data, &chunk); err != nil || len(chunk.Choices) == 0 {
+		return
+	}
+	delta := chunk.Choices[0].Delta
+	r.content.WriteString(delta.Content)
+	for _, tc := range delta.ToolCalls {
+		idx := r.lastIndex
+		if tc.Index != nil {
+			idx = *tc.Index
+		} else if tc.ID != "" {
+			idx = r.lastIndex + 1
+		}
+		r.lastIndex = idx
+		call, ok := r.toolCalls[idx]
+		if !ok {
+			call = &openai.ToolCall{Type: openai.ToolTypeFunction}
+			r.toolCalls[idx] = call
+		}
+		if tc.ID != "" {
+			call.ID = tc.ID
+		}
+		if tc.Type != "" {
+			call.Type = tc.Type
+		}
+		call.Function.Name += tc.Function.Name
+		call.Function.Arguments += tc.Function.Arguments
+	}
+}
+
+// Message 返回累积得到的 assistant 消息
+func (r *StreamRecorder) Message() openai.ChatCompletionMessage {
+	msg := openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: r.content.String(),
+	}
+	indexes := make([]int, 0, len(r.toolCalls))
+	for idx := range r.toolCalls {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+	for _, idx := range indexes {
+		msg.ToolCalls = append(msg.ToolCalls, *r.toolCalls[idx])
+	}
+	return msg
+}
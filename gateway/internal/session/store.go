@@ -0,0 +1,276 @@
+// Package session 提供服务端会话存储：每个会话一个 JSON 文件，保存完整消息历史（含工具调用与工具结果），
+// 客户端每轮只需发送新增消息。
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrNotFound 会话不存在
+var ErrNotFound = errors.New("会话不存在")
+
+// idPattern 会话 ID 合法字符，防止路径穿越
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// titleMaxRunes 列表中标题（首条 user 消息）最大字符数
+const titleMaxRunes = 40
+
+// Session 会话
+type Session struct {
+	ID        string                         `json:"id"`
+	Object    string                         `json:"object"`
+	Model     string                         `json:"model,omitempty"` // 新一轮请求未指定 model 时使用
+	Metadata  map[string]string              `json:"metadata,omitempty"`
+	CreatedAt int64                          `json:"created_at"`
+	UpdatedAt int64                          `json:"updated_at"`
+	Messages  []openai.ChatCompletionMessage `json:"messages"`
+}
+
+// Summary 会话列表项
+type Summary struct {
+	ID           string            `json:"id"`
+	Object       string            `json:"object"`
+	Model        string            `json:"model,omitempty"`
+	Title        string            `json:"title,omitempty"` // 首条 user 消息摘要
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	MessageCount int               `json:"message_count"`
+	CreatedAt    int64             `json:"created_at"`
+	UpdatedAt    int64             `json:"updated_at"`
+}
+
+// Store 基于目录的会话存储
+type Store struct {
+	dir   string
+	mu    sync.Mutex             // 保护 locks
+	locks map[string]*sync.Mutex // 会话级锁，保证同一会话的多轮请求串行
+}
+
+// NewStore 创建会话存储；目录在首次保存会话时才创建，未使用会话功能时不在工作目录留下空目录
+func NewStore(dir string) (*Store, error) {
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		return nil, fmt.Errorf("会话目录 %s 不是目录", dir)
+	}
+	return &Store{dir: dir, locks: make(map[string]*sync.Mutex)}, nil
+}
+
+// ValidID 判断会话 ID 是否合法
+func ValidID(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// Lock 获取会话级锁，返回解锁函数；一轮对话（读取历史、调用上游、追加消息）期间应持有。
+// 只为已存在的会话创建锁，ID 不合法或会话不存在（含等待期间被删除）时返回 ErrNotFound，
+// 避免任意 session_id 在 locks 中无限累积；锁在 Delete 时释放
+func (s *Store) Lock(id string) (func(), error) {
+	if !ValidID(id) {
+		return nil, ErrNotFound
+	}
+	s.mu.Lock()
+	l, ok := s.locks[id]
+	if !ok {
+		if !s.exists(id) {
+			s.mu.Unlock()
+			return nil, ErrNotFound
+		}
+		l = &sync.Mutex{}
+		s.locks[id] = l
+	}
+	s.mu.Unlock()
+
+	l.Lock()
+	if !s.exists(id) {
+		l.Unlock()
+		s.mu.Lock()
+		if s.locks[id] == l {
+			delete(s.locks, id)
+		}
+		s.mu.Unlock()
+		return nil, ErrNotFound
+	}
+	return l.Unlock, nil
+}
+
+// exists 会话文件是否存在
+func (s *Store) exists(id string) bool {
+	_, err := os.Stat(s.path(id))
+	return err == nil
+}
+
+// Create 创建会话，messages 可为初始消息（如 system）
+func (s *Store) Create(model string, messages []openai.ChatCompletionMessage, metadata map[string]string) (*Session, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	sess := &Session{
+		ID:        id,
+		Object:    "session",
+		Model:     model,
+		Metadata:  metadata,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Messages:  messages,
+	}
+	if sess.Messages == nil {
+		sess.Messages = []openai.ChatCompletionMessage{}
+	}
+	if err := s.save(sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// Get 读取会话
+func (s *Store) Get(id string) (*Session, error) {
+	if !ValidID(id) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("读取会话失败: %w", err)
+	}
+	var sess Session
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, fmt.Errorf("解析会话失败: %w", err)
+	}
+	return &sess, nil
+}
+
+// Append 追加消息并保存；调用方应持有 Lock
+func (s *Store) Append(id string, messages ...openai.ChatCompletionMessage) (*Session, error) {
+	sess, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	sess.Messages = append(sess.Messages, messages...)
+	sess.UpdatedAt = time.Now().Unix()
+	if err := s.save(sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// Delete 删除会话
+func (s *Store) Delete(id string) error {
+	if !ValidID(id) {
+		return ErrNotFound
+	}
+	if err := os.Remove(s.path(id)); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("删除会话失败: %w", err)
+	}
+	s.mu.Lock()
+	delete(s.locks, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// List 返回所有会话摘要，按更新时间倒序
+func (s *Store) List() ([]Summary, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Summary{}, nil // 尚未创建过会话
+		}
+		return nil, fmt.Errorf("读取会话目录失败: %w", err)
+	}
+	summaries := make([]Summary, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		sess, err := s.Get(strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil {
+			continue
+		}
+		summaries = append(summaries, Summary{
+			ID:           sess.ID,
+			Object:       "session",
+			Model:        sess.Model,
+			Title:        title(sess.Messages),
+			Metadata:     sess.Metadata,
+			MessageCount: len(sess.Messages),
+			CreatedAt:    sess.CreatedAt,
+			UpdatedAt:    sess.UpdatedAt,
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].UpdatedAt > summaries[j].UpdatedAt
+	})
+	return summaries, nil
+}
+
+// save 先写临时文件再重命名，避免写入中断导致会话文件损坏
+func (s *Store) save(sess *Session) error {
+	data, err := json.MarshalIndent(sess, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化会话失败: %w", err)
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("创建会话目录失败: %w", err)
+	}
+	tmp := s.path(sess.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("写入会话失败: %w", err)
+	}
+	if err := os.Rename(tmp, s.path(sess.ID)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("写入会话失败: %w", err)
+	}
+	return nil
+}
+
+// title 取首条 user 消息作为标题
+func title(messages []openai.ChatCompletionMessage) string {
+	for _, m := range messages {
+		if m.Role != openai.ChatMessageRoleUser {
+			continue
+		}
+		text := m.Content
+		if text == "" {
+			for _, p := range m.MultiContent {
+				if p.Type == openai.ChatMessagePartTypeText {
+					text = p.Text
+					break
+				}
+			}
+		}
+		text = strings.Join(strings.Fields(text), " ")
+		if r := []rune(text); len(r) > titleMaxRunes {
+			text = string(r[:titleMaxRunes]) + "…"
+		}
+		return text
+	}
+	return ""
+}
+
+func newID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成会话 ID 失败: %w", err)
+	}
+	return "sess_" + hex.EncodeToString(b), nil
+}
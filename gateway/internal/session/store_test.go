@@ -0,0 +1,132 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockUnknownSessionsDoNotAccumulate(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		for _, id := range []string{fmt.Sprintf("missing-%d", i), fmt.Sprintf("../bad/%d", i)} {
+			if _, err := store.Lock(id); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Lock(%q) err = %v, 期望 ErrNotFound", id, err)
+			}
+		}
+	}
+	if n := len(store.locks); n != 0 {
+		t.Errorf("不存在的会话不应创建锁，locks = %d", n)
+	}
+}
+
+func TestLockReleasedOnDelete(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := store.Create("", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := store.Lock(sess.ID)
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	unlock()
+	if len(store.locks) != 1 {
+		t.Fatalf("locks = %d, 期望 1", len(store.locks))
+	}
+	if err := store.Delete(sess.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.locks) != 0 {
+		t.Errorf("删除会话后应释放锁，locks = %d", len(store.locks))
+	}
+	if _, err := store.Lock(sess.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("已删除会话 Lock err = %v", err)
+	}
+	if len(store.locks) != 0 {
+		t.Errorf("已删除会话不应重新创建锁，locks = %d", len(store.locks))
+	}
+}
+
+func TestLockWaiterSeesDeletedSession(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := store.Create("", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := store.Lock(sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		unlockWaiter, err := store.Lock(sess.ID)
+		if err == nil {
+			unlockWaiter()
+		}
+		result <- err
+	}()
+	time.Sleep(20 * time.Millisecond) // 让等待方阻塞在会话锁上
+	if err := store.Delete(sess.ID); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+
+	if err := <-result; !errors.Is(err, ErrNotFound) {
+		t.Errorf("等待期间会话被删除，Lock err = %v, 期望 ErrNotFound", err)
+	}
+	if len(store.locks) != 0 {
+		t.Errorf("locks = %d, 期望 0", len(store.locks))
+	}
+}
+
+func TestStoreCreatesDirOnFirstSession(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sessions")
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("NewStore 不应创建目录: %v", err)
+	}
+	if list, err := store.List(); err != nil || len(list) != 0 {
+		t.Fatalf("目录不存在时 List = %v, %v", list, err)
+	}
+	if _, err := store.Get("sess_missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get err = %v", err)
+	}
+
+	sess, err := store.Create("", nil, nil)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Fatalf("首次 Create 后应创建目录: %v", err)
+	}
+	if list, _ := store.List(); len(list) != 1 || list[0].ID != sess.ID {
+		t.Errorf("List = %+v", list)
+	}
+}
+
+func TestNewStoreRejectsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewStore(path); err == nil {
+		t.Error("会话目录为普通文件时应返回错误")
+	}
+}
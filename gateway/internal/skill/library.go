@@ -0,0 +1,329 @@
+package skill
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// DefaultWatchInterval 检查 SKILL.md 变更的默认间隔
+const DefaultWatchInterval = 2 * time.Second
+
+// 技能集跳过原因（Select 之外的过滤）
+const (
+	SkipDisabled = "disabled"  // 已通过 API 或配置禁用
+	SkipSkillSet = "skill_set" // 不在请求模型或用户的技能集中
+)
+
+// 技能集类型
+const (
+	SetKindModel = "models"
+	SetKindUser  = "users"
+)
+
+// ErrNotFound 技能不存在
+var ErrNotFound = fmt.Errorf("技能不存在")
+
+// Library 技能库：启动时加载 skill_dirs 下全部 SKILL.md 到内存，Watch 轮询文件变更后重新加载；
+// 支持运行时启用/禁用技能，以及按请求模型、用户限定可注入的技能集
+type Library struct {
+	dirs []string
+	opts SelectOptions
+
+	mu          sync.RWMutex
+	skills      []*Skill // 按 name 排序
+	byName      map[string]*Skill
+	fingerprint string
+	loadedAt    time.Time
+	disabled    map[string]bool
+	modelSets   map[string][]string // 小写模型名 -> 技能名（支持通配符）
+	userSets    map[string][]string // 用户 ID -> 技能名（支持通配符）
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// NewLibrary 创建技能库并加载技能；disabled 为初始禁用的技能名
+func NewLibrary(dirs []string, opts SelectOptions, disabled []string) (*Library, error) {
+	l := &Library{
+		dirs:      dirs,
+		opts:      opts,
+		disabled:  make(map[string]bool),
+		modelSets: make(map[string][]string),
+		userSets:  make(map[string][]string),
+		stop:      make(chan struct{}),
+	}
+	for _, name := range disabled {
+		if name = strings.TrimSpace(name); name != "" {
+			l.disabled[name] = true
+		}
+	}
+	if _, err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload 重新扫描并加载技能，文件未变化时不重新解析；返回是否有变化。
+// 加载失败时保留原有技能
+func (l *Library) Reload() (bool, error) {
+	fp, err := fingerprint(l.dirs)
+	if err != nil {
+		return false, err
+	}
+	l.mu.RLock()
+	unchanged := fp == l.fingerprint && !l.loadedAt.IsZero()
+	l.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	skills, err := LoadSkills(l.dirs)
+	if err != nil {
+		return false, err
+	}
+	byName := make(map[string]*Skill, len(skills))
+	unique := skills[:0]
+	for _, s := range skills {
+		if prev, ok := byName[s.Name]; ok {
+			log.Printf("[警告] 技能名重复: %s（%s 与 %s），仅保留前者", s.Name, prev.Path, s.Path)
+			continue
+		}
+		byName[s.Name] = s
+		unique = append(unique, s)
+	}
+	sort.Slice(unique, func(i, j int) bool { return unique[i].Name < unique[j].Name })
+
+	l.mu.Lock()
+	l.skills = unique
+	l.byName = byName
+	l.fingerprint = fp
+	l.loadedAt = time.Now()
+	l.mu.Unlock()
+	return true, nil
+}
+
+// fingerprint 以所有 SKILL.md 的路径、大小与修改时间计算指纹，用于判断是否需要重新加载
+func fingerprint(dirs []string) (string, error) {
+	var entries []string
+	for _, dir := range dirs {
+		dir = strings.TrimSpace(dir)
+		if dir == "" {
+			continue
+		}
+		err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() || d.Name() != skillFileName {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			entries = append(entries, fmt.Sprintf("%s|%d|%d", p, info.Size(), info.ModTime().UnixNano()))
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	sum := sha1.Sum([]byte(strings.Join(entries, "\n")))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Watch 后台按 interval 轮询 SKILL.md 变更（新增、修改、删除）并重新加载；interval<=0 时使用默认值
+func (l *Library) Watch(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.stop:
+				return
+			case <-ticker.C:
+				changed, err := l.Reload()
+				if err != nil {
+					log.Printf("[警告] 重新加载技能失败: %v，继续使用已加载的技能", err)
+				} else if changed {
+					log.Printf("[Skill] 检测到 SKILL.md 变更，已重新加载 %d 个技能", len(l.Skills()))
+				}
+			}
+		}
+	}()
+}
+
+// Close 停止文件监听
+func (l *Library) Close() {
+	if l == nil {
+		return
+	}
+	l.once.Do(func() {
+		close(l.stop)
+		l.wg.Wait()
+	})
+}
+
+// Skills 返回全部已加载的技能（按 name 排序）
+func (l *Library) Skills() []*Skill {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return append([]*Skill(nil), l.skills...)
+}
+
+// Get 按名称取技能
+func (l *Library) Get(name string) (*Skill, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	s, ok := l.byName[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return s, nil
+}
+
+// LoadedAt 最近一次加载时间
+func (l *Library) LoadedAt() time.Time {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.loadedAt
+}
+
+// Enabled 技能是否启用
+func (l *Library) Enabled(name string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return !l.disabled[name]
+}
+
+// SetEnabled 启用或禁用技能；禁用状态按名称保存，重新加载后仍然有效
+func (l *Library) SetEnabled(name string, enabled bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.byName[name]; !ok {
+		return ErrNotFound
+	}
+	if enabled {
+		delete(l.disabled, name)
+	} else {
+		l.disabled[name] = true
+	}
+	return nil
+}
+
+// SkillSets 模型与用户技能集
+type SkillSets struct {
+	Models map[string][]string `json:"models"`
+	Users  map[string][]string `json:"users"`
+}
+
+// Sets 返回当前技能集的副本
+func (l *Library) Sets() SkillSets {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return SkillSets{Models: copySets(l.modelSets), Users: copySets(l.userSets)}
+}
+
+func copySets(m map[string][]string) map[string][]string {
+	out := make(map[string][]string, len(m))
+	for k, v := range m {
+		out[k] = append([]string(nil), v...)
+	}
+	return out
+}
+
+// SetSkillSet 设置模型（kind=models，按请求 model 不区分大小写）或用户（kind=users）的技能集，
+// 该模型或用户的请求只会注入集合内的技能；names 为空时删除该技能集（不限制）。名称支持通配符，如 iot-*
+func (l *Library) SetSkillSet(kind, key string, names []string) error {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return fmt.Errorf("技能集的模型名或用户 ID 不能为空")
+	}
+	names = cleanList(names)
+	for _, n := range names {
+		if _, err := path.Match(n, ""); err != nil {
+			return fmt.Errorf("技能名通配符无效: %s", n)
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var sets map[string][]string
+	switch kind {
+	case SetKindModel:
+		sets, key = l.modelSets, strings.ToLower(key)
+	case SetKindUser:
+		sets = l.userSets
+	default:
+		return fmt.Errorf("未知的技能集类型: %s（可选 %s、%s）", kind, SetKindModel, SetKindUser)
+	}
+	if len(names) == 0 {
+		delete(sets, key)
+	} else {
+		sets[key] = names
+	}
+	return nil
+}
+
+// Select 按启用状态、模型与用户技能集过滤后，按相关性选择技能（见 Select）
+func (l *Library) Select(query, model, user string) *Selection {
+	l.mu.RLock()
+	skills := l.skills
+	modelSet, hasModelSet := l.modelSets[strings.ToLower(model)]
+	userSet, hasUserSet := l.userSets[user]
+	var eligible []*Skill
+	var skipped []*Candidate
+	for _, s := range skills {
+		switch {
+		case l.disabled[s.Name]:
+			skipped = append(skipped, &Candidate{Skill: s, Reason: SkipDisabled})
+		case (hasModelSet && !inSet(modelSet, s.Name)) || (user != "" && hasUserSet && !inSet(userSet, s.Name)):
+			skipped = append(skipped, &Candidate{Skill: s, Reason: SkipSkillSet})
+		default:
+			eligible = append(eligible, s)
+		}
+	}
+	l.mu.RUnlock()
+
+	sel := Select(eligible, query, model, l.opts)
+	sel.Skipped = append(sel.Skipped, skipped...)
+	return sel
+}
+
+func inSet(set []string, name string) bool {
+	for _, pattern := range set {
+		if pattern == name {
+			return true
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Inject 选择与最后一条 user 消息相关的技能，作为 user 消息插入 system 之后；返回新消息切片与选择结果
+func (l *Library) Inject(messages []openai.ChatCompletionMessage, model, user string) ([]openai.ChatCompletionMessage, *Selection) {
+	sel := l.Select(LastUserText(messages), model, user)
+	return Inject(messages, sel.Skills()), sel
+}
@@ -0,0 +1,229 @@
+package skill
+
+import (
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// 默认选择参数
+const (
+	DefaultTokenBudget = 4000
+	DefaultMinScore    = 1.0
+)
+
+// BM25 参数与关键词命中加分
+const (
+	bm25K1       = 1.2
+	bm25B        = 0.75
+	triggerBoost = 5.0
+	// metaRepeat name、description、triggers 在索引文档中重复的次数，使元数据比正文权重更高
+	metaRepeat = 3
+)
+
+// SelectOptions 技能选择参数
+type SelectOptions struct {
+	TokenBudget int     // 注入技能正文的总 token 上限；0 使用 DefaultTokenBudget，负数不限制
+	MaxSkills   int     // 最多注入的技能数，0 不限制
+	MinScore    float64 // 未命中关键词时 BM25 分数的下限；0 使用 DefaultMinScore
+}
+
+// 跳过原因
+const (
+	SkipModel     = "model"      // models 不包含请求模型
+	SkipScore     = "low_score"  // 未命中关键词且 BM25 分数低于下限
+	SkipBudget    = "budget"     // 超出 token 预算
+	SkipMaxSkills = "max_skills" // 超出数量上限
+)
+
+// Candidate 一个技能的评分结果
+type Candidate struct {
+	Skill   *Skill
+	Score   float64  // BM25 分数加关键词命中加分
+	Matched []string // 命中的 triggers
+	Reason  string   // 未选中的原因，选中时为空
+}
+
+// Selection 技能选择结果
+type Selection struct {
+	Query      string
+	Budget     int // 实际使用的 token 预算，负数表示不限制
+	UsedTokens int
+	Selected   []*Candidate // 按分数从高到低
+	Skipped    []*Candidate
+}
+
+// Skills 返回选中的技能
+func (s *Selection) Skills() []*Skill {
+	if s == nil {
+		return nil
+	}
+	out := make([]*Skill, 0, len(s.Selected))
+	for _, c := range s.Selected {
+		out = append(out, c.Skill)
+	}
+	return out
+}
+
+// Select 按与 query（最后一条 user 消息）的相关性选择技能：
+// 先按 models 过滤请求模型，再以 name、description、triggers 与正文建立 BM25 索引打分，
+// 每命中一个 trigger（query 中包含该词，不区分大小写）额外加分；
+// 命中 trigger 或分数不低于 MinScore 的技能按分数从高到低放入，直到 token 预算或数量上限。
+func Select(skills []*Skill, query, model string, opts SelectOptions) *Selection {
+	budget := opts.TokenBudget
+	if budget == 0 {
+		budget = DefaultTokenBudget
+	}
+	minScore := opts.MinScore
+	if minScore == 0 {
+		minScore = DefaultMinScore
+	}
+	sel := &Selection{Query: query, Budget: budget}
+
+	var eligible []*Skill
+	for _, s := range skills {
+		if !modelAllowed(s.Models, model) {
+			sel.Skipped = append(sel.Skipped, &Candidate{Skill: s, Reason: SkipModel})
+			continue
+		}
+		eligible = append(eligible, s)
+	}
+
+	candidates := score(eligible, query)
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Score > candidates[j].Score })
+	for _, c := range candidates {
+		switch {
+		case len(c.Matched) == 0 && c.Score < minScore:
+			c.Reason = SkipScore
+		case opts.MaxSkills > 0 && len(sel.Selected) >= opts.MaxSkills:
+			c.Reason = SkipMaxSkills
+		case budget >= 0 && sel.UsedTokens+c.Skill.Tokens > budget:
+			c.Reason = SkipBudget // 继续尝试更小的技能
+		}
+		if c.Reason != "" {
+			sel.Skipped = append(sel.Skipped, c)
+			continue
+		}
+		sel.Selected = append(sel.Selected, c)
+		sel.UsedTokens += c.Skill.Tokens
+	}
+	return sel
+}
+
+// modelAllowed models 为空时不限制；否则请求模型需与其中一项相同（不区分大小写）或匹配通配符
+func modelAllowed(models []string, model string) bool {
+	if len(models) == 0 {
+		return true
+	}
+	model = strings.ToLower(model)
+	for _, m := range models {
+		m = strings.ToLower(m)
+		if m == model {
+			return true
+		}
+		if ok, err := path.Match(m, model); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// score 计算每个技能的 BM25 分数与 trigger 命中
+func score(skills []*Skill, query string) []*Candidate {
+	candidates := make([]*Candidate, 0, len(skills))
+	if len(skills) == 0 {
+		return candidates
+	}
+	docs := make([]map[string]int, len(skills))
+	lengths := make([]int, len(skills))
+	df := make(map[string]int)
+	total := 0
+	for i, s := range skills {
+		meta := strings.Join(append([]string{s.Name, s.Description}, s.Triggers...), " ")
+		terms := terms(strings.Repeat(meta+" ", metaRepeat) + s.Content)
+		tf := make(map[string]int)
+		for _, t := range terms {
+			tf[t]++
+		}
+		for t := range tf {
+			df[t]++
+		}
+		docs[i] = tf
+		lengths[i] = len(terms)
+		total += len(terms)
+	}
+	avgdl := float64(total) / float64(len(skills))
+	if avgdl == 0 {
+		avgdl = 1
+	}
+
+	queryTerms := make(map[string]bool)
+	for _, t := range terms(query) {
+		queryTerms[t] = true
+	}
+	lowerQuery := strings.ToLower(query)
+	n := float64(len(skills))
+	for i, s := range skills {
+		c := &Candidate{Skill: s}
+		for t := range queryTerms {
+			f := float64(docs[i][t])
+			if f == 0 {
+				continue
+			}
+			idf := math.Log(1 + (n-float64(df[t])+0.5)/(float64(df[t])+0.5))
+			c.Score += idf * f * (bm25K1 + 1) / (f + bm25K1*(1-bm25B+bm25B*float64(lengths[i])/avgdl))
+		}
+		for _, tr := range s.Triggers {
+			if lowerQuery != "" && strings.Contains(lowerQuery, strings.ToLower(tr)) {
+				c.Matched = append(c.Matched, tr)
+				c.Score += triggerBoost
+			}
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates
+}
+
+// terms 分词：英文与数字按词切分并转小写（忽略单个字母），中日韩文字按相邻两字切分（单字成段时保留单字）
+func terms(text string) []string {
+	var out []string
+	var word []rune
+	var cjk []rune
+	flushWord := func() {
+		if len(word) > 1 || (len(word) == 1 && unicode.IsDigit(word[0])) {
+			out = append(out, string(word))
+		}
+		word = word[:0]
+	}
+	flushCJK := func() {
+		if len(cjk) == 1 {
+			out = append(out, string(cjk))
+		}
+		for i := 0; i+1 < len(cjk); i++ {
+			out = append(out, string(cjk[i:i+2]))
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, unicode.ToLower(r))
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return out
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
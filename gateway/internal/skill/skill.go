@@ -1,94 +1,201 @@
 package skill
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"ocProxy/gateway/internal/tokenizer"
+
 	"github.com/sashabaranov/go-openai"
+	"gopkg.in/yaml.v3"
 )
 
 const skillFileName = "SKILL.md"
 
-// InjectAfterSystem 根据配置的目录列表，从每个目录及其子目录读取所有 SKILL.md，
-// 将每个文件内容作为一条 user 消息，插入到 system 消息之后；若 skillDirs 为空则不修改。
-// 返回新消息切片，原切片未被修改。
-func InjectAfterSystem(messages []openai.ChatCompletionMessage, skillDirs []string) ([]openai.ChatCompletionMessage, error) {
-	if len(skillDirs) == 0 {
-		return messages, nil
+// Skill 一个 SKILL.md 技能。文件可以 YAML frontmatter 开头：
+//
+//	---
+//	name: send-email
+//	description: 发送邮件
+//	triggers: [邮件, email]   # 也可写作 keywords
+//	models: [work-model]     # 仅对这些请求模型注入，支持通配符；空表示不限
+//	---
+//
+// 没有 frontmatter 时以所在目录名作为 name，全文参与相关性匹配。
+type Skill struct {
+	Name        string
+	Description string
+	Triggers    []string
+	Models      []string
+	Path        string
+	Content     string // 去掉 frontmatter 后注入的正文
+	Tokens      int    // 正文 token 数
+}
+
+// frontmatter SKILL.md 头部元数据
+type frontmatter struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Triggers    []string `yaml:"triggers"`
+	Keywords    []string `yaml:"keywords"`
+	Models      []string `yaml:"models"`
+}
+
+// ParseSkill 解析 SKILL.md 内容；frontmatter 格式错误时返回错误
+func ParseSkill(path string, data []byte) (*Skill, error) {
+	s := &Skill{Path: path, Name: filepath.Base(filepath.Dir(path))}
+	body := data
+	if meta, rest, ok := splitFrontmatter(data); ok {
+		var fm frontmatter
+		if err := yaml.Unmarshal(meta, &fm); err != nil {
+			return nil, fmt.Errorf("解析 %s frontmatter 失败: %w", path, err)
+		}
+		if name := strings.TrimSpace(fm.Name); name != "" {
+			s.Name = name
+		}
+		s.Description = strings.TrimSpace(fm.Description)
+		s.Triggers = cleanList(append(fm.Triggers, fm.Keywords...))
+		s.Models = cleanList(fm.Models)
+		body = rest
 	}
-	userMsgs, err := loadSkillUserMessages(skillDirs)
-	if err != nil {
-		return nil, err
+	s.Content = strings.TrimSpace(string(body))
+	s.Tokens = tokenizer.Count(s.Content)
+	return s, nil
+}
+
+// splitFrontmatter 拆出以 --- 开头、--- 结束的 frontmatter
+func splitFrontmatter(data []byte) (meta, rest []byte, ok bool) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !bytes.HasPrefix(data, []byte("---")) {
+		return nil, data, false
 	}
-	if len(userMsgs) == 0 {
-		return messages, nil
+	first := bytes.IndexByte(data, '\n')
+	if first < 0 || strings.TrimSpace(string(data[:first])) != "---" {
+		return nil, data, false
 	}
-	// 找到最后一条 system 消息的下一个位置
-	insertAt := 0
-	for i := range messages {
-		if messages[i].Role == openai.ChatMessageRoleSystem {
-			insertAt = i + 1
+	lines := data[first+1:]
+	offset := 0
+	for offset <= len(lines) {
+		end := bytes.IndexByte(lines[offset:], '\n')
+		line := lines[offset:]
+		if end >= 0 {
+			line = lines[offset : offset+end]
+		}
+		if strings.TrimSpace(string(line)) == "---" {
+			meta = lines[:offset]
+			if end < 0 {
+				return meta, nil, true
+			}
+			return meta, lines[offset+end+1:], true
 		}
+		if end < 0 {
+			break
+		}
+		offset += end + 1
 	}
-	// 在 insertAt 处插入所有 skill user 消息
-	out := make([]openai.ChatCompletionMessage, 0, len(messages)+len(userMsgs))
-	out = append(out, messages[:insertAt]...)
-	out = append(out, userMsgs...)
-	out = append(out, messages[insertAt:]...)
-	return out, nil
+	return nil, data, false
+}
+
+func cleanList(items []string) []string {
+	var out []string
+	for _, it := range items {
+		if it = strings.TrimSpace(it); it != "" {
+			out = append(out, it)
+		}
+	}
+	return out
 }
 
-// loadSkillUserMessages 从目录列表中收集所有 SKILL.md 内容，每个文件一条 user 消息。
-func loadSkillUserMessages(skillDirs []string) ([]openai.ChatCompletionMessage, error) {
-	var contents []string
+// LoadSkills 从目录列表及其子目录读取并解析所有 SKILL.md
+func LoadSkills(skillDirs []string) ([]*Skill, error) {
+	var skills []*Skill
 	for _, dir := range skillDirs {
 		dir = strings.TrimSpace(dir)
 		if dir == "" {
 			continue
 		}
-		collected, err := collectSkillFilesInDir(dir)
+		err := walkSkillFiles(dir, func(path string, data []byte) error {
+			s, err := ParseSkill(path, data)
+			if err != nil {
+				return err
+			}
+			if s.Content != "" {
+				skills = append(skills, s)
+			}
+			return nil
+		})
 		if err != nil {
 			return nil, err
 		}
-		contents = append(contents, collected...)
 	}
-	out := make([]openai.ChatCompletionMessage, 0, len(contents))
-	for _, c := range contents {
-		c = strings.TrimSpace(c)
-		if c == "" {
-			continue
-		}
-		out = append(out, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleUser,
-			Content: c,
-		})
-	}
-	return out, nil
+	return skills, nil
 }
 
-// collectSkillFilesInDir 遍历 dir 及其子目录，读取所有名为 SKILL.md 的文件内容。
-func collectSkillFilesInDir(dir string) ([]string, error) {
-	var contents []string
-	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+// walkSkillFiles 遍历 dir 及其子目录，对每个名为 SKILL.md 的文件调用 fn
+func walkSkillFiles(dir string, fn func(path string, data []byte) error) error {
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			if os.IsNotExist(err) {
 				return nil
 			}
 			return err
 		}
-		if d.IsDir() {
-			return nil
-		}
-		if d.Name() != skillFileName {
+		if d.IsDir() || d.Name() != skillFileName {
 			return nil
 		}
 		data, err := os.ReadFile(path)
 		if err != nil {
 			return err
 		}
-		contents = append(contents, string(data))
-		return nil
+		return fn(path, data)
 	})
-	return contents, err
+}
+
+// Inject 将技能正文作为 user 消息插入到最后一条 system 消息之后，返回新消息切片
+func Inject(messages []openai.ChatCompletionMessage, skills []*Skill) []openai.ChatCompletionMessage {
+	if len(skills) == 0 {
+		return messages
+	}
+	// 找到最后一条 system 消息的下一个位置
+	insertAt := 0
+	for i := range messages {
+		if messages[i].Role == openai.ChatMessageRoleSystem {
+			insertAt = i + 1
+		}
+	}
+	// 在 insertAt 处插入所有 skill user 消息
+	out := make([]openai.ChatCompletionMessage, 0, len(messages)+len(skills))
+	out = append(out, messages[:insertAt]...)
+	for _, s := range skills {
+		out = append(out, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleUser,
+			Content: s.Content,
+		})
+	}
+	out = append(out, messages[insertAt:]...)
+	return out
+}
+
+// LastUserText 返回最后一条 user 消息的文本，作为技能相关性匹配的查询
+func LastUserText(messages []openai.ChatCompletionMessage) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		m := messages[i]
+		if m.Role != openai.ChatMessageRoleUser {
+			continue
+		}
+		if m.Content != "" {
+			return m.Content
+		}
+		var parts []string
+		for _, p := range m.MultiContent {
+			if p.Type == openai.ChatMessagePartTypeText {
+				parts = append(parts, p.Text)
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
 }
@@ -0,0 +1,186 @@
+// Package stream 提供转发上游 SSE 流时共用的按行读取器：
+// 客户端断开（ctx 取消）时关闭上游、上游长时间无数据时超时，并在等待期间发送 SSE 保活注释。
+package stream
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrIdleTimeout 上游在 IdleTimeout 内没有任何数据
+var ErrIdleTimeout = errors.New("上游流空闲超时")
+
+// Options 流读取选项，零值表示不启用对应功能
+type Options struct {
+	KeepAlive   time.Duration // 多久没有上游数据时向客户端发送一次保活注释
+	IdleTimeout time.Duration // 上游连续无数据超过该时长则终止流
+}
+
+type lineResult struct {
+	line []byte
+	err  error
+}
+
+// LineReader 在后台 goroutine 中按行读取上游 Body，ReadLine 可被 ctx 取消、空闲超时打断
+type LineReader struct {
+	ctx       context.Context
+	body      io.ReadCloser
+	opts      Options
+	keepAlive func() error
+	lines     chan lineResult
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error // 读取结束后的错误（含 io.EOF），之后的 ReadLine 直接返回
+}
+
+// NewLineReader 创建按行读取器；keepAlive 在等待上游期间按 opts.KeepAlive 间隔调用，可为 nil
+func NewLineReader(ctx context.Context, body io.ReadCloser, opts Options, keepAlive func() error) *LineReader {
+	r := &LineReader{
+		ctx:       ctx,
+		body:      body,
+		opts:      opts,
+		keepAlive: keepAlive,
+		lines:     make(chan lineResult),
+		done:      make(chan struct{}),
+	}
+	go r.readLoop()
+	return r
+}
+
+func (r *LineReader) readLoop() {
+	reader := bufio.NewReader(r.body)
+	for {
+		line, err := reader.ReadBytes('\n')
+		select {
+		case r.lines <- lineResult{line: line, err: err}:
+		case <-r.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// ReadLine 返回下一行（含换行符）；上游结束返回 io.EOF，客户端断开返回 ctx.Err()，空闲超时返回 ErrIdleTimeout
+func (r *LineReader) ReadLine() ([]byte, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	var idleC, keepC <-chan time.Time
+	if r.opts.IdleTimeout > 0 {
+		idle := time.NewTimer(r.opts.IdleTimeout)
+		defer idle.Stop()
+		idleC = idle.C
+	}
+	var keep *time.Timer
+	if r.opts.KeepAlive > 0 && r.keepAlive != nil {
+		keep = time.NewTimer(r.opts.KeepAlive)
+		defer keep.Stop()
+		keepC = keep.C
+	}
+
+	for {
+		select {
+		case res := <-r.lines:
+			if res.err != nil {
+				r.err = res.err
+				if len(res.line) == 0 {
+					return nil, res.err
+				}
+				// 最后一行没有换行符：先返回数据，下次调用再返回错误
+				return res.line, nil
+			}
+			return res.line, nil
+		case <-r.ctx.Done():
+			return nil, r.fail(r.ctx.Err())
+		case <-idleC:
+			return nil, r.fail(fmt.Errorf("%w: %s 内无数据", ErrIdleTimeout, r.opts.IdleTimeout))
+		case <-keepC:
+			if err := r.keepAlive(); err != nil {
+				return nil, r.fail(err)
+			}
+			keep.Reset(r.opts.KeepAlive)
+		}
+	}
+}
+
+// fail 记录错误并关闭上游
+func (r *LineReader) fail(err error) error {
+	r.err = err
+	r.Close()
+	return err
+}
+
+// Close 关闭上游 Body 并结束后台读取，可重复调用
+func (r *LineReader) Close() error {
+	var err error
+	r.closeOnce.Do(func() {
+		close(r.done)
+		err = r.body.Close()
+	})
+	return err
+}
+
+// KeepAliveWriter 返回向客户端写 SSE 保活注释并 flush 的回调
+func KeepAliveWriter(w io.Writer, flusher http.Flusher) func() error {
+	return func() error {
+		if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+}
+
+// WriteOpenAIError 以 OpenAI 流式错误格式写出错误事件（data: {"error":...}）
+func WriteOpenAIError(w io.Writer, err error) error {
+	data, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": err.Error(),
+			"type":    "server_error",
+			"code":    errorCode(err),
+		},
+	})
+	_, werr := fmt.Fprintf(w, "data: %s\n\n", data)
+	return werr
+}
+
+// WriteAnthropicError 以 Anthropic 流式错误格式写出 error 事件
+func WriteAnthropicError(w io.Writer, err error) error {
+	errType := "api_error"
+	if errors.Is(err, ErrIdleTimeout) {
+		errType = "timeout_error"
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"type": "error",
+		"error": map[string]interface{}{
+			"type":    errType,
+			"message": err.Error(),
+		},
+	})
+	_, werr := fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+	return werr
+}
+
+func errorCode(err error) string {
+	if errors.Is(err, ErrIdleTimeout) {
+		return "stream_idle_timeout"
+	}
+	return "stream_error"
+}
+
+// IsClientGone 判断错误是否由客户端断开引起（此时无需再向客户端写错误事件）
+func IsClientGone(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
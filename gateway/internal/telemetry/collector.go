@@ -0,0 +1,62 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// Collector 本地 OTLP/HTTP JSON collector 替身：接收 POST 的导出请求并保存在内存中，
+// 配合 httptest.NewServer 即可在测试中验证导出的 span，无需部署真实 collector
+type Collector struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+// NewCollector 创建 collector
+func NewCollector() *Collector {
+	return &Collector{}
+}
+
+// ServeHTTP 接收 OTLP 导出请求
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req ExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	c.spans = append(c.spans, req.Spans()...)
+	c.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{}"))
+}
+
+// Spans 返回已接收的全部 span
+func (c *Collector) Spans() []SpanData {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]SpanData(nil), c.spans...)
+}
+
+// Trace 返回指定 trace ID 的 span
+func (c *Collector) Trace(traceID string) []SpanData {
+	var out []SpanData
+	for _, s := range c.Spans() {
+		if s.TraceID == traceID {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Reset 清空已接收的 span
+func (c *Collector) Reset() {
+	c.mu.Lock()
+	c.spans = nil
+	c.mu.Unlock()
+}
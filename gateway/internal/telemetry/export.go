@@ -0,0 +1,296 @@
+package telemetry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exporter 批量导出 span
+type Exporter interface {
+	Export(serviceName string, spans []*Span) error
+	Close() error
+}
+
+// 以下为 OTLP/HTTP JSON（ExportTraceServiceRequest）的结构，仅包含本包用到的字段
+
+// ExportRequest OTLP 导出请求
+type ExportRequest struct {
+	ResourceSpans []ResourceSpans `json:"resourceSpans"`
+}
+
+// ResourceSpans 同一资源（服务）的 span
+type ResourceSpans struct {
+	Resource   Resource     `json:"resource"`
+	ScopeSpans []ScopeSpans `json:"scopeSpans"`
+}
+
+// Resource 资源属性
+type Resource struct {
+	Attributes []KeyValue `json:"attributes"`
+}
+
+// ScopeSpans 同一 instrumentation scope 的 span
+type ScopeSpans struct {
+	Scope Scope      `json:"scope"`
+	Spans []SpanData `json:"spans"`
+}
+
+// Scope instrumentation scope
+type Scope struct {
+	Name string `json:"name"`
+}
+
+// SpanData 导出的 span
+type SpanData struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              SpanKind   `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []KeyValue `json:"attributes,omitempty"`
+	Status            Status     `json:"status"`
+}
+
+// Status span 状态：0 未设置，1 正常，2 出错
+type Status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// KeyValue 属性键值
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+// AnyValue 属性值，只会设置其中一个字段；intValue 按 OTLP JSON 约定编码为字符串
+type AnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// Attribute 按 key 查找属性值（字符串形式），用于测试与查看
+func (d SpanData) Attribute(key string) (string, bool) {
+	for _, kv := range d.Attributes {
+		if kv.Key != key {
+			continue
+		}
+		switch v := kv.Value; {
+		case v.StringValue != nil:
+			return *v.StringValue, true
+		case v.IntValue != nil:
+			return *v.IntValue, true
+		case v.BoolValue != nil:
+			return strconv.FormatBool(*v.BoolValue), true
+		case v.DoubleValue != nil:
+			return strconv.FormatFloat(*v.DoubleValue, 'f', -1, 64), true
+		}
+	}
+	return "", false
+}
+
+// scopeName 导出时的 instrumentation scope
+const scopeName = "ocProxy/gateway/internal/telemetry"
+
+// NewExportRequest 将 span 编码为 OTLP 导出请求
+func NewExportRequest(serviceName string, spans []*Span) *ExportRequest {
+	data := make([]SpanData, 0, len(spans))
+	for _, s := range spans {
+		data = append(data, s.data())
+	}
+	return &ExportRequest{ResourceSpans: []ResourceSpans{{
+		Resource:   Resource{Attributes: []KeyValue{keyValue(Attr("service.name", serviceName))}},
+		ScopeSpans: []ScopeSpans{{Scope: Scope{Name: scopeName}, Spans: data}},
+	}}}
+}
+
+// Spans 展开导出请求中的全部 span
+func (r *ExportRequest) Spans() []SpanData {
+	var out []SpanData
+	for _, rs := range r.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			out = append(out, ss.Spans...)
+		}
+	}
+	return out
+}
+
+func (s *Span) data() SpanData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := SpanData{
+		TraceID:           s.sc.TraceIDString(),
+		SpanID:            s.sc.SpanIDString(),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		Status:            Status{Code: 1},
+	}
+	if s.parent != [8]byte{} {
+		d.ParentSpanID = SpanContext{SpanID: s.parent}.SpanIDString()
+	}
+	for _, a := range s.attrs {
+		d.Attributes = append(d.Attributes, keyValue(a))
+	}
+	if s.failed {
+		d.Status = Status{Code: 2, Message: s.errMsg}
+	}
+	return d
+}
+
+func keyValue(a Attribute) KeyValue {
+	kv := KeyValue{Key: a.Key}
+	switch v := a.Value.(type) {
+	case string:
+		kv.Value.StringValue = &v
+	case bool:
+		kv.Value.BoolValue = &v
+	case int:
+		s := strconv.Itoa(v)
+		kv.Value.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		kv.Value.IntValue = &s
+	case float64:
+		kv.Value.DoubleValue = &v
+	default:
+		s := fmt.Sprint(v)
+		kv.Value.StringValue = &s
+	}
+	return kv
+}
+
+// OTLPExporter 以 OTLP/HTTP JSON 将 span POST 到 collector（如 http://localhost:4318/v1/traces）
+type OTLPExporter struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+// NewOTLPExporter 创建 OTLP/HTTP exporter；endpoint 未包含路径时补全为 /v1/traces
+func NewOTLPExporter(endpoint string, headers map[string]string) *OTLPExporter {
+	endpoint = strings.TrimRight(strings.TrimSpace(endpoint), "/")
+	if i := strings.Index(endpoint, "://"); i >= 0 && !strings.Contains(endpoint[i+3:], "/") {
+		endpoint += "/v1/traces"
+	}
+	return &OTLPExporter{
+		endpoint: endpoint,
+		headers:  headers,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Export 发送一批 span
+func (e *OTLPExporter) Export(serviceName string, spans []*Span) error {
+	body, err := json.Marshal(NewExportRequest(serviceName, spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("创建 OTLP 请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("OTLP 导出失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("OTLP 导出失败 %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// Close 无需释放资源
+func (e *OTLPExporter) Close() error { return nil }
+
+// FileExporter 将每批 span 以一行 OTLP JSON 追加写入本地文件（与 OpenTelemetry Collector file exporter 格式一致）
+type FileExporter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileExporter 创建文件 exporter
+func NewFileExporter(path string) (*FileExporter, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{file: file}, nil
+}
+
+// Export 写入一批 span
+func (e *FileExporter) Export(serviceName string, spans []*Span) error {
+	data, err := json.Marshal(NewExportRequest(serviceName, spans))
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.file.Write(append(data, '\n'))
+	return err
+}
+
+// Close 关闭文件
+func (e *FileExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.file.Close()
+}
+
+// multiExporter 同时导出到多个 exporter
+type multiExporter []Exporter
+
+// MultiExporter 组合多个 exporter，单个失败不影响其他
+func MultiExporter(exporters ...Exporter) Exporter {
+	if len(exporters) == 1 {
+		return exporters[0]
+	}
+	return multiExporter(exporters)
+}
+
+func (m multiExporter) Export(serviceName string, spans []*Span) error {
+	var errs []string
+	for _, e := range m {
+		if err := e.Export(serviceName, spans); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (m multiExporter) Close() error {
+	var first error
+	for _, e := range m {
+		if err := e.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func logExportError(err error) {
+	log.Printf("[警告] 导出 span 失败: %v", err)
+}
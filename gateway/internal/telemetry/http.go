@@ -0,0 +1,123 @@
+package telemetry
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Middleware 路由中间件：读取请求头 traceparent 作为远端父 span（没有时开启新 trace），
+// 为请求创建 server span 放入 context，并在响应头 traceparent 返回该 span，
+// 客户端（agent）后续调用 fake_app 接口时带上它即可与本次请求关联。tracer 为 nil 时原样返回
+func Middleware(t *Tracer) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if t == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := r.URL.Path
+			if cur := mux.CurrentRoute(r); cur != nil {
+				if tpl, err := cur.GetPathTemplate(); err == nil {
+					route = tpl
+				}
+			}
+			parent, _ := Extract(r.Header)
+			ctx, span := t.StartRoot(r.Context(), r.Method+" "+route, SpanKindServer, parent)
+			span.SetAttributes(
+				Attr("http.method", r.Method),
+				Attr("http.route", route),
+				Attr("http.target", r.URL.RequestURI()),
+			)
+			if user := strings.TrimSpace(r.Header.Get("X-User-ID")); user != "" {
+				span.SetAttributes(Attr("user.id", user))
+			}
+			w.Header().Set(TraceparentHeader, span.SpanContext().Traceparent())
+
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			defer func() {
+				span.SetStatusCode(sw.status)
+				span.End()
+			}()
+			next.ServeHTTP(sw, r.WithContext(ctx))
+		})
+	}
+}
+
+// statusWriter 记录响应状态码，保留 Flush 以支持 SSE
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush 透传 Flush
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 供 http.ResponseController 取得底层 ResponseWriter
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Transport 为出站请求创建 client span 并注入 traceparent；请求 context 中没有 span 时直接转发
+type Transport struct {
+	Base http.RoundTripper // 为 nil 时使用 http.DefaultTransport
+}
+
+// NewTransport 包装 base
+func NewTransport(base http.RoundTripper) *Transport {
+	return &Transport{Base: base}
+}
+
+// RoundTrip 实现 http.RoundTripper；span 在收到响应头时结束，不含读取响应体（流式）的时间
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx, span := Start(req.Context(), "upstream "+req.Method+" "+req.URL.Host, SpanKindClient,
+		Attr("http.method", req.Method),
+		Attr("http.url", redactURL(req)),
+		Attr("server.address", req.URL.Host),
+	)
+	if span == nil {
+		return base.RoundTrip(req)
+	}
+	defer span.End()
+
+	// RoundTripper 不应修改原请求，复制后注入请求头
+	req = req.Clone(ctx)
+	Inject(ctx, req.Header)
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetStatusCode(resp.StatusCode)
+	return resp, nil
+}
+
+// redactURL 去掉查询参数（Gemini 等以 key 参数传 API key）
+func redactURL(req *http.Request) string {
+	u := *req.URL
+	u.RawQuery = ""
+	u.User = nil
+	return u.String()
+}
@@ -0,0 +1,184 @@
+package telemetry
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	incomingTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	incomingSpanID  = "00f067aa0ba902b7"
+)
+
+// tracedGateway 启动带 Middleware 的网关替身：/v1/chat/{id} 经 Transport 调用 upstream，
+// span 导出到 httptest 上的 OTLP collector 替身
+func tracedGateway(t *testing.T, upstreamURL string) (*httptest.Server, *Tracer, *Collector) {
+	t.Helper()
+	collector := NewCollector()
+	collectorSrv := httptest.NewServer(collector)
+	t.Cleanup(collectorSrv.Close)
+
+	tracer := NewTracer(NewOTLPExporter(collectorSrv.URL, nil), TracerOptions{
+		ServiceName:   "gateway-test",
+		FlushInterval: time.Hour, // 只在 Shutdown 时导出
+	})
+	t.Cleanup(func() { tracer.Shutdown() })
+
+	httpClient := &http.Client{Transport: NewTransport(nil)}
+	r := mux.NewRouter()
+	r.Use(Middleware(tracer))
+	r.HandleFunc("/v1/chat/{id}", func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodPost, upstreamURL+"/chat/completions?key=secret", nil)
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		w.WriteHeader(http.StatusAccepted)
+	})
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv, tracer, collector
+}
+
+// upstreamRecorder 记录收到的 traceparent 的上游替身
+func upstreamRecorder(t *testing.T) (*httptest.Server, *string) {
+	t.Helper()
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(TraceparentHeader)
+		w.Write([]byte("{}"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &got
+}
+
+func spanByKind(t *testing.T, spans []SpanData, kind SpanKind) SpanData {
+	t.Helper()
+	for _, s := range spans {
+		if s.Kind == kind {
+			return s
+		}
+	}
+	t.Fatalf("未导出 kind=%d 的 span: %+v", kind, spans)
+	return SpanData{}
+}
+
+func TestTraceparentContinuedToUpstreamAndExported(t *testing.T) {
+	upstream, upstreamTraceparent := upstreamRecorder(t)
+	gateway, tracer, collector := tracedGateway(t, upstream.URL)
+
+	req, _ := http.NewRequest(http.MethodPost, gateway.URL+"/v1/chat/abc", nil)
+	req.Header.Set(TraceparentHeader, "00-"+incomingTraceID+"-"+incomingSpanID+"-01")
+	req.Header.Set("X-User-ID", "u-1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// 响应头返回网关 server span，延续入站 trace
+	serverSC, err := ParseTraceparent(resp.Header.Get(TraceparentHeader))
+	if err != nil {
+		t.Fatalf("响应头 traceparent 无效: %v", err)
+	}
+	if serverSC.TraceIDString() != incomingTraceID || serverSC.SpanIDString() == incomingSpanID {
+		t.Errorf("响应 traceparent 未延续入站 trace: %s", resp.Header.Get(TraceparentHeader))
+	}
+
+	// 上游收到的是 client 子 span
+	upstreamSC, err := ParseTraceparent(*upstreamTraceparent)
+	if err != nil {
+		t.Fatalf("上游未收到有效 traceparent: %q", *upstreamTraceparent)
+	}
+	if upstreamSC.TraceIDString() != incomingTraceID {
+		t.Errorf("上游 trace ID = %s, 期望 %s", upstreamSC.TraceIDString(), incomingTraceID)
+	}
+	if upstreamSC.SpanIDString() == serverSC.SpanIDString() || upstreamSC.SpanIDString() == incomingSpanID {
+		t.Errorf("上游 traceparent 应携带新的 client span: %s", *upstreamTraceparent)
+	}
+
+	if err := tracer.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	spans := collector.Trace(incomingTraceID)
+	if len(spans) != 2 {
+		t.Fatalf("collector 收到 %d 个 span, 期望 2: %+v", len(spans), collector.Spans())
+	}
+
+	server := spanByKind(t, spans, SpanKindServer)
+	if server.SpanID != serverSC.SpanIDString() || server.ParentSpanID != incomingSpanID {
+		t.Errorf("server span = %s (parent %s), 期望 %s (parent %s)", server.SpanID, server.ParentSpanID, serverSC.SpanIDString(), incomingSpanID)
+	}
+	if server.Name != "POST /v1/chat/{id}" {
+		t.Errorf("server span 名称 = %s", server.Name)
+	}
+	if route, _ := server.Attribute("http.route"); route != "/v1/chat/{id}" {
+		t.Errorf("http.route = %s", route)
+	}
+	if user, _ := server.Attribute("user.id"); user != "u-1" {
+		t.Errorf("user.id = %s", user)
+	}
+	if code, _ := server.Attribute("http.status_code"); code != "202" {
+		t.Errorf("server http.status_code = %s", code)
+	}
+
+	clientSpan := spanByKind(t, spans, SpanKindClient)
+	if clientSpan.SpanID != upstreamSC.SpanIDString() || clientSpan.ParentSpanID != server.SpanID {
+		t.Errorf("client span = %s (parent %s), 期望 %s (parent %s)", clientSpan.SpanID, clientSpan.ParentSpanID, upstreamSC.SpanIDString(), server.SpanID)
+	}
+	if u, _ := clientSpan.Attribute("http.url"); u != upstream.URL+"/chat/completions" {
+		t.Errorf("client http.url 应去掉查询参数: %s", u)
+	}
+	if code, _ := clientSpan.Attribute("http.status_code"); code != "200" {
+		t.Errorf("client http.status_code = %s", code)
+	}
+}
+
+func TestMiddlewareStartsTraceWithoutTraceparent(t *testing.T) {
+	upstream, upstreamTraceparent := upstreamRecorder(t)
+	gateway, tracer, collector := tracedGateway(t, upstream.URL)
+
+	resp, err := http.Post(gateway.URL+"/v1/chat/abc", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	serverSC, err := ParseTraceparent(resp.Header.Get(TraceparentHeader))
+	if err != nil {
+		t.Fatalf("响应头 traceparent 无效: %v", err)
+	}
+	upstreamSC, err := ParseTraceparent(*upstreamTraceparent)
+	if err != nil || upstreamSC.TraceID != serverSC.TraceID {
+		t.Errorf("上游 traceparent = %q, 期望 trace %s", *upstreamTraceparent, serverSC.TraceIDString())
+	}
+
+	tracer.Shutdown()
+	spans := collector.Trace(serverSC.TraceIDString())
+	if len(spans) != 2 {
+		t.Fatalf("collector 收到 %d 个 span, 期望 2", len(spans))
+	}
+	if server := spanByKind(t, spans, SpanKindServer); server.ParentSpanID != "" {
+		t.Errorf("新 trace 的 server span 不应有父 span: %s", server.ParentSpanID)
+	}
+}
+
+func TestTransportWithoutSpanPassesThrough(t *testing.T) {
+	upstream, upstreamTraceparent := upstreamRecorder(t)
+	resp, err := (&http.Client{Transport: NewTransport(nil)}).Get(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if *upstreamTraceparent != "" {
+		t.Errorf("context 中没有 span 时不应注入 traceparent: %s", *upstreamTraceparent)
+	}
+}
@@ -0,0 +1,355 @@
+// Package telemetry 轻量的分布式追踪：W3C traceparent 传播、span 记录，
+// 并以 OTLP/HTTP JSON 格式导出到 collector 或本地文件。
+// span 通过 context 传递，Start 在没有父 span 时返回 nil，nil span 的所有方法为空操作。
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader W3C trace context 请求头
+const TraceparentHeader = "traceparent"
+
+// SpanKind span 类型，取值与 OTLP 一致
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// SpanContext span 的传播标识
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// TraceIDString 32 位十六进制 trace ID
+func (sc SpanContext) TraceIDString() string { return hex.EncodeToString(sc.TraceID[:]) }
+
+// SpanIDString 16 位十六进制 span ID
+func (sc SpanContext) SpanIDString() string { return hex.EncodeToString(sc.SpanID[:]) }
+
+// IsValid trace ID 与 span ID 均非全零
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent 格式化为 traceparent 头：00-<trace_id>-<span_id>-<flags>
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceIDString() + "-" + sc.SpanIDString() + "-" + flags
+}
+
+// ParseTraceparent 解析 traceparent 头，格式不合法时返回错误
+func ParseTraceparent(v string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, fmt.Errorf("traceparent 格式无效: %q", v)
+	}
+	// 版本 ff 无效；00 版本必须正好 4 段，更高版本允许追加字段
+	if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, fmt.Errorf("traceparent 版本无效: %q", v)
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, fmt.Errorf("traceparent trace-id 无效: %w", err)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, fmt.Errorf("traceparent parent-id 无效: %w", err)
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return sc, fmt.Errorf("traceparent flags 无效: %w", err)
+	}
+	sc.Sampled = flags[0]&1 == 1
+	if !sc.IsValid() {
+		return sc, fmt.Errorf("traceparent trace-id 或 parent-id 为全零: %q", v)
+	}
+	return sc, nil
+}
+
+// Extract 从请求头读取 traceparent，没有或无效时 ok=false
+func Extract(h http.Header) (SpanContext, bool) {
+	v := h.Get(TraceparentHeader)
+	if v == "" {
+		return SpanContext{}, false
+	}
+	sc, err := ParseTraceparent(v)
+	return sc, err == nil
+}
+
+// Inject 将 context 中当前 span 写入请求头 traceparent，没有 span 时不修改
+func Inject(ctx context.Context, h http.Header) {
+	if s := SpanFromContext(ctx); s != nil {
+		h.Set(TraceparentHeader, s.sc.Traceparent())
+	}
+}
+
+// Tracer 创建 span 并交给 exporter 批量导出；exporter 为 nil 时 span 照常生成与传播但不导出
+type Tracer struct {
+	serviceName string
+	exporter    Exporter
+	batchSize   int
+	interval    time.Duration
+
+	queue chan *Span
+	done  chan struct{}
+	wg    sync.WaitGroup
+	once  sync.Once
+}
+
+// TracerOptions Tracer 选项
+type TracerOptions struct {
+	ServiceName   string        // 导出时的 service.name，默认 ocProxy-gateway
+	BatchSize     int           // 每批最多导出的 span 数，默认 256
+	FlushInterval time.Duration // 批量导出间隔，默认 5s
+	QueueSize     int           // 待导出队列长度，满时丢弃新 span，默认 4096
+}
+
+// NewTracer 创建 Tracer 并启动后台导出
+func NewTracer(exporter Exporter, opts TracerOptions) *Tracer {
+	if opts.ServiceName == "" {
+		opts.ServiceName = "ocProxy-gateway"
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 256
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 5 * time.Second
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 4096
+	}
+	t := &Tracer{
+		serviceName: opts.ServiceName,
+		exporter:    exporter,
+		batchSize:   opts.BatchSize,
+		interval:    opts.FlushInterval,
+		queue:       make(chan *Span, opts.QueueSize),
+		done:        make(chan struct{}),
+	}
+	if exporter != nil {
+		t.wg.Add(1)
+		go t.run()
+	}
+	return t
+}
+
+// run 后台批量导出：攒满一批或到达间隔时导出，Shutdown 时导出剩余 span
+func (t *Tracer) run() {
+	defer t.wg.Done()
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	batch := make([]*Span, 0, t.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.Export(t.serviceName, batch); err != nil {
+			logExportError(err)
+		}
+		batch = make([]*Span, 0, t.batchSize)
+	}
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= t.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.done:
+			for {
+				select {
+				case s := <-t.queue:
+					batch = append(batch, s)
+					if len(batch) >= t.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Shutdown 导出剩余 span 并关闭 exporter，可重复调用
+func (t *Tracer) Shutdown() error {
+	if t == nil {
+		return nil
+	}
+	var err error
+	t.once.Do(func() {
+		close(t.done)
+		t.wg.Wait()
+		if t.exporter != nil {
+			err = t.exporter.Close()
+		}
+	})
+	return err
+}
+
+// StartRoot 开始一个入站 span：parent 有效时继承其 trace ID（远端父 span），否则开启新 trace
+func (t *Tracer) StartRoot(ctx context.Context, name string, kind SpanKind, parent SpanContext) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	s := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+	if parent.IsValid() {
+		s.sc.TraceID = parent.TraceID
+		s.sc.Sampled = parent.Sampled
+		s.parent = parent.SpanID
+	} else {
+		rand.Read(s.sc.TraceID[:])
+		s.sc.Sampled = true
+	}
+	rand.Read(s.sc.SpanID[:])
+	return ContextWithSpan(ctx, s), s
+}
+
+// Span 一次操作的耗时记录
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	parent [8]byte
+	name   string
+	kind   SpanKind
+	start  time.Time
+
+	mu     sync.Mutex
+	end    time.Time
+	attrs  []Attribute
+	errMsg string
+	failed bool
+	ended  bool
+}
+
+// Attribute span 属性，Value 为 string、bool、int、int64 或 float64
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attr 构造属性
+func Attr(key string, value interface{}) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpan 将 span 放入 context
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, s)
+}
+
+// SpanFromContext 取出 context 中的当前 span，没有时返回 nil
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	s, _ := ctx.Value(spanContextKey{}).(*Span)
+	return s
+}
+
+// Start 以 context 中的当前 span 为父开始子 span；没有父 span（未开启追踪）时返回原 ctx 与 nil
+func Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	s := &Span{
+		tracer: parent.tracer,
+		name:   name,
+		kind:   kind,
+		start:  time.Now(),
+		parent: parent.sc.SpanID,
+		attrs:  attrs,
+	}
+	s.sc.TraceID = parent.sc.TraceID
+	s.sc.Sampled = parent.sc.Sampled
+	rand.Read(s.sc.SpanID[:])
+	return ContextWithSpan(ctx, s), s
+}
+
+// SpanContext 返回 span 的传播标识
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttributes 追加属性
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// SetError 标记 span 出错，err 为 nil 时忽略
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = true
+	s.errMsg = err.Error()
+}
+
+// SetStatusCode 按 HTTP 状态码记录属性；服务端 5xx、客户端 4xx 及以上视为出错
+func (s *Span) SetStatusCode(code int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, Attr("http.status_code", code))
+	if code >= 500 || (s.kind == SpanKindClient && code >= 400) {
+		s.failed = true
+	}
+}
+
+// End 结束 span 并提交导出，只有第一次调用有效
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	t := s.tracer
+	if t == nil || t.exporter == nil || !s.sc.Sampled {
+		return
+	}
+	select {
+	case t.queue <- s:
+	default:
+		// 队列已满时丢弃，不阻塞请求
+	}
+}
@@ -0,0 +1,306 @@
+// Package tokenizer 提供本地 token 估算能力
+// - 使用内置的 cl100k_base BPE 词表（assets/cl100k_base.tiktoken），不发起任何网络请求
+// - 词表在首次使用时加载到内存
+// - 按网关实际发送给上游的消息、工具定义估算输入 token 数
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	_ "embed"
+	"encoding/base64"
+	"strconv"
+	"sync"
+	"unicode"
+)
+
+//go:embed assets/cl100k_base.tiktoken
+var cl100kBase []byte
+
+// maxCacheEntries 片段编码缓存的最大条数，超过后整体清空
+const maxCacheEntries = 50000
+
+// encoder BPE 编码器
+type encoder struct {
+	ranks map[string]int // token 字节串 -> rank
+
+	cacheMu sync.Mutex
+	cache   map[string]int // 预分词片段 -> token 数
+}
+
+var (
+	defaultEncoder *encoder
+	loadOnce       sync.Once
+)
+
+// getEncoder 返回全局编码器，首次调用时解析内置词表
+func getEncoder() *encoder {
+	loadOnce.Do(func() {
+		defaultEncoder = &encoder{
+			ranks: parseRanks(cl100kBase),
+			cache: make(map[string]int),
+		}
+	})
+	return defaultEncoder
+}
+
+// parseRanks 解析 tiktoken 词表格式：每行 "base64(token) rank"
+func parseRanks(data []byte) map[string]int {
+	ranks := make(map[string]int, 100256)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		sep := bytes.IndexByte(line, ' ')
+		if sep <= 0 {
+			continue
+		}
+		token, err := base64.StdEncoding.DecodeString(string(line[:sep]))
+		if err != nil {
+			continue
+		}
+		rank, err := strconv.Atoi(string(line[sep+1:]))
+		if err != nil {
+			continue
+		}
+		ranks[string(token)] = rank
+	}
+	return ranks
+}
+
+// Count 估算一段文本的 token 数
+func Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	enc := getEncoder()
+	total := 0
+	for _, piece := range splitPieces(text) {
+		total += enc.countPiece(piece)
+	}
+	return total
+}
+
+// countPiece 计算单个预分词片段的 token 数（带缓存）
+func (e *encoder) countPiece(piece string) int {
+	if _, ok := e.ranks[piece]; ok {
+		return 1
+	}
+	e.cacheMu.Lock()
+	if n, ok := e.cache[piece]; ok {
+		e.cacheMu.Unlock()
+		return n
+	}
+	e.cacheMu.Unlock()
+
+	n := e.bytePairCount([]byte(piece))
+
+	e.cacheMu.Lock()
+	if len(e.cache) >= maxCacheEntries {
+		e.cache = make(map[string]int)
+	}
+	e.cache[piece] = n
+	e.cacheMu.Unlock()
+	return n
+}
+
+// bytePairCount 对字节序列执行 BPE 合并，返回最终 token 数。
+// 每次合并 rank 最小（相同取最靠左）的相邻对；候选对放在小顶堆中，合并后只重算左右两个新相邻对，
+// 整体 O(n log n)，避免 base64、压缩 JSON 等无空白长串逐次全量扫描的 O(n²)
+func (e *encoder) bytePairCount(piece []byte) int {
+	n := len(piece)
+	if n <= 1 {
+		return n
+	}
+	// 第 i 个 token 起始于 piece[i]（合并时左侧吸收右侧，起点不变），end[i] 为结束偏移；
+	// prev/next 串成双向链表，end[i] == 0 表示已被左侧合并
+	end := make([]int, n)
+	prev := make([]int, n)
+	next := make([]int, n)
+	for i := range end {
+		end[i] = i + 1
+		prev[i] = i - 1
+		next[i] = i + 1
+	}
+	next[n-1] = -1
+
+	h := &pairHeap{}
+	push := func(left int) {
+		if left < 0 || next[left] < 0 {
+			return
+		}
+		right := next[left]
+		if rank, ok := e.ranks[string(piece[left:end[right]])]; ok {
+			heap.Push(h, pair{rank: rank, left: left, right: right, end: end[right]})
+		}
+	}
+	for i := 0; i < n-1; i++ {
+		push(i)
+	}
+
+	count := n
+	for h.Len() > 0 {
+		p := heap.Pop(h).(pair)
+		// 惰性删除：左右 token 已变化的候选对直接丢弃
+		if end[p.left] == 0 || next[p.left] != p.right || end[p.right] != p.end {
+			continue
+		}
+		end[p.left] = p.end
+		end[p.right] = 0
+		next[p.left] = next[p.right]
+		if next[p.right] >= 0 {
+			prev[next[p.right]] = p.left
+		}
+		count--
+		push(prev[p.left])
+		push(p.left)
+	}
+	return count
+}
+
+// pair 候选合并对：token left 与其右邻 right，合并后结束于 end
+type pair struct {
+	rank  int
+	left  int
+	right int
+	end   int
+}
+
+// pairHeap 按 rank 升序、相同 rank 按位置升序的小顶堆
+type pairHeap []pair
+
+func (h pairHeap) Len() int { return len(h) }
+func (h pairHeap) Less(i, j int) bool {
+	if h[i].rank != h[j].rank {
+		return h[i].rank < h[j].rank
+	}
+	return h[i].left < h[j].left
+}
+func (h pairHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *pairHeap) Push(x interface{}) { *h = append(*h, x.(pair)) }
+func (h *pairHeap) Pop() interface{} {
+	old := *h
+	p := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return p
+}
+
+// splitPieces 按 cl100k_base 的预分词规则切分文本：
+// 英文缩写、(可带一个前导符号的)字母串、1-3 位数字、(可带前导空格的)标点串、换行与空白。
+func splitPieces(text string) []string {
+	var pieces []string
+	runes := []rune(text)
+	n := len(runes)
+	i := 0
+	for i < n {
+		start := i
+		r := runes[i]
+
+		// 英文缩写 's 't 're 've 'm 'll 'd（不区分大小写）
+		if r == '\'' && i+1 < n {
+			if l := contractionLen(runes[i+1:]); l > 0 {
+				i += 1 + l
+				pieces = append(pieces, string(runes[start:i]))
+				continue
+			}
+		}
+
+		// [^\r\n\p{L}\p{N}]?\p{L}+
+		if unicode.IsLetter(r) || (!isNewline(r) && !unicode.IsNumber(r) && i+1 < n && unicode.IsLetter(runes[i+1])) {
+			i++
+			for i < n && unicode.IsLetter(runes[i]) {
+				i++
+			}
+			pieces = append(pieces, string(runes[start:i]))
+			continue
+		}
+
+		// \p{N}{1,3}
+		if unicode.IsNumber(r) {
+			for i < n && i-start < 3 && unicode.IsNumber(runes[i]) {
+				i++
+			}
+			pieces = append(pieces, string(runes[start:i]))
+			continue
+		}
+
+		// ' ?[^\s\p{L}\p{N}]+[\r\n]*'
+		j := i
+		if runes[j] == ' ' && j+1 < n {
+			j++
+		}
+		if isPunct(runes[j]) {
+			i = j
+			for i < n && isPunct(runes[i]) {
+				i++
+			}
+			for i < n && isNewline(runes[i]) {
+				i++
+			}
+			pieces = append(pieces, string(runes[start:i]))
+			continue
+		}
+
+		// 空白：\s*[\r\n]+ | \s+(?!\S) | \s+
+		for i < n && unicode.IsSpace(runes[i]) {
+			i++
+		}
+		ws := runes[start:i]
+		if lastNL := lastNewline(ws); lastNL >= 0 {
+			// 包含换行：截止到最后一个换行
+			i = start + lastNL + 1
+		} else if i < n && i-start > 1 {
+			// 后面紧跟非空白：留一个空白给下一片段
+			i--
+		}
+		pieces = append(pieces, string(runes[start:i]))
+	}
+	return pieces
+}
+
+// contractionLen 判断是否为英文缩写后缀，返回后缀长度（不含单引号）
+func contractionLen(rest []rune) int {
+	lower := func(k int) rune {
+		if k >= len(rest) {
+			return 0
+		}
+		return unicode.ToLower(rest[k])
+	}
+	switch lower(0) {
+	case 's', 't', 'm', 'd':
+		return 1
+	case 'r':
+		if lower(1) == 'e' {
+			return 2
+		}
+	case 'v':
+		if lower(1) == 'e' {
+			return 2
+		}
+	case 'l':
+		if lower(1) == 'l' {
+			return 2
+		}
+	}
+	return 0
+}
+
+// isNewline 是否为换行符
+func isNewline(r rune) bool {
+	return r == '\r' || r == '\n'
+}
+
+// isPunct 是否为非空白、非字母、非数字字符
+func isPunct(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// lastNewline 返回空白序列中最后一个换行的位置，不存在返回 -1
+func lastNewline(ws []rune) int {
+	for k := len(ws) - 1; k >= 0; k-- {
+		if isNewline(ws[k]) {
+			return k
+		}
+	}
+	return -1
+}
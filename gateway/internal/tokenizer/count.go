@@ -0,0 +1,75 @@
+package tokenizer
+
+import (
+	"encoding/json"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 以下常量参照 OpenAI 对 chat 格式的计数规则
+const (
+	tokensPerMessage = 3  // 每条消息的固定开销（<|start|>role ... <|end|>）
+	tokensPerName    = 1  // 消息带 name 字段时的额外开销
+	tokensReplyPrime = 3  // 回复起始（<|start|>assistant<|message|>）
+	tokensPerTool    = 8  // 每个工具定义的固定开销
+	tokensToolsBase  = 12 // 存在工具时 system 中工具说明的固定开销
+	tokensPerImage   = 85 // 每张图片按低分辨率估算
+)
+
+// CountMessages 估算消息列表的 token 数（含 role、name、tool_calls、tool_call_id 等字段）
+func CountMessages(messages []openai.ChatCompletionMessage) int {
+	if len(messages) == 0 {
+		return 0
+	}
+	total := 0
+	for _, msg := range messages {
+		total += tokensPerMessage
+		total += Count(msg.Role)
+		total += Count(msg.Content)
+		for _, part := range msg.MultiContent {
+			switch part.Type {
+			case openai.ChatMessagePartTypeText:
+				total += Count(part.Text)
+			case openai.ChatMessagePartTypeImageURL:
+				total += tokensPerImage
+			}
+		}
+		if msg.Name != "" {
+			total += tokensPerName + Count(msg.Name)
+		}
+		for _, tc := range msg.ToolCalls {
+			total += Count(tc.ID) + Count(tc.Function.Name) + Count(tc.Function.Arguments)
+		}
+		if msg.ToolCallID != "" {
+			total += Count(msg.ToolCallID)
+		}
+	}
+	return total + tokensReplyPrime
+}
+
+// CountTools 估算工具定义的 token 数（按函数名、描述、参数 JSON Schema 计）
+func CountTools(tools []openai.Tool) int {
+	if len(tools) == 0 {
+		return 0
+	}
+	total := tokensToolsBase
+	for _, tool := range tools {
+		if tool.Function == nil {
+			continue
+		}
+		total += tokensPerTool
+		total += Count(tool.Function.Name)
+		total += Count(tool.Function.Description)
+		if tool.Function.Parameters != nil {
+			if data, err := json.Marshal(tool.Function.Parameters); err == nil {
+				total += Count(string(data))
+			}
+		}
+	}
+	return total
+}
+
+// CountRequest 估算一次 chat 请求的输入 token 数（消息 + 工具）
+func CountRequest(req openai.ChatCompletionRequest) int {
+	return CountMessages(req.Messages) + CountTools(req.Tools)
+}
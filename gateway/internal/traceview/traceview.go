@@ -0,0 +1,391 @@
+// Package traceview 读取 trace_log_file（含切分后的归档），按对话归并请求，供 /debug/traces 查看器使用。
+// 同一对话的多轮请求按 session_id 归并，没有 session_id 时按用户 + 首条 user 消息归并；
+// fake_app 接口调用按用户与对话时间段关联到对话上。
+package traceview
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ocProxy/gateway/internal/logger"
+)
+
+// ProtocolFakeApp fake_app 接口调用的 trace 协议名
+const ProtocolFakeApp = "fake_app"
+
+// maxLineBytes 单条 trace 记录最大字节数
+const maxLineBytes = 64 << 20
+
+// Record 解析后的 trace 记录
+type Record struct {
+	logger.TraceRecord
+	start time.Time
+}
+
+// Start 请求开始时间
+func (r *Record) Start() time.Time { return r.start }
+
+// End 请求结束时间
+func (r *Record) End() time.Time {
+	return r.start.Add(time.Duration(r.DurationMs) * time.Millisecond)
+}
+
+// Model 实际调用的模型 ID，未路由时为请求的模型名
+func (r *Record) Model() string {
+	if r.Routing == nil {
+		return ""
+	}
+	if r.Routing.ModelID != "" {
+		return r.Routing.ModelID
+	}
+	return r.Routing.RequestedModel
+}
+
+// Failed 请求是否出错
+func (r *Record) Failed() bool {
+	return r.Error != "" || r.Status >= 400
+}
+
+// Load 读取 trace 文件及其归档（<name>-<时间>.<ext>[.gz]），按开始时间排序
+func Load(path string) ([]*Record, error) {
+	return NewCache(path).Load()
+}
+
+// Cache 缓存已解析的 trace 文件，按文件修改时间与大小判断是否需要重新读取；
+// 切分后的归档不再变化，每次只重新解析当前写入的文件
+type Cache struct {
+	path  string
+	mu    sync.Mutex
+	files map[string]*cachedFile
+}
+
+type cachedFile struct {
+	modTime time.Time
+	size    int64
+	records []*Record
+}
+
+// NewCache 创建 trace 文件缓存
+func NewCache(path string) *Cache {
+	return &Cache{path: path, files: make(map[string]*cachedFile)}
+}
+
+// Load 读取 trace 文件及其归档，未变化的文件使用缓存；返回的记录按开始时间排序，调用方不应修改
+func (c *Cache) Load() ([]*Record, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	files := traceFiles(c.path)
+	seen := make(map[string]bool, len(files))
+	var records []*Record
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			if os.IsNotExist(err) && f == c.path {
+				continue
+			}
+			return nil, err
+		}
+		seen[f] = true
+		cached := c.files[f]
+		if cached == nil || !cached.modTime.Equal(info.ModTime()) || cached.size != info.Size() {
+			recs, err := loadFile(f)
+			if err != nil {
+				return nil, err
+			}
+			cached = &cachedFile{modTime: info.ModTime(), size: info.Size(), records: recs}
+			c.files[f] = cached
+		}
+		records = append(records, cached.records...)
+	}
+	for f := range c.files {
+		if !seen[f] {
+			delete(c.files, f) // 已被保留策略清理的归档
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].start.Before(records[j].start) })
+	return records, nil
+}
+
+// traceFiles 返回 trace 文件及同目录下的归档路径
+func traceFiles(path string) []string {
+	files := []string{path}
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	ext := filepath.Ext(name)
+	prefix := strings.TrimSuffix(name, ext) + "-"
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, e := range entries {
+			n := e.Name()
+			if e.IsDir() || !strings.HasPrefix(n, prefix) {
+				continue
+			}
+			if strings.HasSuffix(n, ext) || strings.HasSuffix(n, ext+".gz") {
+				files = append(files, filepath.Join(dir, n))
+			}
+		}
+	}
+	return files
+}
+
+func loadFile(path string) ([]*Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	var records []*Record
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(line, &rec.TraceRecord); err != nil || rec.TraceID == "" {
+			continue // 跳过损坏的行
+		}
+		rec.start, _ = time.Parse(time.RFC3339Nano, rec.Time)
+		records = append(records, &rec)
+	}
+	return records, scanner.Err()
+}
+
+// Filter 对话列表筛选条件，零值表示不限制
+type Filter struct {
+	User  string
+	Model string // 匹配请求模型名或实际模型 ID（子串）
+	From  time.Time
+	To    time.Time
+	Error *bool // true 仅返回含错误请求的对话，false 仅返回无错误的对话
+	Limit int
+}
+
+// Summary 对话列表项
+type Summary struct {
+	ID         string   `json:"id"`
+	User       string   `json:"user,omitempty"`
+	Title      string   `json:"title"`
+	SessionID  string   `json:"session_id,omitempty"`
+	Protocol   string   `json:"protocol"`
+	Models     []string `json:"models"`
+	Start      string   `json:"start"`
+	End        string   `json:"end"`
+	Turns      int      `json:"turns"`      // 聊天请求数
+	ToolCalls  int      `json:"tool_calls"` // 关联的 fake_app 调用数
+	Errors     int      `json:"errors"`
+	DurationMs int64    `json:"duration_ms"` // 首个请求开始到最后一个请求结束
+}
+
+// Detail 对话详情
+type Detail struct {
+	Summary
+	Turns     []*Record `json:"turns"`      // 按时间排序的聊天请求
+	FakeCalls []*Record `json:"fake_calls"` // 对话期间同一用户的 fake_app 调用
+}
+
+// conversation 归并中的对话
+type conversation struct {
+	key   string
+	turns []*Record
+	fake  []*Record
+}
+
+// group 按对话归并聊天请求，并将 fake_app 调用关联到同一用户时间上重叠的对话
+func group(records []*Record) []*conversation {
+	var order []*conversation
+	byKey := make(map[string]*conversation)
+	var fakeCalls []*Record
+	for _, rec := range records {
+		if rec.Protocol == ProtocolFakeApp {
+			fakeCalls = append(fakeCalls, rec)
+			continue
+		}
+		key := conversationKey(rec)
+		c, ok := byKey[key]
+		if !ok {
+			c = &conversation{key: key}
+			byKey[key] = c
+			order = append(order, c)
+		}
+		c.turns = append(c.turns, rec)
+	}
+
+	for _, call := range fakeCalls {
+		if call.User == "" {
+			continue
+		}
+		// 同一用户有多个对话重叠时，关联到开始时间最晚的那个
+		var best *conversation
+		for _, c := range order {
+			first, last := c.turns[0], c.turns[len(c.turns)-1]
+			if first.User != call.User || call.start.Before(first.start) || call.start.After(last.End()) {
+				continue
+			}
+			if best == nil || first.start.After(best.turns[0].start) {
+				best = c
+			}
+		}
+		if best != nil {
+			best.fake = append(best.fake, call)
+		}
+	}
+	return order
+}
+
+func conversationKey(rec *Record) string {
+	if rec.SessionID != "" {
+		return "session\x00" + rec.SessionID
+	}
+	title := rec.Title
+	if title == "" {
+		title = rec.TraceID // 没有 user 消息的请求单独成组
+	}
+	return "user\x00" + rec.User + "\x00" + title
+}
+
+func (c *conversation) id() string {
+	sum := sha1.Sum([]byte(c.key))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (c *conversation) summary() Summary {
+	first := c.turns[0]
+	s := Summary{
+		ID:        c.id(),
+		User:      first.User,
+		Title:     first.Title,
+		SessionID: first.SessionID,
+		Protocol:  first.Protocol,
+		Start:     first.Time,
+		Turns:     len(c.turns),
+		ToolCalls: len(c.fake),
+	}
+	end := first.End()
+	seen := make(map[string]bool)
+	for _, rec := range c.turns {
+		if rec.Failed() {
+			s.Errors++
+		}
+		if m := rec.Model(); m != "" && !seen[m] {
+			seen[m] = true
+			s.Models = append(s.Models, m)
+		}
+		if rec.End().After(end) {
+			end = rec.End()
+		}
+	}
+	s.End = end.Format(time.RFC3339Nano)
+	s.DurationMs = end.Sub(first.start).Milliseconds()
+	return s
+}
+
+func (c *conversation) match(f Filter) bool {
+	first, last := c.turns[0], c.turns[len(c.turns)-1]
+	if f.User != "" && first.User != f.User {
+		return false
+	}
+	if !f.From.IsZero() && last.End().Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && first.start.After(f.To) {
+		return false
+	}
+	if f.Model != "" {
+		found := false
+		for _, rec := range c.turns {
+			requested := ""
+			if rec.Routing != nil {
+				requested = rec.Routing.RequestedModel
+			}
+			if strings.Contains(rec.Model(), f.Model) || strings.Contains(requested, f.Model) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Error != nil {
+		failed := false
+		for _, rec := range c.turns {
+			if rec.Failed() {
+				failed = true
+				break
+			}
+		}
+		if failed != *f.Error {
+			return false
+		}
+	}
+	return true
+}
+
+// List 返回符合条件的对话，按开始时间倒序（records 需已按时间排序，group 保持首个请求的先后顺序）
+func List(records []*Record, f Filter) []Summary {
+	convs := group(records)
+	result := make([]Summary, 0, len(convs))
+	for i := len(convs) - 1; i >= 0; i-- {
+		if !convs[i].match(f) {
+			continue
+		}
+		result = append(result, convs[i].summary())
+		if f.Limit > 0 && len(result) >= f.Limit {
+			break
+		}
+	}
+	return result
+}
+
+// Get 返回对话详情，不存在时返回 nil
+func Get(records []*Record, id string) *Detail {
+	for _, c := range group(records) {
+		if c.id() == id {
+			fake := c.fake
+			if fake == nil {
+				fake = []*Record{}
+			}
+			return &Detail{Summary: c.summary(), Turns: c.turns, FakeCalls: fake}
+		}
+	}
+	return nil
+}
+
+// Users 返回出现过的用户（排序后），用于筛选下拉框
+func Users(records []*Record) []string {
+	seen := make(map[string]bool)
+	var users []string
+	for _, rec := range records {
+		if rec.User != "" && !seen[rec.User] {
+			seen[rec.User] = true
+			users = append(users, rec.User)
+		}
+	}
+	sort.Strings(users)
+	return users
+}
@@ -0,0 +1,77 @@
+package traceview
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const traceLine = `{"trace_id":"%s","time":"%s","protocol":"openai","method":"POST","path":"/v1/chat/completions","status":200,"duration_ms":5}` + "\n"
+
+func appendTrace(t *testing.T, path, id string, at time.Time) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(fmt.Sprintf(traceLine, id, at.Format(time.RFC3339Nano))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheReparsesOnlyChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "trace.jsonl")
+	archive := filepath.Join(dir, "trace-20260101T000000.jsonl")
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	appendTrace(t, archive, "a1", base)
+	appendTrace(t, path, "c1", base.Add(time.Hour))
+
+	cache := NewCache(path)
+	first, err := cache.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 2 || first[0].TraceID != "a1" || first[1].TraceID != "c1" {
+		t.Fatalf("records = %v", ids(first))
+	}
+
+	// 文件未变化：返回缓存的记录
+	second, _ := cache.Load()
+	if second[0] != first[0] || second[1] != first[1] {
+		t.Error("文件未变化时不应重新解析")
+	}
+
+	// 当前文件追加：只重新解析当前文件，归档沿用缓存
+	appendTrace(t, path, "c2", base.Add(2*time.Hour))
+	third, _ := cache.Load()
+	if len(third) != 3 || third[2].TraceID != "c2" {
+		t.Fatalf("追加后 records = %v", ids(third))
+	}
+	if third[0] != first[0] {
+		t.Error("归档未变化时不应重新解析")
+	}
+
+	// 归档被清理
+	if err := os.Remove(archive); err != nil {
+		t.Fatal(err)
+	}
+	fourth, _ := cache.Load()
+	if len(fourth) != 2 || fourth[0].TraceID != "c1" {
+		t.Errorf("归档删除后 records = %v", ids(fourth))
+	}
+	if _, ok := cache.files[archive]; ok {
+		t.Error("已删除归档的缓存应被移除")
+	}
+}
+
+func ids(records []*Record) []string {
+	out := make([]string, len(records))
+	for i, r := range records {
+		out[i] = r.TraceID
+	}
+	return out
+}
@@ -0,0 +1,8 @@
+package traceview
+
+import _ "embed"
+
+// IndexHTML /debug/traces 查看器页面（单文件，无外部依赖）
+//
+//go:embed assets/index.html
+var IndexHTML []byte
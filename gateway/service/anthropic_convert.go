@@ -53,6 +53,16 @@ func (s *ProxyService) callWorkModelAnthropic(ctx context.Context, workReq opena
 	return s.convertAnthropicToOpenAIResponse(&anthropicResp, workReq.Model), nil
 }
 
+// ConvertToAnthropicRequest 将 OpenAI 请求转换为 Anthropic 请求（供 Anthropic 直通路径在拦截器改写消息后回写请求体）
+func (s *ProxyService) ConvertToAnthropicRequest(req openai.ChatCompletionRequest) *client.AnthropicMessageRequest {
+	return s.convertOpenAIToAnthropicRequest(req)
+}
+
+// ConvertAnthropicResponse 将 Anthropic 响应转换为 OpenAI 响应（供 Anthropic 直通路径执行响应拦截器）
+func (s *ProxyService) ConvertAnthropicResponse(resp *client.AnthropicMessageResponse, model string) *openai.ChatCompletionResponse {
+	return s.convertAnthropicToOpenAIResponse(resp, model)
+}
+
 // convertOpenAIToAnthropicRequest 将 OpenAI 请求转换为 Anthropic 请求
 func (s *ProxyService) convertOpenAIToAnthropicRequest(req openai.ChatCompletionRequest) *client.AnthropicMessageRequest {
 	maxTokens := req.MaxTokens
@@ -190,10 +200,37 @@ func (s *ProxyService) convertOpenAIToAnthropicRequest(req openai.ChatCompletion
 			anthropicReq.Tools = append(anthropicReq.Tools, anthropicTool)
 		}
 	}
+	if req.ToolChoice != nil && len(anthropicReq.Tools) > 0 {
+		anthropicReq.ToolChoice = convertOpenAIToolChoiceToAnthropic(req.ToolChoice)
+	}
 
 	return anthropicReq
 }
 
+// convertOpenAIToolChoiceToAnthropic 转换 tool_choice：auto -> auto，required -> any，指定函数 -> tool
+func convertOpenAIToolChoiceToAnthropic(choice interface{}) interface{} {
+	switch c := choice.(type) {
+	case string:
+		switch c {
+		case "required", "any":
+			return map[string]interface{}{"type": "any"}
+		case "none":
+			return map[string]interface{}{"type": "none"}
+		}
+	case openai.ToolChoice:
+		if c.Function.Name != "" {
+			return map[string]interface{}{"type": "tool", "name": c.Function.Name}
+		}
+	case map[string]interface{}:
+		if fn, ok := c["function"].(map[string]interface{}); ok {
+			if name, ok := fn["name"].(string); ok && name != "" {
+				return map[string]interface{}{"type": "tool", "name": name}
+			}
+		}
+	}
+	return map[string]interface{}{"type": "auto"}
+}
+
 // convertAnthropicToOpenAIResponse 将 Anthropic 响应转换为 OpenAI 响应
 func (s *ProxyService) convertAnthropicToOpenAIResponse(anthropicResp *client.AnthropicMessageResponse, model string) *openai.ChatCompletionResponse {
 	var content string
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"ocProxy/gateway/client"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// geminiClientFor 按 chat/work 选择 Gemini 客户端
+func (s *ProxyService) geminiClientFor(useWorkModel bool) (*client.GeminiClient, error) {
+	c := s.chatGeminiClient
+	if useWorkModel {
+		c = s.workGeminiClient
+	}
+	if c == nil {
+		return nil, fmt.Errorf("%s 模型未配置 gemini 格式", map[bool]string{true: "工作", false: "聊天"}[useWorkModel])
+	}
+	return c, nil
+}
+
+// callModelGemini 使用 Gemini 格式调用模型，流式返回已转换为 OpenAI SSE 的 StreamResponse，非流式返回 OpenAI 响应
+func (s *ProxyService) callModelGemini(ctx context.Context, req openai.ChatCompletionRequest, useWorkModel bool) (interface{}, error) {
+	if req.Stream {
+		resp, err := s.GeminiChatStream(ctx, req, useWorkModel)
+		if err != nil {
+			log.Printf("[错误] Gemini 流式调用失败: %v", err)
+			return nil, fmt.Errorf("Gemini 流式调用失败: %w", err)
+		}
+		return &StreamResponse{Response: resp, APIFormat: "openai"}, nil
+	}
+	resp, err := s.GeminiChat(ctx, req, useWorkModel)
+	if err != nil {
+		log.Printf("[错误] Gemini 调用失败: %v", err)
+		return nil, fmt.Errorf("Gemini 调用失败: %w", err)
+	}
+	return resp, nil
+}
+
+// GeminiChat 以 OpenAI 请求调用 Gemini generateContent（非流式），返回 OpenAI 响应
+func (s *ProxyService) GeminiChat(ctx context.Context, req openai.ChatCompletionRequest, useWorkModel bool) (*openai.ChatCompletionResponse, error) {
+	c, err := s.geminiClientFor(useWorkModel)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(client.ConvertOpenAIToGeminiRequest(req))
+	if err != nil {
+		return nil, fmt.Errorf("序列化 Gemini 请求失败: %w", err)
+	}
+
+	model := req.Model
+	if model == "" {
+		model = c.Model()
+	}
+	log.Printf("[Gemini] 调用模型 %s (非流式), 消息数=%d", model, len(req.Messages))
+	resp, err := c.GenerateContent(ctx, model, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var geminiResp client.GeminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&geminiResp); err != nil {
+		return nil, fmt.Errorf("解析 Gemini 响应失败: %w", err)
+	}
+	return client.ConvertGeminiToOpenAIResponse(&geminiResp, model), nil
+}
+
+// GeminiChatStream 以 OpenAI 请求调用 Gemini streamGenerateContent，返回 Body 为 OpenAI SSE 的响应
+func (s *ProxyService) GeminiChatStream(ctx context.Context, req openai.ChatCompletionRequest, useWorkModel bool) (*http.Response, error) {
+	c, err := s.geminiClientFor(useWorkModel)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(client.ConvertOpenAIToGeminiRequest(req))
+	if err != nil {
+		return nil, fmt.Errorf("序列化 Gemini 请求失败: %w", err)
+	}
+
+	model := req.Model
+	if model == "" {
+		model = c.Model()
+	}
+	log.Printf("[Gemini] 调用模型 %s (流式), 消息数=%d", model, len(req.Messages))
+	resp, err := c.StreamGenerateContent(ctx, model, body)
+	if err != nil {
+		return nil, err
+	}
+	return client.NewGeminiStreamToOpenAI(resp, model), nil
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ocProxy/gateway/client"
+	"ocProxy/gateway/config"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// newGeminiService 创建工作模型为 gemini 格式、指向替身服务的 ProxyService
+func newGeminiService(t *testing.T, handler http.HandlerFunc) *ProxyService {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return NewProxyService(&config.Config{
+		ChatModel: config.ModelConfig{BaseURL: srv.URL, ModelName: "chat", ModelID: "chat-model"},
+		WorkModel: config.ModelConfig{BaseURL: srv.URL, ModelName: "work", ModelID: "gemini-test", APIFormat: "gemini"},
+	})
+}
+
+func TestGeminiChat(t *testing.T) {
+	var got client.GeminiRequest
+	svc := newGeminiService(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models/gemini-test:generateContent" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		io.WriteString(w, `{
+			"responseId": "resp-1",
+			"candidates": [{
+				"content": {"role": "model", "parts": [
+					{"text": "我来查一下"},
+					{"functionCall": {"name": "search_houses", "args": {"district": "海淀"}}},
+					{"functionCall": {"name": "get_landmark"}}
+				]},
+				"finishReason": "STOP",
+				"index": 0
+			}],
+			"usageMetadata": {"promptTokenCount": 30, "candidatesTokenCount": 10, "totalTokenCount": 40}
+		}`)
+	})
+
+	resp, err := svc.GeminiChat(context.Background(), openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "你是租房助手"},
+			{Role: openai.ChatMessageRoleUser, Content: "海淀有房吗"},
+		},
+	}, true)
+	if err != nil {
+		t.Fatalf("GeminiChat: %v", err)
+	}
+	if got.SystemInstruction == nil || got.SystemInstruction.Parts[0].Text != "你是租房助手" {
+		t.Errorf("systemInstruction = %+v", got.SystemInstruction)
+	}
+	if len(got.Contents) != 1 || got.Contents[0].Parts[0].Text != "海淀有房吗" {
+		t.Errorf("contents = %+v", got.Contents)
+	}
+
+	if resp.ID != "resp-1" || resp.Model != "gemini-test" || resp.Object != "chat.completion" {
+		t.Errorf("响应头部字段 = %s %s %s", resp.ID, resp.Model, resp.Object)
+	}
+	if resp.Usage.PromptTokens != 30 || resp.Usage.CompletionTokens != 10 || resp.Usage.TotalTokens != 40 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+	if len(resp.Choices) != 1 {
+		t.Fatalf("choices = %+v", resp.Choices)
+	}
+	choice := resp.Choices[0]
+	if choice.FinishReason != openai.FinishReasonToolCalls {
+		t.Errorf("存在函数调用时 finish_reason 应为 tool_calls: %s", choice.FinishReason)
+	}
+	msg := choice.Message
+	if msg.Role != openai.ChatMessageRoleAssistant || msg.Content != "我来查一下" {
+		t.Errorf("message = %+v", msg)
+	}
+	if len(msg.ToolCalls) != 2 {
+		t.Fatalf("tool_calls = %+v", msg.ToolCalls)
+	}
+	if tc := msg.ToolCalls[0]; tc.ID == "" || tc.Type != openai.ToolTypeFunction || tc.Function.Name != "search_houses" || tc.Function.Arguments != `{"district":"海淀"}` {
+		t.Errorf("tool_calls[0] = %+v", tc)
+	}
+	if tc := msg.ToolCalls[1]; tc.Function.Name != "get_landmark" || tc.Function.Arguments != "{}" {
+		t.Errorf("无参数函数调用的 arguments 应为 {}: %+v", tc)
+	}
+	if msg.ToolCalls[0].ID == msg.ToolCalls[1].ID {
+		t.Error("tool_call id 应互不相同")
+	}
+}
+
+func TestGeminiChatFinishReasons(t *testing.T) {
+	cases := map[string]openai.FinishReason{
+		"STOP":               openai.FinishReasonStop,
+		"MAX_TOKENS":         openai.FinishReasonLength,
+		"PROHIBITED_CONTENT": openai.FinishReasonContentFilter,
+	}
+	for reason, want := range cases {
+		svc := newGeminiService(t, func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"好"}]},"finishReason":"`+reason+`","index":0}]}`)
+		})
+		resp, err := svc.GeminiChat(context.Background(), openai.ChatCompletionRequest{
+			Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "你好"}},
+		}, true)
+		if err != nil {
+			t.Fatalf("%s: %v", reason, err)
+		}
+		if got := resp.Choices[0].FinishReason; got != want {
+			t.Errorf("%s: finish_reason = %s, 期望 %s", reason, got, want)
+		}
+	}
+}
+
+func TestGeminiChatStream(t *testing.T) {
+	svc := newGeminiService(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models/gemini-test:streamGenerateContent" || r.URL.Query().Get("alt") != "sse" {
+			t.Errorf("请求地址 = %s", r.URL)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"你好\"}]},\"index\":0}]}\n\n")
+		io.WriteString(w, "data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"！\"}]},\"finishReason\":\"MAX_TOKENS\",\"index\":0}]}\n\n")
+	})
+
+	resp, err := svc.GeminiChatStream(context.Background(), openai.ChatCompletionRequest{
+		Stream:   true,
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "你好"}},
+	}, true)
+	if err != nil {
+		t.Fatalf("GeminiChatStream: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var text strings.Builder
+	var finish []string
+	for _, line := range strings.Split(string(data), "\n") {
+		payload, ok := strings.CutPrefix(line, "data: ")
+		if !ok || payload == "[DONE]" {
+			continue
+		}
+		var chunk openai.ChatCompletionStreamResponse
+		if err := json.Unmarshal([]byte(payload), &chunk); err != nil {
+			t.Fatalf("解析 chunk 失败: %v, 数据: %s", err, payload)
+		}
+		if chunk.Object != "chat.completion.chunk" || chunk.Model != "gemini-test" {
+			t.Errorf("chunk = %+v", chunk)
+		}
+		text.WriteString(chunk.Choices[0].Delta.Content)
+		if fr := chunk.Choices[0].FinishReason; fr != "" {
+			finish = append(finish, string(fr))
+		}
+	}
+	if text.String() != "你好！" {
+		t.Errorf("文本 = %q", text.String())
+	}
+	if len(finish) != 1 || finish[0] != string(openai.FinishReasonLength) {
+		t.Errorf("finish_reason = %v, 期望仅结尾一个 length", finish)
+	}
+	if !strings.HasSuffix(strings.TrimSpace(string(data)), "data: [DONE]") {
+		t.Errorf("流未以 data: [DONE] 结束: %s", data)
+	}
+}
+
+func TestGeminiNotConfigured(t *testing.T) {
+	svc := newGeminiService(t, func(w http.ResponseWriter, r *http.Request) {})
+	if _, err := svc.GeminiChat(context.Background(), openai.ChatCompletionRequest{}, false); err == nil {
+		t.Error("聊天模型未配置 gemini 格式时应返回错误")
+	}
+}
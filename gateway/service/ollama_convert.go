@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"ocProxy/gateway/client"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ollamaClientFor 按 chat/work 选择 Ollama 客户端
+func (s *ProxyService) ollamaClientFor(useWorkModel bool) (*client.OllamaClient, error) {
+	c := s.chatOllamaClient
+	if useWorkModel {
+		c = s.workOllamaClient
+	}
+	if c == nil {
+		return nil, fmt.Errorf("%s 模型未配置 ollama 格式", map[bool]string{true: "工作", false: "聊天"}[useWorkModel])
+	}
+	return c, nil
+}
+
+// callModelOllama 使用 Ollama 原生格式调用模型，流式返回已转换为 OpenAI SSE 的 StreamResponse，非流式返回 OpenAI 响应
+func (s *ProxyService) callModelOllama(ctx context.Context, req openai.ChatCompletionRequest, useWorkModel bool) (interface{}, error) {
+	if req.Stream {
+		resp, err := s.OllamaChatStream(ctx, req, useWorkModel)
+		if err != nil {
+			log.Printf("[错误] Ollama 流式调用失败: %v", err)
+			return nil, fmt.Errorf("Ollama 流式调用失败: %w", err)
+		}
+		return &StreamResponse{Response: resp, APIFormat: "openai"}, nil
+	}
+	resp, err := s.OllamaChat(ctx, req, useWorkModel)
+	if err != nil {
+		log.Printf("[错误] Ollama 调用失败: %v", err)
+		return nil, fmt.Errorf("Ollama 调用失败: %w", err)
+	}
+	return resp, nil
+}
+
+// buildOllamaBody 构造 /api/chat 请求体，返回请求体与实际使用的模型 ID
+func buildOllamaBody(c *client.OllamaClient, req openai.ChatCompletionRequest, stream bool) ([]byte, string, error) {
+	if req.Model == "" {
+		req.Model = c.Model()
+	}
+	req.Stream = stream
+	body, err := json.Marshal(client.ConvertOpenAIToOllamaRequest(req, c.KeepAlive(), c.Options()))
+	if err != nil {
+		return nil, "", fmt.Errorf("序列化 Ollama 请求失败: %w", err)
+	}
+	return body, req.Model, nil
+}
+
+// OllamaChat 以 OpenAI 请求调用 Ollama /api/chat（非流式），返回 OpenAI 响应
+func (s *ProxyService) OllamaChat(ctx context.Context, req openai.ChatCompletionRequest, useWorkModel bool) (*openai.ChatCompletionResponse, error) {
+	c, err := s.ollamaClientFor(useWorkModel)
+	if err != nil {
+		return nil, err
+	}
+	body, model, err := buildOllamaBody(c, req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[Ollama] 调用模型 %s (非流式), 消息数=%d", model, len(req.Messages))
+	resp, err := c.Chat(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var ollamaResp client.OllamaChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ollamaResp); err != nil {
+		return nil, fmt.Errorf("解析 Ollama 响应失败: %w", err)
+	}
+	if ollamaResp.Error != "" {
+		return nil, fmt.Errorf("Ollama 错误: %s", ollamaResp.Error)
+	}
+	return client.ConvertOllamaToOpenAIResponse(&ollamaResp, model), nil
+}
+
+// OllamaChatStream 以 OpenAI 请求调用 Ollama /api/chat（流式），返回 Body 为 OpenAI SSE 的响应
+func (s *ProxyService) OllamaChatStream(ctx context.Context, req openai.ChatCompletionRequest, useWorkModel bool) (*http.Response, error) {
+	c, err := s.ollamaClientFor(useWorkModel)
+	if err != nil {
+		return nil, err
+	}
+	body, model, err := buildOllamaBody(c, req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[Ollama] 调用模型 %s (流式), 消息数=%d", model, len(req.Messages))
+	resp, err := c.Chat(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	return client.NewOllamaStreamToOpenAI(resp, model), nil
+}
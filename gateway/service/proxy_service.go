@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"ocProxy/gateway/client"
 	"ocProxy/gateway/config"
+	"ocProxy/gateway/internal/logger"
+	"ocProxy/gateway/internal/telemetry"
 
 	"github.com/sashabaranov/go-openai"
 )
@@ -15,7 +18,9 @@ import (
 // StreamResponse 流式响应包装器
 type StreamResponse struct {
 	Response  *http.Response
-	APIFormat string // "openai" 或 "anthropic"
+	APIFormat string // 响应体的流格式："openai" 或 "anthropic"（gemini、ollama 等上游已转换为 openai）
+	// IdleTimeout 上游连续无数据的超时时长，0 不限制
+	IdleTimeout time.Duration
 }
 
 // ProxyService 代理服务
@@ -24,6 +29,10 @@ type ProxyService struct {
 	workClient          *client.OpenAIClient
 	chatAnthropicClient *client.AnthropicClient
 	workAnthropicClient *client.AnthropicClient
+	chatGeminiClient    *client.GeminiClient
+	workGeminiClient    *client.GeminiClient
+	chatOllamaClient    *client.OllamaClient
+	workOllamaClient    *client.OllamaClient
 	workModelBaseURL    string // 工作模型 base URL，用于判断是否需要 reasoning_content
 	chatModelID         string // 请求远端使用的模型 ID
 	workModelID         string // 请求远端使用的模型 ID
@@ -32,6 +41,13 @@ type ProxyService struct {
 	chatAPIFormat       string // chat 模型 API 格式
 	workAPIFormat       string // work 模型 API 格式
 	preprocessEnabled   bool   // 是否启用前处理
+
+	chatStructured structuredOutputConfig // chat 模型结构化输出模拟配置
+	workStructured structuredOutputConfig // work 模型结构化输出模拟配置
+
+	streamKeepAlive   time.Duration // SSE 保活注释间隔
+	chatStreamTimeout time.Duration // chat 模型流式空闲超时
+	workStreamTimeout time.Duration // work 模型流式空闲超时
 }
 
 // NewProxyService 创建新的代理服务
@@ -77,6 +93,11 @@ func NewProxyService(cfg *config.Config) *ProxyService {
 		chatAPIFormat:     chatAPIFormat,
 		workAPIFormat:     workAPIFormat,
 		preprocessEnabled: preprocessEnabled,
+		chatStructured:    newStructuredOutputConfig(cfg.ChatModel, chatAPIFormat),
+		workStructured:    newStructuredOutputConfig(cfg.WorkModel, workAPIFormat),
+		streamKeepAlive:   time.Duration(cfg.Server.StreamKeepAlive) * time.Second,
+		chatStreamTimeout: time.Duration(cfg.ChatModel.StreamIdleTimeout) * time.Second,
+		workStreamTimeout: time.Duration(cfg.WorkModel.StreamIdleTimeout) * time.Second,
 	}
 
 	// 初始化 Anthropic 客户端（如果配置了 anthropic 格式）
@@ -95,6 +116,40 @@ func NewProxyService(cfg *config.Config) *ProxyService {
 		)
 	}
 
+	// 初始化 Gemini 客户端（如果配置了 gemini 格式）
+	if chatAPIFormat == "gemini" {
+		svc.chatGeminiClient = client.NewGeminiClient(
+			cfg.ChatModel.BaseURL,
+			cfg.ChatModel.APIKey,
+			chatModelID,
+		)
+	}
+	if workAPIFormat == "gemini" {
+		svc.workGeminiClient = client.NewGeminiClient(
+			cfg.WorkModel.BaseURL,
+			cfg.WorkModel.APIKey,
+			workModelID,
+		)
+	}
+
+	// 初始化 Ollama 客户端（如果配置了 ollama 格式）
+	if chatAPIFormat == "ollama" {
+		svc.chatOllamaClient = client.NewOllamaClient(
+			cfg.ChatModel.BaseURL,
+			chatModelID,
+			cfg.ChatModel.KeepAlive,
+			cfg.ChatModel.Options,
+		)
+	}
+	if workAPIFormat == "ollama" {
+		svc.workOllamaClient = client.NewOllamaClient(
+			cfg.WorkModel.BaseURL,
+			workModelID,
+			cfg.WorkModel.KeepAlive,
+			cfg.WorkModel.Options,
+		)
+	}
+
 	return svc
 }
 
@@ -134,6 +189,19 @@ func (s *ProxyService) GetWorkModelID() string {
 	return s.workModelID
 }
 
+// StreamKeepAlive 获取 SSE 保活注释间隔，0 表示不发送
+func (s *ProxyService) StreamKeepAlive() time.Duration {
+	return s.streamKeepAlive
+}
+
+// StreamIdleTimeout 获取 chat/work 模型流式空闲超时，0 表示不限制
+func (s *ProxyService) StreamIdleTimeout(useWorkModel bool) time.Duration {
+	if useWorkModel {
+		return s.workStreamTimeout
+	}
+	return s.chatStreamTimeout
+}
+
 // GetChatAPIFormat 获取聊天模型API格式
 func (s *ProxyService) GetChatAPIFormat() string {
 	return s.chatAPIFormat
@@ -163,6 +231,14 @@ func (s *ProxyService) callWorkModel(ctx context.Context, workReq openai.ChatCom
 		return s.callWorkModelAnthropic(ctx, workReq)
 	}
 
+	if s.workAPIFormat == "gemini" && s.workGeminiClient != nil {
+		return s.callModelGemini(ctx, workReq, true)
+	}
+
+	if s.workAPIFormat == "ollama" && s.workOllamaClient != nil {
+		return s.callModelOllama(ctx, workReq, true)
+	}
+
 	// 否则使用 OpenAI 格式
 	if workReq.Stream {
 		resp, err := s.workClient.ChatStream(ctx, workReq)
@@ -180,13 +256,11 @@ func (s *ProxyService) callWorkModel(ctx context.Context, workReq openai.ChatCom
 	return resp, nil
 }
 
-// ProcessRequest 处理请求
-func (s *ProxyService) ProcessRequest(ctx context.Context, req openai.ChatCompletionRequest, useWorkModel bool) (interface{}, error) {
-	// 检查最后一条消息的 role
+// routeModel 应用前处理规则，返回实际使用的模型（true 为工作模型）及是否触发了前处理
+func (s *ProxyService) routeModel(req openai.ChatCompletionRequest, useWorkModel bool) (bool, bool) {
 	if len(req.Messages) == 0 {
-		return nil, fmt.Errorf("消息列表为空")
+		return useWorkModel, false
 	}
-
 	lastMessage := req.Messages[len(req.Messages)-1]
 	isLastUserMessage := lastMessage.Role == openai.ChatMessageRoleUser
 
@@ -195,7 +269,63 @@ func (s *ProxyService) ProcessRequest(ctx context.Context, req openai.ChatComple
 	if usedPreprocess {
 		useWorkModel = false
 	}
+	return useWorkModel, usedPreprocess
+}
 
+// TraceRouting 将路由决策写入请求 trace 与 routing span（均未开启时为空操作）
+func (s *ProxyService) TraceRouting(ctx context.Context, requestedModel string, requestedWork, routedWork, usedPreprocess bool, mode string) {
+	t := logger.TraceFromContext(ctx)
+	_, span := telemetry.Start(ctx, "gateway.route", telemetry.SpanKindInternal)
+	if t == nil && span == nil {
+		return
+	}
+	routing := logger.TraceRouting{
+		RequestedModel: requestedModel,
+		RequestedWork:  requestedWork,
+		Preprocess:     usedPreprocess,
+		Target:         "chat",
+		ModelID:        s.chatModelID,
+		APIFormat:      s.chatAPIFormat,
+		Mode:           mode,
+	}
+	if routedWork {
+		routing.Target = "work"
+		routing.ModelID = s.workModelID
+		routing.APIFormat = s.workAPIFormat
+	}
+	t.SetRouting(routing)
+	span.SetAttributes(
+		telemetry.Attr("gen_ai.request.model", requestedModel),
+		telemetry.Attr("gateway.route.target", routing.Target),
+		telemetry.Attr("gateway.route.model_id", routing.ModelID),
+		telemetry.Attr("gateway.route.api_format", routing.APIFormat),
+		telemetry.Attr("gateway.route.preprocess", usedPreprocess),
+	)
+	if mode != "" {
+		span.SetAttributes(telemetry.Attr("gateway.route.mode", mode))
+	}
+	span.End()
+}
+
+// ProcessRequest 处理请求
+func (s *ProxyService) ProcessRequest(ctx context.Context, req openai.ChatCompletionRequest, useWorkModel bool) (interface{}, error) {
+	// 检查消息列表
+	if len(req.Messages) == 0 {
+		return nil, fmt.Errorf("消息列表为空")
+	}
+
+	routedWork, usedPreprocess := s.routeModel(req, useWorkModel)
+	s.TraceRouting(ctx, req.Model, useWorkModel, routedWork, usedPreprocess, "")
+	useWorkModel = routedWork
+	result, err := s.callRoutedModel(ctx, req, useWorkModel, usedPreprocess)
+	if streamResp, ok := result.(*StreamResponse); ok {
+		streamResp.IdleTimeout = s.StreamIdleTimeout(useWorkModel)
+	}
+	return result, err
+}
+
+// callRoutedModel 按路由结果调用 chat 或 work 模型
+func (s *ProxyService) callRoutedModel(ctx context.Context, req openai.ChatCompletionRequest, useWorkModel, usedPreprocess bool) (interface{}, error) {
 	if useWorkModel {
 		req.Model = s.workModelID
 		log.Printf("[调用] 模型=%s, 流式=%v, 前处理=%v", s.workModelID, req.Stream, usedPreprocess)
@@ -204,6 +334,12 @@ func (s *ProxyService) ProcessRequest(ctx context.Context, req openai.ChatComple
 
 	req.Model = s.chatModelID
 	log.Printf("[调用] 模型=%s, 流式=%v, 前处理=%v", s.chatModelID, req.Stream, usedPreprocess)
+	if s.chatAPIFormat == "gemini" && s.chatGeminiClient != nil {
+		return s.callModelGemini(ctx, req, false)
+	}
+	if s.chatAPIFormat == "ollama" && s.chatOllamaClient != nil {
+		return s.callModelOllama(ctx, req, false)
+	}
 	if req.Stream {
 		stream, err := s.chatClient.ChatStream(ctx, req)
 		if err != nil {
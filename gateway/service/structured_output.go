@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"ocProxy/gateway/client"
+	"ocProxy/gateway/config"
+	"ocProxy/gateway/internal/jsonschema"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	structuredModeTool   = "tool"   // schema 作为唯一工具参数并强制调用
+	structuredModePrompt = "prompt" // schema 注入 system 提示词
+
+	defaultStructuredRetries = 2
+	defaultStructuredName    = "json_response"
+)
+
+// toolNamePattern 工具名合法字符（OpenAI / Anthropic 通用）
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// JSONSchemaFormat response_format.json_schema 内容（go-openai 当前版本不含该字段，需从原始请求体解析）
+type JSONSchemaFormat struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Schema      map[string]interface{} `json:"schema"`
+	Strict      bool                   `json:"strict,omitempty"`
+}
+
+// structuredOutputConfig 单个模型的结构化输出模拟配置
+type structuredOutputConfig struct {
+	mode    string
+	retries int
+}
+
+// newStructuredOutputConfig 根据模型配置生成结构化输出配置；未指定模式时 anthropic 使用 tool，其余使用 prompt
+func newStructuredOutputConfig(mc config.ModelConfig, apiFormat string) structuredOutputConfig {
+	cfg := structuredOutputConfig{
+		mode:    strings.ToLower(strings.TrimSpace(mc.StructuredOutput)),
+		retries: mc.StructuredOutputRetries,
+	}
+	if cfg.mode != structuredModeTool && cfg.mode != structuredModePrompt {
+		if apiFormat == "anthropic" {
+			cfg.mode = structuredModeTool
+		} else {
+			cfg.mode = structuredModePrompt
+		}
+	}
+	if cfg.retries <= 0 {
+		cfg.retries = defaultStructuredRetries
+	}
+	return cfg
+}
+
+// ParseJSONSchemaFormat 从原始请求体中取出 response_format.json_schema；response_format 不是 json_schema 时返回 nil
+func ParseJSONSchemaFormat(body []byte) (*JSONSchemaFormat, error) {
+	var raw struct {
+		ResponseFormat *struct {
+			Type       string            `json:"type"`
+			JSONSchema *JSONSchemaFormat `json:"json_schema"`
+		} `json:"response_format"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	if raw.ResponseFormat == nil || raw.ResponseFormat.Type != "json_schema" {
+		return nil, nil
+	}
+	format := raw.ResponseFormat.JSONSchema
+	if format == nil {
+		format = &JSONSchemaFormat{}
+	}
+	if format.Schema == nil {
+		format.Schema = map[string]interface{}{"type": "object"}
+	}
+	return format, nil
+}
+
+// ProcessStructuredRequest 处理 response_format 为 json_schema 的请求：按模型配置以强制工具或提示词方式模拟，
+// 校验输出并在不符合 schema 时带上错误信息重试；成功时 content 为符合 schema 的紧凑 JSON。
+// 上游始终以非流式调用，客户端请求 stream 时将最终结果包装为 OpenAI SSE。
+func (s *ProxyService) ProcessStructuredRequest(ctx context.Context, req openai.ChatCompletionRequest, format *JSONSchemaFormat, useWorkModel bool) (interface{}, error) {
+	if len(req.Messages) == 0 {
+		return nil, fmt.Errorf("消息列表为空")
+	}
+
+	routedWork, usedPreprocess := s.routeModel(req, useWorkModel)
+	s.TraceRouting(ctx, req.Model, useWorkModel, routedWork, usedPreprocess, "structured_output")
+	cfg := s.chatStructured
+	if routedWork {
+		cfg = s.workStructured
+	}
+	mode := cfg.mode
+	if mode == structuredModeTool && len(req.Tools) > 0 {
+		// 请求自带工具时强制单工具会屏蔽原有工具，退回提示词方式
+		mode = structuredModePrompt
+	}
+
+	name := format.Name
+	if !toolNamePattern.MatchString(name) {
+		name = defaultStructuredName
+	}
+	schema := format.Schema
+
+	stream := req.Stream
+	upstreamReq := req
+	upstreamReq.Stream = false
+	upstreamReq.ResponseFormat = nil
+	upstreamReq.Messages = append([]openai.ChatCompletionMessage(nil), req.Messages...)
+
+	// tool 方式下工具参数必须是 object，非 object 的 schema 包一层 value 字段
+	wrapped := false
+	if mode == structuredModeTool {
+		params := schema
+		if t, _ := schema["type"].(string); t != "object" {
+			wrapped = true
+			params = map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"value": schema},
+				"required":   []string{"value"},
+			}
+		}
+		upstreamReq.Tools = []openai.Tool{{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        name,
+				Description: structuredToolDescription(format),
+				Parameters:  params,
+			},
+		}}
+		upstreamReq.ToolChoice = openai.ToolChoice{
+			Type:     openai.ToolTypeFunction,
+			Function: openai.ToolFunction{Name: name},
+		}
+	} else {
+		upstreamReq.Messages = insertSchemaInstruction(upstreamReq.Messages, format, name, len(req.Tools) > 0)
+	}
+
+	log.Printf("[结构化输出] schema=%s, 方式=%s, 最大重试=%d, 流式=%v", name, mode, cfg.retries, stream)
+
+	var usage openai.Usage
+	var lastErr error
+	for attempt := 0; attempt <= cfg.retries; attempt++ {
+		// 沿用首次的路由结果：重试追加的 user 纠正消息不应触发前处理改走另一个模型
+		result, err := s.callRoutedModel(ctx, upstreamReq, routedWork, usedPreprocess)
+		if err != nil {
+			return nil, err
+		}
+		resp, ok := result.(*openai.ChatCompletionResponse)
+		if !ok || len(resp.Choices) == 0 {
+			return nil, fmt.Errorf("结构化输出: 上游返回无效响应")
+		}
+		usage.PromptTokens += resp.Usage.PromptTokens
+		usage.CompletionTokens += resp.Usage.CompletionTokens
+		usage.TotalTokens += resp.Usage.TotalTokens
+
+		// 提示词方式下请求自带工具：模型发起工具调用时原样返回，由客户端执行工具后继续对话，只校验最终的文本回答
+		if mode == structuredModePrompt && isToolCallResponse(resp) {
+			passthrough := *resp
+			passthrough.Usage = usage
+			log.Printf("[结构化输出] 模型发起工具调用，原样返回（不校验 schema）")
+			if stream {
+				return &StreamResponse{Response: client.NewOpenAIStreamFromResponse(&passthrough), APIFormat: "openai"}, nil
+			}
+			return &passthrough, nil
+		}
+
+		raw := structuredOutputText(resp.Choices[0].Message, mode, name)
+		value, err := jsonschema.ExtractJSON(raw)
+		if err == nil && wrapped {
+			if obj, ok := value.(map[string]interface{}); ok {
+				value = obj["value"]
+			}
+		}
+		if err == nil {
+			err = jsonschema.Validate(schema, value)
+		}
+		if err == nil {
+			final := structuredResponse(resp, value, usage)
+			if stream {
+				return &StreamResponse{Response: client.NewOpenAIStreamFromResponse(final), APIFormat: "openai"}, nil
+			}
+			return final, nil
+		}
+
+		lastErr = err
+		log.Printf("[结构化输出] 第 %d 次输出不符合 schema: %v", attempt+1, err)
+		upstreamReq.Messages = append(upstreamReq.Messages,
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: raw},
+			openai.ChatCompletionMessage{
+				Role: openai.ChatMessageRoleUser,
+				Content: fmt.Sprintf("上面的输出不符合要求的 JSON Schema：%v。请修正后只输出符合 schema 的 JSON，不要包含任何其他文字。",
+					err),
+			},
+		)
+	}
+	return nil, fmt.Errorf("结构化输出在 %d 次尝试后仍不符合 schema: %w", cfg.retries+1, lastErr)
+}
+
+// structuredToolDescription 生成强制工具的描述
+func structuredToolDescription(format *JSONSchemaFormat) string {
+	if format.Description != "" {
+		return format.Description
+	}
+	return "以结构化 JSON 返回最终回答"
+}
+
+// insertSchemaInstruction 在开头的 system 消息之后插入一条 system 消息，要求只输出符合 schema 的 JSON；
+// hasTools 时说明可先调用工具，最终回答再输出 JSON
+func insertSchemaInstruction(messages []openai.ChatCompletionMessage, format *JSONSchemaFormat, name string, hasTools bool) []openai.ChatCompletionMessage {
+	schemaJSON, _ := json.MarshalIndent(format.Schema, "", "  ")
+	var b strings.Builder
+	if hasTools {
+		b.WriteString("如需调用工具可直接调用；给出最终回答时，")
+	}
+	b.WriteString("请只输出一个符合以下 JSON Schema 的 JSON 值，不要输出解释、Markdown 代码块或任何其他文字。\n")
+	fmt.Fprintf(&b, "Schema 名称: %s\n", name)
+	if format.Description != "" {
+		fmt.Fprintf(&b, "说明: %s\n", format.Description)
+	}
+	b.WriteString("JSON Schema:\n")
+	b.Write(schemaJSON)
+
+	instruction := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: b.String()}
+	pos := 0
+	for pos < len(messages) && messages[pos].Role == openai.ChatMessageRoleSystem {
+		pos++
+	}
+	out := make([]openai.ChatCompletionMessage, 0, len(messages)+1)
+	out = append(out, messages[:pos]...)
+	out = append(out, instruction)
+	return append(out, messages[pos:]...)
+}
+
+// isToolCallResponse 响应是否为工具调用（带 tool_calls 或 finish_reason 为 tool_calls）
+func isToolCallResponse(resp *openai.ChatCompletionResponse) bool {
+	choice := resp.Choices[0]
+	return len(choice.Message.ToolCalls) > 0 || choice.FinishReason == openai.FinishReasonToolCalls
+}
+
+// structuredOutputText 取出待校验的输出：tool 方式优先取强制工具的参数，否则取文本内容
+func structuredOutputText(msg openai.ChatCompletionMessage, mode, name string) string {
+	if mode == structuredModeTool {
+		for _, tc := range msg.ToolCalls {
+			if tc.Function.Name == name {
+				return tc.Function.Arguments
+			}
+		}
+	}
+	return msg.Content
+}
+
+// structuredResponse 以校验通过的 JSON 作为 content 构造最终响应，去掉工具调用
+func structuredResponse(resp *openai.ChatCompletionResponse, value interface{}, usage openai.Usage) *openai.ChatCompletionResponse {
+	content, _ := json.Marshal(value)
+	final := *resp
+	final.Choices = []openai.ChatCompletionChoice{{
+		Index: 0,
+		Message: openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleAssistant,
+			Content: string(content),
+		},
+		FinishReason: openai.FinishReasonStop,
+	}}
+	final.Usage = usage
+	return &final
+}
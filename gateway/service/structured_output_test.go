@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ocProxy/gateway/config"
+	"ocProxy/gateway/internal/logger"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// newStructuredService 创建聊天模型为 openai 格式、依次返回 replies 的 ProxyService，并返回收到的请求
+func newStructuredService(t *testing.T, replies ...openai.ChatCompletionMessage) (*ProxyService, *[]openai.ChatCompletionRequest) {
+	t.Helper()
+	var received []openai.ChatCompletionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		received = append(received, req)
+		if len(received) > len(replies) {
+			t.Errorf("上游调用次数超出预期: %d", len(received))
+			http.Error(w, "unexpected", http.StatusInternalServerError)
+			return
+		}
+		msg := replies[len(received)-1]
+		finish := openai.FinishReasonStop
+		if len(msg.ToolCalls) > 0 {
+			finish = openai.FinishReasonToolCalls
+		}
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			ID:      "chatcmpl-test",
+			Object:  "chat.completion",
+			Model:   req.Model,
+			Choices: []openai.ChatCompletionChoice{{Message: msg, FinishReason: finish}},
+			Usage:   openai.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	svc := NewProxyService(&config.Config{
+		ChatModel: config.ModelConfig{BaseURL: srv.URL, ModelName: "chat", ModelID: "chat-model"},
+		WorkModel: config.ModelConfig{BaseURL: srv.URL, ModelName: "work", ModelID: "work-model"},
+	})
+	return svc, &received
+}
+
+var houseFormat = &JSONSchemaFormat{
+	Name: "house_answer",
+	Schema: map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"house_id"},
+		"properties": map[string]interface{}{
+			"house_id": map[string]interface{}{"type": "string"},
+		},
+	},
+}
+
+func structuredRequestWithTools() openai.ChatCompletionRequest {
+	return openai.ChatCompletionRequest{
+		Model:    "chat",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "推荐一套海淀的房子"}},
+		Tools: []openai.Tool{{
+			Type:     openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{Name: "search_houses", Parameters: map[string]interface{}{"type": "object"}},
+		}},
+	}
+}
+
+func TestStructuredOutputPassesThroughToolCalls(t *testing.T) {
+	call := openai.ToolCall{
+		ID:       "call_1",
+		Type:     openai.ToolTypeFunction,
+		Function: openai.FunctionCall{Name: "search_houses", Arguments: `{"district":"海淀"}`},
+	}
+	svc, received := newStructuredService(t, openai.ChatCompletionMessage{
+		Role:      openai.ChatMessageRoleAssistant,
+		ToolCalls: []openai.ToolCall{call},
+	})
+
+	result, err := svc.ProcessStructuredRequest(context.Background(), structuredRequestWithTools(), houseFormat, false)
+	if err != nil {
+		t.Fatalf("工具调用应原样返回，而不是报错: %v", err)
+	}
+	if len(*received) != 1 {
+		t.Errorf("工具调用不应触发重试，上游调用次数 = %d", len(*received))
+	}
+	resp, ok := result.(*openai.ChatCompletionResponse)
+	if !ok {
+		t.Fatalf("result 类型 = %T", result)
+	}
+	choice := resp.Choices[0]
+	if choice.FinishReason != openai.FinishReasonToolCalls || len(choice.Message.ToolCalls) != 1 ||
+		choice.Message.ToolCalls[0].Function.Name != "search_houses" || choice.Message.ToolCalls[0].ID != "call_1" {
+		t.Errorf("choice = %+v", choice)
+	}
+
+	// 请求自带工具：工具原样透传，schema 以提示词注入
+	upstream := (*received)[0]
+	if len(upstream.Tools) != 1 || upstream.Tools[0].Function.Name != "search_houses" || upstream.ToolChoice != nil {
+		t.Errorf("上游工具 = %+v, tool_choice = %v", upstream.Tools, upstream.ToolChoice)
+	}
+	if upstream.Messages[0].Role != openai.ChatMessageRoleSystem || !strings.Contains(upstream.Messages[0].Content, "house_answer") {
+		t.Errorf("未注入 schema 提示词: %+v", upstream.Messages[0])
+	}
+}
+
+func TestStructuredOutputStreamsToolCalls(t *testing.T) {
+	svc, _ := newStructuredService(t, openai.ChatCompletionMessage{
+		Role: openai.ChatMessageRoleAssistant,
+		ToolCalls: []openai.ToolCall{{
+			ID: "call_1", Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: "search_houses", Arguments: `{}`},
+		}},
+	})
+	req := structuredRequestWithTools()
+	req.Stream = true
+
+	result, err := svc.ProcessStructuredRequest(context.Background(), req, houseFormat, false)
+	if err != nil {
+		t.Fatalf("ProcessStructuredRequest: %v", err)
+	}
+	stream, ok := result.(*StreamResponse)
+	if !ok {
+		t.Fatalf("result 类型 = %T", result)
+	}
+	defer stream.Response.Body.Close()
+	body, err := io.ReadAll(stream.Response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), `"search_houses"`) || !strings.Contains(string(body), `"finish_reason":"tool_calls"`) {
+		t.Errorf("流中缺少工具调用: %s", body)
+	}
+}
+
+func TestStructuredOutputValidatesFinalAnswerAfterTools(t *testing.T) {
+	svc, received := newStructuredService(t,
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "推荐 HF_2001"},
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "```json\n{\"house_id\": \"HF_2001\"}\n```"},
+	)
+	req := structuredRequestWithTools()
+	req.Messages = append(req.Messages,
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{
+			ID: "call_1", Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: "search_houses", Arguments: `{}`},
+		}}},
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleTool, ToolCallID: "call_1", Content: `[{"house_id":"HF_2001"}]`},
+	)
+
+	result, err := svc.ProcessStructuredRequest(context.Background(), req, houseFormat, false)
+	if err != nil {
+		t.Fatalf("ProcessStructuredRequest: %v", err)
+	}
+	if len(*received) != 2 {
+		t.Errorf("文本回答不符合 schema 时应重试一次，上游调用次数 = %d", len(*received))
+	}
+	resp := result.(*openai.ChatCompletionResponse)
+	if got := resp.Choices[0].Message.Content; got != `{"house_id":"HF_2001"}` {
+		t.Errorf("content = %s", got)
+	}
+	if resp.Usage.TotalTokens != 30 {
+		t.Errorf("usage 应累计两次调用: %+v", resp.Usage)
+	}
+}
+
+func TestStructuredOutputRetryKeepsRouting(t *testing.T) {
+	svc, received := newStructuredService(t,
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "推荐 HF_2001"},
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: `{"house_id": "HF_2001"}`},
+	)
+	svc.preprocessEnabled = true
+	// 最后一条为 tool 结果：请求工作模型时不触发前处理；重试追加的 user 纠正消息不应改走聊天模型
+	req := structuredRequestWithTools()
+	req.Model = "work"
+	req.Messages = append(req.Messages,
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{
+			ID: "call_1", Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: "search_houses", Arguments: `{}`},
+		}}},
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleTool, ToolCallID: "call_1", Content: `[{"house_id":"HF_2001"}]`},
+	)
+	trace := logger.NewTrace("", "openai", "POST", "/v1/chat/completions")
+	ctx := logger.WithTrace(context.Background(), trace)
+
+	if _, err := svc.ProcessStructuredRequest(ctx, req, houseFormat, true); err != nil {
+		t.Fatalf("ProcessStructuredRequest: %v", err)
+	}
+	if len(*received) != 2 {
+		t.Fatalf("上游调用次数 = %d, 期望 2", len(*received))
+	}
+	for i, r := range *received {
+		if r.Model != "work-model" {
+			t.Errorf("第 %d 次调用 model = %s, 期望沿用首次路由的 work-model", i+1, r.Model)
+		}
+	}
+	if last := (*received)[1].Messages; last[len(last)-1].Role != openai.ChatMessageRoleUser {
+		t.Errorf("重试请求应以 user 纠正消息结尾: %+v", last[len(last)-1])
+	}
+
+	routing := trace.Finish(200).Routing
+	if routing == nil || routing.Mode != "structured_output" || routing.Target != "work" || routing.Preprocess {
+		t.Errorf("trace routing = %+v, 期望 mode=structured_output target=work", routing)
+	}
+}
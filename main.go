@@ -61,18 +61,33 @@ func main() {
 		}
 	}()
 
-	// 优雅关闭
+	// 优雅关闭：/ready 先返回 503 并继续服务 drain_delay 秒供负载均衡摘除实例，再停止接受新连接，
+	// 等待进行中的请求与 SSE 流结束（最长 drain_timeout），最后刷写日志
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("正在关闭服务器...")
+	drainTimeout := 30 * time.Second
+	if cfg.Server.DrainTimeout > 0 {
+		drainTimeout = time.Duration(cfg.Server.DrainTimeout) * time.Second
+	}
+	h.StartDrain()
+	if cfg.Server.DrainDelay > 0 {
+		drainDelay := time.Duration(cfg.Server.DrainDelay) * time.Second
+		log.Printf("/ready 已返回 503，%s 后停止接受新连接（再次收到信号立即关闭）...", drainDelay)
+		select {
+		case <-time.After(drainDelay):
+		case <-quit:
+		}
+	}
+	log.Printf("正在关闭服务器，等待进行中的请求结束（%d 个 SSE 流，最长 %s）...", h.InflightStreams(), drainTimeout)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("服务器关闭失败: %v", err)
+		log.Printf("[警告] 等待请求结束超时: %v，强制关闭剩余 %d 个 SSE 流", err, h.InflightStreams())
+		srv.Close()
 	}
 
 	log.Println("服务器已关闭")